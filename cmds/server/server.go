@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/duglin/dlog"
 	"github.com/xregistry/server/registry"
@@ -15,11 +17,33 @@ var Port = 8080
 var DBName = "registry"
 var Verbose = 2
 var RegistryName = "CloudEvents"
+var RetentionInterval = time.Hour
+var ContentDir = ""
+var ContentPruneInterval = time.Hour
+var ContentPruneAge = time.Hour
+var ProxyCacheDir = ""
+var ProxyPruneInterval = time.Hour
+var ProxyPruneAge = time.Hour
+var TLSCert = ""
+var TLSKey = ""
+var TLSClientCA = ""
+var TLSRequireClient = false
+var CORSOrigins = ""
+var CORSMethods = ""
+var CORSHeaders = ""
+var CORSExpose = ""
+var CORSCredentials = false
+var OTLPFile = ""
+var AccessLogFile = ""
+var OTLPEndpoint = ""
+var RateLimit = 0.0
+var RateBurst = 0
 
 var doDelete *bool
 var doRecreate *bool
 var doVerify *bool
 var noLoad *bool
+var doMigrateContent *bool
 var firstTimeDB = true
 
 func InitDB() {
@@ -98,6 +122,65 @@ func main() {
 	noLoad = flag.Bool("noload", false, "Don't load any models")
 	flag.IntVar(&Verbose, "v", Verbose, "Verbose level")
 	flag.IntVar(&Port, "p", Port, "Listen port")
+	flag.DurationVar(&RetentionInterval, "retention", RetentionInterval,
+		"Retention sweeper interval (0=disabled)")
+	flag.StringVar(&ContentDir, "contentdir", ContentDir,
+		"Dir to store documents in, instead of the DB")
+	flag.DurationVar(&ContentPruneInterval, "contentprune",
+		ContentPruneInterval, "How often to delete unused -contentdir "+
+			"documents (0=disabled)")
+	flag.DurationVar(&ContentPruneAge, "contentpruneage", ContentPruneAge,
+		"How old an unused -contentdir document must be to be deleted")
+	doMigrateContent = flag.Bool("migratecontent", false,
+		"Move documents from the DB into -contentdir and exit")
+	flag.DurationVar(&registry.ProxyTimeout, "proxytimeout",
+		registry.ProxyTimeout, "Timeout for fetching proxied docs")
+	flag.Int64Var(&registry.ProxyMaxSize, "proxymaxsize",
+		registry.ProxyMaxSize, "Max size (bytes) of a proxied doc")
+	flag.Int64Var(&registry.ProxyCacheSize, "proxycache",
+		registry.ProxyCacheSize, "Size (bytes) of proxied docs cache (0=off)")
+	flag.StringVar(&ProxyCacheDir, "proxycachedir", ProxyCacheDir,
+		"Dir to also cache proxied docs in, so they survive restarts")
+	flag.DurationVar(&ProxyPruneInterval, "proxyprune", ProxyPruneInterval,
+		"How often to delete unused -proxycachedir docs (0=disabled)")
+	flag.DurationVar(&ProxyPruneAge, "proxypruneage", ProxyPruneAge,
+		"How old an unused -proxycachedir doc must be to be deleted")
+	flag.StringVar(&TLSCert, "tlscert", TLSCert, "TLS certificate file")
+	flag.StringVar(&TLSKey, "tlskey", TLSKey, "TLS key file")
+	flag.StringVar(&TLSClientCA, "tlsclientca", TLSClientCA,
+		"CA file to verify client certificates with")
+	flag.BoolVar(&TLSRequireClient, "tlsrequireclient", TLSRequireClient,
+		"Require a valid client certificate")
+	flag.StringVar(&CORSOrigins, "corsorigins", CORSOrigins,
+		"Comma separated list of CORS origins to allow (*=any)")
+	flag.StringVar(&CORSMethods, "corsmethods", CORSMethods,
+		"Comma separated list of CORS methods to allow (default is all)")
+	flag.StringVar(&CORSHeaders, "corsheaders", CORSHeaders,
+		"Comma separated list of CORS request headers to allow "+
+			"(default is any)")
+	flag.StringVar(&CORSExpose, "corsexpose", CORSExpose,
+		"Comma separated list of extra response headers to expose via CORS")
+	flag.BoolVar(&CORSCredentials, "corscredentials", CORSCredentials,
+		"Allow CORS requests to include credentials")
+	flag.StringVar(&AccessLogFile, "accesslog", AccessLogFile,
+		"File to append JSON access logs to (-=stdout)")
+	flag.StringVar(&OTLPFile, "otlpfile", OTLPFile,
+		"File to append OTLP/JSON trace spans to")
+	flag.StringVar(&OTLPEndpoint, "otlpendpoint", OTLPEndpoint,
+		"OTLP/HTTP collector URL for trace spans (e.g. http://localhost:4318)")
+	flag.Float64Var(&RateLimit, "ratelimit", RateLimit,
+		"Requests per second allowed per client (0=no limit)")
+	flag.IntVar(&RateBurst, "rateburst", RateBurst,
+		"Max burst of requests per client (0=same as -ratelimit)")
+	flag.Int64Var(&registry.MaxRequestSize, "maxrequestsize",
+		registry.MaxRequestSize, "Max size (bytes) of a request body (0=no limit)")
+	flag.IntVar(&registry.MaxResponseEntities, "maxentities",
+		registry.MaxResponseEntities, "Max # of entities in a response (0=no limit)")
+	flag.Int64Var(&registry.MaxResponseSize, "maxresponsesize",
+		registry.MaxResponseSize,
+		"Max size (bytes) of entity data in a response (0=no limit)")
+	flag.DurationVar(&registry.QueryTimeout, "querytimeout",
+		registry.QueryTimeout, "Max time for a request's DB calls (0=no limit)")
 	flag.Parse()
 
 	if flag.NArg() > 0 {
@@ -116,10 +199,113 @@ func main() {
 		}
 	}
 
+	if ContentDir != "" {
+		store, err := registry.NewFileContentStore(ContentDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		registry.Contents = store
+		log.VPrintf(1, "Content dir: %s", ContentDir)
+	}
+
+	if ProxyCacheDir != "" {
+		disk, err := registry.NewProxyDiskCache(ProxyCacheDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		registry.ProxyDisk = disk
+		log.VPrintf(1, "Proxy cache dir: %s", ProxyCacheDir)
+	}
+
 	registry.DB_Name = DBName
 	registry.GitCommit = GitCommit
 	// registry.DB_InitFunc = InitDB
 	InitDB()
 
-	registry.NewServer(Port).Serve()
+	if *doMigrateContent {
+		count, err := registry.MigrateContentToStore()
+		log.VPrintf(1, "Moved %d documents into %q", count, ContentDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error moving documents: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if AccessLogFile == "-" {
+		registry.AccessLog = os.Stdout
+	} else if AccessLogFile != "" {
+		file, err := os.OpenFile(AccessLogFile,
+			os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening access log: %s\n", err)
+			os.Exit(1)
+		}
+		registry.AccessLog = file
+	}
+
+	if CORSCredentials && registry.ArrayContains(splitList(CORSOrigins), "*") {
+		fmt.Fprintf(os.Stderr, "-corscredentials can't be used with "+
+			"-corsorigins=*\n")
+		os.Exit(1)
+	}
+
+	if OTLPFile != "" && OTLPEndpoint != "" {
+		fmt.Fprintf(os.Stderr, "Only one of -otlpfile and -otlpendpoint "+
+			"can be specified\n")
+		os.Exit(1)
+	}
+	if OTLPFile != "" {
+		registry.StartTracing(&registry.OTLPFileExporter{File: OTLPFile})
+		log.VPrintf(1, "Tracing to: %s", OTLPFile)
+	} else if OTLPEndpoint != "" {
+		exporter := registry.NewOTLPHTTPExporter(OTLPEndpoint)
+		registry.StartTracing(exporter)
+		log.VPrintf(1, "Tracing to: %s", exporter.URL)
+	}
+
+	registry.StartRetentionSweeper(RetentionInterval)
+	registry.StartContentStorePruner(ContentPruneInterval, ContentPruneAge)
+	registry.StartProxyDiskPruner(ProxyPruneInterval, ProxyPruneAge)
+
+	server := registry.NewServer(Port)
+	if TLSCert != "" || TLSKey != "" {
+		server.TLS = &registry.TLSConfig{
+			CertFile:          TLSCert,
+			KeyFile:           TLSKey,
+			ClientCAFile:      TLSClientCA,
+			RequireClientCert: TLSRequireClient,
+		}
+	}
+	if CORSOrigins != "" {
+		server.CORS = registry.NewCORSConfig(splitList(CORSOrigins))
+		if CORSMethods != "" {
+			server.CORS.AllowedMethods = splitList(CORSMethods)
+		}
+		if CORSHeaders != "" {
+			server.CORS.AllowedHeaders = splitList(CORSHeaders)
+		}
+		if CORSExpose != "" {
+			server.CORS.ExposedHeaders = append(server.CORS.ExposedHeaders,
+				splitList(CORSExpose)...)
+		}
+		server.CORS.AllowCredentials = CORSCredentials
+	}
+	if RateLimit > 0 {
+		server.RateLimiter = registry.NewRateLimiter(RateLimit, RateBurst)
+	}
+	server.Serve()
+}
+
+// Splits a comma separated flag value, ignoring spaces and empty entries
+func splitList(str string) []string {
+	list := []string{}
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
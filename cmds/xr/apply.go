@@ -0,0 +1,645 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+// xr apply DIR [--prune] [--dry-run]
+var applyLong = `Update the Registry to match the entities in DIR. DIR looks like:
+
+  GROUPS/gID/group.json                           Group attributes
+  GROUPS/gID/RESOURCES/rID/meta.json              Resource's "meta" attributes
+  GROUPS/gID/RESOURCES/rID/versions/vID/version.json  Version attributes
+  GROUPS/gID/RESOURCES/rID/versions/vID/FILE      Version's document
+
+All of the .json files are optional and can be .yaml files instead. Only the
+Group types that have a directory in DIR are changed. Updates and deletes
+include the "epoch" the entity had when the plan was made so they fail if
+someone else changed it in the meantime.`
+
+func addApplyCmd(parent *cobra.Command) {
+	applyCmd := &cobra.Command{
+		Use:   "apply DIR",
+		Short: "Update the Registry to match the entities in DIR",
+		Long:  applyLong,
+		Run:   applyFunc,
+	}
+	applyCmd.Flags().Bool("prune", false,
+		"Delete entities that aren't in DIR")
+	applyCmd.Flags().Bool("dry-run", false,
+		"Just show what would be changed")
+
+	parent.AddCommand(applyCmd)
+}
+
+type localEntity struct {
+	Attrs   map[string]any // nil if there's no metadata file
+	Doc     []byte
+	DocFile string
+}
+
+type localResource struct {
+	Meta     *localEntity
+	Versions map[string]*localEntity // vID
+}
+
+type localGroup struct {
+	Entity    *localEntity
+	Resources map[string]map[string]*localResource // RESOURCES/rID
+}
+
+const (
+	APPLY_CREATE = "create"
+	APPLY_UPDATE = "update"
+	APPLY_DELETE = "delete"
+)
+
+type applyStep struct {
+	Action     string
+	Kind       string // group, meta, version, resource
+	XID        string
+	Changes    []xrlib.AttrChange
+	DocChanged bool
+
+	Verb  string
+	Path  string
+	Body  map[string]any
+	Epoch int // -1 means don't check it
+
+	// For "meta" steps. If set then the epoch needs to be refreshed
+	// before the step is done since earlier steps changed the Resource
+	refreshEpoch bool
+}
+
+// Reads the attributes in DIR/NAME.json or DIR/NAME.yaml, if there
+func readAttrsFile(dir string, name string) (map[string]any, string, error) {
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		file := filepath.Join(dir, name+ext)
+		buf, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if ext != ".json" {
+			if buf, err = registry.YAMLToJSON(buf); err != nil {
+				return nil, "", fmt.Errorf("Error parsing %q: %s", file, err)
+			}
+		}
+		attrs := map[string]any{}
+		if err = registry.Unmarshal(buf, &attrs); err != nil {
+			return nil, "", fmt.Errorf("Error parsing %q: %s", file, err)
+		}
+		return attrs, name + ext, nil
+	}
+	return nil, "", nil
+}
+
+// Returns the names of the sub-dirs and files of "dir", skipping hidden ones
+func readDir(dir string) ([]string, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs, files := []string{}, []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		} else {
+			files = append(files, entry.Name())
+		}
+	}
+	return dirs, files, nil
+}
+
+// GROUPS/gID -> localGroup
+func loadLocalDir(reg *xrlib.Registry,
+	dir string) (map[string]map[string]*localGroup, error) {
+
+	res := map[string]map[string]*localGroup{}
+
+	gPlurals, _, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gPlural := range gPlurals {
+		gm := reg.Model.FindGroupByPlural(gPlural)
+		if gm == nil {
+			return nil, fmt.Errorf("%s: unknown Group type %q",
+				filepath.Join(dir, gPlural), gPlural)
+		}
+		res[gPlural] = map[string]*localGroup{}
+
+		gIDs, _, err := readDir(filepath.Join(dir, gPlural))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, gID := range gIDs {
+			gDir := filepath.Join(dir, gPlural, gID)
+			group := &localGroup{
+				Entity:    &localEntity{},
+				Resources: map[string]map[string]*localResource{},
+			}
+			res[gPlural][gID] = group
+
+			if group.Entity.Attrs, _, err = readAttrsFile(gDir,
+				"group"); err != nil {
+				return nil, err
+			}
+
+			rPlurals, _, err := readDir(gDir)
+			if err != nil {
+				return nil, err
+			}
+			for _, rPlural := range rPlurals {
+				rm := gm.FindResourceByPlural(rPlural)
+				if rm == nil {
+					return nil, fmt.Errorf("%s: unknown Resource type %q",
+						filepath.Join(gDir, rPlural), rPlural)
+				}
+				group.Resources[rPlural] = map[string]*localResource{}
+
+				rIDs, _, err := readDir(filepath.Join(gDir, rPlural))
+				if err != nil {
+					return nil, err
+				}
+				for _, rID := range rIDs {
+					resource, err := loadLocalResource(rm,
+						filepath.Join(gDir, rPlural, rID))
+					if err != nil {
+						return nil, err
+					}
+					group.Resources[rPlural][rID] = resource
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+func loadLocalResource(rm *xrlib.ResourceModel,
+	rDir string) (*localResource, error) {
+
+	var err error
+	resource := &localResource{
+		Versions: map[string]*localEntity{},
+	}
+
+	if attrs, _, err := readAttrsFile(rDir, "meta"); err != nil {
+		return nil, err
+	} else if attrs != nil {
+		resource.Meta = &localEntity{Attrs: attrs}
+	}
+
+	vIDs, _, err := readDir(filepath.Join(rDir, "versions"))
+	if err != nil || len(vIDs) == 0 {
+		return nil, fmt.Errorf("%s: must have at least one Version in "+
+			"\"versions\"", rDir)
+	}
+
+	for _, vID := range vIDs {
+		vDir := filepath.Join(rDir, "versions", vID)
+		version := &localEntity{}
+		resource.Versions[vID] = version
+
+		attrsFile := ""
+		version.Attrs, attrsFile, err = readAttrsFile(vDir, "version")
+		if err != nil {
+			return nil, err
+		}
+
+		_, files, err := readDir(vDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file == attrsFile {
+				continue
+			}
+			if !hasDocument(rm) {
+				return nil, fmt.Errorf("%s: Resource type %q doesn't "+
+					"support documents", filepath.Join(vDir, file),
+					rm.Plural)
+			}
+			if version.DocFile != "" {
+				return nil, fmt.Errorf("%s: only one document is allowed, "+
+					"found %q and %q", vDir, version.DocFile, file)
+			}
+			version.DocFile = file
+			if version.Doc, err = os.ReadFile(filepath.Join(vDir,
+				file)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return resource, nil
+}
+
+// Returns the GROUPS collection with the Resources, Versions and metas
+// inlined
+func getLiveGroups(reg *xrlib.Registry, gm *xrlib.GroupModel) (
+	map[string]map[string]any, error) {
+
+	path := gm.Plural
+	next := "?"
+	for _, rPlural := range registry.SortedKeys(gm.Resources) {
+		path += next + "inline=" + rPlural + ".versions&inline=" +
+			rPlural + ".meta"
+		next = "&"
+	}
+
+	body, err := reg.HttpDo("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]map[string]any{}
+	if err = json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func getEpoch(attrs map[string]any) int {
+	if epoch, ok := attrs["epoch"].(float64); ok {
+		return int(epoch)
+	}
+	return -1
+}
+
+func getMap(attrs map[string]any, name string) map[string]any {
+	val, _ := attrs[name].(map[string]any)
+	if val == nil {
+		val = map[string]any{}
+	}
+	return val
+}
+
+func copyAttrs(attrs map[string]any) map[string]any {
+	res := map[string]any{}
+	for k, v := range attrs {
+		if k != "epoch" {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Figures out what needs to be done to make the Registry look like "local"
+func buildApplyPlan(reg *xrlib.Registry,
+	local map[string]map[string]*localGroup, prune bool) ([]*applyStep,
+	error) {
+
+	steps := []*applyStep{}
+	deletes := []*applyStep{}
+
+	for _, gPlural := range registry.SortedKeys(local) {
+		gm := reg.Model.FindGroupByPlural(gPlural)
+		liveGroups, err := getLiveGroups(reg, gm)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, gID := range registry.SortedKeys(local[gPlural]) {
+			group := local[gPlural][gID]
+			gXID := "/" + gPlural + "/" + gID
+			liveGroup, exists := liveGroups[gID]
+
+			attrs := copyAttrs(group.Entity.Attrs)
+			if !exists {
+				steps = append(steps, &applyStep{
+					Action:  APPLY_CREATE,
+					Kind:    "group",
+					XID:     gXID,
+					Changes: xrlib.DiffAttributes(nil, attrs),
+					Verb:    "PUT",
+					Path:    gXID,
+					Body:    attrs,
+					Epoch:   -1,
+				})
+			} else if group.Entity.Attrs != nil {
+				// Skip the Resource collections that were inlined
+				ignore := append(registry.SortedKeys(gm.Resources),
+					gm.Singular+"id")
+				ignore = append(ignore, gm.CollectionAttributes()...)
+				changes := xrlib.DiffAttributes(liveGroup, attrs, ignore...)
+				if len(changes) > 0 {
+					steps = append(steps, &applyStep{
+						Action:  APPLY_UPDATE,
+						Kind:    "group",
+						XID:     gXID,
+						Changes: changes,
+						Verb:    "PUT",
+						Path:    gXID,
+						Body:    attrs,
+						Epoch:   getEpoch(liveGroup),
+					})
+				}
+			}
+
+			for _, rPlural := range registry.SortedKeys(gm.Resources) {
+				rm := gm.Resources[rPlural]
+				liveResources := getMap(liveGroup, rPlural)
+				localResources := group.Resources[rPlural]
+
+				for _, rID := range registry.SortedKeys(localResources) {
+					liveRes, _ := liveResources[rID].(map[string]any)
+					rSteps, rDeletes, err := planResource(reg, rm,
+						gXID+"/"+rPlural+"/"+rID, localResources[rID],
+						liveRes, prune)
+					if err != nil {
+						return nil, err
+					}
+					steps = append(steps, rSteps...)
+					deletes = append(deletes, rDeletes...)
+				}
+
+				if !exists || !prune {
+					continue
+				}
+				for _, rID := range registry.SortedKeys(liveResources) {
+					if _, ok := localResources[rID]; ok {
+						continue
+					}
+					liveRes, _ := liveResources[rID].(map[string]any)
+					xid := gXID + "/" + rPlural + "/" + rID
+					deletes = append(deletes, &applyStep{
+						Action: APPLY_DELETE,
+						Kind:   "resource",
+						XID:    xid,
+						Verb:   "DELETE",
+						Path:   xid,
+						Epoch:  getEpoch(getMap(liveRes, "meta")),
+					})
+				}
+			}
+		}
+
+		if !prune {
+			continue
+		}
+		for _, gID := range registry.SortedKeys(liveGroups) {
+			if _, ok := local[gPlural][gID]; ok {
+				continue
+			}
+			xid := "/" + gPlural + "/" + gID
+			deletes = append(deletes, &applyStep{
+				Action: APPLY_DELETE,
+				Kind:   "group",
+				XID:    xid,
+				Verb:   "DELETE",
+				Path:   xid,
+				Epoch:  getEpoch(liveGroups[gID]),
+			})
+		}
+	}
+
+	// Do the deletes last so that things like changing the default
+	// Version are done first
+	return append(steps, deletes...), nil
+}
+
+func planResource(reg *xrlib.Registry, rm *xrlib.ResourceModel, rXID string,
+	resource *localResource, liveRes map[string]any, prune bool) (
+	[]*applyStep, []*applyStep, error) {
+
+	steps := []*applyStep{}
+	deletes := []*applyStep{}
+	liveVersions := getMap(liveRes, "versions")
+
+	for _, vID := range registry.SortedKeys(resource.Versions) {
+		version := resource.Versions[vID]
+		xid := rXID + "/versions/" + vID
+		liveVer, exists := liveVersions[vID].(map[string]any)
+
+		attrs := copyAttrs(version.Attrs)
+		if version.DocFile != "" {
+			if _, ok := attrs["contenttype"]; !ok {
+				attrs["contenttype"] =
+					xrlib.ContentTypeFromFileName(version.DocFile)
+			}
+		}
+
+		step := &applyStep{
+			Kind:  "version",
+			XID:   xid,
+			Verb:  "PUT",
+			Path:  xid,
+			Epoch: -1,
+		}
+		if hasDocument(rm) {
+			step.Path += "$details"
+		}
+
+		if !exists {
+			step.Action = APPLY_CREATE
+			step.Changes = xrlib.DiffAttributes(nil, attrs)
+			step.DocChanged = version.DocFile != ""
+		} else {
+			step.Action = APPLY_UPDATE
+
+			// No local document means leave the live one alone, a PUT
+			// without one doesn't touch it. Keep its contenttype too.
+			if hasDocument(rm) && version.DocFile == "" {
+				if _, ok := attrs["contenttype"]; !ok &&
+					liveVer["contenttype"] != nil {
+					attrs["contenttype"] = liveVer["contenttype"]
+				}
+			}
+
+			step.Changes = xrlib.DiffAttributes(liveVer, attrs,
+				append(rm.CollectionAttributes(), "versionid",
+					rm.Singular+"id")...)
+			step.Epoch = getEpoch(liveVer)
+
+			if hasDocument(rm) && version.DocFile != "" {
+				// Fetch the current document so we can compare them
+				res, err := reg.HttpDoFull("GET", xid, nil, nil)
+				if err != nil && (res == nil || res.Code/100 != 3) {
+					return nil, nil, fmt.Errorf("%s: %s", xid, err)
+				}
+				if res.Code/100 == 3 {
+					// Stored outside of the registry (eg. xxxurl)
+					step.DocChanged = true
+				} else {
+					step.DocChanged = string(res.Body) != string(version.Doc)
+				}
+			}
+			if len(step.Changes) == 0 && !step.DocChanged {
+				continue
+			}
+		}
+
+		// Always include the document since it's a PUT. Use base64 so the
+		// bytes are saved as is.
+		if version.DocFile != "" {
+			attrs[rm.Singular+"base64"] =
+				base64.StdEncoding.EncodeToString(version.Doc)
+		}
+		step.Body = attrs
+		steps = append(steps, step)
+	}
+
+	// Versions the Registry has that we don't
+	for _, vID := range registry.SortedKeys(liveVersions) {
+		if _, ok := resource.Versions[vID]; ok || !prune {
+			continue
+		}
+		xid := rXID + "/versions/" + vID
+		liveVer, _ := liveVersions[vID].(map[string]any)
+		deletes = append(deletes, &applyStep{
+			Action: APPLY_DELETE,
+			Kind:   "version",
+			XID:    xid,
+			Verb:   "DELETE",
+			Path:   xid,
+			Epoch:  getEpoch(liveVer),
+		})
+	}
+
+	if resource.Meta != nil {
+		liveMeta := getMap(liveRes, "meta")
+		attrs := copyAttrs(resource.Meta.Attrs)
+		changes := xrlib.DiffAttributes(liveMeta, attrs,
+			append(rm.CollectionAttributes(), rm.Singular+"id")...)
+		if len(changes) > 0 {
+			// PATCH so we need to null out the ones being removed
+			for _, change := range changes {
+				if change.New == nil {
+					attrs[change.Name] = nil
+				}
+			}
+			action := APPLY_UPDATE
+			if liveRes == nil {
+				action = APPLY_CREATE
+			}
+			steps = append(steps, &applyStep{
+				Action:       action,
+				Kind:         "meta",
+				XID:          rXID + "/meta",
+				Changes:      changes,
+				Verb:         "PATCH",
+				Path:         rXID + "/meta",
+				Body:         attrs,
+				Epoch:        getEpoch(liveMeta),
+				refreshEpoch: len(steps) > 0,
+			})
+		}
+	}
+
+	return steps, deletes, nil
+}
+
+func (step *applyStep) String() string {
+	prefix := map[string]string{
+		APPLY_CREATE: "+",
+		APPLY_UPDATE: "~",
+		APPLY_DELETE: "-",
+	}[step.Action]
+
+	str := fmt.Sprintf("%s %s %s %s", prefix, step.Action, step.Kind,
+		step.XID)
+	for _, change := range step.Changes {
+		str += "\n    " + change.String()
+	}
+	if step.DocChanged {
+		str += "\n    (document changed)"
+	}
+	return str
+}
+
+func (step *applyStep) Do(reg *xrlib.Registry) error {
+	path := step.Path
+	body := []byte(nil)
+	epoch := step.Epoch
+
+	if step.refreshEpoch && epoch >= 0 {
+		buf, err := reg.HttpDo("GET", path, nil)
+		if err != nil {
+			return err
+		}
+		attrs := map[string]any{}
+		if err = json.Unmarshal(buf, &attrs); err != nil {
+			return err
+		}
+		epoch = getEpoch(attrs)
+	}
+
+	if step.Verb == "DELETE" {
+		if epoch >= 0 {
+			path += fmt.Sprintf("?epoch=%d", epoch)
+		}
+	} else {
+		attrs := copyAttrs(step.Body)
+		if epoch >= 0 {
+			attrs["epoch"] = epoch
+		}
+		body = []byte(xrlib.ToJSON(attrs))
+	}
+
+	_, err := reg.HttpDo(step.Verb, path, body)
+	return err
+}
+
+func applyFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one DIR")
+	}
+
+	prune, _ := cmd.Flags().GetBool("prune")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	local, err := loadLocalDir(reg, args[0])
+	ErrStop(err)
+
+	steps, err := buildApplyPlan(reg, local, prune)
+	ErrStop(err)
+
+	if len(steps) == 0 {
+		fmt.Printf("No changes\n")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, step := range steps {
+		fmt.Printf("%s\n", step.String())
+		counts[step.Action]++
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to delete\n",
+		counts[APPLY_CREATE], counts[APPLY_UPDATE], counts[APPLY_DELETE])
+
+	if dryRun {
+		return
+	}
+
+	for i, step := range steps {
+		if err := step.Do(reg); err != nil {
+			Error("%s %s: %s\n%d of %d changes were made", step.Action,
+				step.XID, err, i, len(steps))
+		}
+		Verbose("%sd %s %s", step.Action, step.Kind, step.XID)
+	}
+	fmt.Printf("Applied %d changes\n", len(steps))
+}
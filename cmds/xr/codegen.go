@@ -0,0 +1,532 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"strings"
+	"unicode"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/registry"
+)
+
+var codegenLong = `Generate the source code of typed entity structs, and a typed
+client, for a Registry's model. The model comes from the server, or from
+FILE ("-" for stdin) if one is given.
+
+  --lang go  structs for the Registry, each Group, Resource (and its
+             Versions) and Resource meta, plus a client on top of the
+             xrlib package, e.g.:
+               c, err := NewClient(ctx, "http://localhost:8080")
+               files, err := c.Dir("d1").Files().List(ctx)
+  --lang ts  TypeScript interfaces plus a client that uses fetch()
+
+The output only depends on the model, so just run it again when the
+model changes.`
+
+func addCodegenCmd(parent *cobra.Command) {
+	codegenCmd := &cobra.Command{
+		Use:   "codegen [ - | FILE ]",
+		Short: "Generate typed code for a Registry's model",
+		Long:  codegenLong,
+		Run:   codegenFunc,
+	}
+	codegenCmd.Flags().String("lang", "go", "language: go, ts")
+	codegenCmd.Flags().String("package", "xrclient",
+		"name of the Go package")
+	codegenCmd.Flags().String("out", "",
+		"file to write the code to (default is stdout)")
+	parent.AddCommand(codegenCmd)
+}
+
+func codegenFunc(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		Error("Only one model can be used at a time")
+	}
+	name := "-"
+	if len(args) == 1 {
+		name = args[0]
+	} else if Server != "" {
+		name = Server
+	}
+	lang, _ := cmd.Flags().GetString("lang")
+	pkg, _ := cmd.Flags().GetString("package")
+	outFile, _ := cmd.Flags().GetString("out")
+
+	doc, _, err := loadModel(name)
+	ErrStop(err)
+	doc, err = verifyModelDoc(name, doc)
+	ErrStop(err)
+
+	// Use the verified model so that the spec defined attributes are
+	// included too
+	model := &registry.Model{}
+	buf, _ := json.Marshal(doc)
+	err = registry.Unmarshal(buf, model)
+	ErrStop(err)
+
+	gen := newCodeGen(model)
+	code := []byte(nil)
+	switch lang {
+	case "go":
+		code, err = gen.Go(pkg)
+		ErrStop(err, "Error formatting the Go code: %s", err)
+	case "ts", "typescript":
+		code = gen.TypeScript()
+	default:
+		Error("--lang must be one of 'go', 'ts'")
+	}
+
+	if outFile == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	err = os.WriteFile(outFile, code, 0644)
+	ErrStop(err, "Error writing %q: %s", outFile, err)
+}
+
+// The Go names of the spec defined attributes
+var codegenWords = map[string]string{
+	"ancestor":               "Ancestor",
+	"capabilities":           "Capabilities",
+	"compatibility":          "Compatibility",
+	"compatibilityauthority": "CompatibilityAuthority",
+	"contenttype":            "ContentType",
+	"createdat":              "CreatedAt",
+	"defaultversionid":       "DefaultVersionID",
+	"defaultversionsticky":   "DefaultVersionSticky",
+	"defaultversionurl":      "DefaultVersionURL",
+	"deprecated":             "Deprecated",
+	"description":            "Description",
+	"documentation":          "Documentation",
+	"epoch":                  "Epoch",
+	"icon":                   "Icon",
+	"isdefault":              "IsDefault",
+	"labels":                 "Labels",
+	"locked":                 "Locked",
+	"metaurl":                "MetaURL",
+	"model":                  "Model",
+	"modelsource":            "ModelSource",
+	"modifiedat":             "ModifiedAt",
+	"name":                   "Name",
+	"readonly":               "ReadOnly",
+	"registryid":             "RegistryID",
+	"self":                   "Self",
+	"shortself":              "ShortSelf",
+	"specversion":            "SpecVersion",
+	"versionid":              "VersionID",
+	"versionscount":          "VersionsCount",
+	"versionsurl":            "VersionsURL",
+	"xid":                    "XID",
+	"xref":                   "XRef",
+}
+
+type codeGen struct {
+	model *registry.Model
+	words map[string]string // Attribute name -> Go name
+
+	// Type names of the Groups ("dirs") and Resources ("dirs/files")
+	types map[string]string
+
+	buf      strings.Builder
+	pending  []func() // Nested types still to be written
+	usesTime bool
+}
+
+func newCodeGen(model *registry.Model) *codeGen {
+	gen := &codeGen{
+		model: model,
+		words: map[string]string{},
+		types: map[string]string{},
+	}
+	for name, word := range codegenWords {
+		gen.words[name] = word
+	}
+
+	// Add the names that are based on the Groups and Resources, and make
+	// sure two Resource types don't end up with the same type name
+	used := map[string]int{}
+	for _, gName := range registry.SortedKeys(model.Groups) {
+		gm := model.Groups[gName]
+		gen.addWords(gm.Singular, gm.Plural)
+		gen.types[gName] = gen.Name(gm.Singular)
+		used[gen.types[gName]]++
+		for _, rm := range gm.Resources {
+			gen.addWords(rm.Singular, rm.Plural)
+			used[gen.Name(rm.Singular)]++
+		}
+	}
+	for _, gName := range registry.SortedKeys(model.Groups) {
+		gm := model.Groups[gName]
+		for _, rName := range registry.SortedKeys(gm.Resources) {
+			name := gen.Name(gm.Resources[rName].Singular)
+			if used[name] > 1 {
+				name = gen.types[gName] + name
+			}
+			gen.types[gName+"/"+rName] = name
+		}
+	}
+	return gen
+}
+
+func (gen *codeGen) addWords(singular, plural string) {
+	s, p := gen.Name(singular), gen.Name(plural)
+	gen.words[singular+"id"] = s + "ID"
+	gen.words[singular+"url"] = s + "URL"
+	gen.words[singular+"proxyurl"] = s + "ProxyURL"
+	gen.words[singular+"base64"] = s + "Base64"
+	gen.words[plural+"url"] = p + "URL"
+	gen.words[plural+"count"] = p + "Count"
+}
+
+// The exported Go name for "name", e.g. "created_by" is "CreatedBy"
+func (gen *codeGen) Name(name string) string {
+	if word, ok := gen.words[name]; ok {
+		return word
+	}
+	res := strings.Builder{}
+	upper := true
+	for _, ch := range name {
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
+			upper = true
+			continue
+		}
+		if upper {
+			ch = unicode.ToUpper(ch)
+			upper = false
+		}
+		res.WriteRune(ch)
+	}
+	str := res.String()
+	if str == "" || unicode.IsDigit(rune(str[0])) {
+		str = "X" + str
+	}
+	return str
+}
+
+func (gen *codeGen) p(format string, args ...any) {
+	fmt.Fprintf(&gen.buf, format+"\n", args...)
+}
+
+// Writes the nested types that were found while writing the last one
+func (gen *codeGen) flush() {
+	for len(gen.pending) > 0 {
+		fn := gen.pending[0]
+		gen.pending = gen.pending[1:]
+		fn()
+	}
+}
+
+func isStringType(daType string) bool {
+	switch daType {
+	case registry.STRING, registry.URI, registry.URI_REFERENCE,
+		registry.URI_TEMPLATE, registry.URL, registry.XID:
+		return true
+	}
+	return false
+}
+
+// Attributes to generate fields for, sorted by name
+func genAttrNames(attrs registry.Attributes) []string {
+	names := []string{}
+	for _, name := range registry.SortedKeys(attrs) {
+		if name != "*" && name[0] != '$' {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// The Go type for an attribute, or item, of type "daType". "name" is
+// used for any new type that's needed (enums, objects).
+func (gen *codeGen) goType(name string, daType string, enum []any,
+	attrs registry.Attributes, item *registry.Item) string {
+
+	if len(enum) > 0 && isStringType(daType) {
+		gen.pending = append(gen.pending, func() {
+			gen.p("type %s string\n", name)
+			gen.p("const (")
+			for _, val := range enum {
+				str := fmt.Sprintf("%v", val)
+				gen.p("\t%s%s %s = %q", name, gen.Name(str), name, str)
+			}
+			gen.p(")\n")
+		})
+		return name
+	}
+
+	switch daType {
+	case registry.BOOLEAN:
+		return "bool"
+	case registry.INTEGER:
+		return "int64"
+	case registry.UINTEGER:
+		return "uint64"
+	case registry.DECIMAL:
+		return "float64"
+	case registry.TIMESTAMP:
+		gen.usesTime = true
+		return "time.Time"
+	case registry.MAP, registry.ARRAY:
+		itemType := "any"
+		if item != nil {
+			itemType = gen.goType(name+"Item", item.Type, nil,
+				item.Attributes, item.Item)
+		}
+		if daType == registry.MAP {
+			return "map[string]" + itemType
+		}
+		return "[]" + itemType
+	case registry.OBJECT:
+		if len(genAttrNames(attrs)) == 0 {
+			return "map[string]any"
+		}
+		gen.pending = append(gen.pending, func() {
+			gen.goStruct(name, "", attrs)
+		})
+		return name
+	}
+	if isStringType(daType) {
+		return "string"
+	}
+	return "any"
+}
+
+func (gen *codeGen) goStruct(name string, comment string,
+	attrs registry.Attributes) {
+
+	if comment != "" {
+		gen.p("// %s", comment)
+	}
+	gen.p("type %s struct {", name)
+	for _, aName := range genAttrNames(attrs) {
+		attr := attrs[aName]
+		fType := gen.goType(name+gen.Name(aName), attr.Type, attr.Enum,
+			attr.Attributes, attr.Item)
+
+		// Use pointers for everything but strings, maps and arrays so
+		// that values that aren't set aren't sent to the server
+		if !isStringType(attr.Type) && attr.Type != registry.MAP &&
+			attr.Type != registry.ARRAY && attr.Type != registry.ANY &&
+			fType != "map[string]any" {
+			fType = "*" + fType
+		}
+		if attr.Description != "" {
+			gen.p("\t// %s", attr.Description)
+		}
+		gen.p("\t%s %s `json:\"%s,omitempty\"`", gen.Name(aName), fType,
+			aName)
+	}
+	gen.p("}\n")
+	gen.flush()
+}
+
+// Go returns the Go source code of the structs and client
+func (gen *codeGen) Go(pkg string) ([]byte, error) {
+	m := gen.model
+
+	gen.goStruct("Registry", "Registry is the Registry's attributes",
+		m.Attributes)
+
+	for _, gName := range registry.SortedKeys(m.Groups) {
+		gm := m.Groups[gName]
+		gType := gen.types[gName]
+		gen.goStruct(gType, fmt.Sprintf("%s is a %q Group", gType, gName),
+			gm.Attributes)
+
+		for _, rName := range registry.SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			rType := gen.types[gName+"/"+rName]
+			gen.goStruct(rType, fmt.Sprintf("%s is a %q Resource, or one "+
+				"of its Versions", rType, gName+"/"+rName), rm.Attributes)
+			gen.goStruct(rType+"Meta", fmt.Sprintf("%sMeta is the meta "+
+				"of a %q Resource", rType, gName+"/"+rName),
+				rm.MetaAttributes)
+		}
+	}
+
+	gen.goClient()
+
+	code := gen.buf.String()
+	gen.buf.Reset()
+	gen.p("// Code generated by \"xr codegen\". DO NOT EDIT.\n")
+	gen.p("package %s\n", pkg)
+	gen.p("import (")
+	gen.p("\t\"context\"")
+	gen.p("\t\"encoding/json\"")
+	if gen.usesTime {
+		gen.p("\t\"time\"")
+	}
+	gen.p("")
+	gen.p("\t\"github.com/xregistry/server/cmds/xr/xrlib\"")
+	gen.p(")\n")
+
+	return format.Source([]byte(gen.buf.String() + code))
+}
+
+// The typed client: one type for each entity and each collection, all
+// of which embed the xrlib type they're built on
+func (gen *codeGen) goClient() {
+	gen.p(`// Client is a typed client for the Registry
+type Client struct {
+	*xrlib.Registry
+}
+
+func NewClient(ctx context.Context, url string) (*Client, error) {
+	reg, err := xrlib.GetRegistryContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{reg}, nil
+}
+
+func fromAttrs(attrs map[string]any, v any) error {
+	buf, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+func toAttrs(v any) (map[string]any, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]any{}
+	return attrs, json.Unmarshal(buf, &attrs)
+}
+`)
+
+	m := gen.model
+	for _, gName := range registry.SortedKeys(m.Groups) {
+		gm := m.Groups[gName]
+		gType := gen.types[gName]
+		one, all := gen.methodNames(gm.Singular, gm.Plural)
+
+		gen.goEntity(gType, gType, "Group", fmt.Sprintf("a %q Group",
+			gName))
+		gen.p(`func (c *Client) %s(id string) *%sClient {
+	return &%sClient{c.Registry.Group(%q, id)}
+}
+
+func (c *Client) %s() *%sCollection {
+	return &%sCollection{c.Registry.Groups(%q)}
+}
+`, one, gType, gType, gName, all, gType, gType, gName)
+
+		for _, rName := range registry.SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			rType := gen.types[gName+"/"+rName]
+			one, all := gen.methodNames(rm.Singular, rm.Plural)
+
+			gen.goEntity(rType, rType, "Resource",
+				fmt.Sprintf("a %q Resource", gName+"/"+rName))
+			gen.goEntity(rType+"Version", rType, "Version",
+				fmt.Sprintf("a Version of a %q Resource", gName+"/"+rName))
+
+			gen.p(`func (g *%sClient) %s(id string) *%sClient {
+	return &%sClient{g.Group.Resource(%q, id)}
+}
+
+func (g *%sClient) %s() *%sCollection {
+	return &%sCollection{g.Group.Resources(%q)}
+}
+
+// GetMeta gets the latest attributes of the Resource's meta
+func (r *%sClient) GetMeta(ctx context.Context) (*%sMeta, error) {
+	meta := r.Resource.Meta()
+	if err := meta.Fetch(ctx); err != nil {
+		return nil, err
+	}
+	res := &%sMeta{}
+	return res, fromAttrs(meta.Attributes(), res)
+}
+
+func (r *%sClient) Version(id string) *%sVersionClient {
+	return &%sVersionClient{r.Resource.Version(id)}
+}
+
+func (r *%sClient) Versions() *%sVersionCollection {
+	return &%sVersionCollection{r.Resource.Versions()}
+}
+`, gType, one, rType, rType, rName,
+				gType, all, rType, rType, rName,
+				rType, rType, rType,
+				rType, rType, rType,
+				rType, rType, rType)
+		}
+	}
+}
+
+// Writes the client, and collection, types for one kind of entity.
+// "xrType" is the xrlib type it's built on (Group, Resource, Version).
+func (gen *codeGen) goEntity(name string, attrsType string, xrType string,
+	desc string) {
+
+	collType := xrType + "Collection"
+	gen.p(`// %sClient is %s
+type %sClient struct {
+	*xrlib.%s
+}
+
+// Get gets its latest attributes from the server
+func (e *%sClient) Get(ctx context.Context) (*%s, error) {
+	if err := e.Fetch(ctx); err != nil {
+		return nil, err
+	}
+	res := &%s{}
+	return res, fromAttrs(e.Attributes(), res)
+}
+
+// Put creates it, or replaces its attributes
+func (e *%sClient) Put(ctx context.Context, attrs *%s) error {
+	m, err := toAttrs(attrs)
+	if err != nil {
+		return err
+	}
+	return e.Upsert(ctx, m)
+}
+
+type %sCollection struct {
+	*xrlib.%s
+}
+
+// List returns all of them, sorted by ID. Each filter is an xRegistry
+// "filter" query parameter value.
+func (c *%sCollection) List(ctx context.Context,
+	filters ...string) ([]*%s, error) {
+
+	list, err := c.%s.List(ctx, filters...)
+	if err != nil {
+		return nil, err
+	}
+	res := []*%s{}
+	for _, e := range list {
+		attrs := &%s{}
+		if err := fromAttrs(e.Attributes(), attrs); err != nil {
+			return nil, err
+		}
+		res = append(res, attrs)
+	}
+	return res, nil
+}
+`, name, desc, name, xrType,
+		name, attrsType, attrsType,
+		name, attrsType,
+		name, collType,
+		name, attrsType,
+		collType, attrsType, attrsType)
+}
+
+// The names of the methods to get one entity, and the collection
+func (gen *codeGen) methodNames(singular, plural string) (string, string) {
+	one, all := gen.Name(singular), gen.Name(plural)
+	if one == all {
+		all += "Collection"
+	}
+	return one, all
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/xregistry/server/registry"
+)
+
+var tsIdentRE = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// The TypeScript type for an attribute, or item, of type "daType"
+func (gen *codeGen) tsType(name string, daType string, enum []any,
+	attrs registry.Attributes, item *registry.Item) string {
+
+	if len(enum) > 0 && isStringType(daType) {
+		gen.pending = append(gen.pending, func() {
+			vals := []string{}
+			for _, val := range enum {
+				buf, _ := json.Marshal(fmt.Sprintf("%v", val))
+				vals = append(vals, string(buf))
+			}
+			gen.p("export type %s = %s;\n", name,
+				strings.Join(vals, " | "))
+		})
+		return name
+	}
+
+	switch daType {
+	case registry.BOOLEAN:
+		return "boolean"
+	case registry.INTEGER, registry.UINTEGER, registry.DECIMAL:
+		return "number"
+	case registry.MAP, registry.ARRAY:
+		itemType := "any"
+		if item != nil {
+			itemType = gen.tsType(name+"Item", item.Type, nil,
+				item.Attributes, item.Item)
+		}
+		if daType == registry.MAP {
+			return "Record<string, " + itemType + ">"
+		}
+		return itemType + "[]"
+	case registry.OBJECT:
+		if len(genAttrNames(attrs)) == 0 {
+			return "Record<string, any>"
+		}
+		gen.pending = append(gen.pending, func() {
+			gen.tsInterface(name, "", attrs)
+		})
+		return name
+	}
+	if isStringType(daType) || daType == registry.TIMESTAMP {
+		return "string"
+	}
+	return "any"
+}
+
+func (gen *codeGen) tsInterface(name string, comment string,
+	attrs registry.Attributes) {
+
+	if comment != "" {
+		gen.p("/** %s */", comment)
+	}
+	gen.p("export interface %s {", name)
+	for _, aName := range genAttrNames(attrs) {
+		attr := attrs[aName]
+		aType := gen.tsType(name+gen.Name(aName), attr.Type, attr.Enum,
+			attr.Attributes, attr.Item)
+		if attr.Description != "" {
+			gen.p("  /** %s */", attr.Description)
+		}
+		prop := aName
+		if !tsIdentRE.MatchString(prop) {
+			prop = fmt.Sprintf("%q", prop)
+		}
+		gen.p("  %s?: %s;", prop, aType)
+	}
+	gen.p("}\n")
+	gen.flush()
+}
+
+// TypeScript returns the TypeScript source code of the interfaces and a
+// client that uses fetch()
+func (gen *codeGen) TypeScript() []byte {
+	m := gen.model
+
+	gen.p("// Code generated by \"xr codegen\". DO NOT EDIT.\n")
+	gen.tsInterface("Registry", "The Registry's attributes", m.Attributes)
+
+	for _, gName := range registry.SortedKeys(m.Groups) {
+		gm := m.Groups[gName]
+		gType := gen.types[gName]
+		gen.tsInterface(gType, fmt.Sprintf("A %q Group", gName),
+			gm.Attributes)
+
+		for _, rName := range registry.SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			rType := gen.types[gName+"/"+rName]
+			gen.tsInterface(rType, fmt.Sprintf("A %q Resource, or one of "+
+				"its Versions", gName+"/"+rName), rm.Attributes)
+			gen.tsInterface(rType+"Meta", fmt.Sprintf("The meta of a %q "+
+				"Resource", gName+"/"+rName), rm.MetaAttributes)
+		}
+	}
+
+	gen.p(`/** A typed client for the Registry */
+export class Client {
+  constructor(public url: string, public init: RequestInit = {}) {
+    this.url = url.replace(/\/+$/, "");
+  }
+
+  async request<T>(method: string, path: string, body?: unknown): Promise<T> {
+    const res = await fetch(this.url + path, {
+      ...this.init,
+      method,
+      headers: {
+        "Content-Type": "application/json",
+        ...(this.init.headers as Record<string, string>),
+      },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await res.text();
+    if (!res.ok) {
+      throw new Error(method + " " + path + ": " + res.status + " " + text);
+    }
+    return (text ? JSON.parse(text) : undefined) as T;
+  }
+
+  /** Each filter is an xRegistry "filter" query parameter value */
+  async list<T>(path: string, filters: string[]): Promise<T[]> {
+    const query = filters
+      .map((f) => "filter=" + encodeURIComponent(f))
+      .join("&");
+    const res = await this.request<Record<string, T>>(
+      "GET", path + (query ? "?" + query : ""));
+    return Object.keys(res).sort().map((id) => res[id]);
+  }
+
+  getRegistry(): Promise<Registry> {
+    return this.request("GET", "/");
+  }
+`)
+
+	for _, gName := range registry.SortedKeys(m.Groups) {
+		gm := m.Groups[gName]
+		gType := gen.types[gName]
+		gPath := fmt.Sprintf("/%s/${encodeURIComponent(%sID)}", gName,
+			gm.Singular)
+		gen.tsMethods(gType, gType, gen.Name(gm.Plural), "/"+gName, gPath,
+			gm.Singular+"ID: string", false)
+
+		for _, rName := range registry.SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			rType := gen.types[gName+"/"+rName]
+			plural := gen.Name(rm.Plural)
+			if rType != gen.Name(rm.Singular) {
+				plural = gType + plural
+			}
+			rPath := fmt.Sprintf("%s/%s/${encodeURIComponent(%sID)}",
+				gPath, rName, rm.Singular)
+			params := gm.Singular + "ID: string, " + rm.Singular +
+				"ID: string"
+
+			gen.tsMethods(rType, rType, plural, gPath+"/"+rName, rPath,
+				params, rm.GetHasDocument())
+			gen.p(`  get%sMeta(%s): Promise<%sMeta> {
+    return this.request("GET", `+"`%s/meta`"+`);
+  }
+`, rType, params, rType, rPath)
+
+			vPath := fmt.Sprintf("%s/versions/${encodeURIComponent("+
+				"versionID)}", rPath)
+			gen.tsMethods(rType+"Version", rType, rType+"Versions",
+				rPath+"/versions", vPath, params+", versionID: string",
+				rm.GetHasDocument())
+		}
+	}
+	gen.p("}")
+
+	return []byte(gen.buf.String())
+}
+
+// Writes the list, get, put and delete methods for one kind of entity,
+// whose attributes are of type "attrsType". "params" are the IDs needed
+// for "path", the last one is the entity's.
+func (gen *codeGen) tsMethods(name string, attrsType string, plural string,
+	collPath string, path string, params string, hasDoc bool) {
+
+	details := ""
+	if hasDoc {
+		details = "$details"
+	}
+	parentParams := ""
+	if i := strings.LastIndex(params, ", "); i >= 0 {
+		parentParams = params[:i] + ", "
+	}
+	varName := strings.ToLower(name[:1]) + name[1:]
+
+	gen.p(`  list%s(%s...filters: string[]): Promise<%s[]> {
+    return this.list(`+"`%s`"+`, filters);
+  }
+
+  get%s(%s): Promise<%s> {
+    return this.request("GET", `+"`%s%s`"+`);
+  }
+
+  put%s(%s, %s: %s): Promise<%s> {
+    return this.request("PUT", `+"`%s%s`"+`, %s);
+  }
+
+  delete%s(%s): Promise<void> {
+    return this.request("DELETE", `+"`%s`"+`);
+  }
+`, plural, parentParams, attrsType, collPath,
+		name, params, attrsType, path, details,
+		name, params, varName, attrsType, attrsType, path, details, varName,
+		name, params, path)
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+// Completions ask the server for the model and the IDs of entities. To
+// keep <TAB> fast the responses are cached for XR_CACHE_TTL (default 30s,
+// 0 turns it off) in XR_CACHE_DIR (default: the user's cache dir + "/xr").
+var CacheTTL = xrlib.EnvString("XR_CACHE_TTL", "30s")
+
+func cacheDir() string {
+	if dir := os.Getenv("XR_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "xr")
+}
+
+// GETs "path" from the Server, using the cached copy if it's new enough
+func cachedGet(path string) ([]byte, error) {
+	url := strings.TrimRight(Server, "/") + "/" + strings.TrimLeft(path, "/")
+
+	ttl, err := time.ParseDuration(CacheTTL)
+	if err != nil {
+		ttl = 0
+	}
+
+	// Include the profile so different users/tokens don't share the cache
+	file := ""
+	if dir := cacheDir(); dir != "" && ttl > 0 {
+		profile := ""
+		if xrlib.CurrentProfile != nil {
+			profile = xrlib.ToJSON(xrlib.CurrentProfile)
+		}
+		sum := sha256.Sum256([]byte(url + "\n" + profile))
+		file = filepath.Join(dir, hex.EncodeToString(sum[:16]))
+
+		if info, err := os.Stat(file); err == nil &&
+			time.Since(info.ModTime()) < ttl {
+			if buf, err := os.ReadFile(file); err == nil {
+				return buf, nil
+			}
+		}
+	}
+
+	buf, err := xrlib.HttpDo("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if file != "" {
+		if os.MkdirAll(filepath.Dir(file), 0700) == nil {
+			os.WriteFile(file, buf, 0600)
+		}
+	}
+	return buf, nil
+}
+
+// Returns the Registry to use for completions, with its (cached) model,
+// or nil if there's no server to talk to
+func completionRegistry(cmd *cobra.Command) *xrlib.Registry {
+	// By now the command line's flags have been parsed, so pick up any
+	// -p or -s that was on it
+	if cmd.Flags().Changed("profile") && !cmd.Flags().Changed("server") {
+		Server = ""
+		loadProfile(cmd)
+	}
+	if Server == "" || Server == "http://" {
+		return nil
+	}
+	if !strings.HasPrefix(Server, "http") {
+		Server = "http://" + strings.TrimLeft(Server, "/")
+	}
+
+	buf, err := cachedGet("/model")
+	if err != nil {
+		cobra.CompDebugln("Error getting model: "+err.Error(), false)
+		return nil
+	}
+	model := &xrlib.Model{}
+	if err := json.Unmarshal(buf, model); err != nil {
+		cobra.CompDebugln("Error parsing model: "+err.Error(), false)
+		return nil
+	}
+	return xrlib.NewRegistryWithModel(Server, model)
+}
+
+// The (sorted) IDs of the entities in the collection at "path"
+func completionIDs(path string) []string {
+	path = strings.TrimRight(path, "/")
+	buf, err := cachedGet(path)
+	if err != nil {
+		cobra.CompDebugln("Error getting "+path+": "+err.Error(), false)
+		return nil
+	}
+	coll := map[string]any{}
+	if err := json.Unmarshal(buf, &coll); err != nil {
+		return nil
+	}
+	return registry.SortedKeys(coll)
+}
+
+// Keeps the values in "list" that start with "prefix"
+func completionFilter(list []string, prefix string) []string {
+	res := []string{}
+	for _, val := range list {
+		if strings.HasPrefix(val, prefix) {
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
+// Completes an XID, one level at a time:
+// /GROUPS/gID/RESOURCES/rID/versions/vID
+func completeXID(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	reg := completionRegistry(cmd)
+	if reg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return xidCompletions(reg, toComplete), cobra.ShellCompDirectiveNoSpace
+}
+
+// The possible next parts of "toComplete", an XID that's being typed.
+// Only the IDs of the versions are full XIDs, everything else ends with a
+// "/" so the next part can be completed.
+func xidCompletions(reg *xrlib.Registry, toComplete string) []string {
+	parts := strings.Split(strings.TrimLeft(toComplete, "/"), "/")
+	base := "/" + strings.Join(parts[:len(parts)-1], "/")
+	if len(parts) > 1 {
+		base += "/"
+	}
+	prefix := parts[len(parts)-1]
+
+	names := []string{}
+	leaf := false
+
+	switch len(parts) {
+	case 1:
+		names = registry.SortedKeys(reg.Model.Groups)
+	case 2:
+		names = completionIDs(base)
+	case 3:
+		if gm := reg.Model.FindGroupByPlural(parts[0]); gm != nil {
+			names = registry.SortedKeys(gm.Resources)
+		}
+	case 4:
+		names = completionIDs(base)
+	case 5:
+		names = []string{"meta", "versions"}
+	case 6:
+		if parts[4] == "versions" {
+			names = completionIDs(base)
+			leaf = true
+		}
+	}
+
+	res := []string{}
+	for _, name := range completionFilter(names, prefix) {
+		if leaf || name == "meta" {
+			res = append(res, base+name)
+		} else {
+			res = append(res, base+name+"/")
+		}
+	}
+	return res
+}
+
+// Completes Group types, by plural name
+func completeGroupPlural(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	reg := completionRegistry(cmd)
+	if reg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completionFilter(registry.SortedKeys(reg.Model.Groups),
+		toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// Completes Group types, by singular name, or TYPE/ID
+func completeGroupSingular(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	reg := completionRegistry(cmd)
+	if reg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	singular, prefix, hasID := strings.Cut(toComplete, "/")
+	if hasID {
+		gm := reg.Model.FindGroupBySingular(singular)
+		if gm == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		res := []string{}
+		for _, id := range completionFilter(completionIDs(gm.Plural),
+			prefix) {
+			res = append(res, singular+"/"+id)
+		}
+		return res, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	singulars := []string{}
+	for _, gm := range reg.Model.Groups {
+		singulars = append(singulars, gm.Singular)
+	}
+	sort.Strings(singulars)
+	return completionFilter(singulars, toComplete),
+		cobra.ShellCompDirectiveNoFileComp
+}
+
+// The paths of the attributes in "attrs", objects are descended into and
+// maps end with a "." so the key can be added
+func attrPaths(attrs xrlib.Attributes, prefix string) []string {
+	res := []string{}
+	for _, name := range registry.SortedKeys(attrs) {
+		attr := attrs[name]
+		if name == "*" {
+			continue
+		}
+		switch attr.Type {
+		case "object":
+			res = append(res, prefix+name)
+			res = append(res, attrPaths(attr.Attributes, prefix+name+".")...)
+		case "map":
+			res = append(res, prefix+name+".")
+		default:
+			res = append(res, prefix+name)
+		}
+	}
+	return res
+}
+
+// Completes the Registry's attribute names for "xr registry set"
+func completeRegistryAttr(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	reg := completionRegistry(cmd)
+	if reg == nil || len(args) > 0 || strings.Contains(toComplete, "=") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	res := []string{}
+	for _, path := range attrPaths(reg.Model.Attributes, "") {
+		if !strings.HasSuffix(path, ".") {
+			path += "="
+		}
+		res = append(res, path)
+	}
+	return completionFilter(res, toComplete), cobra.ShellCompDirectiveNoSpace
+}
+
+// Completes "--filter" values based on the entities under the command's
+// PATH/XID arg (if any), e.g. "dirs.files.name="
+func completeFilter(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	reg := completionRegistry(cmd)
+	if reg == nil || strings.Contains(toComplete, "=") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	xid := &xrlib.XID{}
+	if len(args) > 0 {
+		xid = xrlib.ParseXID(args[0])
+	}
+
+	paths := []string{}
+	addResource := func(rm *xrlib.ResourceModel, prefix string) {
+		paths = append(paths, attrPaths(rm.Attributes, prefix)...)
+		if xid.Version == "" {
+			paths = append(paths,
+				attrPaths(rm.Attributes, prefix+"versions.")...)
+		}
+	}
+	addGroup := func(gm *xrlib.GroupModel, prefix string) {
+		paths = append(paths, attrPaths(gm.Attributes, prefix)...)
+		for _, rPlural := range registry.SortedKeys(gm.Resources) {
+			addResource(gm.Resources[rPlural], prefix+rPlural+".")
+		}
+	}
+
+	gm := reg.Model.FindGroupByPlural(xid.Group)
+	switch {
+	case xid.Group == "":
+		for _, gPlural := range registry.SortedKeys(reg.Model.Groups) {
+			addGroup(reg.Model.Groups[gPlural], gPlural+".")
+		}
+	case gm == nil:
+	case xid.Resource == "":
+		addGroup(gm, "")
+	default:
+		if rm := gm.FindResourceByPlural(xid.Resource); rm != nil {
+			addResource(rm, "")
+		}
+	}
+
+	res := []string{}
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".") {
+			path += "="
+		}
+		res = append(res, path)
+	}
+	return completionFilter(res, toComplete), cobra.ShellCompDirectiveNoSpace
+}
+
+// Completes "--columns", a comma separated list of column names
+func completeColumns(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	done, prefix := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		done, prefix = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	names := map[string]bool{}
+	if reg := completionRegistry(cmd); reg != nil {
+		for _, name := range attrPaths(reg.Model.Attributes, "") {
+			names[name] = true
+		}
+		for _, gm := range reg.Model.Groups {
+			for _, name := range attrPaths(gm.Attributes, "") {
+				names[name] = true
+			}
+			for _, rm := range gm.Resources {
+				for _, name := range attrPaths(rm.Attributes, "") {
+					names[name] = true
+				}
+			}
+		}
+	}
+
+	res := []string{}
+	for _, name := range registry.SortedKeys(names) {
+		if strings.HasPrefix(name, prefix) {
+			res = append(res, done+name)
+		}
+	}
+	return res, cobra.ShellCompDirectiveNoSpace
+}
+
+// Completes profile names
+func completeProfile(cmd *cobra.Command, args []string,
+	toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completionFilter(registry.SortedKeys(config.Profiles),
+		toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// Adds the completions for flags that are used by lots of commands. The
+// args of each command are completed based on its own ValidArgsFunction.
+func addFlagCompletions(cmd *cobra.Command) {
+	if cmd.Flags().Lookup("output") != nil {
+		cmd.RegisterFlagCompletionFunc("output",
+			func(cmd *cobra.Command, args []string,
+				toComplete string) ([]string, cobra.ShellCompDirective) {
+
+				usage := cmd.Flags().Lookup("output").Usage
+				formats := strings.Split(strings.TrimPrefix(usage,
+					"output: "), ",")
+				for i, format := range formats {
+					format, _, _ = strings.Cut(format, "=")
+					if format == "jsonpath" || format == "template" {
+						format += "="
+					}
+					formats[i] = format
+				}
+				return completionFilter(formats, toComplete),
+					cobra.ShellCompDirectiveNoSpace
+			})
+	}
+	if cmd.Flags().Lookup("columns") != nil {
+		cmd.RegisterFlagCompletionFunc("columns", completeColumns)
+	}
+	if cmd.Flags().Lookup("filter") != nil {
+		cmd.RegisterFlagCompletionFunc("filter", completeFilter)
+	}
+
+	for _, child := range cmd.Commands() {
+		addFlagCompletions(child)
+	}
+}
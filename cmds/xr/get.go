@@ -3,12 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	// "text/tabwriter"
+	"strings"
 
 	// log "github.com/duglin/dlog"
-	"github.com/xregistry/server/cmds/xr/xrlib"
-	// "github.com/xregistry/server/registry"
 	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
 )
 
 func addGetCmd(parent *cobra.Command) {
@@ -16,8 +16,10 @@ func addGetCmd(parent *cobra.Command) {
 		Use:   "get [ XID ]",
 		Short: "Retrieve data from the registry",
 		Run:   getFunc,
+
+		ValidArgsFunction: completeXID,
 	}
-	getCmd.Flags().StringP("output", "o", "table", "Output format(table,json)")
+	addOutputFlags(getCmd, "table", true)
 
 	parent.AddCommand(getCmd)
 }
@@ -32,10 +34,7 @@ func getFunc(cmd *cobra.Command, args []string) {
 		Error(err.Error())
 	}
 
-	output, _ := cmd.Flags().GetString("output")
-	if !xrlib.ArrayContains([]string{"table", "json"}, output) {
-		Error("--ouput must be one of 'table', 'json'")
-	}
+	out := getOutput(cmd)
 
 	if len(args) == 0 {
 		args = []string{"/"}
@@ -44,7 +43,10 @@ func getFunc(cmd *cobra.Command, args []string) {
 	objects := map[string]any{}
 	for _, xid := range args {
 		suffix := ""
-		if len(args) > 1 {
+		// Only Resources and Versions have a $details, not collections
+		x := xrlib.ParseXID(xid)
+		isDoc := (x.ResourceID != "" && x.Version == "") || x.VersionID != ""
+		if len(args) > 1 && isDoc && !strings.HasSuffix(xid, "$details") {
 			rm, err := reg.GetResourceModelFromXID(xid)
 			if err != nil {
 				Error(err.Error())
@@ -68,11 +70,96 @@ func getFunc(cmd *cobra.Command, args []string) {
 		objects[xid] = obj
 	}
 
-	if output == "json" {
-		str, _ := json.MarshalIndent(objects, "", "  ")
-		fmt.Printf("%s\n", str)
-		return
+	// Each entity is a row, collections are expanded
+	table := &Table{
+		Columns: getColumns,
+		Rows:    map[string]map[string]any{},
+	}
+	attrs := map[string]bool{}
+	for xidStr, obj := range objects {
+		xidStr, _, _ = strings.Cut(xidStr, "?")
+		xidStr = strings.TrimSuffix(xidStr, "$details")
+		xidStr = "/" + strings.Trim(xidStr, "/")
+		xid := xrlib.ParseXID(xidStr)
+
+		singular, model := getEntityModel(reg, xid)
+		for _, name := range modelAttrs(model) {
+			attrs[name] = true
+		}
+
+		// Collections are at the odd levels: GROUPS, RESOURCES, versions
+		if xid.VersionID == "" && (xid.Version != "" ||
+			(xid.ResourceID == "" && xid.Resource != "") ||
+			(xid.GroupID == "" && xid.Group != "")) {
+
+			for id, child := range obj.(map[string]any) {
+				childObj, _ := child.(map[string]any)
+				table.Rows[xidStr+"/"+id] = getRow(singular, id, childObj)
+			}
+			continue
+		}
+
+		id := xidStr[strings.LastIndex(xidStr, "/")+1:]
+		table.Rows[xidStr] = getRow(singular, id, obj.(map[string]any))
+	}
+	table.Attrs = registry.SortedKeys(attrs)
+
+	out.Print(objects, table)
+}
+
+var getColumns = []*Column{
+	{Name: "TYPE", Value: func(xid string, obj map[string]any) any {
+		return obj["$type"]
+	}},
+	{Name: "ID", Value: func(xid string, obj map[string]any) any {
+		return obj["$id"]
+	}},
+	attrColumn("name"),
+	attrColumn("epoch"),
+	{Name: "MODIFIED", Wide: true, Value: func(xid string,
+		obj map[string]any) any {
+		return obj["modifiedat"]
+	}},
+	{Name: "XID", Value: func(xid string, obj map[string]any) any {
+		return xid
+	}},
+}
+
+// A copy of "obj" with the entity's type and ID added for the table
+func getRow(singular, id string, obj map[string]any) map[string]any {
+	row := map[string]any{}
+	for k, v := range obj {
+		row[k] = v
+	}
+	if val, ok := obj[singular+"id"]; ok {
+		id = fmt.Sprintf("%v", val)
 	}
+	row["$type"] = singular
+	row["$id"] = id
+	return row
+}
 
-	// output == "table"
+// The singular name and attributes of the type of entity at "xid", or
+// of the entities in it if it's a collection
+func getEntityModel(reg *xrlib.Registry, xid *xrlib.XID) (string,
+	xrlib.Attributes) {
+
+	if xid.Group == "" {
+		return "registry", reg.Model.Attributes
+	}
+	gm := reg.Model.FindGroupByPlural(xid.Group)
+	if gm == nil {
+		Error("Unknown Group type: %s", xid.Group)
+	}
+	if xid.Resource == "" {
+		return gm.Singular, gm.Attributes
+	}
+	rm := gm.FindResourceByPlural(xid.Resource)
+	if rm == nil {
+		Error("Unknown Resource type: %s", xid.Resource)
+	}
+	if xid.Version == "" {
+		return rm.Singular, rm.Attributes
+	}
+	return "version", rm.Attributes
 }
@@ -3,9 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
-	"text/tabwriter"
 
 	// log "github.com/duglin/dlog"
 	"github.com/spf13/cobra"
@@ -29,6 +27,8 @@ func addGroupCmd(parent *cobra.Command) {
 		Short:                 "Create instances of Groups (TYPE is singular).",
 		Run:                   groupCreateFunc,
 		DisableFlagsInUseLine: true,
+
+		ValidArgsFunction: completeGroupSingular,
 	}
 	groupCreateCmd.Flags().StringP("import", "i", "", "Map of data (json)")
 	groupCreateCmd.Flags().StringP("data", "d", "", "Group data (json),@FILE,-")
@@ -42,7 +42,7 @@ func addGroupCmd(parent *cobra.Command) {
 		Short: "Get Group types",
 		Run:   groupTypesFunc,
 	}
-	groupTypesCmd.Flags().StringP("output", "o", "table", "output: table,json")
+	addOutputFlags(groupTypesCmd, "table", true)
 	groupCmd.AddCommand(groupTypesCmd)
 
 	// xr group get [ TYPE ]
@@ -50,8 +50,10 @@ func addGroupCmd(parent *cobra.Command) {
 		Use:   "get [ TYPE... ]",
 		Short: "Get instances of Group types (TYPE is plural)",
 		Run:   groupGetFunc,
+
+		ValidArgsFunction: completeGroupPlural,
 	}
-	groupGetCmd.Flags().StringP("output", "o", "table", "output: table,json")
+	addOutputFlags(groupGetCmd, "table", true)
 	groupCmd.AddCommand(groupGetCmd)
 
 	// xr group delete ( TYPE [ ID... ] [--all] ) | TYPE/ID...
@@ -59,6 +61,8 @@ func addGroupCmd(parent *cobra.Command) {
 		Use:   "delete ( TYPE [ ID... ] | [-all] ) | TYPE/ID...",
 		Short: "Delete instances of a Group type (TYPE is singular)",
 		Run:   groupDeleteFunc,
+
+		ValidArgsFunction: completeGroupSingular,
 	}
 	groupDeleteCmd.Flags().Bool("all", false, "delete all instances of TYPE")
 	groupCmd.AddCommand(groupDeleteCmd)
@@ -188,47 +192,39 @@ func groupTypesFunc(cmd *cobra.Command, args []string) {
 		Error(err.Error())
 	}
 
-	keys := registry.SortedKeys(reg.Model.Groups)
+	out := getOutput(cmd)
 
-	output, _ := cmd.Flags().GetString("output")
-	switch output {
-	case "table":
-		tw := tabwriter.NewWriter(os.Stdout, 0, 1, 2, ' ', 0)
-		fmt.Fprintln(tw, "PLURAL\tSINGULAR\tURL")
-		for _, key := range keys {
-			g := reg.Model.Groups[key]
-			url, err := reg.URLWithPath(g.Plural)
-			if err != nil {
-				Error(err.Error())
-			}
-			fmt.Fprintf(tw, "%s\t%s\t%s\n", g.Plural, g.Singular, url.String())
-		}
-		tw.Flush()
-	case "json":
-		type out struct {
-			Plural   string
-			Singular string
-			URL      string
+	type outType struct {
+		Plural   string
+		Singular string
+		URL      string
+	}
+	res := []outType{}
+	rows := map[string]map[string]any{}
+	for _, key := range registry.SortedKeys(reg.Model.Groups) {
+		g := reg.Model.Groups[key]
+		url, err := reg.URLWithPath(g.Plural)
+		if err != nil {
+			Error(err.Error())
 		}
-		res := []out{}
-		for _, key := range keys {
-			g := reg.Model.Groups[key]
-			url, err := reg.URLWithPath(g.Plural)
-			if err != nil {
-				Error(err.Error())
-			}
-			res = append(res, out{g.Plural, g.Singular, url.String()})
+		res = append(res, outType{g.Plural, g.Singular, url.String()})
+		rows[key] = map[string]any{
+			"plural":   g.Plural,
+			"singular": g.Singular,
+			"url":      url.String(),
 		}
-		buf, _ := json.MarshalIndent(res, "", "  ")
-		fmt.Printf("%s\n", string(buf))
-	default:
-		Error("--ouput must be one of 'table', 'json'")
 	}
+
+	out.Print(res, &Table{
+		Columns: []*Column{attrColumn("plural"), attrColumn("singular"),
+			attrColumn("url")},
+		Rows: rows,
+	})
 }
 
 // xr group get [ TYPE [ ID ] ... | TYPE/ID ... ]
 func groupGetFunc(cmd *cobra.Command, args []string) {
-	output, _ := cmd.Flags().GetString("output")
+	out := getOutput(cmd)
 
 	if Server == "" {
 		Error("No Server address provided. Try either -s or XR_SERVER env var")
@@ -263,37 +259,49 @@ func groupGetFunc(cmd *cobra.Command, args []string) {
 		res[plural] = resMap
 	}
 
-	switch output {
-	case "table":
-		tw := tabwriter.NewWriter(os.Stdout, 0, 1, 2, ' ', 0)
-		fmt.Fprintln(tw, "TYPE\tNAME\tRESOURCES\tPATH")
-		groupKeys := registry.SortedKeys(res)
-		for _, groupKey := range groupKeys {
-			gMap := res[groupKey]
-			gMapKeys := registry.SortedKeys(gMap)
-			for _, gMapKey := range gMapKeys {
-				group := gMap[gMapKey]
-
-				gm := reg.Model.FindGroupByPlural(groupKey)
+	// TYPE/ID -> Group, and the attributes of all of the Group types
+	rows := map[string]map[string]any{}
+	attrs := map[string]bool{}
+	for _, plural := range registry.SortedKeys(res) {
+		for id, group := range res[plural] {
+			rows[plural+"/"+id] = group
+		}
+		gm := reg.Model.FindGroupByPlural(plural)
+		for _, name := range modelAttrs(gm.Attributes) {
+			attrs[name] = true
+		}
+	}
+
+	out.Print(res, &Table{
+		Columns: []*Column{
+			{Name: "TYPE", Value: func(key string, group map[string]any) any {
+				plural, _, _ := strings.Cut(key, "/")
+				return plural
+			}},
+			{Name: "NAME", Value: func(key string, group map[string]any) any {
+				_, id, _ := strings.Cut(key, "/")
+				return id
+			}},
+			{Name: "RESOURCES", Value: func(key string,
+				group map[string]any) any {
+
+				plural, _, _ := strings.Cut(key, "/")
+				gm := reg.Model.FindGroupByPlural(plural)
 				children := 0
 				for _, rm := range gm.Resources {
-					if cntAny, ok := group[rm.Plural+"count"]; ok {
-						if cnt, ok := cntAny.(float64); ok {
-							children += int(cnt)
-						}
+					if cnt, ok := group[rm.Plural+"count"].(float64); ok {
+						children += int(cnt)
 					}
 				}
-
-				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n",
-					groupKey, gMapKey, children, group["xid"])
-			}
-		}
-		tw.Flush()
-	case "json":
-		fmt.Printf("%s\n", xrlib.ToJSON(res))
-	default:
-		Error("--ouput must be one of 'table', 'json'")
-	}
+				return children
+			}},
+			{Name: "PATH", Value: func(key string, group map[string]any) any {
+				return group["xid"]
+			}},
+		},
+		Attrs: registry.SortedKeys(attrs),
+		Rows:  rows,
+	})
 }
 
 // xr group delete ( TYPE [ ID... ] [--all] ) | TYPE/ID... | -
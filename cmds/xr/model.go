@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	// log "github.com/duglin/dlog"
-	// "github.com/xregistry/server/cmds/xr/xrlib"
 	"github.com/spf13/cobra"
 	"github.com/xregistry/server/registry"
 )
@@ -24,6 +23,7 @@ func addModelCmd(parent *cobra.Command) {
 		Short: "Parse and resolve includes in an xRegistry model document",
 		Run:   modelNormalizeFunc,
 	}
+	addOutputFlags(modelNormalizeCmd, "json", false)
 	modelCmd.AddCommand(modelNormalizeCmd)
 
 	modelVerifyCmd := &cobra.Command{
@@ -33,6 +33,8 @@ func addModelCmd(parent *cobra.Command) {
 	}
 	modelCmd.AddCommand(modelVerifyCmd)
 
+	addModelToolCmds(modelCmd)
+
 	parent.AddCommand(modelCmd)
 }
 
@@ -40,6 +42,8 @@ func modelNormalizeFunc(cmd *cobra.Command, args []string) {
 	var err error
 	var buf []byte
 
+	out := getOutput(cmd)
+
 	if len(args) == 0 {
 		args = []string{"-"}
 	}
@@ -71,6 +75,10 @@ func modelNormalizeFunc(cmd *cobra.Command, args []string) {
 			Error("Error reading %q: %s", fileName, err)
 		}
 
+		if buf, err = ModelFromYAML(buf); err != nil {
+			Error("%s: %s", fileName, err)
+		}
+
 		buf, err = registry.ProcessIncludes(fileName, buf, true)
 		if err != nil {
 			Error(err.Error())
@@ -81,10 +89,23 @@ func modelNormalizeFunc(cmd *cobra.Command, args []string) {
 		if err != nil {
 			Error(err.Error())
 		}
-		fmt.Printf("%s\n", registry.ToJSON(tmp))
+		if out.Format == "json" {
+			fmt.Printf("%s\n", registry.ToJSON(tmp))
+		} else {
+			out.Print(tmp, nil)
+		}
 	}
 }
 
+// Models are always JSON objects, so if it doesn't look like one then
+// assume it's YAML and convert it to JSON
+func ModelFromYAML(buf []byte) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(buf)), "{") {
+		return buf, nil
+	}
+	return registry.YAMLToJSON(buf)
+}
+
 func modelVerifyFunc(cmd *cobra.Command, args []string) {
 	var buf []byte
 	var err error
@@ -130,6 +151,10 @@ func VerifyModel(fileName string, buf []byte) {
 		fileName = ""
 	}
 
+	if buf, err = ModelFromYAML(buf); err != nil {
+		Error("%s%s", fileName, err)
+	}
+
 	buf, err = registry.ProcessIncludes(fileName, buf, true)
 	if err != nil {
 		Error("%s%s", fileName, err)
@@ -0,0 +1,766 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+var modelDiffLong = `Show the differences between two models. Each of
+OLD and NEW can be a model file ("-" for stdin) or a server's URL, in
+which case its current model is used. Both are verified first so that
+the spec defined attributes don't show up as differences.
+
+Exits with 0 if the models are the same, 1 if they're not.`
+
+var modelLintLong = `Check a model for things that are allowed, but are
+not a good idea:
+  description  an extension attribute has no "description"
+  unbounded    a "string" attribute has no (strict) "enum", or "*" allows
+               any extension attribute
+  shadow       an attribute uses a name that the spec, or the model, uses
+               for something else (e.g. "versionid" on a Group, or
+               "filesurl")
+
+If no model is given then the server's model is checked, or stdin if
+there's no server. Exits with 1 if there are any warnings.`
+
+var modelEditLong = `Edits the model in FILE, which is created if it
+doesn't exist. The result must be a valid model, otherwise FILE isn't
+changed. Files ending in .yaml or .yml, or that were YAML, are written
+as YAML. Comments are not kept.`
+
+func addModelToolCmds(modelCmd *cobra.Command) {
+	// xr model diff OLD NEW
+	modelDiffCmd := &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Show the differences between two models",
+		Long:  modelDiffLong,
+		Run:   modelDiffFunc,
+	}
+	modelCmd.AddCommand(modelDiffCmd)
+
+	// xr model merge FILE...
+	modelMergeCmd := &cobra.Command{
+		Use:   "merge FILE...",
+		Short: "Merge model documents, later ones override earlier ones",
+		Run:   modelMergeFunc,
+	}
+	addOutputFlags(modelMergeCmd, "json", false)
+	modelCmd.AddCommand(modelMergeCmd)
+
+	// xr model lint [ - | FILE | SERVER ]
+	modelLintCmd := &cobra.Command{
+		Use:   "lint [ - | FILE | SERVER ]",
+		Short: "Check a model for best practices",
+		Long:  modelLintLong,
+		Run:   modelLintFunc,
+	}
+	modelLintCmd.Flags().StringSlice("skip", nil,
+		"rules to skip: description,unbounded,shadow")
+	modelCmd.AddCommand(modelLintCmd)
+
+	// xr model add-group FILE PLURAL [SINGULAR]
+	modelAddGroupCmd := &cobra.Command{
+		Use:   "add-group FILE PLURAL [SINGULAR]",
+		Short: "Add a Group type to a model file",
+		Long:  modelEditLong,
+		Run:   modelAddGroupFunc,
+	}
+	modelCmd.AddCommand(modelAddGroupCmd)
+
+	// xr model add-resource FILE GROUPS PLURAL [SINGULAR]
+	modelAddResourceCmd := &cobra.Command{
+		Use:   "add-resource FILE GROUPS PLURAL [SINGULAR]",
+		Short: "Add a Resource type to a Group type in a model file",
+		Long:  modelEditLong,
+		Run:   modelAddResourceFunc,
+	}
+	modelAddResourceCmd.Flags().Int("max-versions", 0,
+		"max number of Versions to keep (0=unlimited)")
+	modelAddResourceCmd.Flags().Bool("no-doc", false,
+		"Resources don't have a document")
+	modelCmd.AddCommand(modelAddResourceCmd)
+
+	// xr model add-attribute FILE NAME [--on PATH] --type TYPE ...
+	modelAddAttrCmd := &cobra.Command{
+		Use:   "add-attribute FILE NAME",
+		Short: "Add an attribute to a model file",
+		Long: modelEditLong + `
+
+NAME can be a dotted path (e.g. "owner.email") to add the attribute
+to an existing "object" attribute.`,
+		Run: modelAddAttrFunc,
+	}
+	modelAddAttrCmd.Flags().String("on", "",
+		"where to add it: \"\" (Registry), GROUPS, GROUPS/RESOURCES or "+
+			"GROUPS/RESOURCES/meta")
+	modelAddAttrCmd.Flags().StringP("type", "t", "string", "attribute's type")
+	modelAddAttrCmd.Flags().String("item-type", "",
+		"type of the items of a map or array")
+	modelAddAttrCmd.Flags().StringP("description", "d", "",
+		"attribute's description")
+	modelAddAttrCmd.Flags().Bool("required", false, "attribute is required")
+	modelAddAttrCmd.Flags().StringSlice("enum", nil,
+		"allowed values, comma separated")
+	modelCmd.AddCommand(modelAddAttrCmd)
+
+	// xr model push FILE [--dry-run] [--force]
+	modelPushCmd := &cobra.Command{
+		Use:   "push [ - | FILE ]",
+		Short: "Show what changes, then update the server's model",
+		Run:   modelPushFunc,
+	}
+	modelPushCmd.Flags().Bool("dry-run", false,
+		"Just show what would be changed")
+	modelPushCmd.Flags().Bool("force", false,
+		"push even if existing entities will be deleted")
+	modelCmd.AddCommand(modelPushCmd)
+}
+
+// Returns the model from a file ("-" is stdin), with includes resolved,
+// or from a server if "name" isn't a file. "reg" is nil for files.
+func loadModel(name string) (map[string]any, *xrlib.Registry, error) {
+	reg := (*xrlib.Registry)(nil)
+	buf := []byte(nil)
+	var err error
+
+	if stat, statErr := os.Stat(name); name == "-" ||
+		(statErr == nil && !stat.IsDir()) {
+		if buf, err = xrlib.ReadFile(name); err == nil {
+			if buf, err = ModelFromYAML(buf); err == nil {
+				buf, err = registry.ProcessIncludes(name, buf, true)
+			}
+		}
+	} else {
+		reg, err = xrlib.GetRegistry(name)
+		if err == nil {
+			buf, err = reg.HttpDo("GET", "/model", nil)
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	doc := map[string]any{}
+	if err = registry.Unmarshal(buf, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return doc, reg, nil
+}
+
+// Verifies "doc" and returns it as the server would show it, with all of
+// the spec defined attributes and defaults filled in
+func verifyModelDoc(name string, doc map[string]any) (map[string]any, error) {
+	buf, _ := json.Marshal(doc)
+	model := &registry.Model{}
+	if err := registry.Unmarshal(buf, model); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if err := model.Verify(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	res := map[string]any{}
+	buf, _ = json.Marshal(model)
+	if err := json.Unmarshal(buf, &res); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return res, nil
+}
+
+// Returns a copy of "m" without "key"
+func withoutKey(m map[string]any, key string) map[string]any {
+	res := map[string]any{}
+	for k, v := range m {
+		if k != key {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// The steps needed to turn the (verified) model "oldDoc" into "newDoc"
+func diffModels(oldDoc, newDoc map[string]any) []*applyStep {
+	steps := []*applyStep{}
+
+	changes := xrlib.DiffValues("", withoutKey(oldDoc, "groups"),
+		withoutKey(newDoc, "groups"))
+	if len(changes) > 0 {
+		steps = append(steps, &applyStep{
+			Action:  APPLY_UPDATE,
+			Kind:    "registry",
+			XID:     "/",
+			Changes: changes,
+		})
+	}
+
+	oldGroups, newGroups := getMap(oldDoc, "groups"), getMap(newDoc, "groups")
+	for _, gName := range registry.SortedKeys(newGroups) {
+		newGM, _ := newGroups[gName].(map[string]any)
+		oldGM, ok := oldGroups[gName].(map[string]any)
+		if !ok {
+			steps = append(steps, &applyStep{
+				Action: APPLY_CREATE,
+				Kind:   "group",
+				XID:    gName,
+			})
+			continue
+		}
+
+		changes := xrlib.DiffValues("", withoutKey(oldGM, "resources"),
+			withoutKey(newGM, "resources"))
+		if len(changes) > 0 {
+			steps = append(steps, &applyStep{
+				Action:  APPLY_UPDATE,
+				Kind:    "group",
+				XID:     gName,
+				Changes: changes,
+			})
+		}
+
+		oldRes, newRes := getMap(oldGM, "resources"), getMap(newGM, "resources")
+		for _, rName := range registry.SortedKeys(newRes) {
+			step := &applyStep{Kind: "resource", XID: gName + "/" + rName}
+			if _, ok := oldRes[rName]; !ok {
+				step.Action = APPLY_CREATE
+			} else {
+				step.Action = APPLY_UPDATE
+				step.Changes = xrlib.DiffValues("", oldRes[rName], newRes[rName])
+				if len(step.Changes) == 0 {
+					continue
+				}
+			}
+			steps = append(steps, step)
+		}
+		for _, rName := range registry.SortedKeys(oldRes) {
+			if _, ok := newRes[rName]; !ok {
+				steps = append(steps, &applyStep{
+					Action: APPLY_DELETE,
+					Kind:   "resource",
+					XID:    gName + "/" + rName,
+				})
+			}
+		}
+	}
+
+	for _, gName := range registry.SortedKeys(oldGroups) {
+		if _, ok := newGroups[gName]; !ok {
+			steps = append(steps, &applyStep{
+				Action: APPLY_DELETE,
+				Kind:   "group",
+				XID:    gName,
+			})
+		}
+	}
+
+	return steps
+}
+
+func modelDiffFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		Error("Must specify exactly two models: OLD and NEW")
+	}
+
+	docs := []map[string]any{}
+	for _, name := range args {
+		doc, _, err := loadModel(name)
+		ErrStop(err)
+		doc, err = verifyModelDoc(name, doc)
+		ErrStop(err)
+		docs = append(docs, doc)
+	}
+
+	steps := diffModels(docs[0], docs[1])
+	if len(steps) == 0 {
+		fmt.Printf("No differences\n")
+		return
+	}
+	printPlan(steps)
+	os.Exit(1)
+}
+
+// Copies "src" into "dst", merging maps that are in both
+func mergeMaps(dst, src map[string]any) {
+	for key, val := range src {
+		srcMap, ok1 := val.(map[string]any)
+		dstMap, ok2 := dst[key].(map[string]any)
+		if ok1 && ok2 {
+			mergeMaps(dstMap, srcMap)
+		} else {
+			dst[key] = val
+		}
+	}
+}
+
+func modelMergeFunc(cmd *cobra.Command, args []string) {
+	out := getOutput(cmd)
+
+	if len(args) == 0 {
+		Error("Must specify at least one model file")
+	}
+
+	res := map[string]any{}
+	for _, fileName := range args {
+		Verbose("%s:\n", fileName)
+		buf, err := xrlib.ReadFile(fileName)
+		if err != nil {
+			Error("Error reading %q: %s", fileName, err)
+		}
+		if buf, err = ModelFromYAML(buf); err != nil {
+			Error("%s: %s", fileName, err)
+		}
+		buf, err = registry.ProcessIncludes(fileName, buf, true)
+		ErrStop(err)
+
+		doc := map[string]any{}
+		err = registry.Unmarshal(buf, &doc)
+		ErrStop(err, "%s: %s", fileName, err)
+		mergeMaps(res, doc)
+	}
+
+	_, err := verifyModelDoc("Merged model", res)
+	ErrStop(err)
+
+	if out.Format == "json" {
+		fmt.Printf("%s\n", registry.ToJSON(res))
+	} else {
+		out.Print(res, nil)
+	}
+}
+
+type modelLinter struct {
+	skip     []string
+	reserved map[string]bool // Names the spec, or model, uses
+	warnings []string
+}
+
+func (l *modelLinter) warn(rule string, path string, format string,
+	args ...any) {
+
+	if !xrlib.ArrayContains(l.skip, rule) {
+		l.warnings = append(l.warnings, fmt.Sprintf("warning: %s: %s (%s)",
+			path, fmt.Sprintf(format, args...), rule))
+	}
+}
+
+// Is "name" a spec defined attribute of the "singular" entity, which is
+// at "level"
+func isSpecAttr(level int, singular string, hasDoc bool, name string) bool {
+	if level == registry.ENTITY_REGISTRY && name == "registryid" {
+		return true
+	}
+	if level != registry.ENTITY_REGISTRY && name == singular+"id" {
+		return true
+	}
+	if level == registry.ENTITY_VERSION && hasDoc {
+		for _, suffix := range []string{"", "url", "base64", "proxyurl"} {
+			if name == singular+suffix {
+				return true
+			}
+		}
+	}
+	prop := registry.SpecProps[name]
+	return prop != nil && name != "id" && prop.InType(level)
+}
+
+func (l *modelLinter) lintAttrs(path string, level int, singular string,
+	hasDoc bool, attrs registry.Attributes) {
+
+	for _, name := range registry.SortedKeys(attrs) {
+		attr := attrs[name]
+		attrPath := path + "." + name
+
+		if level >= 0 {
+			// Spec attributes are checked by "verify"
+			if isSpecAttr(level, singular, hasDoc, name) {
+				continue
+			}
+			if l.reserved[name] {
+				l.warn("shadow", attrPath, "%q is used by the spec, or "+
+					"the model, for something else", name)
+			}
+		}
+
+		if name == "*" {
+			if attr.Type == registry.ANY {
+				l.warn("unbounded", attrPath,
+					"allows any extension attribute with any value")
+			}
+			continue
+		}
+
+		if attr.Description == "" {
+			l.warn("description", attrPath, "has no description")
+		}
+		strict := attr.Strict == nil || *attr.Strict
+		if attr.Type == registry.STRING && (len(attr.Enum) == 0 || !strict) {
+			l.warn("unbounded", attrPath, "is a string with no strict "+
+				"enum, consider an enum or a more specific type (e.g. uri, "+
+				"timestamp)")
+		}
+
+		// Nested attributes can't clash with spec ones, so use level -1
+		l.lintAttrs(attrPath+".attributes", -1, "", false, attr.Attributes)
+		itemPath := attrPath
+		for item := attr.Item; item != nil; item = item.Item {
+			itemPath += ".item"
+			l.lintAttrs(itemPath+".attributes", -1, "", false,
+				item.Attributes)
+		}
+	}
+}
+
+func (l *modelLinter) lint(model *registry.Model) {
+	l.reserved = map[string]bool{"registryid": true}
+	for name := range registry.SpecProps {
+		if name != "id" && name[0] != '$' {
+			l.reserved[name] = true
+		}
+	}
+	for _, gm := range model.Groups {
+		l.reserved[gm.Singular+"id"] = true
+		l.reserved[gm.Plural+"url"] = true
+		l.reserved[gm.Plural+"count"] = true
+		for _, rm := range gm.Resources {
+			l.reserved[rm.Singular+"id"] = true
+			l.reserved[rm.Plural+"url"] = true
+			l.reserved[rm.Plural+"count"] = true
+			for _, suffix := range []string{"", "url", "base64", "proxyurl"} {
+				l.reserved[rm.Singular+suffix] = true
+			}
+		}
+	}
+
+	l.lintAttrs("attributes", registry.ENTITY_REGISTRY, "", false,
+		model.Attributes)
+	for _, gName := range registry.SortedKeys(model.Groups) {
+		gm := model.Groups[gName]
+		path := "groups." + gName
+		l.lintAttrs(path+".attributes", registry.ENTITY_GROUP, gm.Singular,
+			false, gm.Attributes)
+
+		for _, rName := range registry.SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			path := path + ".resources." + rName
+			hasDoc := rm.HasDocument == nil || *rm.HasDocument
+			l.lintAttrs(path+".attributes", registry.ENTITY_VERSION,
+				rm.Singular, hasDoc, rm.Attributes)
+			l.lintAttrs(path+".metaattributes", registry.ENTITY_META,
+				rm.Singular, false, rm.MetaAttributes)
+		}
+	}
+}
+
+func modelLintFunc(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		Error("Only one model can be checked at a time")
+	}
+	name := "-"
+	if len(args) == 1 {
+		name = args[0]
+	} else if Server != "" {
+		name = Server
+	}
+
+	doc, _, err := loadModel(name)
+	ErrStop(err)
+	_, err = verifyModelDoc(name, doc)
+	ErrStop(err)
+
+	// Lint the model as it was written, not the verified version, so
+	// that we can tell which attributes the user defined
+	buf, _ := json.Marshal(doc)
+	model := &registry.Model{}
+	err = registry.Unmarshal(buf, model)
+	ErrStop(err)
+
+	l := &modelLinter{}
+	l.skip, _ = cmd.Flags().GetStringSlice("skip")
+	l.lint(model)
+
+	for _, warning := range l.warnings {
+		fmt.Printf("%s\n", warning)
+	}
+	if len(l.warnings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Reads the model in "fileName", as is (no includes processed). An empty
+// model is returned if the file doesn't exist yet.
+func readModelFile(fileName string) (map[string]any, bool, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	isYAML := ext == ".yaml" || ext == ".yml"
+	doc := map[string]any{}
+
+	buf, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return doc, isYAML, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	isYAML = !strings.HasPrefix(strings.TrimSpace(string(buf)), "{")
+	if buf, err = ModelFromYAML(buf); err != nil {
+		return nil, false, fmt.Errorf("%s: %s", fileName, err)
+	}
+	if err = registry.Unmarshal(registry.RemoveComments(buf), &doc); err != nil {
+		return nil, false, fmt.Errorf("%s: %s", fileName, err)
+	}
+	return doc, isYAML, nil
+}
+
+// Verifies "doc" and, if it's ok, saves it in "fileName"
+func writeModelFile(fileName string, doc map[string]any, isYAML bool) {
+	buf, _ := json.Marshal(doc)
+	buf, err := registry.ProcessIncludes(fileName, buf, true)
+	ErrStop(err)
+	full := map[string]any{}
+	err = registry.Unmarshal(buf, &full)
+	ErrStop(err)
+	_, err = verifyModelDoc(fileName, full)
+	ErrStop(err)
+
+	str := xrlib.ToJSON(doc) + "\n"
+	if isYAML {
+		str = xrlib.ToYAML(doc)
+	}
+	err = os.WriteFile(fileName, []byte(str), 0644)
+	ErrStop(err, "Error writing %q: %s", fileName, err)
+}
+
+// Returns the map "key" in "parent", adding it if it's not there
+func addMap(parent map[string]any, key string) map[string]any {
+	res, ok := parent[key].(map[string]any)
+	if !ok {
+		res = map[string]any{}
+		parent[key] = res
+	}
+	return res
+}
+
+func modelAddGroupFunc(cmd *cobra.Command, args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		Error("Must specify FILE, PLURAL and optionally SINGULAR")
+	}
+	fileName, plural := args[0], args[1]
+	singular := strings.TrimSuffix(plural, "s")
+	if len(args) == 3 {
+		singular = args[2]
+	}
+
+	doc, isYAML, err := readModelFile(fileName)
+	ErrStop(err)
+
+	groups := addMap(doc, "groups")
+	if _, ok := groups[plural]; ok {
+		Error("Group type %q already exists", plural)
+	}
+	groups[plural] = map[string]any{"plural": plural, "singular": singular}
+
+	writeModelFile(fileName, doc, isYAML)
+}
+
+func modelAddResourceFunc(cmd *cobra.Command, args []string) {
+	if len(args) < 3 || len(args) > 4 {
+		Error("Must specify FILE, GROUPS, PLURAL and optionally SINGULAR")
+	}
+	fileName, gPlural, plural := args[0], args[1], args[2]
+	singular := strings.TrimSuffix(plural, "s")
+	if len(args) == 4 {
+		singular = args[3]
+	}
+
+	doc, isYAML, err := readModelFile(fileName)
+	ErrStop(err)
+
+	gm, ok := getMap(doc, "groups")[gPlural].(map[string]any)
+	if !ok {
+		Error("Unknown Group type: %s", gPlural)
+	}
+	resources := addMap(gm, "resources")
+	if _, ok := resources[plural]; ok {
+		Error("Resource type %q already exists in %q", plural, gPlural)
+	}
+
+	rm := map[string]any{"plural": plural, "singular": singular}
+	if cmd.Flags().Changed("max-versions") {
+		rm["maxversions"], _ = cmd.Flags().GetInt("max-versions")
+	}
+	if noDoc, _ := cmd.Flags().GetBool("no-doc"); noDoc {
+		rm["hasdocument"] = false
+	}
+	resources[plural] = rm
+
+	writeModelFile(fileName, doc, isYAML)
+}
+
+func modelAddAttrFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		Error("Must specify FILE and NAME")
+	}
+	fileName, name := args[0], args[1]
+	on, _ := cmd.Flags().GetString("on")
+
+	doc, isYAML, err := readModelFile(fileName)
+	ErrStop(err)
+
+	// Find the entity's "attributes"
+	parts := strings.Split(strings.Trim(on, "/"), "/")
+	parent := doc
+	attrsKey := "attributes"
+	if on != "" && on != "/" {
+		gm, ok := getMap(doc, "groups")[parts[0]].(map[string]any)
+		if !ok {
+			Error("Unknown Group type: %s", parts[0])
+		}
+		parent = gm
+		if len(parts) > 1 {
+			rm, ok := getMap(gm, "resources")[parts[1]].(map[string]any)
+			if !ok {
+				Error("Unknown Resource type: %s/%s", parts[0], parts[1])
+			}
+			parent = rm
+		}
+		if len(parts) == 3 && parts[2] == "meta" {
+			attrsKey = "metaattributes"
+		} else if len(parts) > 2 {
+			Error("Invalid --on value: %s", on)
+		}
+	}
+
+	// Walk down into the "object" attributes of a dotted NAME
+	names := strings.Split(name, ".")
+	attrs := addMap(parent, attrsKey)
+	for _, objName := range names[:len(names)-1] {
+		obj, ok := attrs[objName].(map[string]any)
+		if !ok || obj["type"] != registry.OBJECT {
+			Error("%q isn't an existing \"object\" attribute", objName)
+		}
+		attrs = addMap(obj, "attributes")
+	}
+	name = names[len(names)-1]
+	if _, ok := attrs[name]; ok {
+		Error("Attribute %q already exists", args[1])
+	}
+
+	attr := map[string]any{"name": name}
+	attr["type"], _ = cmd.Flags().GetString("type")
+	if itemType, _ := cmd.Flags().GetString("item-type"); itemType != "" {
+		attr["item"] = map[string]any{"type": itemType}
+	}
+	if desc, _ := cmd.Flags().GetString("description"); desc != "" {
+		attr["description"] = desc
+	}
+	if req, _ := cmd.Flags().GetBool("required"); req {
+		attr["required"] = true
+	}
+	if enum, _ := cmd.Flags().GetStringSlice("enum"); len(enum) > 0 {
+		attr["enum"] = enum
+	}
+	attrs[name] = attr
+
+	writeModelFile(fileName, doc, isYAML)
+}
+
+// The number of entities that will be deleted by the steps
+func modelPushImpact(reg *xrlib.Registry, steps []*applyStep) []string {
+	impact := []string{}
+	regAttrs := map[string]any(nil)
+
+	for _, step := range steps {
+		if step.Action != APPLY_DELETE {
+			continue
+		}
+		gName, rName, _ := strings.Cut(step.XID, "/")
+		count := 0.0
+
+		if rName == "" {
+			if regAttrs == nil {
+				buf, err := reg.HttpDo("GET", "/", nil)
+				ErrStop(err)
+				err = json.Unmarshal(buf, &regAttrs)
+				ErrStop(err)
+			}
+			count, _ = regAttrs[gName+"count"].(float64)
+		} else {
+			groups := map[string]any{}
+			buf, err := reg.HttpDo("GET", "/"+gName, nil)
+			ErrStop(err)
+			err = json.Unmarshal(buf, &groups)
+			ErrStop(err)
+			for _, group := range groups {
+				attrs, _ := group.(map[string]any)
+				n, _ := attrs[rName+"count"].(float64)
+				count += n
+			}
+		}
+
+		if count > 0 {
+			impact = append(impact, fmt.Sprintf("%d %s", int(count),
+				step.XID))
+		}
+	}
+	return impact
+}
+
+func modelPushFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) > 1 {
+		Error("Only one model file can be pushed")
+	}
+	fileName := "-"
+	if len(args) == 1 {
+		fileName = args[0]
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	force, _ := cmd.Flags().GetBool("force")
+
+	newDoc, reg, err := loadModel(fileName)
+	ErrStop(err)
+	if reg != nil {
+		Error("%s: not a file", fileName)
+	}
+	verified, err := verifyModelDoc(fileName, newDoc)
+	ErrStop(err)
+
+	oldDoc, reg, err := loadModel(Server)
+	ErrStop(err)
+	oldDoc, err = verifyModelDoc(Server, oldDoc)
+	ErrStop(err)
+
+	steps := diffModels(oldDoc, verified)
+	if len(steps) == 0 {
+		fmt.Printf("No changes\n")
+		return
+	}
+	printPlan(steps)
+
+	impact := modelPushImpact(reg, steps)
+	if len(impact) > 0 {
+		fmt.Printf("\nThis will delete: %s\n", strings.Join(impact, ", "))
+	}
+
+	if dryRun {
+		return
+	}
+	if len(impact) > 0 && !force {
+		Error("Existing entities will be deleted, use --force to push " +
+			"the model anyway")
+	}
+
+	_, err = reg.HttpDo("PUT", "/model", []byte(xrlib.ToJSON(newDoc)))
+	ErrStop(err)
+	Verbose("Model updated")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+// Adds the common "--output" flag, and "--columns" if the command can
+// show a table. "def" is the default output format.
+func addOutputFlags(cmd *cobra.Command, def string, table bool) {
+	formats := "json,yaml,jsonpath=EXPR,template=TMPL"
+	if table {
+		formats = "table,wide," + formats
+		cmd.Flags().StringSlice("columns", nil,
+			"table columns to show (names or attributes), comma separated")
+	}
+	cmd.Flags().StringP("output", "o", def, "output: "+formats)
+}
+
+type Output struct {
+	Format  string   // table, wide, json, yaml, jsonpath, template
+	Arg     string   // The EXPR or TMPL of jsonpath= and template=
+	Columns []string // From --columns
+
+	template *template.Template
+}
+
+// Gets the output format to use from the command's flags
+func getOutput(cmd *cobra.Command) *Output {
+	str, _ := cmd.Flags().GetString("output")
+	format, arg, hasArg := strings.Cut(str, "=")
+
+	out := &Output{Format: format, Arg: arg}
+	table := cmd.Flags().Lookup("columns") != nil
+	if table {
+		out.Columns, _ = cmd.Flags().GetStringSlice("columns")
+	}
+
+	switch format {
+	case "table", "wide":
+		if !table {
+			break
+		}
+		if hasArg {
+			Error("--output %s doesn't take a value", format)
+		}
+		return out
+	case "json", "yaml":
+		if hasArg {
+			Error("--output %s doesn't take a value", format)
+		}
+		if len(out.Columns) > 0 {
+			Error("--columns can only be used with table output")
+		}
+		return out
+	case "jsonpath":
+		if arg == "" {
+			Error("--output jsonpath needs an expression, e.g. " +
+				"jsonpath='{.*.xid}'")
+		}
+		if _, err := xrlib.JSONPath(nil, arg); err != nil {
+			Error("Invalid jsonpath: %s", err)
+		}
+		return out
+	case "template":
+		if arg == "" {
+			Error("--output template needs a template, e.g. " +
+				"template='{{range .}}{{.xid}}{{\"\\n\"}}{{end}}'")
+		}
+		tmpl, err := template.New("output").Funcs(template.FuncMap{
+			"json": func(v any) string { return xrlib.JSONPathString(v) },
+			"yaml": func(v any) string { return xrlib.ToYAML(v) },
+		}).Parse(arg)
+		if err != nil {
+			Error("Invalid template: %s", err)
+		}
+		out.template = tmpl
+		return out
+	}
+
+	formats := []string{"json", "yaml", "jsonpath=EXPR", "template=TMPL"}
+	if table {
+		formats = append([]string{"table", "wide"}, formats...)
+	}
+	Error("--output must be one of '%s'", strings.Join(formats, "', '"))
+	return nil
+}
+
+func (out *Output) IsTable() bool {
+	return out.Format == "table" || out.Format == "wide"
+}
+
+// Returns "data" in the non-table output format. For jsonpath and
+// templates "data" is first converted into its generic JSON form so the
+// expressions use the same names as the json output.
+func (out *Output) String(data any) string {
+	switch out.Format {
+	case "json":
+		return xrlib.ToJSON(data) + "\n"
+	case "yaml":
+		return xrlib.ToYAML(data)
+	}
+
+	generic := any(nil)
+	buf, err := json.Marshal(data)
+	ErrStop(err)
+	ErrStop(json.Unmarshal(buf, &generic))
+
+	str := ""
+	if out.Format == "jsonpath" {
+		str, err = xrlib.JSONPath(generic, out.Arg)
+		ErrStop(err, "Error processing jsonpath: %s", err)
+	} else {
+		res := strings.Builder{}
+		err = out.template.Execute(&res, generic)
+		ErrStop(err, "Error processing template: %s", err)
+		str = res.String()
+	}
+	if str != "" && !strings.HasSuffix(str, "\n") {
+		str += "\n"
+	}
+	return str
+}
+
+// Prints "data", or "table" if a table (or wide) was asked for
+func (out *Output) Print(data any, table *Table) {
+	if out.IsTable() {
+		table.Print(os.Stdout, out)
+		return
+	}
+	fmt.Print(out.String(data))
+}
+
+type Column struct {
+	Name  string // Header, upper case
+	Wide  bool   // Only shown for "wide" output
+	Value func(key string, row map[string]any) any
+}
+
+type Table struct {
+	Columns []*Column
+	Attrs   []string                  // Model's attributes, for "wide"
+	Rows    map[string]map[string]any // Shown sorted by key
+}
+
+// A column that just shows the attribute "name", which may be a dotted
+// path (e.g. labels.env)
+func attrColumn(name string) *Column {
+	return &Column{
+		Name: strings.ToUpper(name),
+		Value: func(key string, row map[string]any) any {
+			vals, err := xrlib.JSONPathValues(row, name)
+			if err != nil || len(vals) == 0 {
+				return nil
+			}
+			return vals[0]
+		},
+	}
+}
+
+// Sorted names of the scalar attributes in "attrs", for the "wide" columns
+func modelAttrs(attrs xrlib.Attributes) []string {
+	names := []string{}
+	for _, name := range registry.SortedKeys(attrs) {
+		switch attrs[name].Type {
+		case "any", "array", "map", "object":
+			continue
+		}
+		if name != "*" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// The columns to show based on the output format and --columns
+func (t *Table) columns(out *Output) []*Column {
+	cols := []*Column{}
+
+	if len(out.Columns) > 0 {
+		for _, name := range out.Columns {
+			name = strings.TrimSpace(name)
+			col := (*Column)(nil)
+			for _, c := range t.Columns {
+				if strings.EqualFold(c.Name, name) {
+					col = c
+					break
+				}
+			}
+			if col == nil {
+				col = attrColumn(name)
+			}
+			cols = append(cols, col)
+		}
+		return cols
+	}
+
+	for _, col := range t.Columns {
+		if !col.Wide || out.Format == "wide" {
+			cols = append(cols, col)
+		}
+	}
+	if out.Format == "wide" {
+		for _, name := range t.Attrs {
+			col := attrColumn(name)
+			dup := false
+			for _, c := range cols {
+				dup = dup || c.Name == col.Name
+			}
+			if !dup {
+				cols = append(cols, col)
+			}
+		}
+	}
+	return cols
+}
+
+func (t *Table) Print(w *os.File, out *Output) {
+	cols := t.columns(out)
+
+	tw := tabwriter.NewWriter(w, 0, 1, 2, ' ', 0)
+	names := []string{}
+	for _, col := range cols {
+		names = append(names, col.Name)
+	}
+	fmt.Fprintln(tw, strings.Join(names, "\t"))
+
+	for _, key := range registry.SortedKeys(t.Rows) {
+		vals := []string{}
+		for _, col := range cols {
+			vals = append(vals, xrlib.JSONPathString(col.Value(key,
+				t.Rows[key])))
+		}
+		fmt.Fprintln(tw, strings.Join(vals, "\t"))
+	}
+	tw.Flush()
+}
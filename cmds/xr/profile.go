@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+)
+
+// Commands that manage the profiles themselves, so they don't need (and
+// shouldn't fail on) the active one
+var noProfile = map[string]string{"noprofile": "true"}
+
+// Picks the profile to use (--profile, XR_PROFILE or the config's current
+// one) and sets up xrlib so all HTTP requests use its auth/TLS info
+func loadProfile(cmd *cobra.Command) {
+	if cmd.Annotations["noprofile"] == "true" {
+		return
+	}
+
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	profile, err := config.GetProfile(ProfileName)
+	ErrStop(err)
+	if profile == nil {
+		return
+	}
+
+	xrlib.CurrentProfile = profile
+	xrlib.ResetHTTPClient()
+	if Server == "" {
+		Server = profile.URL()
+	}
+}
+
+func addProfileCmd(parent *cobra.Command) {
+	// xr login [NAME] -s URL [--token T | --user U --password P] ...
+	loginCmd := &cobra.Command{
+		Use:   "login [NAME]",
+		Short: "Save a server's connection info as a profile and use it",
+		Run:   loginFunc,
+
+		Annotations:       noProfile,
+		ValidArgsFunction: completeProfile,
+	}
+	loginCmd.Flags().String("registry", "", "default registry (reg-NAME)")
+	loginCmd.Flags().String("token", "", "bearer token, \"-\" for stdin")
+	loginCmd.Flags().StringP("user", "u", "", "basic auth user name")
+	loginCmd.Flags().String("password", "", "basic auth password, "+
+		"\"-\" for stdin")
+	loginCmd.Flags().String("cacert", "", "CA bundle file")
+	loginCmd.Flags().String("cert", "", "client certificate file")
+	loginCmd.Flags().String("key", "", "client key file")
+	loginCmd.Flags().Bool("insecure", false, "skip TLS verification")
+	loginCmd.Flags().Bool("no-verify", false,
+		"don't check that the server can be reached")
+	parent.AddCommand(loginCmd)
+
+	// xr logout [NAME]
+	logoutCmd := &cobra.Command{
+		Use:   "logout [NAME]",
+		Short: "Remove the credentials from a profile",
+		Run:   logoutFunc,
+
+		Annotations:       noProfile,
+		ValidArgsFunction: completeProfile,
+	}
+	parent.AddCommand(logoutCmd)
+
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage the profiles in the config file",
+	}
+
+	profileListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the profiles",
+		Run:   profileListFunc,
+
+		Annotations: noProfile,
+	}
+	addOutputFlags(profileListCmd, "table", true)
+	profileCmd.AddCommand(profileListCmd)
+
+	profileUseCmd := &cobra.Command{
+		Use:   "use NAME",
+		Short: "Make a profile the current one",
+		Run:   profileUseFunc,
+
+		Annotations:       noProfile,
+		ValidArgsFunction: completeProfile,
+	}
+	profileCmd.AddCommand(profileUseCmd)
+
+	profileShowCmd := &cobra.Command{
+		Use:   "show [NAME]",
+		Short: "Show a profile, secrets are masked",
+		Run:   profileShowFunc,
+
+		Annotations:       noProfile,
+		ValidArgsFunction: completeProfile,
+	}
+	addOutputFlags(profileShowCmd, "yaml", false)
+	profileCmd.AddCommand(profileShowCmd)
+
+	profileDeleteCmd := &cobra.Command{
+		Use:   "delete NAME...",
+		Short: "Delete profiles",
+		Run:   profileDeleteFunc,
+
+		Annotations:       noProfile,
+		ValidArgsFunction: completeProfile,
+	}
+	profileCmd.AddCommand(profileDeleteCmd)
+
+	parent.AddCommand(profileCmd)
+}
+
+// Returns the name of the profile to use for commands that take an
+// optional profile NAME arg
+func profileArg(config *xrlib.Config, args []string) string {
+	if len(args) > 1 {
+		Error("Too many arguments - just a profile NAME is allowed")
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+	if ProfileName != "" {
+		return ProfileName
+	}
+	return config.Current
+}
+
+func readSecret(what string) string {
+	fmt.Fprintf(os.Stderr, "%s: ", what)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		ErrStop(err, "Error reading %s: %s", what, err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func loginFunc(cmd *cobra.Command, args []string) {
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	name := profileArg(config, args)
+	if name == "" {
+		name = "default"
+	}
+
+	profile := config.Profiles[name]
+	if profile == nil {
+		profile = &xrlib.Profile{}
+	}
+
+	// Only use what was explicitly set on the command line, otherwise
+	// we'd pick up the server from the current profile
+	if cmd.Flags().Changed("server") || DefaultServer != "" {
+		profile.Server = Server
+	}
+	if profile.Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+
+	if cmd.Flags().Changed("registry") {
+		profile.Registry, _ = cmd.Flags().GetString("registry")
+	}
+	if cmd.Flags().Changed("token") {
+		profile.Token, _ = cmd.Flags().GetString("token")
+		if profile.Token == "-" {
+			profile.Token = readSecret("Token")
+		}
+		profile.Username, profile.Password = "", ""
+	}
+	if cmd.Flags().Changed("user") {
+		profile.Username, _ = cmd.Flags().GetString("user")
+		profile.Password, _ = cmd.Flags().GetString("password")
+		if profile.Password == "-" {
+			profile.Password = readSecret("Password")
+		}
+		profile.Token = ""
+	} else if cmd.Flags().Changed("password") {
+		Error("--password requires --user")
+	}
+	if cmd.Flags().Changed("cacert") {
+		profile.CACert, _ = cmd.Flags().GetString("cacert")
+	}
+	if cmd.Flags().Changed("cert") {
+		profile.Cert, _ = cmd.Flags().GetString("cert")
+	}
+	if cmd.Flags().Changed("key") {
+		profile.Key, _ = cmd.Flags().GetString("key")
+	}
+	if cmd.Flags().Changed("insecure") {
+		profile.Insecure, _ = cmd.Flags().GetBool("insecure")
+	}
+
+	if noVerify, _ := cmd.Flags().GetBool("no-verify"); !noVerify {
+		xrlib.CurrentProfile = profile
+		xrlib.ResetHTTPClient()
+		_, err := xrlib.GetRegistry(profile.URL())
+		ErrStop(err, "Error talking to server (%s): %s", profile.URL(), err)
+	}
+
+	config.Profiles[name] = profile
+	config.Current = name
+	ErrStop(config.Save())
+	Verbose("Profile %q saved in %s", name, config.Path())
+}
+
+func logoutFunc(cmd *cobra.Command, args []string) {
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	name := profileArg(config, args)
+	if name == "" {
+		Error("No profile is in use")
+	}
+	profile, err := config.GetProfile(name)
+	ErrStop(err)
+
+	profile.Token = ""
+	profile.Username = ""
+	profile.Password = ""
+	ErrStop(config.Save())
+	Verbose("Credentials removed from profile %q", name)
+}
+
+func profileListFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		Error("Too many arguments")
+	}
+	out := getOutput(cmd)
+
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	rows := map[string]map[string]any{}
+	for name, profile := range config.Profiles {
+		current := ""
+		if name == config.Current {
+			current = "*"
+		}
+		auth := "none"
+		if profile.Token != "" {
+			auth = "token"
+		} else if profile.Username != "" {
+			auth = "basic (" + profile.Username + ")"
+		} else if profile.Cert != "" {
+			auth = "cert"
+		}
+		rows[name] = map[string]any{
+			"current": current,
+			"name":    name,
+			"server":  profile.URL(),
+			"auth":    auth,
+		}
+	}
+
+	out.Print(rows, &Table{
+		Columns: []*Column{attrColumn("current"), attrColumn("name"),
+			attrColumn("server"), attrColumn("auth")},
+		Rows: rows,
+	})
+}
+
+func profileUseFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		Error("Must specify exactly one profile NAME")
+	}
+
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	_, err = config.GetProfile(args[0])
+	ErrStop(err)
+
+	config.Current = args[0]
+	ErrStop(config.Save())
+	Verbose("Now using profile %q", args[0])
+}
+
+func profileShowFunc(cmd *cobra.Command, args []string) {
+	out := getOutput(cmd)
+
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	name := profileArg(config, args)
+	if name == "" {
+		Error("No profile is in use")
+	}
+	profile, err := config.GetProfile(name)
+	ErrStop(err)
+
+	masked := *profile
+	if masked.Token != "" {
+		masked.Token = "****"
+	}
+	if masked.Password != "" {
+		masked.Password = "****"
+	}
+
+	out.Print(masked, nil)
+}
+
+func profileDeleteFunc(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		Error("Must specify at least one profile NAME")
+	}
+
+	config, err := xrlib.LoadConfig(xrlib.ConfigPath())
+	ErrStop(err)
+
+	for _, name := range args {
+		_, err = config.GetProfile(name)
+		ErrStop(err)
+		delete(config.Profiles, name)
+		if config.Current == name {
+			config.Current = ""
+		}
+	}
+	ErrStop(config.Save())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+)
+
+func addReferencesCmd(parent *cobra.Command) {
+	// xr references XID...
+	referencesCmd := &cobra.Command{
+		Use:   "references XID...",
+		Short: "Show the entities that reference the Resources/Versions",
+		Run:   referencesFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	addOutputFlags(referencesCmd, "table", true)
+
+	parent.AddCommand(referencesCmd)
+}
+
+func referencesFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+
+	if len(args) == 0 {
+		Error("Must specify at least one XID")
+	}
+
+	out := getOutput(cmd)
+
+	reg, err := xrlib.GetRegistry(Server)
+	if err != nil {
+		Error(err.Error())
+	}
+
+	// XID -> Source XID -> attribute names
+	refs := map[string]map[string][]string{}
+	for _, xid := range args {
+		xid = "/" + strings.Trim(xid, "/")
+		body, err := reg.HttpDo("GET", xid+"?referencedby", nil)
+		if err != nil {
+			if len(args) > 1 {
+				Error(xid + ": " + err.Error())
+			} else {
+				Error(err.Error())
+			}
+		}
+
+		sources := map[string][]string(nil)
+		if err = json.Unmarshal(body, &sources); err != nil {
+			Error(err.Error())
+		}
+		refs[xid] = sources
+	}
+
+	rows := map[string]map[string]any{}
+	for xid, sources := range refs {
+		for source, attrs := range sources {
+			for i, attr := range attrs {
+				key := fmt.Sprintf("%s\x00%s\x00%05d", xid, source, i)
+				rows[key] = map[string]any{
+					"xid":          xid,
+					"referencedby": source,
+					"attribute":    attr,
+				}
+			}
+		}
+	}
+
+	out.Print(refs, &Table{
+		Columns: []*Column{
+			attrColumn("xid"),
+			{Name: "REFERENCED BY", Value: func(key string,
+				row map[string]any) any {
+				return row["referencedby"]
+			}},
+			attrColumn("attribute"),
+		},
+		Rows: rows,
+	})
+}
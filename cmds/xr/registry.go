@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,11 +25,14 @@ func addRegistryCmd(parent *cobra.Command) {
 		Short:  "Export data from the Registry",
 		Run:    registryGetFunc,
 		Hidden: true,
+
+		ValidArgsFunction: completeXID,
 	}
 	registryGetCmd.Flags().BoolP("model", "m", false, "Show model")
 	registryGetCmd.Flags().BoolP("capabilities", "c", false, "Show capabilities")
 	registryGetCmd.Flags().StringArrayP("inline", "i", nil, "Inline value")
 	registryGetCmd.Flags().StringArrayP("filter", "f", nil, "Filter value")
+	addOutputFlags(registryGetCmd, "json", false)
 	registryCmd.AddCommand(registryGetCmd)
 
 	// registry export (alias for 'get')
@@ -36,11 +40,14 @@ func addRegistryCmd(parent *cobra.Command) {
 		Use:   "export [ [PATH][?QUERY] ]",
 		Short: "Retrieve the Registry",
 		Run:   registryGetFunc,
+
+		ValidArgsFunction: completeXID,
 	}
 	registryExportCmd.Flags().BoolP("model", "m", false, "Show model")
 	registryExportCmd.Flags().BoolP("capabilities", "c", false, "Show capabilities")
 	registryExportCmd.Flags().StringArrayP("inline", "i", nil, "Inline value")
 	registryExportCmd.Flags().StringArrayP("filter", "f", nil, "Filter value")
+	addOutputFlags(registryExportCmd, "json", false)
 	registryCmd.AddCommand(registryExportCmd)
 
 	// registry set
@@ -48,6 +55,8 @@ func addRegistryCmd(parent *cobra.Command) {
 		Use:   "set attributePath[=value | -]",
 		Short: "Modify an attribute on the Registry entity",
 		Run:   registrySetFunc,
+
+		ValidArgsFunction: completeRegistryAttr,
 	}
 	registryCmd.AddCommand(registrySetCmd)
 
@@ -76,6 +85,8 @@ func addRegistryCmd(parent *cobra.Command) {
 	registryImportCmd.Flags().StringArrayP("filter", "f", nil, "Filter value")
 	registryCmd.AddCommand(registryImportCmd)
 
+	addRegistrySyncCmds(registryCmd)
+
 	parent.AddCommand(registryCmd)
 
 	// Put some of these commands on the 'xr' cmd itself as short-cuts
@@ -90,6 +101,7 @@ func registryGetFunc(cmd *cobra.Command, args []string) {
 	if Server == "" {
 		Error("No Server address provided. Try either -s or XR_SERVER env var")
 	}
+	out := getOutput(cmd)
 
 	url := Server
 	if len(args) == 1 {
@@ -121,15 +133,22 @@ func registryGetFunc(cmd *cobra.Command, args []string) {
 		next = "&"
 	}
 
-	res, err := http.Get(url)
-	ErrStop(err, "Error talking to server (%s): %s", Server, err)
-	if err != nil {
-		Error(err.Error())
+	// Use xrlib so we pick up the auth/TLS info from the profile. Show
+	// the response body even if it's an error
+	res, err := xrlib.HttpDoFull("GET", url, nil, nil)
+	if res == nil {
+		ErrStop(err, "Error talking to server (%s): %s", Server, err)
+	}
+
+	// Errors, and json, are shown just as the server sent them
+	if err != nil || out.Format == "json" {
+		fmt.Printf("%s", string(res.Body))
+		return
 	}
 
-	body, err := io.ReadAll(res.Body)
-	ErrStop(err, "Error reading server response: %s", err)
-	fmt.Printf("%s", string(body))
+	data := any(nil)
+	ErrStop(json.Unmarshal(res.Body, &data))
+	out.Print(data, nil)
 }
 
 func registrySetFunc(cmd *cobra.Command, args []string) {
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+func addResourceCmd(parent *cobra.Command) {
+	resourceCmd := &cobra.Command{
+		Use:   "resource",
+		Short: "resource commands",
+	}
+
+	// xr resource create XID [--data/--file] [--doc FILE [--contenttype CT]]
+	resourceCreateCmd := &cobra.Command{
+		Use:   "create XID",
+		Short: "Create a Resource (XID is /GROUPS/gID/RESOURCES/rID)",
+		Run:   resourceCreateFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	resourceCreateCmd.Flags().StringP("data", "d", "",
+		"Resource data (json),@FILE,-")
+	resourceCreateCmd.Flags().StringP("file", "f", "",
+		"filename for Resource data (json), \"-\" for stdin")
+	resourceCreateCmd.Flags().String("doc", "",
+		"filename of the document to upload")
+	resourceCreateCmd.Flags().StringP("contenttype", "c", "",
+		"contenttype of the document (default: based on --doc)")
+	resourceCmd.AddCommand(resourceCreateCmd)
+
+	// xr resource get XID... [--doc FILE]
+	resourceGetCmd := &cobra.Command{
+		Use:   "get XID...",
+		Short: "Get Resources, or download the default Version's document",
+		Run:   resourceGetFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	addOutputFlags(resourceGetCmd, "table", true)
+	resourceGetCmd.Flags().String("doc", "",
+		"download the document to this file, \"-\" for stdout")
+	resourceCmd.AddCommand(resourceGetCmd)
+
+	// xr resource list /GROUPS/gID[/RESOURCES]
+	resourceListCmd := &cobra.Command{
+		Use:   "list XID",
+		Short: "List the Resources of a Group (XID is /GROUPS/gID[/RESOURCES])",
+		Run:   resourceListFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	addOutputFlags(resourceListCmd, "table", true)
+	resourceCmd.AddCommand(resourceListCmd)
+
+	// xr resource delete XID...
+	resourceDeleteCmd := &cobra.Command{
+		Use:   "delete XID...",
+		Short: "Delete Resources",
+		Run:   resourceDeleteFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	resourceCmd.AddCommand(resourceDeleteCmd)
+
+	// xr resource meta XID [--xref XID] [--compatibility VAL] [--sticky BOOL]
+	resourceMetaCmd := &cobra.Command{
+		Use:   "meta XID",
+		Short: "Show or modify the \"meta\" of a Resource",
+		Run:   resourceMetaFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	resourceMetaCmd.Flags().String("xref", "",
+		"XID of the Resource to point to, \"\" to remove it")
+	resourceMetaCmd.Flags().String("compatibility", "",
+		"compatibility value, \"\" to remove it")
+	resourceMetaCmd.Flags().Bool("sticky", false,
+		"value of \"defaultversionsticky\"")
+	addOutputFlags(resourceMetaCmd, "json", false)
+	resourceMetaCmd.RegisterFlagCompletionFunc("xref", completeXID)
+	resourceCmd.AddCommand(resourceMetaCmd)
+
+	parent.AddCommand(resourceCmd)
+}
+
+// Parses "xidStr" and makes sure it's at least "level" levels deep (1=Group
+// type ... 6=Version ID), and that it matches the model. If "exact" is
+// true then it can't be deeper than "level" either.
+func parseXID(reg *xrlib.Registry, xidStr string, level int,
+	exact bool) (*xrlib.XID, *xrlib.GroupModel, *xrlib.ResourceModel) {
+
+	xid := xrlib.ParseXID(xidStr)
+	parts := []string{xid.Group, xid.GroupID, xid.Resource, xid.ResourceID,
+		xid.Version, xid.VersionID}
+
+	depth := 0
+	for depth < len(parts) && parts[depth] != "" {
+		depth++
+	}
+	if depth < level || (exact && depth > level) {
+		names := []string{"GROUPS", "gID", "RESOURCES", "rID", "versions",
+			"vID"}
+		Error("XID %q must be of the form: /%s", xidStr,
+			strings.Join(names[:level], "/"))
+	}
+
+	gm := reg.Model.FindGroupByPlural(xid.Group)
+	if gm == nil {
+		Error("Unknown Group type: %s", xid.Group)
+	}
+
+	rm := (*xrlib.ResourceModel)(nil)
+	if xid.Resource != "" {
+		if rm = gm.FindResourceByPlural(xid.Resource); rm == nil {
+			Error("Unknown Resource type: %s", xid.Resource)
+		}
+	}
+	if xid.Version != "" && xid.Version != "versions" {
+		Error("XID %q must use \"versions\" after the Resource ID", xidStr)
+	}
+
+	return xid, gm, rm
+}
+
+func hasDocument(rm *xrlib.ResourceModel) bool {
+	return rm != nil && (rm.HasDocument == nil || *rm.HasDocument)
+}
+
+// The path to use for the metadata of the Resource or Version
+func detailsPath(xid *xrlib.XID, rm *xrlib.ResourceModel) string {
+	if hasDocument(rm) && xid.ResourceID != "" &&
+		(xid.Version == "" || xid.VersionID != "") {
+		return xid.String() + "$details"
+	}
+	return xid.String()
+}
+
+// Creates the Resource or Version "xid". The metadata comes from
+// --data/--file and the document from --doc.
+func createEntity(cmd *cobra.Command, reg *xrlib.Registry, xid *xrlib.XID,
+	rm *xrlib.ResourceModel, what string) {
+
+	data, _ := cmd.Flags().GetString("data")
+	file, _ := cmd.Flags().GetString("file")
+	doc, _ := cmd.Flags().GetString("doc")
+	contentType, _ := cmd.Flags().GetString("contenttype")
+
+	if data != "" && file != "" {
+		Error("Both --data and --file can not be used at the same time")
+	}
+	if data == "-" {
+		file, data = "-", ""
+	} else if strings.HasPrefix(data, "@") {
+		file, data = data[1:], ""
+	}
+	if file != "" {
+		buf, err := xrlib.ReadFile(file)
+		ErrStop(err)
+		data = string(buf)
+	}
+	if data != "" {
+		ErrStop(xrlib.IsValidJSON([]byte(data)))
+	}
+
+	if doc != "" && !hasDocument(rm) {
+		Error("Resource type %q doesn't support documents", rm.Plural)
+	}
+	if contentType != "" && doc == "" {
+		Error("--contenttype can only be used with --doc")
+	}
+
+	if _, err := reg.HttpDo("GET", detailsPath(xid, rm), nil); err == nil {
+		Error("%s %q already exists", what, xid.String())
+	}
+
+	if doc == "" {
+		if data == "" {
+			data = "{}"
+		}
+		_, err := reg.HttpDo("PUT", detailsPath(xid, rm), []byte(data))
+		ErrStop(err)
+		Verbose("%s %s created", what, xid.String())
+		return
+	}
+
+	buf, err := xrlib.ReadFile(doc)
+	ErrStop(err)
+	if contentType == "" {
+		contentType = xrlib.ContentTypeFromFileName(doc)
+	}
+
+	_, err = reg.HttpDoFull("PUT", xid.String(),
+		map[string]string{"Content-Type": contentType}, buf)
+	ErrStop(err)
+
+	// Now add the metadata, if any
+	if data != "" {
+		_, err = reg.HttpDo("PATCH", detailsPath(xid, rm), []byte(data))
+		ErrStop(err)
+	}
+	Verbose("%s %s created", what, xid.String())
+}
+
+// Downloads the document of the Resource/Version "xid" into "fileName"
+func downloadDoc(reg *xrlib.Registry, xid *xrlib.XID, fileName string) {
+	res, err := reg.HttpDoFull("GET", xid.String(), nil, nil)
+	buf := []byte(nil)
+	if res != nil && res.Code/100 == 3 && res.Header.Get("Location") != "" {
+		// Document is stored elsewhere (xxxurl) so go get it
+		buf, err = xrlib.ReadFile(res.Header.Get("Location"))
+	} else if res != nil {
+		buf = res.Body
+	}
+	ErrStop(err)
+
+	if fileName == "-" {
+		os.Stdout.Write(buf)
+		return
+	}
+	ErrStop(os.WriteFile(fileName, buf, 0644))
+	Verbose("Saved %s to %s (%d bytes)", xid.String(), fileName, len(buf))
+}
+
+// Prints "objects" (XID -> entity) as a table of "columns" plus, for wide
+// output, the model's "attrs". Otherwise it's in the --output format.
+func printEntities(out *Output, objects map[string]map[string]any,
+	columns []*Column, attrs []string) {
+
+	out.Print(objects, &Table{
+		Columns: columns,
+		Attrs:   attrs,
+		Rows:    objects,
+	})
+}
+
+// Sorted names of the scalar attributes of the Resource types "rms"
+func resourceAttrs(rms ...*xrlib.ResourceModel) []string {
+	attrs := map[string]bool{}
+	for _, rm := range rms {
+		for _, name := range modelAttrs(rm.Attributes) {
+			attrs[name] = true
+		}
+	}
+	return registry.SortedKeys(attrs)
+}
+
+func getEntity(reg *xrlib.Registry, path string) map[string]any {
+	body, err := reg.HttpDo("GET", path, nil)
+	if err != nil {
+		Error("%s: %s", strings.TrimSuffix(path, "$details"), err)
+	}
+	obj := map[string]any(nil)
+	ErrStop(json.Unmarshal(body, &obj))
+	return obj
+}
+
+var resourceColumns = []*Column{
+	{Name: "TYPE", Value: func(xid string, obj map[string]any) any {
+		return xrlib.ParseXID(xid).Resource
+	}},
+	{Name: "ID", Value: func(xid string, obj map[string]any) any {
+		return xrlib.ParseXID(xid).ResourceID
+	}},
+	{Name: "DEFAULT", Value: func(xid string, obj map[string]any) any {
+		return obj["versionid"]
+	}},
+	{Name: "VERSIONS", Value: func(xid string, obj map[string]any) any {
+		return obj["versionscount"]
+	}},
+	{Name: "XID", Value: func(xid string, obj map[string]any) any {
+		return xid
+	}},
+}
+
+func resourceCreateFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one XID")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	xid, _, rm := parseXID(reg, args[0], 4, true)
+	createEntity(cmd, reg, xid, rm, "Resource")
+}
+
+func resourceGetFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) == 0 {
+		Error("Must specify at least one XID")
+	}
+
+	out := getOutput(cmd)
+	doc, _ := cmd.Flags().GetString("doc")
+	if doc != "" && len(args) != 1 {
+		Error("--doc can only be used with one XID")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	objects := map[string]map[string]any{}
+	rms := []*xrlib.ResourceModel{}
+	for _, arg := range args {
+		xid, _, rm := parseXID(reg, arg, 4, true)
+		rms = append(rms, rm)
+		if doc != "" {
+			if !hasDocument(rm) {
+				Error("Resource type %q doesn't support documents", rm.Plural)
+			}
+			downloadDoc(reg, xid, doc)
+			return
+		}
+		objects[xid.String()] = getEntity(reg, detailsPath(xid, rm))
+	}
+
+	printEntities(out, objects, resourceColumns, resourceAttrs(rms...))
+}
+
+func resourceListFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one XID")
+	}
+
+	out := getOutput(cmd)
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	xid, gm, _ := parseXID(reg, args[0], 2, false)
+	if xid.ResourceID != "" {
+		Error("XID %q must be of the form: /GROUPS/gID[/RESOURCES]", args[0])
+	}
+
+	plurals := []string{xid.Resource}
+	if xid.Resource == "" {
+		plurals = registry.SortedKeys(gm.Resources)
+	}
+
+	objects := map[string]map[string]any{}
+	rms := []*xrlib.ResourceModel{}
+	for _, plural := range plurals {
+		xid.Resource = plural
+		rms = append(rms, gm.Resources[plural])
+		body, err := reg.HttpDo("GET", xid.String(), nil)
+		ErrStop(err)
+
+		coll := map[string]map[string]any{}
+		ErrStop(json.Unmarshal(body, &coll))
+		for id, obj := range coll {
+			objects[xid.String()+"/"+id] = obj
+		}
+	}
+
+	printEntities(out, objects, resourceColumns, resourceAttrs(rms...))
+}
+
+func resourceDeleteFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) == 0 {
+		Error("Must specify at least one XID")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	// Check them all before we delete any
+	xids := []*xrlib.XID{}
+	for _, arg := range args {
+		xid, _, _ := parseXID(reg, arg, 4, true)
+		xids = append(xids, xid)
+	}
+
+	for _, xid := range xids {
+		if _, err := reg.HttpDo("DELETE", xid.String(), nil); err != nil {
+			Error("%s: %s", xid.String(), err)
+		}
+		Verbose("Resource %s deleted", xid.String())
+	}
+}
+
+func resourceMetaFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one XID")
+	}
+
+	out := getOutput(cmd)
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	xid, _, _ := parseXID(reg, args[0], 4, true)
+	path := xid.String() + "/meta"
+
+	changes := map[string]any{}
+	if cmd.Flags().Changed("xref") {
+		xref, _ := cmd.Flags().GetString("xref")
+		if xref == "" {
+			changes["xref"] = nil
+		} else {
+			parseXID(reg, xref, 4, true)
+			changes["xref"] = "/" + strings.Trim(xref, "/")
+		}
+	}
+	if cmd.Flags().Changed("compatibility") {
+		compat, _ := cmd.Flags().GetString("compatibility")
+		if compat == "" {
+			changes["compatibility"] = nil
+		} else {
+			changes["compatibility"] = compat
+		}
+	}
+	if cmd.Flags().Changed("sticky") {
+		sticky, _ := cmd.Flags().GetBool("sticky")
+		changes["defaultversionsticky"] = sticky
+	}
+
+	if len(changes) > 0 {
+		_, err := reg.HttpDo("PATCH", path, []byte(xrlib.ToJSON(changes)))
+		ErrStop(err)
+		Verbose("Resource %s meta updated", xid.String())
+		if !VerboseFlag {
+			return
+		}
+	}
+
+	out.Print(getEntity(reg, path), nil)
+}
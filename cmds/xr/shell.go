@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+var shellLong = `Start an interactive shell to browse the Registry as if it were a tree
+of directories: /GROUPS/gID/RESOURCES/rID/versions/vID
+
+Commands:
+  cd [PATH]        go to PATH, or to "/"
+  ls [-l] [PATH]   list what's in PATH (default: the current one)
+  pwd              show the current path
+  get [PATH]       show the entity, or collection, at PATH as JSON
+  cat PATH         show the document of a Resource or Version
+  help             show this text
+  exit, quit       leave the shell
+
+Anything else is run as an "xr" command, e.g. "resource list .", where
+args of ".", or that start with "./" or "../", are relative to the
+current path.`
+
+func addShellCmd(parent *cobra.Command) {
+	shellCmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Browse the Registry interactively",
+		Long:  shellLong,
+		Run:   shellFunc,
+	}
+	parent.AddCommand(shellCmd)
+}
+
+type shell struct {
+	reg         *xrlib.Registry
+	cwd         string // Always absolute and clean, e.g. "/" or "/dirs/d1"
+	interactive bool   // Is a person typing the commands?
+}
+
+func shellFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 0 {
+		Error("Too many arguments")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	sh := &shell{reg: reg, cwd: "/"}
+	if info, err := os.Stdin.Stat(); err == nil {
+		sh.interactive = info.Mode()&os.ModeCharDevice != 0
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if sh.interactive {
+			fmt.Printf("xr:%s> ", sh.cwd)
+		}
+		if !scanner.Scan() {
+			break
+		}
+		if !sh.run(scanner.Text()) {
+			return
+		}
+	}
+	if sh.interactive {
+		fmt.Println()
+	}
+	ErrStop(scanner.Err())
+}
+
+// Runs one line, returns false if the shell should exit
+func (sh *shell) run(line string) bool {
+	words, err := splitLine(line)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return true
+	}
+	if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+		return true
+	}
+
+	args := words[1:]
+	switch words[0] {
+	case "exit", "quit":
+		return false
+	case "help", "?":
+		fmt.Println(shellLong)
+	case "pwd":
+		fmt.Println(sh.cwd)
+	case "cd":
+		err = sh.cd(args)
+	case "ls":
+		err = sh.ls(args)
+	case "get":
+		err = sh.get(args)
+	case "cat":
+		err = sh.cat(args)
+	default:
+		err = sh.xr(words)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+	return true
+}
+
+// Splits "line" into words, single and double quotes group words
+func splitLine(line string) ([]string, error) {
+	words := []string{}
+	word := strings.Builder{}
+	inWord := false
+	quote := rune(0)
+
+	for _, ch := range line {
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(ch)
+		case ch == '\'' || ch == '"':
+			quote = ch
+			inWord = true
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Missing closing quote (%c)", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Returns the absolute version of "p", which can be relative to the
+// current path
+func (sh *shell) resolve(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = sh.cwd + "/" + p
+	}
+	return path.Clean(p)
+}
+
+// Checks that "p" (absolute) matches the model and returns its XID and
+// depth (0=Registry ... 6=Version)
+func (sh *shell) check(p string) (*xrlib.XID, int, error) {
+	xid := xrlib.ParseXID(p)
+	parts := []string{xid.Group, xid.GroupID, xid.Resource, xid.ResourceID,
+		xid.Version, xid.VersionID}
+	depth := 0
+	for depth < len(parts) && parts[depth] != "" {
+		depth++
+	}
+
+	if depth > 0 {
+		gm := sh.reg.Model.FindGroupByPlural(xid.Group)
+		if gm == nil {
+			return nil, 0, fmt.Errorf("Unknown Group type: %s", xid.Group)
+		}
+		if depth > 2 && gm.FindResourceByPlural(xid.Resource) == nil {
+			return nil, 0, fmt.Errorf("Unknown Resource type: %s",
+				xid.Resource)
+		}
+	}
+	if depth > 4 && xid.Version != "versions" {
+		return nil, 0, fmt.Errorf("%s: not found", p)
+	}
+	return xid, depth, nil
+}
+
+// The path of the metadata of the entity, or collection, at "xid"
+func (sh *shell) metadataPath(xid *xrlib.XID, depth int) string {
+	if depth == 4 || depth == 6 {
+		rm, _ := sh.reg.GetResourceModelFromXID(xid.String())
+		if hasDocument(rm) {
+			return xid.String() + "$details"
+		}
+	}
+	return xid.String()
+}
+
+func (sh *shell) getMap(xid *xrlib.XID, depth int) (map[string]any, error) {
+	body, err := sh.reg.HttpDo("GET", sh.metadataPath(xid, depth), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", xid.String(), err)
+	}
+	obj := map[string]any{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, fmt.Errorf("%s: %s", xid.String(), err)
+	}
+	return obj, nil
+}
+
+func (sh *shell) cd(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("cd: too many arguments")
+	}
+	p := "/"
+	if len(args) == 1 {
+		p = sh.resolve(args[0])
+	}
+
+	xid, depth, err := sh.check(p)
+	if err != nil {
+		return err
+	}
+	if depth == 6 {
+		return fmt.Errorf("%s: is a Version, not a collection", p)
+	}
+
+	// Make sure it's really there
+	if depth == 2 || depth == 4 {
+		if _, err := sh.getMap(xid, depth); err != nil {
+			return err
+		}
+	}
+	sh.cwd = xid.String()
+	return nil
+}
+
+// The names of the collections under the entity at "xid", with the
+// number of items in each, if known
+func (sh *shell) children(xid *xrlib.XID, depth int,
+	obj map[string]any) ([]string, map[string]any) {
+
+	names := []string{}
+	switch depth {
+	case 0:
+		names = registry.SortedKeys(sh.reg.Model.Groups)
+	case 2:
+		gm := sh.reg.Model.FindGroupByPlural(xid.Group)
+		names = registry.SortedKeys(gm.Resources)
+	case 4:
+		names = []string{"versions"}
+	}
+
+	counts := map[string]any{}
+	for _, name := range names {
+		counts[name] = obj[name+"count"]
+	}
+	return names, counts
+}
+
+func (sh *shell) ls(args []string) error {
+	long := false
+	if len(args) > 0 && args[0] == "-l" {
+		long = true
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("ls: too many arguments")
+	}
+	p := sh.cwd
+	if len(args) == 1 {
+		p = sh.resolve(args[0])
+	}
+
+	xid, depth, err := sh.check(p)
+	if err != nil {
+		return err
+	}
+	obj, err := sh.getMap(xid, depth)
+	if err != nil {
+		return err
+	}
+
+	// Registry, Group or Resource: show its collections
+	if depth%2 == 0 && depth < 6 {
+		names, counts := sh.children(xid, depth, obj)
+		if depth == 4 {
+			names = append([]string{"meta"}, names...)
+		}
+		if !long {
+			for _, name := range names {
+				if name != "meta" {
+					name += "/"
+				}
+				fmt.Println(name)
+			}
+			return nil
+		}
+
+		rows := map[string]map[string]any{}
+		for _, name := range names {
+			rows[name] = map[string]any{"name": name, "count": counts[name]}
+		}
+		(&Table{
+			Columns: []*Column{attrColumn("name"), attrColumn("count")},
+			Rows:    rows,
+		}).Print(os.Stdout, &Output{Format: "table"})
+		return nil
+	}
+
+	// A Version, just show it
+	if depth == 6 {
+		fmt.Println(xid.VersionID)
+		return nil
+	}
+
+	// A collection: show the IDs
+	if !long {
+		for _, id := range registry.SortedKeys(obj) {
+			if depth < 5 {
+				id += "/"
+			}
+			fmt.Println(id)
+		}
+		return nil
+	}
+
+	singular, _ := getEntityModel(sh.reg, xid)
+	rows := map[string]map[string]any{}
+	for id, child := range obj {
+		childObj, _ := child.(map[string]any)
+		rows[xid.String()+"/"+id] = getRow(singular, id, childObj)
+	}
+	(&Table{Columns: getColumns, Rows: rows}).Print(os.Stdout,
+		&Output{Format: "table"})
+	return nil
+}
+
+func (sh *shell) get(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("get: too many arguments")
+	}
+	p := sh.cwd
+	if len(args) == 1 {
+		p = sh.resolve(args[0])
+	}
+
+	xid, depth, err := sh.check(p)
+	if err != nil {
+		return err
+	}
+	obj, err := sh.getMap(xid, depth)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", xrlib.ToJSON(obj))
+	return nil
+}
+
+func (sh *shell) cat(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("cat: must specify exactly one PATH")
+	}
+	p := sh.resolve(args[0])
+
+	xid, depth, err := sh.check(p)
+	if err != nil {
+		return err
+	}
+	if depth != 4 && depth != 6 {
+		return fmt.Errorf("%s: is not a Resource or Version", p)
+	}
+	rm, _ := sh.reg.GetResourceModelFromXID(xid.String())
+	if !hasDocument(rm) {
+		return fmt.Errorf("Resource type %q doesn't support documents",
+			rm.Plural)
+	}
+
+	res, err := sh.reg.HttpDoFull("GET", xid.String(), nil, nil)
+	if res != nil && res.Code/100 == 3 && res.Header.Get("Location") != "" {
+		// Document is stored elsewhere (xxxurl) so go get it
+		buf, err := xrlib.ReadFile(res.Header.Get("Location"))
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(buf)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", p, err)
+	}
+	os.Stdout.Write(res.Body)
+	return nil
+}
+
+// Runs an "xr" command, relative paths in its args are resolved first
+func (sh *shell) xr(words []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-s", Server}
+	if ProfileName != "" {
+		args = append(args, "-p", ProfileName)
+	}
+	if VerboseFlag {
+		args = append(args, "-v")
+	}
+	for _, word := range words {
+		if word == "." || word == ".." || strings.HasPrefix(word, "./") ||
+			strings.HasPrefix(word, "../") {
+			word = sh.resolve(word)
+		}
+		args = append(args, word)
+	}
+
+	// Don't let the command read the rest of a script that's being piped
+	// into the shell
+	cmd := exec.Command(exe, args...)
+	if sh.interactive {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// The command already said what went wrong
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		}
+	}
+	return nil
+}
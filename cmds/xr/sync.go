@@ -0,0 +1,643 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+var syncLong = `Make DST look like SRC. SRC can be a server URL or a file
+created by "xr export", DST must be a server URL. Only the entities
+selected by --path and --label are copied, and Version IDs and default
+Version settings are kept. Entities that aren't in SRC are only deleted if
+--delete is used.`
+
+var diffLong = `Show the differences between SRC and DST: their models,
+capabilities and entities (metadata and document hashes). Each of SRC and
+DST can be a server URL or a file created by "xr export". The output shows
+what "xr registry sync SRC DST" would do, entities that are only in DST are
+shown as deletes. Exits with 1 if there are differences.`
+
+func addRegistrySyncCmds(registryCmd *cobra.Command) {
+	// xr registry diff SRC DST [--path XID]... [--label NAME=VALUE]...
+	registryDiffCmd := &cobra.Command{
+		Use:   "diff SRC DST",
+		Short: "Show the differences between two Registries",
+		Long:  diffLong,
+		Run:   registryDiffFunc,
+	}
+	registryDiffCmd.Flags().StringArray("path", nil,
+		"only entities under this XID")
+	registryDiffCmd.Flags().StringArray("label", nil,
+		"only entities with this label (NAME=VALUE)")
+	registryCmd.AddCommand(registryDiffCmd)
+
+	// xr registry sync SRC DST [--path XID]... [--label NAME=VALUE]...
+	registrySyncCmd := &cobra.Command{
+		Use:   "sync SRC DST",
+		Short: "Copy the entities from one Registry to another",
+		Long:  syncLong,
+		Run:   registrySyncFunc,
+	}
+	registrySyncCmd.Flags().StringArray("path", nil,
+		"only entities under this XID")
+	registrySyncCmd.Flags().StringArray("label", nil,
+		"only entities with this label (NAME=VALUE)")
+	registrySyncCmd.Flags().Bool("delete", false,
+		"delete entities that are only in DST")
+	registrySyncCmd.Flags().Bool("model", false, "update DST's model first")
+	registrySyncCmd.Flags().Bool("capabilities", false,
+		"update DST's capabilities first")
+	registrySyncCmd.Flags().Bool("dry-run", false,
+		"Just show what would be changed")
+	registryCmd.AddCommand(registrySyncCmd)
+}
+
+// The output of /export from a server, or from a file
+type regSnapshot struct {
+	Name  string
+	Data  map[string]any
+	Model *xrlib.Model
+	reg   *xrlib.Registry // nil if it's from a file
+}
+
+func loadSnapshot(name string) (*regSnapshot, error) {
+	snap := &regSnapshot{Name: name}
+	buf := []byte(nil)
+	var err error
+
+	if stat, statErr := os.Stat(name); name == "-" ||
+		(statErr == nil && !stat.IsDir()) {
+		buf, err = xrlib.ReadFile(name)
+	} else {
+		snap.reg, err = xrlib.GetRegistry(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		buf, err = snap.reg.HttpDo("GET", "/export", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	if err = registry.Unmarshal(buf, &snap.Data); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	buf, _ = json.Marshal(snap.Data["model"])
+	if err = json.Unmarshal(buf, &snap.Model); err != nil || snap.Model == nil {
+		return nil, fmt.Errorf("%s: doesn't include a model", name)
+	}
+	return snap, nil
+}
+
+type syncFilter struct {
+	Paths  []string
+	Labels map[string]string
+}
+
+func newSyncFilter(cmd *cobra.Command) *syncFilter {
+	filter := &syncFilter{Labels: map[string]string{}}
+
+	paths, _ := cmd.Flags().GetStringArray("path")
+	for _, path := range paths {
+		filter.Paths = append(filter.Paths, xrlib.ParseXID(path).String())
+	}
+
+	labels, _ := cmd.Flags().GetStringArray("label")
+	for _, label := range labels {
+		name, value, found := strings.Cut(label, "=")
+		if !found || name == "" {
+			Error("--label must be of the form NAME=VALUE: %s", label)
+		}
+		filter.Labels[name] = value
+	}
+	return filter
+}
+
+// Returns whether "xid" was selected by --path, and whether it's just the
+// parent of something that was
+func (f *syncFilter) InPath(xid string) (bool, bool) {
+	if len(f.Paths) == 0 {
+		return true, false
+	}
+	parent := false
+	for _, path := range f.Paths {
+		if path == "/" || xid == path || strings.HasPrefix(xid, path+"/") {
+			return true, false
+		}
+		if strings.HasPrefix(path, xid+"/") {
+			parent = true
+		}
+	}
+	return false, parent
+}
+
+func (f *syncFilter) HasLabels(attrs map[string]any) bool {
+	labels := getMap(attrs, "labels")
+	for name, value := range f.Labels {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Removes the attributes that are set by the server, or that are about the
+// entity's children (the "drop" ones, eg. the model's collection
+// attributes), since those are never copied. Any "keep" ones are kept even
+// if they'd normally be removed.
+func syncAttrs(attrs map[string]any, drop []string,
+	keep ...string) map[string]any {
+
+	res := map[string]any{}
+	for name, val := range attrs {
+		if !xrlib.ArrayContains(keep, name) {
+			if xrlib.ArrayContains(drop, name) {
+				continue
+			}
+			switch name {
+			case "self", "xid", "epoch", "createdat", "modifiedat",
+				"isdefault", "meta", "versions":
+				continue
+			}
+		}
+		res[name] = val
+	}
+	return res
+}
+
+// A short hash of a Version's document, nil if it doesn't have one
+func docHash(rm *xrlib.ResourceModel, attrs map[string]any) any {
+	buf := []byte(nil)
+	if val, ok := attrs[rm.Singular+"base64"].(string); ok {
+		buf, _ = base64.StdEncoding.DecodeString(val)
+	} else if val, ok := attrs[rm.Singular]; ok {
+		buf, _ = json.Marshal(val)
+	} else if val, ok := attrs[rm.Singular+"url"]; ok {
+		return fmt.Sprintf("url:%v", val)
+	} else {
+		return nil
+	}
+	sum := sha256.Sum256(buf)
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+type syncPlanner struct {
+	src    *regSnapshot
+	dst    *regSnapshot
+	filter *syncFilter
+	delete bool
+
+	// True if DST's model will be replaced by SRC's, or we're just
+	// showing the differences, so it's ok if DST's model is missing types
+	newModel bool
+
+	steps   []*applyStep
+	deletes []*applyStep
+}
+
+func (sp *syncPlanner) addStep(step *applyStep) {
+	if step.Action == APPLY_DELETE {
+		sp.deletes = append(sp.deletes, step)
+	} else {
+		sp.steps = append(sp.steps, step)
+	}
+}
+
+// The steps to make DST's model and capabilities look like SRC's
+func (sp *syncPlanner) planModel(doModel, doCaps bool) {
+	for _, name := range []string{"model", "capabilities"} {
+		if (name == "model" && !doModel) ||
+			(name == "capabilities" && !doCaps) {
+			continue
+		}
+		changes := xrlib.DiffValues("", sp.dst.Data[name], sp.src.Data[name])
+		if len(changes) == 0 {
+			continue
+		}
+		body, _ := sp.src.Data[name].(map[string]any)
+		sp.addStep(&applyStep{
+			Action:  APPLY_UPDATE,
+			Kind:    name,
+			XID:     "/" + name,
+			Changes: changes,
+			Verb:    "PUT",
+			Path:    "/" + name,
+			Body:    body,
+			Epoch:   -1,
+		})
+	}
+}
+
+func (sp *syncPlanner) planGroups() error {
+	for _, gPlural := range registry.SortedKeys(sp.src.Model.Groups) {
+		gm := sp.src.Model.Groups[gPlural]
+		srcGroups := getMap(sp.src.Data, gPlural)
+		dstGroups := getMap(sp.dst.Data, gPlural)
+		children := registry.SortedKeys(gm.Resources)
+
+		for _, gID := range registry.SortedKeys(srcGroups) {
+			gXID := "/" + gPlural + "/" + gID
+			selected, parent := sp.filter.InPath(gXID)
+			if !selected && !parent {
+				continue
+			}
+			if sp.dst.Model.Groups[gPlural] == nil && !sp.newModel {
+				return fmt.Errorf("Group type %q isn't in %s's model",
+					gPlural, sp.dst.Name)
+			}
+
+			srcGroup := getMap(srcGroups, gID)
+			dstGroup, exists := dstGroups[gID].(map[string]any)
+			match := selected && sp.filter.HasLabels(srcGroup)
+
+			// Do the Resources first so we know if the Group is needed
+			saveSteps, saveDeletes := sp.steps, sp.deletes
+			sp.steps, sp.deletes = nil, nil
+			for _, rPlural := range children {
+				err := sp.planResources(gm.Resources[rPlural], gXID, rPlural,
+					getMap(srcGroup, rPlural), getMap(dstGroup, rPlural),
+					match)
+				if err != nil {
+					return err
+				}
+			}
+			rSteps, rDeletes := sp.steps, sp.deletes
+			sp.steps, sp.deletes = saveSteps, saveDeletes
+
+			drop := append(gm.CollectionAttributes(), children...)
+			attrs := syncAttrs(srcGroup, drop)
+			if !exists && (match || len(rSteps) > 0) {
+				sp.addStep(&applyStep{
+					Action:  APPLY_CREATE,
+					Kind:    "group",
+					XID:     gXID,
+					Changes: xrlib.DiffAttributes(nil, attrs),
+					Verb:    "PUT",
+					Path:    gXID,
+					Body:    attrs,
+					Epoch:   -1,
+				})
+			} else if exists && match {
+				changes := xrlib.DiffAttributes(syncAttrs(dstGroup, drop),
+					attrs)
+				if len(changes) > 0 {
+					sp.addStep(&applyStep{
+						Action:  APPLY_UPDATE,
+						Kind:    "group",
+						XID:     gXID,
+						Changes: changes,
+						Verb:    "PUT",
+						Path:    gXID,
+						Body:    attrs,
+						Epoch:   getEpoch(dstGroup),
+					})
+				}
+			}
+			sp.steps = append(sp.steps, rSteps...)
+			sp.deletes = append(sp.deletes, rDeletes...)
+		}
+
+		if !sp.delete {
+			continue
+		}
+		for _, gID := range registry.SortedKeys(dstGroups) {
+			gXID := "/" + gPlural + "/" + gID
+			dstGroup := getMap(dstGroups, gID)
+			if _, ok := srcGroups[gID]; ok {
+				continue
+			}
+			if selected, _ := sp.filter.InPath(gXID); !selected ||
+				!sp.filter.HasLabels(dstGroup) {
+				continue
+			}
+			sp.addStep(&applyStep{
+				Action: APPLY_DELETE,
+				Kind:   "group",
+				XID:    gXID,
+				Verb:   "DELETE",
+				Path:   gXID,
+				Epoch:  getEpoch(dstGroup),
+			})
+		}
+	}
+	return nil
+}
+
+// The Version that's the default one, based on the Resource's meta
+func defaultVersion(resource map[string]any) map[string]any {
+	vID, _ := getMap(resource, "meta")["defaultversionid"].(string)
+	return getMap(getMap(resource, "versions"), vID)
+}
+
+func (sp *syncPlanner) planResources(rm *xrlib.ResourceModel, gXID string,
+	rPlural string, srcResources, dstResources map[string]any,
+	groupMatch bool) error {
+
+	gm := sp.dst.Model.FindGroupByPlural(xrlib.ParseXID(gXID).Group)
+	if len(srcResources) > 0 && !sp.newModel &&
+		(gm == nil || gm.Resources[rPlural] == nil) {
+		return fmt.Errorf("Resource type %q isn't in %s's model",
+			rPlural, sp.dst.Name)
+	}
+
+	for _, rID := range registry.SortedKeys(srcResources) {
+		rXID := gXID + "/" + rPlural + "/" + rID
+		srcRes := getMap(srcResources, rID)
+		selected, parent := sp.filter.InPath(rXID)
+		if !selected && !parent {
+			continue
+		}
+		if !groupMatch && !sp.filter.HasLabels(defaultVersion(srcRes)) {
+			continue
+		}
+		dstRes, _ := dstResources[rID].(map[string]any)
+		sp.planResource(rm, rXID, srcRes, dstRes)
+	}
+
+	if !sp.delete {
+		return nil
+	}
+	for _, rID := range registry.SortedKeys(dstResources) {
+		rXID := gXID + "/" + rPlural + "/" + rID
+		dstRes := getMap(dstResources, rID)
+		if _, ok := srcResources[rID]; ok {
+			continue
+		}
+		if selected, _ := sp.filter.InPath(rXID); !selected ||
+			(!groupMatch && !sp.filter.HasLabels(defaultVersion(dstRes))) {
+			continue
+		}
+		sp.addStep(&applyStep{
+			Action: APPLY_DELETE,
+			Kind:   "resource",
+			XID:    rXID,
+			Verb:   "DELETE",
+			Path:   rXID,
+			Epoch:  getEpoch(getMap(dstRes, "meta")),
+		})
+	}
+	return nil
+}
+
+func (sp *syncPlanner) planResource(rm *xrlib.ResourceModel, rXID string,
+	srcRes, dstRes map[string]any) {
+
+	srcMeta := getMap(srcRes, "meta")
+	dstMeta := getMap(dstRes, "meta")
+	action := APPLY_UPDATE
+	if dstRes == nil {
+		action = APPLY_CREATE
+	}
+
+	// Just a pointer to another Resource so there are no Versions to copy
+	if xref, ok := srcMeta["xref"]; ok {
+		if dstMeta["xref"] != xref {
+			change := xrlib.AttrChange{
+				Name: "xref", Old: dstMeta["xref"], New: xref}
+			sp.addStep(&applyStep{
+				Action:  action,
+				Kind:    "meta",
+				XID:     rXID + "/meta",
+				Changes: []xrlib.AttrChange{change},
+				Verb:    "PUT",
+				Path:    rXID + "/meta",
+				Body:    map[string]any{"xref": xref},
+				Epoch:   getEpoch(dstMeta),
+			})
+		}
+		return
+	}
+
+	srcVersions := getMap(srcRes, "versions")
+	dstVersions := getMap(dstRes, "versions")
+
+	// Create them oldest first so the newest one is the default, like SRC
+	vIDs := registry.SortedKeys(srcVersions)
+	sort.SliceStable(vIDs, func(i, j int) bool {
+		ci, _ := getMap(srcVersions, vIDs[i])["createdat"].(string)
+		cj, _ := getMap(srcVersions, vIDs[j])["createdat"].(string)
+		return ci < cj
+	})
+
+	versionSteps := 0
+	drop := rm.CollectionAttributes()
+	ignore := append([]string{"createdat", rm.Singular,
+		rm.Singular + "base64"}, drop...)
+	for _, vID := range vIDs {
+		vXID := rXID + "/versions/" + vID
+		if selected, _ := sp.filter.InPath(vXID); !selected {
+			continue
+		}
+
+		srcVer := getMap(srcVersions, vID)
+		dstVer, exists := dstVersions[vID].(map[string]any)
+		attrs := syncAttrs(srcVer, drop, "createdat")
+
+		step := &applyStep{
+			Action: APPLY_CREATE,
+			Kind:   "version",
+			XID:    vXID,
+			Verb:   "PUT",
+			Path:   vXID,
+			Body:   attrs,
+			Epoch:  -1,
+		}
+		if hasDocument(rm) {
+			step.Path += "$details"
+		}
+		if exists {
+			step.Action = APPLY_UPDATE
+			step.Epoch = getEpoch(dstVer)
+		}
+
+		step.Changes = xrlib.DiffAttributes(
+			syncAttrs(dstVer, ignore), syncAttrs(srcVer, ignore))
+		if hasDocument(rm) {
+			oldHash, newHash := docHash(rm, dstVer), docHash(rm, srcVer)
+			if !xrlib.SameValue(oldHash, newHash) {
+				step.Changes = append(step.Changes,
+					xrlib.AttrChange{
+						Name: "document", Old: oldHash, New: newHash})
+			}
+		}
+		if exists && len(step.Changes) == 0 {
+			continue
+		}
+		sp.addStep(step)
+		versionSteps++
+	}
+
+	if sp.delete {
+		for _, vID := range registry.SortedKeys(dstVersions) {
+			vXID := rXID + "/versions/" + vID
+			if _, ok := srcVersions[vID]; ok {
+				continue
+			}
+			if selected, _ := sp.filter.InPath(vXID); !selected {
+				continue
+			}
+			sp.addStep(&applyStep{
+				Action: APPLY_DELETE,
+				Kind:   "version",
+				XID:    vXID,
+				Verb:   "DELETE",
+				Path:   vXID,
+				Epoch:  getEpoch(getMap(dstVersions, vID)),
+			})
+		}
+	}
+
+	// A new Resource will end up with the last Version as its default
+	if dstRes == nil && len(vIDs) > 0 {
+		dstMeta = map[string]any{
+			"defaultversionid":     vIDs[len(vIDs)-1],
+			"defaultversionsticky": false,
+		}
+	}
+
+	// Only the default Version settings, and compatibility, are copied
+	sticky := srcMeta["defaultversionsticky"] == true
+	body := map[string]any{"defaultversionsticky": sticky}
+	if sticky {
+		body["defaultversionid"] = srcMeta["defaultversionid"]
+	}
+	if val, ok := srcMeta["compatibility"]; ok {
+		body["compatibility"] = val
+	}
+	if _, ok := dstMeta["xref"]; ok {
+		body["xref"] = nil
+	}
+
+	changes := []xrlib.AttrChange{}
+	for _, name := range []string{"compatibility", "defaultversionid",
+		"defaultversionsticky", "xref"} {
+		oldVal, newVal := dstMeta[name], srcMeta[name]
+		if name == "defaultversionsticky" {
+			oldVal, newVal = oldVal == true, sticky
+		}
+		if !xrlib.SameValue(oldVal, newVal) {
+			changes = append(changes, xrlib.AttrChange{
+				Name: name, Old: oldVal, New: newVal})
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	sp.addStep(&applyStep{
+		Action:       action,
+		Kind:         "meta",
+		XID:          rXID + "/meta",
+		Changes:      changes,
+		Verb:         "PATCH",
+		Path:         rXID + "/meta",
+		Body:         body,
+		Epoch:        getEpoch(dstMeta),
+		refreshEpoch: versionSteps > 0,
+	})
+}
+
+// Loads SRC and DST and figures out what needs to be done to make DST
+// look like SRC
+func planSync(cmd *cobra.Command, args []string, isDiff bool) (
+	*syncPlanner, []*applyStep) {
+
+	if len(args) != 2 {
+		Error("Must specify exactly one SRC and one DST")
+	}
+
+	src, err := loadSnapshot(args[0])
+	ErrStop(err)
+	dst, err := loadSnapshot(args[1])
+	ErrStop(err)
+
+	sp := &syncPlanner{
+		src:    src,
+		dst:    dst,
+		filter: newSyncFilter(cmd),
+		delete: isDiff,
+	}
+
+	// A diff shows everything
+	doModel, doCaps := true, true
+	if !isDiff {
+		sp.delete, _ = cmd.Flags().GetBool("delete")
+		doModel, _ = cmd.Flags().GetBool("model")
+		doCaps, _ = cmd.Flags().GetBool("capabilities")
+	}
+	sp.newModel = doModel
+
+	sp.planModel(doModel, doCaps)
+	ErrStop(sp.planGroups())
+
+	// Do the deletes last so that things like changing the default
+	// Version are done first
+	return sp, append(sp.steps, sp.deletes...)
+}
+
+func printPlan(steps []*applyStep) {
+	counts := map[string]int{}
+	for _, step := range steps {
+		fmt.Printf("%s\n", step.String())
+		counts[step.Action]++
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to delete\n",
+		counts[APPLY_CREATE], counts[APPLY_UPDATE], counts[APPLY_DELETE])
+}
+
+func registryDiffFunc(cmd *cobra.Command, args []string) {
+	_, steps := planSync(cmd, args, true)
+
+	if len(steps) == 0 {
+		fmt.Printf("No differences\n")
+		return
+	}
+	printPlan(steps)
+	os.Exit(1)
+}
+
+func registrySyncFunc(cmd *cobra.Command, args []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	sp, steps := planSync(cmd, args, false)
+	if sp.dst.reg == nil {
+		Error("DST must be a server, not a file: %s", sp.dst.Name)
+	}
+
+	if len(steps) == 0 {
+		fmt.Printf("No changes\n")
+		return
+	}
+	printPlan(steps)
+
+	if dryRun {
+		return
+	}
+
+	reg := sp.dst.reg
+	for i, step := range steps {
+		if err := step.Do(reg); err != nil {
+			Error("%s %s: %s\n%d of %d changes were made", step.Action,
+				step.XID, err, i, len(steps))
+		}
+		Verbose("%sd %s %s", step.Action, step.Kind, step.XID)
+
+		// Later steps need to know about the new types
+		if step.Kind == "model" {
+			ErrStop(reg.RefreshModel())
+		}
+	}
+	fmt.Printf("Applied %d changes\n", len(steps))
+}
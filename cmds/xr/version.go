@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+)
+
+func addVersionCmd(parent *cobra.Command) {
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "version commands",
+	}
+
+	// xr version create XID [--data/--file] [--doc FILE [--contenttype CT]]
+	versionCreateCmd := &cobra.Command{
+		Use:   "create XID",
+		Short: "Create a Version (XID is /GROUPS/gID/RESOURCES/rID/versions/vID)",
+		Run:   versionCreateFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	versionCreateCmd.Flags().StringP("data", "d", "",
+		"Version data (json),@FILE,-")
+	versionCreateCmd.Flags().StringP("file", "f", "",
+		"filename for Version data (json), \"-\" for stdin")
+	versionCreateCmd.Flags().String("doc", "",
+		"filename of the document to upload")
+	versionCreateCmd.Flags().StringP("contenttype", "c", "",
+		"contenttype of the document (default: based on --doc)")
+	versionCmd.AddCommand(versionCreateCmd)
+
+	// xr version get XID... [--doc FILE]
+	versionGetCmd := &cobra.Command{
+		Use:   "get XID...",
+		Short: "Get Versions, or download a Version's document",
+		Run:   versionGetFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	addOutputFlags(versionGetCmd, "table", true)
+	versionGetCmd.Flags().String("doc", "",
+		"download the document to this file, \"-\" for stdout")
+	versionCmd.AddCommand(versionGetCmd)
+
+	// xr version list /GROUPS/gID/RESOURCES/rID
+	versionListCmd := &cobra.Command{
+		Use:   "list XID",
+		Short: "List the Versions of a Resource",
+		Run:   versionListFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	addOutputFlags(versionListCmd, "table", true)
+	versionCmd.AddCommand(versionListCmd)
+
+	// xr version delete XID...
+	versionDeleteCmd := &cobra.Command{
+		Use:   "delete XID...",
+		Short: "Delete Versions",
+		Run:   versionDeleteFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	versionCmd.AddCommand(versionDeleteCmd)
+
+	// xr version set-default XID | RESOURCE-XID --latest
+	versionSetDefaultCmd := &cobra.Command{
+		Use:   "set-default XID",
+		Short: "Make a Version the default one of its Resource",
+		Run:   versionSetDefaultFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	versionSetDefaultCmd.Flags().Bool("latest", false,
+		"Go back to the newest Version being the default (XID is a Resource)")
+	versionCmd.AddCommand(versionSetDefaultCmd)
+
+	parent.AddCommand(versionCmd)
+}
+
+// ID, DEFAULT, CREATED, XID
+var versionColumns = []*Column{
+	{Name: "ID", Value: func(xid string, obj map[string]any) any {
+		return xrlib.ParseXID(xid).VersionID
+	}},
+	{Name: "DEFAULT", Value: func(xid string, obj map[string]any) any {
+		return obj["isdefault"] == true
+	}},
+	{Name: "CREATED", Value: func(xid string, obj map[string]any) any {
+		return obj["createdat"]
+	}},
+	{Name: "XID", Value: func(xid string, obj map[string]any) any {
+		return xid
+	}},
+}
+
+func versionCreateFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one XID")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	xid, _, rm := parseXID(reg, args[0], 6, true)
+	createEntity(cmd, reg, xid, rm, "Version")
+}
+
+func versionGetFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) == 0 {
+		Error("Must specify at least one XID")
+	}
+
+	out := getOutput(cmd)
+	doc, _ := cmd.Flags().GetString("doc")
+	if doc != "" && len(args) != 1 {
+		Error("--doc can only be used with one XID")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	objects := map[string]map[string]any{}
+	rms := []*xrlib.ResourceModel{}
+	for _, arg := range args {
+		xid, _, rm := parseXID(reg, arg, 6, true)
+		rms = append(rms, rm)
+		if doc != "" {
+			if !hasDocument(rm) {
+				Error("Resource type %q doesn't support documents", rm.Plural)
+			}
+			downloadDoc(reg, xid, doc)
+			return
+		}
+		objects[xid.String()] = getEntity(reg, detailsPath(xid, rm))
+	}
+
+	printEntities(out, objects, versionColumns, resourceAttrs(rms...))
+}
+
+func versionListFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one XID")
+	}
+
+	out := getOutput(cmd)
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	xid, _, rm := parseXID(reg, args[0], 4, false)
+	if xid.VersionID != "" {
+		Error("XID %q must be of the form: /GROUPS/gID/RESOURCES/rID",
+			args[0])
+	}
+	xid.Version = "versions"
+
+	body, err := reg.HttpDo("GET", xid.String(), nil)
+	ErrStop(err)
+
+	coll := map[string]map[string]any{}
+	ErrStop(json.Unmarshal(body, &coll))
+
+	objects := map[string]map[string]any{}
+	for id, obj := range coll {
+		objects[xid.String()+"/"+id] = obj
+	}
+
+	printEntities(out, objects, versionColumns, resourceAttrs(rm))
+}
+
+func versionDeleteFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) == 0 {
+		Error("Must specify at least one XID")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	// Check them all before we delete any
+	xids := []*xrlib.XID{}
+	for _, arg := range args {
+		xid, _, _ := parseXID(reg, arg, 6, true)
+		xids = append(xids, xid)
+	}
+
+	for _, xid := range xids {
+		if _, err := reg.HttpDo("DELETE", xid.String(), nil); err != nil {
+			Error("%s: %s", xid.String(), err)
+		}
+		Verbose("Version %s deleted", xid.String())
+	}
+}
+
+func versionSetDefaultFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) != 1 {
+		Error("Must specify exactly one XID")
+	}
+
+	latest, _ := cmd.Flags().GetBool("latest")
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	changes := map[string]any{}
+	xid := (*xrlib.XID)(nil)
+	if latest {
+		xid, _, _ = parseXID(reg, args[0], 4, true)
+		changes["defaultversionsticky"] = false
+	} else {
+		xid, _, _ = parseXID(reg, args[0], 6, true)
+		changes["defaultversionid"] = xid.VersionID
+		changes["defaultversionsticky"] = true
+	}
+
+	path := xrlib.XID{
+		Group:      xid.Group,
+		GroupID:    xid.GroupID,
+		Resource:   xid.Resource,
+		ResourceID: xid.ResourceID,
+	}
+	_, err = reg.HttpDo("PATCH", path.String()+"/meta",
+		[]byte(xrlib.ToJSON(changes)))
+	ErrStop(err)
+	Verbose("Default Version of %s updated", path.String())
+}
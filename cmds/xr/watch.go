@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	// log "github.com/duglin/dlog"
+	"github.com/spf13/cobra"
+	"github.com/xregistry/server/cmds/xr/xrlib"
+	"github.com/xregistry/server/registry"
+)
+
+var watchLong = `Show the Groups, Resources and Versions under PATH as they're
+created, updated or deleted. The Registry is polled, and changes are found
+by comparing the "epoch" and "modifiedat" of each entity. A Resource's
+changes are based on its "meta".`
+
+func addWatchCmd(parent *cobra.Command) {
+	// xr watch [PATH] [--filter EXPR]... [--interval DURATION] [-o json]
+	watchCmd := &cobra.Command{
+		Use:   "watch [PATH]",
+		Short: "Show changes to the Registry as they happen",
+		Long:  watchLong,
+		Run:   watchFunc,
+
+		ValidArgsFunction: completeXID,
+	}
+	watchCmd.Flags().StringArrayP("filter", "f", nil, "Filter value")
+	watchCmd.Flags().Duration("interval", 2*time.Second,
+		"how often to check for changes")
+	watchCmd.Flags().Int("count", 0,
+		"stop after this many checks, 0 means never")
+	watchCmd.Flags().StringP("output", "o", "table",
+		"output: table,json,jsonpath=EXPR,template=TMPL")
+
+	parent.AddCommand(watchCmd)
+}
+
+type watchState struct {
+	Kind       string
+	Epoch      int
+	ModifiedAt string
+}
+
+type watchEvent struct {
+	Time       string `json:"time"`
+	Action     string `json:"action"`
+	Kind       string `json:"kind"`
+	XID        string `json:"xid"`
+	Epoch      int    `json:"epoch,omitempty"`
+	ModifiedAt string `json:"modifiedat,omitempty"`
+}
+
+type watcher struct {
+	reg      *xrlib.Registry
+	xid      *xrlib.XID
+	path     string // Includes the query parameters
+	depth    int    // Number of parts in "xid"
+	entities map[string]*watchState
+}
+
+func newWatcher(reg *xrlib.Registry, path string,
+	filters []string) *watcher {
+
+	xid := xrlib.ParseXID(path)
+	w := &watcher{
+		reg: reg,
+		xid: xid,
+	}
+
+	// Inline everything under PATH, except documents
+	inlines := []string{}
+	for _, part := range []string{xid.Group, xid.GroupID, xid.Resource,
+		xid.ResourceID, xid.Version, xid.VersionID} {
+		if part == "" {
+			break
+		}
+		w.depth++
+	}
+
+	gm := (*xrlib.GroupModel)(nil)
+	if w.depth > 0 {
+		gm = reg.Model.FindGroupByPlural(xid.Group)
+		if gm == nil {
+			Error("Unknown Group type: %s", xid.Group)
+		}
+	}
+	rm := (*xrlib.ResourceModel)(nil)
+	if w.depth > 2 {
+		rm = gm.FindResourceByPlural(xid.Resource)
+		if rm == nil {
+			Error("Unknown Resource type: %s", xid.Resource)
+		}
+	}
+
+	switch w.depth {
+	case 0:
+		for _, gPlural := range registry.SortedKeys(reg.Model.Groups) {
+			inlines = append(inlines, gPlural)
+			for _, rPlural := range registry.SortedKeys(
+				reg.Model.Groups[gPlural].Resources) {
+				prefix := gPlural + "." + rPlural
+				inlines = append(inlines, prefix, prefix+".meta",
+					prefix+".versions")
+			}
+		}
+	case 1, 2:
+		for _, rPlural := range registry.SortedKeys(gm.Resources) {
+			inlines = append(inlines, rPlural, rPlural+".meta",
+				rPlural+".versions")
+		}
+	case 3, 4:
+		inlines = append(inlines, "meta", "versions")
+	}
+
+	w.path = xid.String()
+	if w.depth == 4 || w.depth == 6 {
+		w.path = detailsPath(xid, rm)
+	}
+	query := url.Values{}
+	for _, inline := range inlines {
+		query.Add("inline", inline)
+	}
+	for _, filter := range filters {
+		query.Add("filter", filter)
+	}
+	if len(query) > 0 {
+		w.path += "?" + query.Encode()
+	}
+
+	return w
+}
+
+func (w *watcher) add(kind string, xid string, obj map[string]any) {
+	modifiedAt, _ := obj["modifiedat"].(string)
+	w.entities[xid] = &watchState{
+		Kind:       kind,
+		Epoch:      getEpoch(obj),
+		ModifiedAt: modifiedAt,
+	}
+}
+
+func (w *watcher) addVersions(xid string, coll map[string]any) {
+	for id := range coll {
+		w.add("version", xid+"/"+id, getMap(coll, id))
+	}
+}
+
+func (w *watcher) addResource(xid string, obj map[string]any) {
+	meta, ok := obj["meta"].(map[string]any)
+	if !ok {
+		meta = obj
+	}
+	w.add("resource", xid, meta)
+	w.addVersions(xid+"/versions", getMap(obj, "versions"))
+}
+
+func (w *watcher) addGroup(gm *xrlib.GroupModel, xid string,
+	obj map[string]any) {
+
+	w.add("group", xid, obj)
+	for rPlural := range gm.Resources {
+		coll := getMap(obj, rPlural)
+		for id := range coll {
+			w.addResource(xid+"/"+rPlural+"/"+id, getMap(coll, id))
+		}
+	}
+}
+
+// Gets the current state of all of the entities under PATH
+func (w *watcher) poll() error {
+	body, err := w.reg.HttpDo("GET", w.path, nil)
+	if err != nil {
+		return err
+	}
+
+	obj := map[string]any{}
+	if err = json.Unmarshal(body, &obj); err != nil {
+		return err
+	}
+
+	w.entities = map[string]*watchState{}
+	xid := w.xid.String()
+	gm := w.reg.Model.FindGroupByPlural(w.xid.Group)
+
+	switch w.depth {
+	case 0:
+		for gPlural, gm := range w.reg.Model.Groups {
+			coll := getMap(obj, gPlural)
+			for id := range coll {
+				w.addGroup(gm, "/"+gPlural+"/"+id, getMap(coll, id))
+			}
+		}
+	case 1:
+		for id := range obj {
+			w.addGroup(gm, xid+"/"+id, getMap(obj, id))
+		}
+	case 2:
+		w.addGroup(gm, xid, obj)
+	case 3:
+		for id := range obj {
+			w.addResource(xid+"/"+id, getMap(obj, id))
+		}
+	case 4:
+		w.addResource(xid, obj)
+	case 5:
+		w.addVersions(xid, obj)
+	case 6:
+		w.add("version", xid, obj)
+	}
+	return nil
+}
+
+// Returns what changed between "old" and "new", sorted by XID
+func watchDiff(old, new map[string]*watchState) []*watchEvent {
+	now := time.Now().UTC().Format(time.RFC3339)
+	events := []*watchEvent{}
+
+	for _, xid := range registry.SortedKeys(new) {
+		state := new[xid]
+		event := &watchEvent{
+			Time:       now,
+			Kind:       state.Kind,
+			XID:        xid,
+			Epoch:      state.Epoch,
+			ModifiedAt: state.ModifiedAt,
+		}
+		if oldState, ok := old[xid]; !ok {
+			event.Action = "created"
+		} else if *oldState != *state {
+			event.Action = "updated"
+		} else {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	for _, xid := range registry.SortedKeys(old) {
+		if _, ok := new[xid]; !ok {
+			events = append(events, &watchEvent{
+				Time:   now,
+				Action: "deleted",
+				Kind:   old[xid].Kind,
+				XID:    xid,
+			})
+		}
+	}
+	return events
+}
+
+func watchFunc(cmd *cobra.Command, args []string) {
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+	if len(args) > 1 {
+		Error("Too many arguments - just PATH is allowed")
+	}
+
+	// Each event is shown on its own, so json is one compact line per
+	// event and jsonpath/templates are applied to each one
+	output, _ := cmd.Flags().GetString("output")
+	out := (*Output)(nil)
+	if output != "table" && output != "json" {
+		out = getOutput(cmd)
+		if out.Format != "jsonpath" && out.Format != "template" {
+			Error("--output must be one of 'table', 'json', " +
+				"'jsonpath=EXPR', 'template=TMPL'")
+		}
+	}
+	filters, _ := cmd.Flags().GetStringArray("filter")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	count, _ := cmd.Flags().GetInt("count")
+	if interval <= 0 {
+		Error("--interval must be greater than zero")
+	}
+
+	reg, err := xrlib.GetRegistry(Server)
+	ErrStop(err)
+
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	w := newWatcher(reg, strings.TrimRight(path, "/"), filters)
+
+	// The first poll is the starting point, so it must work
+	ErrStop(w.poll())
+	Verbose("Watching %s", w.path)
+
+	for i := 1; count == 0 || i < count; i++ {
+		time.Sleep(interval)
+
+		old := w.entities
+		if err := w.poll(); err != nil {
+			// Keep going, it might be a temporary problem
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			w.entities = old
+			continue
+		}
+
+		for _, event := range watchDiff(old, w.entities) {
+			if output == "json" {
+				buf, _ := json.Marshal(event)
+				fmt.Printf("%s\n", string(buf))
+				continue
+			}
+			if out != nil {
+				fmt.Print(out.String(event))
+				continue
+			}
+			epoch := ""
+			if event.Action != "deleted" {
+				epoch = fmt.Sprintf(" (epoch: %d)", event.Epoch)
+			}
+			fmt.Printf("%s %s %s %s%s\n", event.Time, event.Action,
+				event.Kind, event.XID, epoch)
+		}
+	}
+}
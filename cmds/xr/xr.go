@@ -16,6 +16,7 @@ var VerboseFlag = xrlib.EnvBool("XR_VERBOSE", false)
 var DebugFlag = xrlib.EnvBool("XR_DEBUG", false)
 var Server = "" // Will grab DefaultServer after we add the --server flag
 var DefaultServer = xrlib.EnvString("XR_SERVER", "")
+var ProfileName = xrlib.EnvString("XR_PROFILE", "")
 
 func ErrStop(err error, prefix ...any) {
 	if err == nil {
@@ -60,6 +61,10 @@ func main() {
 		Short: "xRegistry CLI",
 
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// The profile is used for auth/TLS info, and for the Server
+			// if one wasn't specified via -s or XR_SERVER
+			loadProfile(cmd)
+
 			// Just make sure Server starts with some variant of "http"
 			if !strings.HasPrefix(Server, "http") {
 				Server = "http://" + strings.TrimLeft(Server, "/")
@@ -68,13 +73,15 @@ func main() {
 			xrlib.DebugFlag = DebugFlag
 		},
 	}
-	xrCmd.CompletionOptions.HiddenDefaultCmd = true
 	xrCmd.PersistentFlags().BoolVarP(&VerboseFlag, "verbose", "v", false,
 		"Be chatty")
 	xrCmd.PersistentFlags().BoolVarP(&DebugFlag, "debug", "x", false,
 		"Show HTTP traffic")
 	xrCmd.PersistentFlags().StringVarP(&Server, "server", "s", "",
 		"Server URL")
+	xrCmd.PersistentFlags().StringVarP(&ProfileName, "profile", "p",
+		ProfileName, "Name of the config profile to use (XR_PROFILE)")
+	xrCmd.RegisterFlagCompletionFunc("profile", completeProfile)
 
 	// Set Server after we add the --server flag so we don't show the
 	// default value in the help text
@@ -84,6 +91,16 @@ func main() {
 	addRegistryCmd(xrCmd)
 	addGroupCmd(xrCmd)
 	addGetCmd(xrCmd)
+	addResourceCmd(xrCmd)
+	addVersionCmd(xrCmd)
+	addReferencesCmd(xrCmd)
+	addApplyCmd(xrCmd)
+	addWatchCmd(xrCmd)
+	addProfileCmd(xrCmd)
+	addShellCmd(xrCmd)
+	addCodegenCmd(xrCmd)
+
+	addFlagCompletions(xrCmd)
 
 	if err := xrCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
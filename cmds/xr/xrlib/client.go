@@ -0,0 +1,440 @@
+package xrlib
+
+// A typed client for the entities in a registry. For example:
+//
+//	reg, err := xrlib.GetRegistryContext(ctx, "http://localhost:8080")
+//	file := reg.Group("dirs", "d1").Resource("files", "f1")
+//	err = file.UploadDocument(ctx, "application/json", []byte(`{}`))
+//	versions, err := file.Versions().List(ctx, "description=beta")
+//	err = file.SetDefault(ctx, versions[0].ID())
+//
+// Getting a Group, Resource, Meta or Version handle doesn't talk to the
+// server, that's only done by the methods that take a context. Errors from
+// the server are returned as *HttpError, see IsNotFound() and
+// IsEpochMismatch().
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+
+	"github.com/xregistry/server/registry"
+)
+
+type Document struct {
+	ContentType string
+	Data        []byte
+}
+
+func (reg *Registry) Group(plural, id string) *Group {
+	return &Group{
+		Entity: Entity{
+			registry: reg,
+			uid:      id,
+			daType:   registry.ENTITY_GROUP,
+			path:     plural + "/" + id,
+			abstract: plural,
+		},
+	}
+}
+
+func (reg *Registry) Groups(plural string) *GroupCollection {
+	return &GroupCollection{registry: reg, plural: plural}
+}
+
+func (g *Group) Resource(plural, id string) *Resource {
+	rm := (*ResourceModel)(nil)
+	if reg := g.registry; reg.Model != nil {
+		if gm := reg.Model.Groups[g.abstract]; gm != nil {
+			rm = gm.Resources[plural]
+		}
+	}
+	hasDoc := rm != nil && (rm.HasDocument == nil || *rm.HasDocument)
+
+	return &Resource{
+		Entity: Entity{
+			registry: g.registry,
+			uid:      id,
+			daType:   registry.ENTITY_RESOURCE,
+			path:     g.path + "/" + plural + "/" + id,
+			abstract: g.abstract + "/" + plural,
+			hasDoc:   hasDoc,
+		},
+		model: rm,
+	}
+}
+
+func (g *Group) Resources(plural string) *ResourceCollection {
+	return &ResourceCollection{group: g, plural: plural}
+}
+
+func (r *Resource) Meta() *Meta {
+	return &Meta{
+		Entity: Entity{
+			registry: r.registry,
+			uid:      r.uid,
+			daType:   registry.ENTITY_META,
+			path:     r.path + "/meta",
+			abstract: r.abstract,
+		},
+		resource: r,
+	}
+}
+
+func (r *Resource) Version(id string) *Version {
+	return &Version{
+		Entity: Entity{
+			registry: r.registry,
+			uid:      id,
+			daType:   registry.ENTITY_VERSION,
+			path:     r.path + "/versions/" + id,
+			abstract: r.abstract + "/versions",
+			hasDoc:   r.hasDoc,
+		},
+		resource: r,
+	}
+}
+
+func (r *Resource) Versions() *VersionCollection {
+	return &VersionCollection{resource: r}
+}
+
+// Makes "versionID" the default Version, and sticky
+func (r *Resource) SetDefault(ctx context.Context, versionID string) error {
+	return r.Meta().Patch(ctx, map[string]any{
+		"defaultversionid":     versionID,
+		"defaultversionsticky": true,
+	})
+}
+
+// Goes back to the newest Version being the default one
+func (r *Resource) SetDefaultLatest(ctx context.Context) error {
+	return r.Meta().Patch(ctx, map[string]any{
+		"defaultversionsticky": false,
+	})
+}
+
+// The document of the default Version
+func (r *Resource) Document(ctx context.Context) (*Document, error) {
+	return r.document(ctx)
+}
+
+// Updates the document of the default Version, or creates the Resource
+func (r *Resource) UploadDocument(ctx context.Context, contentType string,
+	data []byte) error {
+
+	return r.uploadDocument(ctx, contentType, data)
+}
+
+// nil if the Resource type isn't in the model
+func (r *Resource) Model() *ResourceModel {
+	return r.model
+}
+
+func (v *Version) Resource() *Resource {
+	return v.resource
+}
+
+func (v *Version) Document(ctx context.Context) (*Document, error) {
+	return v.document(ctx)
+}
+
+func (v *Version) UploadDocument(ctx context.Context, contentType string,
+	data []byte) error {
+
+	return v.uploadDocument(ctx, contentType, data)
+}
+
+func (e *Entity) ID() string {
+	return e.uid
+}
+
+func (e *Entity) XID() string {
+	return "/" + e.path
+}
+
+// The attributes from the last time the entity was fetched or updated,
+// nil if it hasn't been
+func (e *Entity) Attributes() map[string]any {
+	return e.attributes
+}
+
+// The epoch from the last time the entity was fetched or updated, 0 if
+// it's not known
+func (e *Entity) Epoch() int {
+	epoch, _ := e.attributes["epoch"].(float64)
+	return int(epoch)
+}
+
+// The path for the entity's metadata
+func (e *Entity) detailsPath() string {
+	if e.hasDoc {
+		return e.path + "$details"
+	}
+	return e.path
+}
+
+// Does the request and saves the attributes in the response
+func (e *Entity) do(ctx context.Context, verb string, body []byte) error {
+	res, err := e.registry.HttpDoCtx(ctx, verb, e.detailsPath(),
+		map[string]string{"Content-Type": "application/json"}, body)
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]any{}
+	if err := json.Unmarshal(res.Body, &attrs); err != nil {
+		return fmt.Errorf("Error parsing response for %q: %s", e.XID(), err)
+	}
+	e.attributes = attrs
+	return nil
+}
+
+// Gets the latest attributes from the server
+func (e *Entity) Fetch(ctx context.Context) error {
+	return e.do(ctx, "GET", nil)
+}
+
+// Creates the entity, or replaces its attributes
+func (e *Entity) Upsert(ctx context.Context, attrs map[string]any) error {
+	if attrs == nil {
+		attrs = map[string]any{}
+	}
+	buf, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	return e.do(ctx, "PUT", buf)
+}
+
+// Same as Upsert except it'll fail, with an error that IsEpochMismatch(),
+// if the entity was changed since it was last fetched or updated
+func (e *Entity) Update(ctx context.Context, attrs map[string]any) error {
+	if e.attributes == nil {
+		return fmt.Errorf("%q must be fetched before it can be updated",
+			e.XID())
+	}
+
+	tmp := map[string]any{}
+	for k, v := range attrs {
+		tmp[k] = v
+	}
+	tmp["epoch"] = e.Epoch()
+	return e.Upsert(ctx, tmp)
+}
+
+// Only updates the attributes in "attrs", a nil value deletes one
+func (e *Entity) Patch(ctx context.Context, attrs map[string]any) error {
+	buf, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	return e.do(ctx, "PATCH", buf)
+}
+
+func (e *Entity) Delete(ctx context.Context) error {
+	_, err := e.registry.HttpDoCtx(ctx, "DELETE", e.path, nil, nil)
+	if err == nil {
+		e.attributes = nil
+	}
+	return err
+}
+
+// Only deletes the entity if its epoch is still "epoch". For Resources the
+// epoch is the one in its "meta".
+func (e *Entity) DeleteIfEpoch(ctx context.Context, epoch int) error {
+	_, err := e.registry.HttpDoCtx(ctx, "DELETE",
+		fmt.Sprintf("%s?epoch=%d", e.path, epoch), nil, nil)
+	if err == nil {
+		e.attributes = nil
+	}
+	return err
+}
+
+func (e *Entity) document(ctx context.Context) (*Document, error) {
+	res, err := e.registry.HttpDoCtx(ctx, "GET", e.path, nil, nil)
+
+	// The document is stored elsewhere (eg. RESOURCEurl), so go get it
+	if res != nil && res.Code/100 == 3 {
+		if loc := res.Header.Get("Location"); loc != "" {
+			res, err = e.registry.getRedirect(ctx, e.path, loc)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		ContentType: res.Header.Get("Content-Type"),
+		Data:        res.Body,
+	}, nil
+}
+
+func (e *Entity) uploadDocument(ctx context.Context, contentType string,
+	data []byte) error {
+
+	if !e.hasDoc {
+		return fmt.Errorf("%q doesn't support documents", e.XID())
+	}
+
+	_, err := e.registry.HttpDoCtx(ctx, "PUT", e.path,
+		map[string]string{"Content-Type": contentType}, data)
+	if err == nil {
+		// The response is the document so we don't know the new attributes
+		e.attributes = nil
+	}
+	return err
+}
+
+var linkNextRE = regexp.MustCompile(`<([^>]*)>\s*;[^,]*rel="?next"?`)
+
+// Calls "fn" for each entity in the collection at "path", following the
+// "next" links if the server paginates the results
+func (reg *Registry) eachInCollection(ctx context.Context, path string,
+	filters []string, fn func(id string, attrs map[string]any) error) error {
+
+	u, err := reg.URLWithPath(path)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for _, filter := range filters {
+		query.Add("filter", filter)
+	}
+	u.RawQuery = query.Encode()
+
+	next := u.String()
+	for next != "" {
+		res, err := HttpDoCtx(ctx, "GET", next, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		coll := map[string]map[string]any{}
+		if err := json.Unmarshal(res.Body, &coll); err != nil {
+			return fmt.Errorf("Error parsing response for %q: %s", path, err)
+		}
+
+		// Be consistent across pages
+		for _, id := range registry.SortedKeys(coll) {
+			if err := fn(id, coll[id]); err != nil {
+				return err
+			}
+		}
+
+		next = ""
+		for _, link := range res.Header.Values("Link") {
+			if m := linkNextRE.FindStringSubmatch(link); m != nil {
+				next = m[1]
+				break
+			}
+		}
+	}
+	return nil
+}
+
+type GroupCollection struct {
+	registry *Registry
+	plural   string
+}
+
+// Calls "fn" for each Group, stops on the first error. Each filter is an
+// xRegistry "filter" query parameter value.
+func (gc *GroupCollection) Each(ctx context.Context, fn func(*Group) error,
+	filters ...string) error {
+
+	return gc.registry.eachInCollection(ctx, gc.plural, filters,
+		func(id string, attrs map[string]any) error {
+			g := gc.registry.Group(gc.plural, id)
+			g.attributes = attrs
+			return fn(g)
+		})
+}
+
+// Returns all of the Groups, sorted by ID
+func (gc *GroupCollection) List(ctx context.Context,
+	filters ...string) ([]*Group, error) {
+
+	list := []*Group{}
+	err := gc.Each(ctx, func(g *Group) error {
+		list = append(list, g)
+		return nil
+	}, filters...)
+	sort.Slice(list, func(i, j int) bool { return list[i].uid < list[j].uid })
+	return list, err
+}
+
+type ResourceCollection struct {
+	group  *Group
+	plural string
+}
+
+func (rc *ResourceCollection) Each(ctx context.Context,
+	fn func(*Resource) error, filters ...string) error {
+
+	return rc.group.registry.eachInCollection(ctx,
+		rc.group.path+"/"+rc.plural, filters,
+		func(id string, attrs map[string]any) error {
+			r := rc.group.Resource(rc.plural, id)
+			r.attributes = attrs
+			return fn(r)
+		})
+}
+
+func (rc *ResourceCollection) List(ctx context.Context,
+	filters ...string) ([]*Resource, error) {
+
+	list := []*Resource{}
+	err := rc.Each(ctx, func(r *Resource) error {
+		list = append(list, r)
+		return nil
+	}, filters...)
+	sort.Slice(list, func(i, j int) bool { return list[i].uid < list[j].uid })
+	return list, err
+}
+
+type VersionCollection struct {
+	resource *Resource
+}
+
+func (vc *VersionCollection) Each(ctx context.Context,
+	fn func(*Version) error, filters ...string) error {
+
+	return vc.resource.registry.eachInCollection(ctx,
+		vc.resource.path+"/versions", filters,
+		func(id string, attrs map[string]any) error {
+			v := vc.resource.Version(id)
+			v.attributes = attrs
+			return fn(v)
+		})
+}
+
+func (vc *VersionCollection) List(ctx context.Context,
+	filters ...string) ([]*Version, error) {
+
+	list := []*Version{}
+	err := vc.Each(ctx, func(v *Version) error {
+		list = append(list, v)
+		return nil
+	}, filters...)
+	sort.Slice(list, func(i, j int) bool { return list[i].uid < list[j].uid })
+	return list, err
+}
+
+// The "default" Version, based on the Resource's meta
+func (vc *VersionCollection) Default(ctx context.Context) (*Version, error) {
+	meta := vc.resource.Meta()
+	if err := meta.Fetch(ctx); err != nil {
+		return nil, err
+	}
+	id, _ := meta.attributes["defaultversionid"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("%q has no default Version",
+			vc.resource.XID())
+	}
+	v := vc.resource.Version(id)
+	return v, v.Fetch(ctx)
+}
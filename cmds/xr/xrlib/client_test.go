@@ -0,0 +1,488 @@
+package xrlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xregistry/server/registry"
+)
+
+// A very small in-memory xRegistry with one Group type (dirs) and one
+// Resource type (files) that has documents. Collections are paginated.
+type fakeServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	entities map[string]map[string]any // path -> attributes
+	docs     map[string]*Document      // path -> document
+	requests []string                  // "VERB PATH?QUERY"
+	auth     string                    // Last "Authorization" header
+	pageSize int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	fs := &fakeServer{
+		entities: map[string]map[string]any{},
+		docs:     map[string]*Document{},
+		pageSize: 2,
+	}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serve))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *fakeServer) lastRequest() string {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.requests[len(fs.requests)-1]
+}
+
+func (fs *fakeServer) send(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (fs *fakeServer) problem(w http.ResponseWriter, class, detail string) {
+	problem := registry.NewProblem(
+		registry.NewProblemError(class, "%s", detail), 0, "")
+	w.Header().Set("Content-Type", registry.PROBLEM_CONTENT_TYPE)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func (fs *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.requests = append(fs.requests, r.Method+" "+r.URL.RequestURI())
+	fs.auth = r.Header.Get("Authorization")
+
+	path := strings.Trim(r.URL.Path, "/")
+	details := strings.HasSuffix(path, "$details")
+	path = strings.TrimSuffix(path, "$details")
+	parts := strings.Split(path, "/")
+
+	switch path {
+	case "":
+		fs.send(w, 200, map[string]any{"specversion": "0.5"})
+		return
+	case "model":
+		fs.send(w, 200, map[string]any{"groups": map[string]any{
+			"dirs": map[string]any{"plural": "dirs", "singular": "dir",
+				"resources": map[string]any{"files": map[string]any{
+					"plural": "files", "singular": "file"}}}}})
+		return
+	case "capabilities":
+		fs.send(w, 200, map[string]any{})
+		return
+	case "external":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("external doc"))
+		return
+	}
+
+	// Collections
+	if len(parts)%2 == 1 && parts[len(parts)-1] != "meta" {
+		if r.Method != "GET" {
+			fs.problem(w, registry.PROBLEM_METHOD_NOT_ALLOWED, "nope")
+			return
+		}
+		ids := []string{}
+		for key := range fs.entities {
+			if id, ok := strings.CutPrefix(key, path+"/"); ok &&
+				!strings.Contains(id, "/") {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start, end := page*fs.pageSize, (page+1)*fs.pageSize
+		if end < len(ids) {
+			q := r.URL.Query()
+			q.Set("page", strconv.Itoa(page+1))
+			w.Header().Add("Link", fmt.Sprintf(`<%s/%s?%s>;rel="next"`,
+				fs.URL, path, q.Encode()))
+		} else {
+			end = len(ids)
+		}
+
+		res := map[string]any{}
+		if start > end {
+			start = end
+		}
+		for _, id := range ids[start:end] {
+			res[id] = fs.entities[path+"/"+id]
+		}
+		fs.send(w, 200, res)
+		return
+	}
+
+	isDoc := !details && parts[len(parts)-1] != "meta" && len(parts) >= 4
+	attrs := fs.entities[path]
+	body, _ := io.ReadAll(r.Body)
+
+	switch r.Method {
+	case "GET":
+		if attrs == nil {
+			fs.problem(w, registry.PROBLEM_NOT_FOUND, "Not found: "+path)
+			return
+		}
+		if !isDoc {
+			fs.send(w, 200, attrs)
+			return
+		}
+		if attrs["fileurl"] != nil {
+			w.Header().Set("Location", attrs["fileurl"].(string))
+			w.WriteHeader(http.StatusSeeOther)
+			return
+		}
+		doc := fs.docs[path]
+		w.Header().Set("Content-Type", doc.ContentType)
+		w.Write(doc.Data)
+
+	case "PUT", "PATCH":
+		if isDoc {
+			fs.docs[path] = &Document{r.Header.Get("Content-Type"), body}
+			body = []byte(`{}`)
+			if r.Method == "PATCH" {
+				fs.problem(w, registry.PROBLEM_BAD_REQUEST, "nope")
+				return
+			}
+		}
+		newAttrs := map[string]any{}
+		if err := json.Unmarshal(body, &newAttrs); err != nil {
+			fs.problem(w, registry.PROBLEM_BAD_REQUEST, err.Error())
+			return
+		}
+		epoch := 0.0
+		if attrs != nil {
+			epoch = attrs["epoch"].(float64)
+		}
+		if e, ok := newAttrs["epoch"]; ok && e != epoch {
+			fs.problem(w, registry.PROBLEM_MISMATCHED_EPOCH,
+				fmt.Sprintf("Epoch must be %v not %v", epoch, e))
+			return
+		}
+		if r.Method == "PATCH" && attrs != nil {
+			for k, v := range newAttrs {
+				if v == nil {
+					delete(attrs, k)
+				} else {
+					attrs[k] = v
+				}
+			}
+			newAttrs = attrs
+		}
+		newAttrs["epoch"] = epoch + 1
+		fs.entities[path] = newAttrs
+		fs.send(w, 200, newAttrs)
+
+	case "DELETE":
+		if attrs == nil {
+			fs.problem(w, registry.PROBLEM_NOT_FOUND, "Not found: "+path)
+			return
+		}
+		if e := r.URL.Query().Get("epoch"); e != "" &&
+			e != fmt.Sprint(attrs["epoch"]) {
+			fs.problem(w, registry.PROBLEM_MISMATCHED_EPOCH, "Bad epoch")
+			return
+		}
+		delete(fs.entities, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestClientEntities(t *testing.T) {
+	fs := newFakeServer(t)
+	ctx := context.Background()
+
+	reg, err := GetRegistryContext(ctx, fs.URL)
+	if err != nil {
+		t.Fatalf("GetRegistry: %s", err)
+	}
+
+	g := reg.Group("dirs", "d1")
+	if g.ID() != "d1" || g.XID() != "/dirs/d1" {
+		t.Fatalf("Bad group: %s %s", g.ID(), g.XID())
+	}
+
+	if err := g.Update(ctx, map[string]any{}); err == nil {
+		t.Fatalf("Update before a fetch should fail")
+	}
+
+	err = g.Upsert(ctx, map[string]any{"description": "one"})
+	if err != nil {
+		t.Fatalf("Upsert: %s", err)
+	}
+	if g.Epoch() != 1 || g.Attributes()["description"] != "one" {
+		t.Fatalf("Bad attributes: %v", g.Attributes())
+	}
+
+	// Someone else changes it
+	other := reg.Group("dirs", "d1")
+	if err := other.Patch(ctx, map[string]any{"labels": "x"}); err != nil {
+		t.Fatalf("Patch: %s", err)
+	}
+	if other.Epoch() != 2 || other.Attributes()["description"] != "one" {
+		t.Fatalf("Bad attributes: %v", other.Attributes())
+	}
+
+	err = g.Update(ctx, map[string]any{"description": "two"})
+	if !IsEpochMismatch(err) {
+		t.Fatalf("Expected epoch mismatch, got: %v", err)
+	}
+	if err.Error() != "Epoch must be 2 not 1" {
+		t.Fatalf("Bad error text: %s", err)
+	}
+
+	if err := g.Fetch(ctx); err != nil {
+		t.Fatalf("Fetch: %s", err)
+	}
+	if err := g.Update(ctx, map[string]any{"description": "two"}); err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	if g.Epoch() != 3 {
+		t.Fatalf("Bad epoch: %d", g.Epoch())
+	}
+
+	if err := g.DeleteIfEpoch(ctx, 1); !IsEpochMismatch(err) {
+		t.Fatalf("Expected epoch mismatch, got: %v", err)
+	}
+	if err := g.DeleteIfEpoch(ctx, g.Epoch()); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if g.Attributes() != nil {
+		t.Fatalf("Attributes should be cleared")
+	}
+
+	err = g.Fetch(ctx)
+	if !IsNotFound(err) || IsEpochMismatch(err) {
+		t.Fatalf("Expected not found, got: %v", err)
+	}
+	if err := g.Delete(ctx); !IsNotFound(err) {
+		t.Fatalf("Expected not found, got: %v", err)
+	}
+}
+
+func TestClientResources(t *testing.T) {
+	fs := newFakeServer(t)
+	ctx := context.Background()
+
+	reg, err := GetRegistryContext(ctx, fs.URL)
+	if err != nil {
+		t.Fatalf("GetRegistry: %s", err)
+	}
+
+	for _, id := range []string{"d3", "d1", "d2"} {
+		if err := reg.Group("dirs", id).Upsert(ctx, nil); err != nil {
+			t.Fatalf("Upsert: %s", err)
+		}
+	}
+	groups, err := reg.Groups("dirs").List(ctx, "epoch=1")
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(groups) != 3 || groups[0].ID() != "d1" || groups[2].ID() != "d3" {
+		t.Fatalf("Bad groups: %v", groups)
+	}
+	// 2 per page
+	if req := fs.lastRequest(); req != "GET /dirs?filter=epoch%3D1&page=1" {
+		t.Fatalf("Bad request: %s", req)
+	}
+
+	file := groups[0].Resource("files", "f1")
+	if file.XID() != "/dirs/d1/files/f1" || file.Model().Singular != "file" {
+		t.Fatalf("Bad resource: %s", file.XID())
+	}
+
+	err = file.UploadDocument(ctx, "application/json", []byte(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+	if req := fs.lastRequest(); req != "PUT /dirs/d1/files/f1" {
+		t.Fatalf("Bad request: %s", req)
+	}
+
+	// Metadata is at $details
+	err = file.Patch(ctx, map[string]any{"description": "my file"})
+	if err != nil {
+		t.Fatalf("Patch: %s", err)
+	}
+	if req := fs.lastRequest(); req != "PATCH /dirs/d1/files/f1$details" {
+		t.Fatalf("Bad request: %s", req)
+	}
+
+	doc, err := file.Document(ctx)
+	if err != nil {
+		t.Fatalf("Document: %s", err)
+	}
+	if doc.ContentType != "application/json" || string(doc.Data) != `{"a":1}` {
+		t.Fatalf("Bad doc: %s %s", doc.ContentType, doc.Data)
+	}
+
+	for i := 1; i <= 5; i++ {
+		v := file.Version(strconv.Itoa(i))
+		err := v.UploadDocument(ctx, "text/plain", []byte("doc"+v.ID()))
+		if err != nil {
+			t.Fatalf("Upload: %s", err)
+		}
+		if err := v.Upsert(ctx, map[string]any{"n": i}); err != nil {
+			t.Fatalf("Upsert: %s", err)
+		}
+	}
+
+	versions, err := file.Versions().List(ctx)
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	ids := []string{}
+	for _, v := range versions {
+		ids = append(ids, v.ID())
+		if v.Resource() != file || v.Attributes()["n"] == nil {
+			t.Fatalf("Bad version: %v", v.Attributes())
+		}
+	}
+	if strings.Join(ids, ",") != "1,2,3,4,5" {
+		t.Fatalf("Bad versions: %v", ids)
+	}
+
+	// Stop part way through
+	count := 0
+	err = file.Versions().Each(ctx, func(v *Version) error {
+		if count++; count == 3 {
+			return fmt.Errorf("Stop")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "Stop" || count != 3 {
+		t.Fatalf("Bad Each: %d %v", count, err)
+	}
+
+	doc, err = file.Version("3").Document(ctx)
+	if err != nil || string(doc.Data) != "doc3" {
+		t.Fatalf("Bad doc: %v %v", doc, err)
+	}
+
+	// Document stored outside of the registry
+	err = file.Version("4").Patch(ctx,
+		map[string]any{"fileurl": fs.URL + "/external"})
+	if err != nil {
+		t.Fatalf("Patch: %s", err)
+	}
+	doc, err = file.Version("4").Document(ctx)
+	if err != nil || string(doc.Data) != "external doc" {
+		t.Fatalf("Bad doc: %v %v", doc, err)
+	}
+
+	if err := file.SetDefault(ctx, "2"); err != nil {
+		t.Fatalf("SetDefault: %s", err)
+	}
+	if req := fs.lastRequest(); req != "PATCH /dirs/d1/files/f1/meta" {
+		t.Fatalf("Bad request: %s", req)
+	}
+	v, err := file.Versions().Default(ctx)
+	if err != nil || v.ID() != "2" || v.Attributes()["n"] != 2.0 {
+		t.Fatalf("Bad default: %v %v", v, err)
+	}
+	if err := file.SetDefaultLatest(ctx); err != nil {
+		t.Fatalf("SetDefaultLatest: %s", err)
+	}
+	meta := file.Meta()
+	if err := meta.Fetch(ctx); err != nil {
+		t.Fatalf("Fetch: %s", err)
+	}
+	if meta.Attributes()["defaultversionsticky"] != false {
+		t.Fatalf("Bad meta: %v", meta.Attributes())
+	}
+
+	if err := file.Version("5").Delete(ctx); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if versions, _ = file.Versions().List(ctx); len(versions) != 4 {
+		t.Fatalf("Bad versions: %d", len(versions))
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	fs := newFakeServer(t)
+
+	reg, err := GetRegistry(fs.URL)
+	if err != nil {
+		t.Fatalf("GetRegistry: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = reg.Group("dirs", "d1").Upsert(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("Expected cancel error, got: %v", err)
+	}
+	if _, err = reg.Groups("dirs").List(ctx); err == nil {
+		t.Fatalf("Expected cancel error")
+	}
+	if _, err = GetRegistryContext(ctx, fs.URL); err == nil {
+		t.Fatalf("Expected cancel error")
+	}
+}
+
+func TestClientRedirectAuth(t *testing.T) {
+	fs := newFakeServer(t)
+	ctx := context.Background()
+
+	other := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				t.Errorf("Credentials sent to another server: %s", auth)
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("other doc"))
+		}))
+	defer other.Close()
+
+	defer func(p *Profile) { CurrentProfile = p }(CurrentProfile)
+	CurrentProfile = &Profile{Token: "secret"}
+	ResetHTTPClient()
+	defer ResetHTTPClient()
+
+	reg, err := GetRegistryContext(ctx, fs.URL)
+	if err != nil {
+		t.Fatalf("GetRegistry: %s", err)
+	}
+	file := reg.Group("dirs", "d1").Resource("files", "f1")
+	if err := reg.Group("dirs", "d1").Upsert(ctx, nil); err != nil {
+		t.Fatalf("Upsert: %s", err)
+	}
+
+	// Same server still gets the credentials
+	err = file.Patch(ctx, map[string]any{"fileurl": fs.URL + "/external"})
+	if err != nil {
+		t.Fatalf("Patch: %s", err)
+	}
+	doc, err := file.Document(ctx)
+	if err != nil || string(doc.Data) != "external doc" {
+		t.Fatalf("Bad doc: %v %v", doc, err)
+	}
+	if fs.lastRequest() != "GET /external" || fs.auth != "Bearer secret" {
+		t.Fatalf("Bad request: %s %q", fs.lastRequest(), fs.auth)
+	}
+
+	err = file.Patch(ctx, map[string]any{"fileurl": other.URL + "/doc"})
+	if err != nil {
+		t.Fatalf("Patch: %s", err)
+	}
+	doc, err = file.Document(ctx)
+	if err != nil || string(doc.Data) != "other doc" {
+		t.Fatalf("Bad doc: %v %v", doc, err)
+	}
+}
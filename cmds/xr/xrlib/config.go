@@ -0,0 +1,217 @@
+package xrlib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The xr config file holds a set of named profiles, each one with the
+// info needed to talk to one registry server. It's JSON:
+//
+//	{
+//	  "current": "dev",
+//	  "profiles": {
+//	    "dev": { "server": "http://localhost:8080", "token": "..." }
+//	  }
+//	}
+
+type Profile struct {
+	Server   string `json:"server,omitempty"`
+	Registry string `json:"registry,omitempty"` // reg-NAME, optional
+
+	// Auth - either a bearer token or basic auth
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// TLS
+	CACert   string `json:"cacert,omitempty"` // CA bundle file
+	Cert     string `json:"cert,omitempty"`   // Client cert file
+	Key      string `json:"key,omitempty"`    // Client key file
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+type Config struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*Profile `json:"profiles,omitempty"`
+
+	path string
+}
+
+// The profile used for all HTTP requests to the server, nil means none
+var CurrentProfile *Profile
+
+var httpClient *http.Client
+var httpClientMutex sync.Mutex
+
+// $XR_CONFIG, or $XDG_CONFIG_HOME/xr/config, or ~/.config/xr/config
+func ConfigPath() string {
+	if path := os.Getenv("XR_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "xr", "config")
+}
+
+// A missing file isn't an error, it's just an empty config
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{
+		Profiles: map[string]*Profile{},
+		path:     path,
+	}
+
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading config file %q: %s", path, err)
+	}
+
+	if err = json.Unmarshal(buf, config); err != nil {
+		return nil, fmt.Errorf("Error parsing config file %q: %s", path, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]*Profile{}
+	}
+	return config, nil
+}
+
+// Only the owner can read it since it can have credentials in it
+func (c *Config) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	buf, _ := json.MarshalIndent(c, "", "  ")
+	if err := os.WriteFile(c.path, append(buf, '\n'), 0600); err != nil {
+		return fmt.Errorf("Error writing config file %q: %s", c.path, err)
+	}
+	return nil
+}
+
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Returns the named profile, or the current one if "name" is ""
+func (c *Config) GetProfile(name string) (*Profile, error) {
+	if name == "" {
+		name = c.Current
+		if name == "" {
+			return nil, nil
+		}
+	}
+	p := c.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("Unknown profile: %s", name)
+	}
+	return p, nil
+}
+
+// The URL of the registry, including the "reg-NAME" part if there is one
+func (p *Profile) URL() string {
+	url := p.Server
+	if url != "" && !strings.HasPrefix(url, "http") {
+		url = "http://" + strings.TrimLeft(url, "/")
+	}
+	if p.Registry != "" {
+		url = strings.TrimRight(url, "/") + "/" + strings.Trim(p.Registry, "/")
+	}
+	return url
+}
+
+func (p *Profile) TLSConfig() (*tls.Config, error) {
+	if p.CACert == "" && p.Cert == "" && !p.Insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: p.Insecure}
+
+	if p.CACert != "" {
+		buf, err := os.ReadFile(p.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA file %q: %s",
+				p.CACert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("No certificates found in CA file %q",
+				p.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if p.Cert != "" || p.Key != "" {
+		key := p.Key
+		if key == "" {
+			key = p.Cert // Both in the same file
+		}
+		cert, err := tls.LoadX509KeyPair(p.Cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate: %s",
+				err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func (p *Profile) AddAuth(req *http.Request) {
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	} else if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+}
+
+// Returns the http.Client to use, based on CurrentProfile
+func GetHTTPClient() (*http.Client, error) {
+	httpClientMutex.Lock()
+	defer httpClientMutex.Unlock()
+
+	if httpClient != nil {
+		return httpClient, nil
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+
+	if CurrentProfile != nil {
+		config, err := CurrentProfile.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = config
+			client.Transport = transport
+		}
+	}
+
+	httpClient = client
+	return httpClient, nil
+}
+
+// Call this if CurrentProfile is changed after a request was made
+func ResetHTTPClient() {
+	httpClientMutex.Lock()
+	defer httpClientMutex.Unlock()
+	httpClient = nil
+}
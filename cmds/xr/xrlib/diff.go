@@ -0,0 +1,135 @@
+package xrlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/xregistry/server/registry"
+)
+
+type AttrChange struct {
+	Name string
+	Old  any // nil if it's being added
+	New  any // nil if it's being removed
+}
+
+func (ac AttrChange) String() string {
+	str := func(val any) string {
+		if val == nil {
+			return "<none>"
+		}
+		buf, _ := json.Marshal(val)
+		return string(buf)
+	}
+	return fmt.Sprintf("%s: %s -> %s", ac.Name, str(ac.Old), str(ac.New))
+}
+
+// Attributes that are set, or defaulted, by the server. These are only
+// compared if they appear in the new set of attributes.
+var ServerAttributes = map[string]bool{
+	"specversion":          true,
+	"self":                 true,
+	"xid":                  true,
+	"epoch":                true,
+	"createdat":            true,
+	"modifiedat":           true,
+	"isdefault":            true,
+	"ancestor":             true,
+	"contenttype":          true,
+	"readonly":             true,
+	"defaultversionid":     true,
+	"defaultversionsticky": true,
+	"meta":                 true,
+	"versions":             true,
+}
+
+// Returns the differences between two sets of attributes, sorted by name.
+// Attributes named in "ignore" (eg. the CollectionAttributes() of the
+// entity's model) are skipped.
+func DiffAttributes(oldAttrs, newAttrs map[string]any,
+	ignore ...string) []AttrChange {
+
+	skip := func(name string) bool {
+		return ArrayContains(ignore, name)
+	}
+
+	changes := []AttrChange{}
+	for name, newVal := range newAttrs {
+		if skip(name) || name == "epoch" {
+			continue
+		}
+		oldVal, ok := oldAttrs[name]
+		if !ok || !SameValue(oldVal, newVal) {
+			changes = append(changes, AttrChange{name, oldVal, newVal})
+		}
+	}
+	for name, oldVal := range oldAttrs {
+		if skip(name) || ServerAttributes[name] {
+			continue
+		}
+		if _, ok := newAttrs[name]; !ok {
+			changes = append(changes, AttrChange{name, oldVal, nil})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Compares two values as if they were both serialized as JSON, so things
+// like int vs float64 don't matter
+func SameValue(a, b any) bool {
+	normalize := func(val any) any {
+		buf, err := json.Marshal(val)
+		if err != nil {
+			return val
+		}
+		res := any(nil)
+		json.Unmarshal(buf, &res)
+		return res
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// Returns the differences between two values, recursing into maps. The
+// name of each change is the path to the value, eg. "groups.dirs.plural".
+func DiffValues(name string, oldVal, newVal any) []AttrChange {
+	oldMap, ok1 := oldVal.(map[string]any)
+	newMap, ok2 := newVal.(map[string]any)
+	if !ok1 || !ok2 {
+		if SameValue(oldVal, newVal) {
+			return nil
+		}
+		return []AttrChange{{name, oldVal, newVal}}
+	}
+
+	keys := map[string]bool{}
+	for key := range oldMap {
+		keys[key] = true
+	}
+	for key := range newMap {
+		keys[key] = true
+	}
+
+	changes := []AttrChange{}
+	for _, key := range registry.SortedKeys(keys) {
+		path := key
+		if name != "" {
+			path = name + "." + key
+		}
+		oldVal, inOld := oldMap[key]
+		newVal, inNew := newMap[key]
+		if !inOld {
+			changes = append(changes, AttrChange{path, nil, newVal})
+		} else if !inNew {
+			changes = append(changes, AttrChange{path, oldVal, nil})
+		} else {
+			changes = append(changes, DiffValues(path, oldVal, newVal)...)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,37 @@
+package xrlib
+
+import (
+	"testing"
+)
+
+func TestDiffAttributes(t *testing.T) {
+	gm := &GroupModel{
+		Plural:    "dirs",
+		Singular:  "dir",
+		Resources: map[string]*ResourceModel{"files": {Plural: "files"}},
+	}
+
+	live := map[string]any{
+		"dirid":       "d1",
+		"epoch":       2,
+		"filesurl":    "http://localhost/dirs/d1/files",
+		"filescount":  3,
+		"homepageurl": "http://old",
+		"retrycount":  1,
+	}
+	local := map[string]any{
+		"dirid":       "d1",
+		"homepageurl": "http://new",
+	}
+
+	changes := DiffAttributes(live, local, gm.CollectionAttributes()...)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got: %v", changes)
+	}
+	if changes[0].String() != `homepageurl: "http://old" -> "http://new"` {
+		t.Errorf("Wrong change: %s", changes[0])
+	}
+	if changes[1].String() != `retrycount: 1 -> <none>` {
+		t.Errorf("Wrong change: %s", changes[1])
+	}
+}
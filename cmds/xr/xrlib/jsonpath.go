@@ -0,0 +1,205 @@
+package xrlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xregistry/server/registry"
+)
+
+// JSONPath evaluates a kubectl style JSONPath template against "data",
+// which is expected to be the result of json.Unmarshal into an "any".
+// Text outside of {...} is copied as is, and each {...} is replaced with
+// the values it selects, separated by spaces. Supported expressions:
+//
+//	.name or ['name']  a map key
+//	[N]                an array index, negative values count from the end
+//	[*] or .*          all array items or map values (map keys are sorted)
+//	..name             "name" at any depth
+//
+// An expression may start with "$" and may omit the leading ".".
+// Strings are shown as is, everything else as compact JSON.
+func JSONPath(data any, tmpl string) (string, error) {
+	res := strings.Builder{}
+
+	for tmpl != "" {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			res.WriteString(tmpl)
+			break
+		}
+		end := strings.Index(tmpl[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("Missing \"}\" in JSONPath %q", tmpl)
+		}
+		end += start
+
+		res.WriteString(tmpl[:start])
+		vals, err := JSONPathValues(data, tmpl[start+1:end])
+		if err != nil {
+			return "", err
+		}
+		for i, val := range vals {
+			if i > 0 {
+				res.WriteString(" ")
+			}
+			res.WriteString(JSONPathString(val))
+		}
+		tmpl = tmpl[end+1:]
+	}
+
+	return res.String(), nil
+}
+
+// Converts a value selected by a JSONPath into the string to show
+func JSONPathString(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		buf, _ := json.Marshal(v)
+		return string(buf)
+	}
+}
+
+// JSONPathValues returns the values selected by the JSONPath expression
+// "expr" (no surrounding {}). Missing keys and indexes select nothing.
+func JSONPathValues(data any, expr string) ([]any, error) {
+	expr = strings.TrimSpace(expr)
+	expr = strings.TrimPrefix(expr, "$")
+	if expr != "" && expr[0] != '.' && expr[0] != '[' {
+		expr = "." + expr
+	}
+
+	vals := []any{data}
+	for expr != "" {
+		next := []any{}
+
+		switch {
+		case strings.HasPrefix(expr, ".."):
+			name, rest := jsonPathName(expr[2:])
+			if name == "" {
+				return nil, fmt.Errorf("Missing name after \"..\" in "+
+					"JSONPath %q", expr)
+			}
+			expr = rest
+			for _, val := range vals {
+				next = append(next, jsonPathFind(val, name)...)
+			}
+
+		case expr[0] == '.':
+			name, rest := jsonPathName(expr[1:])
+			expr = rest
+			if name == "" {
+				// Just "." means "everything"
+				next = vals
+				break
+			}
+			for _, val := range vals {
+				next = append(next, jsonPathChild(val, name)...)
+			}
+
+		case expr[0] == '[':
+			end := strings.Index(expr, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Missing \"]\" in JSONPath %q", expr)
+			}
+			key := strings.TrimSpace(expr[1:end])
+			expr = expr[end+1:]
+
+			if len(key) > 1 && (key[0] == '\'' || key[0] == '"') &&
+				key[len(key)-1] == key[0] {
+				for _, val := range vals {
+					next = append(next,
+						jsonPathChild(val, key[1:len(key)-1])...)
+				}
+				break
+			}
+			if key == "*" {
+				for _, val := range vals {
+					next = append(next, jsonPathChild(val, "*")...)
+				}
+				break
+			}
+
+			index, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid index %q in JSONPath", key)
+			}
+			for _, val := range vals {
+				arr, ok := val.([]any)
+				if !ok {
+					continue
+				}
+				i := index
+				if i < 0 {
+					i += len(arr)
+				}
+				if i >= 0 && i < len(arr) {
+					next = append(next, arr[i])
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("Unexpected %q in JSONPath", expr)
+		}
+
+		vals = next
+	}
+
+	return vals, nil
+}
+
+// Splits "expr" into the name at the start of it, and what's after it
+func jsonPathName(expr string) (string, string) {
+	end := strings.IndexAny(expr, ".[")
+	if end < 0 {
+		end = len(expr)
+	}
+	return strings.TrimSpace(expr[:end]), expr[end:]
+}
+
+// The "name" child of "val", "*" means all of them
+func jsonPathChild(val any, name string) []any {
+	switch v := val.(type) {
+	case map[string]any:
+		if name == "*" {
+			res := []any{}
+			for _, key := range registry.SortedKeys(v) {
+				res = append(res, v[key])
+			}
+			return res
+		}
+		if child, ok := v[name]; ok {
+			return []any{child}
+		}
+	case []any:
+		if name == "*" {
+			return v
+		}
+	}
+	return nil
+}
+
+// All of the values of "name" under "val", at any depth
+func jsonPathFind(val any, name string) []any {
+	res := []any{}
+	switch v := val.(type) {
+	case map[string]any:
+		for _, key := range registry.SortedKeys(v) {
+			if key == name || name == "*" {
+				res = append(res, v[key])
+			}
+			res = append(res, jsonPathFind(v[key], name)...)
+		}
+	case []any:
+		for _, item := range v {
+			res = append(res, jsonPathFind(item, name)...)
+		}
+	}
+	return res
+}
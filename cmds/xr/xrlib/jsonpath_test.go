@@ -0,0 +1,57 @@
+package xrlib
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	data := any(nil)
+	err := json.Unmarshal([]byte(`{
+	  "/dirs/d1": {
+	    "dirid": "d1",
+	    "epoch": 2,
+	    "labels": { "env": "prod", "tier": "web" },
+	    "tags": [ "a", "b", "c" ],
+	    "files": { "f1": { "fileid": "f1" }, "f2": { "fileid": "f2" } }
+	  },
+	  "/dirs/d2": { "dirid": "d2", "epoch": 1 }
+	}`), &data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+
+	for _, test := range []struct {
+		tmpl string
+		exp  string
+	}{
+		{`{.*.dirid}`, `d1 d2`},
+		{`{$.*.dirid}`, `d1 d2`},
+		{`{['/dirs/d1'].epoch}`, `2`},
+		{`{["/dirs/d1"].labels.env}`, `prod`},
+		{`{['/dirs/d1'].labels}`, `{"env":"prod","tier":"web"}`},
+		{`{['/dirs/d1'].tags[0]}`, `a`},
+		{`{['/dirs/d1'].tags[-1]}`, `c`},
+		{`{['/dirs/d1'].tags[*]}`, `a b c`},
+		{`{['/dirs/d1'].tags[9]}`, ``},
+		{`{..fileid}`, `f1 f2`},
+		{`{.*.missing}`, ``},
+		{`id={['/dirs/d2'].dirid} epoch={['/dirs/d2'].epoch}`,
+			`id=d2 epoch=1`},
+		{`no braces`, `no braces`},
+	} {
+		res, err := JSONPath(data, test.tmpl)
+		if err != nil {
+			t.Fatalf("%s: %s", test.tmpl, err)
+		}
+		if res != test.exp {
+			t.Errorf("%s: expected %q, got %q", test.tmpl, test.exp, res)
+		}
+	}
+
+	for _, tmpl := range []string{`{.a`, `{.a[0}`, `{.a[x]}`, `{..}`} {
+		if _, err := JSONPath(data, tmpl); err == nil {
+			t.Errorf("%s: should have failed", tmpl)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package xrlib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -11,9 +12,8 @@ import (
 
 type Registry struct {
 	Entity
-	Capabilities *Capabilities     `json:"capabilities,omitempty"`
-	Model        *Model            `json:"model,omitempty"`
-	Groups       map[string]*Group `json:"groups,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	Model        *Model        `json:"model,omitempty"`
 
 	isNew  bool
 	server string
@@ -42,6 +42,7 @@ type Attribute struct {
 	Immutable    bool   `json:"immutable,omitempty"`
 	Required     bool   `json:"required,omitempty"`
 	Default      any    `json:"default,omitempty"`
+	OnDelete     string `json:"ondelete,omitempty"`
 
 	Attributes Attributes `json:"attributes,omitempty"`
 	Item       *Item      `json:"item,omitempty"`
@@ -77,6 +78,10 @@ type ResourceModel struct {
 	SetVersionId     *bool
 	SetDefaultSticky *bool
 	HasDocument      *bool
+	XRefDelete       string                    `json:"xrefdelete,omitempty"`
+	Retention        *registry.RetentionPolicy `json:"retention,omitempty"`
+	VersionLock      string                    `json:"versionlock,omitempty"`
+	ProxySnapshot    bool                      `json:"proxysnapshot,omitempty"`
 	TypeMap          map[string]string
 	Labels           map[string]string `json:"labels,omitempty"`
 	Attributes       Attributes        `json:"attributes,omitempty"`
@@ -85,15 +90,11 @@ type ResourceModel struct {
 
 type Group struct {
 	Entity
-	registry  *Registry
-	resources map[string]*Resource
 }
 
 type Resource struct {
 	Entity
-	group    *Group
-	meta     *Meta
-	versions map[string]*Version
+	model *ResourceModel
 }
 
 type Meta struct {
@@ -112,11 +113,30 @@ type Entity struct {
 	attributes map[string]any
 
 	daType   int
-	path     string
-	abstract string
+	path     string // GROUPS/gID[/RESOURCES/rID[/versions/vID]]
+	abstract string // GROUPS[/RESOURCES[/versions]]
+	hasDoc   bool   // Metadata is at PATH$details
 }
 
 func GetRegistry(url string) (*Registry, error) {
+	return GetRegistryContext(context.Background(), url)
+}
+
+func GetRegistryContext(ctx context.Context, url string) (*Registry, error) {
+	reg := newRegistry(url)
+	return reg, reg.RefreshContext(ctx)
+}
+
+// Returns a Registry for "url" that uses "model" rather than getting it
+// from the server, e.g. when the model was cached. Nothing is sent to the
+// server until one of its methods needs to.
+func NewRegistryWithModel(url string, model *Model) *Registry {
+	reg := newRegistry(url)
+	reg.Model = model
+	return reg
+}
+
+func newRegistry(url string) *Registry {
 	if !strings.HasPrefix(url, "http") {
 		url = "http://" + strings.TrimLeft(url, "/")
 	}
@@ -130,16 +150,20 @@ func GetRegistry(url string) (*Registry, error) {
 		server: url,
 	}
 	reg.Entity.registry = reg
-
-	return reg, reg.Refresh()
+	return reg
 }
 
 func (reg *Registry) Refresh() error {
+	return reg.RefreshContext(context.Background())
+}
+
+func (reg *Registry) RefreshContext(ctx context.Context) error {
 	// GET root and verify it's an xRegistry
-	body, err := reg.HttpDo("GET", "", nil)
+	res, err := reg.HttpDoCtx(ctx, "GET", "", nil, nil)
 	if err != nil {
 		return err
 	}
+	body := res.Body
 
 	attrs := map[string]any(nil)
 	if err := registry.Unmarshal(body, &attrs); err != nil {
@@ -152,21 +176,27 @@ func (reg *Registry) Refresh() error {
 
 	// Before we process the attributes, get the model and capabilities
 
-	if err := reg.RefreshModel(); err != nil {
+	if err := reg.refreshModel(ctx); err != nil {
 		return err
 	}
-	if err := reg.RefreshCapabilities(); err != nil {
+	if err := reg.refreshCapabilities(ctx); err != nil {
 		return err
 	}
 
+	reg.attributes = attrs
 	return nil
 }
 
 func (reg *Registry) RefreshModel() error {
-	buf, err := reg.HttpDo("GET", "/model", nil)
+	return reg.refreshModel(context.Background())
+}
+
+func (reg *Registry) refreshModel(ctx context.Context) error {
+	res, err := reg.HttpDoCtx(ctx, "GET", "/model", nil, nil)
 	if err != nil {
 		return err
 	}
+	buf := res.Body
 
 	if err := json.Unmarshal(buf, &reg.Model); err != nil {
 		return fmt.Errorf("Unable to parse registry model: %s\n%s",
@@ -176,10 +206,15 @@ func (reg *Registry) RefreshModel() error {
 }
 
 func (reg *Registry) RefreshCapabilities() error {
-	buf, err := reg.HttpDo("GET", "/capabilities", nil)
+	return reg.refreshCapabilities(context.Background())
+}
+
+func (reg *Registry) refreshCapabilities(ctx context.Context) error {
+	res, err := reg.HttpDoCtx(ctx, "GET", "/capabilities", nil, nil)
 	if err != nil {
 		return err
 	}
+	buf := res.Body
 
 	if err := json.Unmarshal(buf, &reg.Capabilities); err != nil {
 		return fmt.Errorf("Unable to parse registry capabilities: %s\n%s",
@@ -227,6 +262,31 @@ func (gm *GroupModel) FindResourceByPlural(plural string) *ResourceModel {
 	return gm.Resources[plural]
 }
 
+// The names of the attributes the server adds for the collections of a
+// Registry, eg. "dirsurl" and "dirscount"
+func (m *Model) CollectionAttributes() []string {
+	names := []string{}
+	for _, plural := range registry.SortedKeys(m.Groups) {
+		names = append(names, plural+"url", plural+"count")
+	}
+	return names
+}
+
+// Same as Model.CollectionAttributes but for a Group, eg. "filesurl"
+func (gm *GroupModel) CollectionAttributes() []string {
+	names := []string{}
+	for _, plural := range registry.SortedKeys(gm.Resources) {
+		names = append(names, plural+"url", plural+"count")
+	}
+	return names
+}
+
+// Same as Model.CollectionAttributes but for a Resource, and its meta
+func (rm *ResourceModel) CollectionAttributes() []string {
+	return []string{"metaurl", "versionsurl", "versionscount",
+		"defaultversionurl"}
+}
+
 func (gm *GroupModel) FindResourceBySingular(singular string) *ResourceModel {
 	for _, resource := range gm.Resources {
 		if resource.Singular == singular {
@@ -249,7 +309,13 @@ func (reg *Registry) URLWithPath(path string) (*url.URL, error) {
 	if u.Scheme == "" {
 		u.Scheme = "http"
 	}
+
+	// Don't let any query params get escaped as part of the path
+	path, query, _ := strings.Cut(path, "?")
 	u.Path += "/" + strings.TrimLeft(path, "/")
+	if query != "" {
+		u.RawQuery = query
+	}
 
 	return u, nil
 }
@@ -271,3 +337,48 @@ func (reg *Registry) GetResourceModelFromXID(xidStr string) (*ResourceModel, err
 	}
 	return rm, nil
 }
+
+func (reg *Registry) HttpDoFull(verb, path string, headers map[string]string,
+	body []byte) (*HttpResponse, error) {
+
+	return reg.HttpDoCtx(context.Background(), verb, path, headers, body)
+}
+
+func (reg *Registry) HttpDoCtx(ctx context.Context, verb, path string,
+	headers map[string]string, body []byte) (*HttpResponse, error) {
+
+	u, err := reg.URLWithPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return HttpDoCtx(ctx, verb, u.String(), headers, body)
+}
+
+// GETs "loc", the target of a redirect from "path". The credentials are
+// only sent if "loc" is on the registry's own server (same scheme, host and
+// port) since they're not meant for anyone else.
+func (reg *Registry) getRedirect(ctx context.Context, path string,
+	loc string) (*HttpResponse, error) {
+
+	base, err := reg.URLWithPath(path)
+	if err != nil {
+		return nil, err
+	}
+	u, err := base.Parse(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := strings.EqualFold(u.Scheme, base.Scheme) &&
+		strings.EqualFold(hostPort(u), hostPort(base))
+	return httpDoCtx(ctx, "GET", u.String(), nil, nil, auth)
+}
+
+// Returns "host:port", filling in the scheme's default port if needed
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	return u.Hostname() + ":" + port
+}
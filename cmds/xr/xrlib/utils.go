@@ -2,11 +2,15 @@ package xrlib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/xregistry/server/registry"
@@ -69,22 +73,110 @@ func EnvString(name string, def string) string {
 	return def
 }
 
+type HttpResponse struct {
+	Code   int
+	Header http.Header
+	Body   []byte
+}
+
+// Returned by the HttpDo funcs for non-2xx responses. The error text is
+// the "detail" from the problem details, or the body of the response.
+type HttpError struct {
+	Code    int
+	Problem *registry.Problem // nil if the response wasn't problem details
+	msg     string
+}
+
+func NewHttpError(code int, status string, contentType string,
+	body []byte) *HttpError {
+
+	he := &HttpError{Code: code, msg: status}
+	if len(body) != 0 {
+		he.msg = registry.ProblemDetail(contentType, body)
+	}
+	if strings.HasPrefix(contentType, registry.PROBLEM_CONTENT_TYPE) {
+		problem := &registry.Problem{}
+		if json.Unmarshal(body, problem) == nil {
+			he.Problem = problem
+		}
+	}
+	return he
+}
+
+func (he *HttpError) Error() string {
+	return he.msg
+}
+
+// Returns true if the problem details "type" is for "class", eg.
+// registry.PROBLEM_MISMATCHED_EPOCH. Only the last part of the "type" URI
+// is checked since the server might not use the default base URI.
+func (he *HttpError) IsProblem(class string) bool {
+	return he.Problem != nil &&
+		strings.HasSuffix(he.Problem.Type, "/"+class)
+}
+
+func IsNotFound(err error) bool {
+	he := (*HttpError)(nil)
+	return errors.As(err, &he) && he.Code == http.StatusNotFound
+}
+
+func IsEpochMismatch(err error) bool {
+	he := (*HttpError)(nil)
+	return errors.As(err, &he) &&
+		he.IsProblem(registry.PROBLEM_MISMATCHED_EPOCH)
+}
+
 // statusCode, body
-// Add headers (in and out) later
 func HttpDo(verb string, url string, body []byte) ([]byte, error) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		}}
+	res, err := HttpDoFull(verb, url, nil, body)
+	if res == nil {
+		return nil, err
+	}
+	return res.Body, err
+}
+
+// Same as HttpDo but with request headers, and it returns the entire
+// response, even on error. Redirects are not followed.
+func HttpDoFull(verb string, url string, headers map[string]string,
+	body []byte) (*HttpResponse, error) {
+
+	return HttpDoCtx(context.Background(), verb, url, headers, body)
+}
+
+// Same as HttpDoFull but the request is bound to "ctx"
+func HttpDoCtx(ctx context.Context, verb string, url string,
+	headers map[string]string, body []byte) (*HttpResponse, error) {
+
+	return httpDoCtx(ctx, verb, url, headers, body, true)
+}
+
+// Same as HttpDoCtx but the CurrentProfile's credentials are only added
+// when "auth" is true
+func httpDoCtx(ctx context.Context, verb string, url string,
+	headers map[string]string, body []byte, auth bool) (*HttpResponse, error) {
+
+	client, err := GetHTTPClient()
+	if err != nil {
+		return nil, err
+	}
 
 	bodyReader := bytes.NewReader(body)
 
-	req, err := http.NewRequest(verb, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, verb, url, bodyReader)
 	if err != nil {
 		return nil, err
 	}
+	if auth && CurrentProfile != nil {
+		CurrentProfile.AddAuth(req)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
 
 	Debug("Request: %s %s", verb, url)
+	for name, value := range headers {
+		Debug("%s: %s", name, value)
+	}
 	if len(body) != 0 {
 		Debug("Body:\n%s", string(body))
 	}
@@ -93,6 +185,7 @@ func HttpDo(verb string, url string, body []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	body, err = io.ReadAll(res.Body)
 	if err != nil {
@@ -100,11 +193,8 @@ func HttpDo(verb string, url string, body []byte) ([]byte, error) {
 	}
 
 	if res.StatusCode/100 != 2 {
-		tmp := res.Status
-		if len(body) != 0 {
-			tmp = string(body)
-		}
-		err = fmt.Errorf(tmp)
+		err = NewHttpError(res.StatusCode, res.Status,
+			res.Header.Get("Content-Type"), body)
 	}
 
 	Debug("Response: %s", res.Status)
@@ -112,7 +202,11 @@ func HttpDo(verb string, url string, body []byte) ([]byte, error) {
 		Debug("Body:\n%s", string(body))
 	}
 
-	return body, err
+	return &HttpResponse{
+		Code:   res.StatusCode,
+		Header: res.Header,
+		Body:   body,
+	}, err
 }
 
 // Support "http" and "-" (stdin)
@@ -173,6 +267,14 @@ func ToJSON(val any) string {
 	return string(buf)
 }
 
+func ToYAML(val any) string {
+	buf, err := registry.JSONToYAML([]byte(ToJSON(val)))
+	if err != nil {
+		return fmt.Sprintf("Error converting to YAML: %s\n", err)
+	}
+	return string(buf)
+}
+
 func ArrayContains(strs []string, needle string) bool {
 	for _, s := range strs {
 		if needle == s {
@@ -214,3 +316,37 @@ func ParseXID(xidStr string) *XID {
 	}
 	return xid
 }
+
+func (xid *XID) String() string {
+	res := ""
+	for _, part := range []string{xid.Group, xid.GroupID, xid.Resource,
+		xid.ResourceID, xid.Version, xid.VersionID} {
+		if part == "" {
+			break
+		}
+		res += "/" + part
+	}
+	if res == "" {
+		res = "/"
+	}
+	return res
+}
+
+// Guesses the media type of a document based on its file name
+func ContentTypeFromFileName(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	switch ext {
+	case ".json", ".avsc":
+		return "application/json"
+	case ".yaml", ".yml":
+		return "application/yaml"
+	case ".xml", ".xsd":
+		return "application/xml"
+	case ".proto":
+		return "application/x-protobuf"
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -3,10 +3,12 @@ module github.com/xregistry/server
 go 1.20
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/duglin/dlog v0.0.0-20231117185220-2f50b3ce612d
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/google/uuid v1.3.0
 	github.com/spf13/cobra v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/duglin/dlog"
+	"github.com/google/uuid"
+)
+
+// Where to write the JSON access log entries, one per line. nil means
+// access logging is turned off.
+var AccessLog io.Writer
+var accessLogMutex sync.Mutex
+
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+type AccessLogEntry struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"requestid"`
+	User       string  `json:"user,omitempty"`
+	Registry   string  `json:"registry,omitempty"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"durationms"`
+	Queries    int     `json:"queries"`
+	Error      string  `json:"error,omitempty"`
+}
+
+func WriteAccessLog(entry *AccessLogEntry) {
+	if AccessLog == nil {
+		return
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error writing access log: %s", err)
+		return
+	}
+
+	accessLogMutex.Lock()
+	defer accessLogMutex.Unlock()
+	AccessLog.Write(append(buf, '\n'))
+}
+
+// Uses the client's X-Request-Id if it looks reasonable, otherwise a new
+// one is generated
+func GetRequestID(r *http.Request) string {
+	id := r.Header.Get(REQUEST_ID_HEADER)
+	if id == "" || len(id) > 128 {
+		return uuid.NewString()
+	}
+	for _, ch := range id {
+		if !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') &&
+			!(ch >= '0' && ch <= '9') && !strings.ContainsRune("-_.:", ch) {
+			return uuid.NewString()
+		}
+	}
+	return id
+}
+
+// Keeps track of the status and # of bytes sent for the access log
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (aw *accessWriter) WriteHeader(code int) {
+	if aw.status == 0 {
+		aw.status = code
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *accessWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(b)
+	aw.bytes += int64(n)
+	return n, err
+}
+
+func (aw *accessWriter) Status() int {
+	if aw.status == 0 {
+		return http.StatusOK
+	}
+	return aw.status
+}
+
+func newAccessLogEntry(r *http.Request, reqID string, aw *accessWriter,
+	start time.Time) *AccessLogEntry {
+
+	return &AccessLogEntry{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		RequestID:  reqID,
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Status:     aw.Status(),
+		Bytes:      aw.bytes,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+}
+
+// The verbosity to use for this Tx's logging. The "?verbose" query
+// parameter can raise it for just one request, w/o touching the global
+// verbosity that other requests are using. Only logging done via a Tx
+// (tx.VPrintf) honors it, code that runs outside of a request (startup,
+// the DB setup, background sweepers) always uses the global verbosity.
+func (tx *Tx) GetVerbose() int {
+	if tx != nil && tx.Verbose > log.GetVerbose() {
+		return tx.Verbose
+	}
+	return log.GetVerbose()
+}
+
+// Like log.VPrintf but uses the Tx's verbosity and includes its request ID.
+// A nil Tx is ok, it'll just use the global verbosity.
+func (tx *Tx) VPrintf(v int, f string, args ...any) {
+	if tx == nil {
+		log.VPrintf(v, f, args...)
+		return
+	}
+
+	if v > tx.GetVerbose() {
+		return
+	}
+
+	if tx.RequestID != "" {
+		prefix := "[" + tx.RequestID + "] "
+		// Keep the dlog indent markers at the start
+		if len(f) > 0 && (f[0] == '>' || f[0] == '<') {
+			f = f[:1] + prefix + f[1:]
+		} else {
+			f = prefix + f
+		}
+	}
+
+	// Already checked the verbosity
+	log.VPrintf(log.GetVerbose(), f, args...)
+}
+
+func (tx *Tx) Printf(f string, args ...any) {
+	tx.VPrintf(1, f, args...)
+}
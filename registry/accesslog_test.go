@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+func TestGetRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, test := range []struct {
+		header string
+		keep   bool
+	}{
+		{"", false},
+		{"abc-123_x.y:z", true},
+		{"has space", false},
+		{"quote\"", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	} {
+		req.Header.Set(REQUEST_ID_HEADER, test.header)
+		id := GetRequestID(req)
+		if (id == test.header) != test.keep || id == "" {
+			t.Fatalf("%q: got %q", test.header, id)
+		}
+	}
+}
+
+func TestAccessWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	aw := &accessWriter{ResponseWriter: rec}
+	if aw.Status() != 200 {
+		t.Fatalf("Default status should be 200")
+	}
+	aw.WriteHeader(404)
+	aw.Write([]byte("Not found\n"))
+
+	buf := &bytes.Buffer{}
+	AccessLog = buf
+	defer func() { AccessLog = nil }()
+
+	req := httptest.NewRequest("DELETE", "/dirs?x=1", nil)
+	entry := newAccessLogEntry(req, "id1", aw, time.Now())
+	entry.Queries = 3
+	WriteAccessLog(entry)
+
+	got := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Bad JSON(%s): %s", buf.String(), err)
+	}
+	if got["requestid"] != "id1" || got["method"] != "DELETE" ||
+		got["path"] != "/dirs?x=1" || got["status"] != 404.0 ||
+		got["bytes"] != 10.0 || got["queries"] != 3.0 || got["error"] != nil {
+		t.Fatalf("Bad entry: %s", buf.String())
+	}
+}
+
+func TestTxLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	saveWriter, saveVerbose := log.Writer(), log.GetVerbose()
+	log.SetOutput(buf)
+	log.SetVerbose(1)
+	defer func() {
+		log.SetOutput(saveWriter)
+		log.SetVerbose(saveVerbose)
+	}()
+
+	tx := &Tx{RequestID: "r1"}
+	tx.VPrintf(2, "hidden")
+	tx.Printf("shown %d", 1)
+
+	tx.Verbose = 3
+	tx.VPrintf(3, "debug")
+	if log.GetVerbose() != 1 {
+		t.Fatalf("Global verbosity changed")
+	}
+
+	var nilTx *Tx
+	nilTx.Printf("no tx")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") ||
+		!strings.Contains(out, "[r1] shown 1") ||
+		!strings.Contains(out, "[r1] debug") ||
+		!strings.Contains(out, "no tx") {
+		t.Fatalf("Bad output:\n%s", out)
+	}
+}
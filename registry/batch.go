@@ -0,0 +1,255 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// POST /batch - runs a list of write operations against the registry.
+//
+// In "atomic" mode (the default) all of the operations are done in one Tx
+// and the first failure undoes all of them. In "best-effort" mode each
+// operation is committed on its own and a failure only affects that one
+// operation. Either way the response has the result of each operation.
+
+const (
+	BATCH_ATOMIC      = "atomic"
+	BATCH_BEST_EFFORT = "best-effort"
+)
+
+var BatchMaxOperations = 1000
+
+var batchOps = map[string]string{
+	"upsert": "PUT",
+	"patch":  "PATCH",
+	"delete": "DELETE",
+}
+
+type BatchOperation struct {
+	Op   string          `json:"op"`             // upsert, patch, delete
+	Path string          `json:"path"`           // Relative to the registry
+	Body json.RawMessage `json:"body,omitempty"` // Sent as is
+}
+
+type BatchRequest struct {
+	Mode       string            `json:"mode,omitempty"`
+	Operations []*BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Op     string          `json:"op"`
+	Path   string          `json:"path"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`  // Only if it's JSON
+	Error  *Problem        `json:"error,omitempty"` // Only if it failed
+}
+
+type BatchResponse struct {
+	Mode      string         `json:"mode"`
+	Committed bool           `json:"committed"` // Was anything saved?
+	Results   []*BatchResult `json:"results"`
+}
+
+// Holds the response of one operation
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *batchResponseWriter) Header() http.Header { return bw.header }
+
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
+
+func (bw *batchResponseWriter) WriteHeader(code int) {
+	if bw.status == 0 {
+		bw.status = code
+	}
+}
+
+func ParseBatchRequest(buf []byte) (*BatchRequest, error) {
+	br := &BatchRequest{}
+	if err := Unmarshal(buf, br); err != nil {
+		return nil, fmt.Errorf("Error parsing batch request: %s", err)
+	}
+
+	if br.Mode == "" {
+		br.Mode = BATCH_ATOMIC
+	}
+	if br.Mode != BATCH_ATOMIC && br.Mode != BATCH_BEST_EFFORT {
+		return nil, fmt.Errorf("Invalid batch \"mode\" %q, must be one "+
+			"of: %s, %s", br.Mode, BATCH_ATOMIC, BATCH_BEST_EFFORT)
+	}
+
+	if len(br.Operations) == 0 {
+		return nil, fmt.Errorf("A batch request must have at least one " +
+			"operation")
+	}
+	if len(br.Operations) > BatchMaxOperations {
+		return nil, fmt.Errorf("Too many operations in batch request "+
+			"(%d), the max is %d", len(br.Operations), BatchMaxOperations)
+	}
+
+	for i, op := range br.Operations {
+		if _, ok := batchOps[op.Op]; !ok {
+			return nil, fmt.Errorf("Operation %d: invalid \"op\" %q, must "+
+				"be one of: delete, patch, upsert", i, op.Op)
+		}
+
+		if op.Path == "" || op.Path[0] != '/' {
+			return nil, fmt.Errorf("Operation %d: \"path\" must start "+
+				"with \"/\"", i)
+		}
+		first, _, _ := strings.Cut(strings.TrimLeft(op.Path, "/"), "/")
+		first, _, _ = strings.Cut(first, "?")
+		if strings.HasPrefix(first, "reg-") || first == "batch" {
+			return nil, fmt.Errorf("Operation %d: \"path\" (%s) isn't "+
+				"allowed in a batch request", i, op.Path)
+		}
+	}
+
+	return br, nil
+}
+
+func HTTPBatch(info *RequestInfo) error {
+	info.tx.VPrintf(3, ">Enter: HTTPBatch")
+	defer info.tx.VPrintf(3, "<Exit: HTTPBatch")
+
+	if strings.ToUpper(info.OriginalRequest.Method) != "POST" {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("%s not allowed on /batch",
+			strings.ToUpper(info.OriginalRequest.Method))
+	}
+	if len(info.Parts) > 1 {
+		info.StatusCode = http.StatusNotFound
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
+	}
+
+	buf, err := info.ReadBody()
+	if err != nil {
+		return err
+	}
+	br, err := ParseBatchRequest(buf)
+	if err != nil {
+		return err
+	}
+
+	res := &BatchResponse{
+		Mode:    br.Mode,
+		Results: []*BatchResult{},
+	}
+
+	failed := false
+	for _, op := range br.Operations {
+		result := &BatchResult{Op: op.Op, Path: op.Path}
+		res.Results = append(res.Results, result)
+
+		if failed {
+			// Atomic mode, and an earlier one failed
+			result.Status = http.StatusFailedDependency
+			continue
+		}
+
+		err := batchDo(info, op, result)
+
+		if br.Mode == BATCH_BEST_EFFORT {
+			if err == nil {
+				if err = info.tx.Commit(); err != nil {
+					result.Status = http.StatusInternalServerError
+					result.Error = NewProblem(err, result.Status, op.Path)
+					result.Body = nil
+				}
+			}
+			if err != nil {
+				info.tx.Rollback()
+			}
+			res.Committed = res.Committed || err == nil
+			continue
+		}
+
+		if err != nil {
+			info.tx.Rollback()
+			failed = true
+			info.StatusCode = result.Status
+		}
+	}
+
+	if br.Mode == BATCH_ATOMIC {
+		// The Tx is committed by our caller
+		res.Committed = !failed
+	}
+
+	buf, err = json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	info.AddHeader("Content-Type", "application/json")
+	info.Write(buf)
+	info.Write([]byte("\n"))
+	return nil
+}
+
+// Runs one operation using the same code as a normal HTTP request would,
+// but w/o committing the Tx. Fills in "result" and returns the error, if any.
+func batchDo(parent *RequestInfo, op *BatchOperation, result *BatchResult) error {
+	parent.tx.VPrintf(3, "Batch: %s %s", op.Op, op.Path)
+
+	// No "reg-" prefix is needed in the URL since the Tx already points to
+	// the registry that the batch request was sent to
+	req, err := http.NewRequest(batchOps[op.Op],
+		"http://"+parent.OriginalRequest.Host+op.Path,
+		bytes.NewReader(op.Body))
+	if err != nil {
+		result.Status = http.StatusBadRequest
+		result.Error = NewProblem(err, result.Status, op.Path)
+		return err
+	}
+	req.Host = parent.OriginalRequest.Host
+	req.TLS = parent.OriginalRequest.TLS
+	if len(op.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := &batchResponseWriter{header: http.Header{}}
+	info, err := ParseRequest(parent.tx, w, req)
+	if err == nil {
+		info.BaseURL = parent.BaseURL
+
+		switch req.Method {
+		case "PUT", "PATCH":
+			err = HTTPPutPost(info)
+		case "DELETE":
+			err = HTTPDelete(info)
+		}
+	}
+
+	if err != nil {
+		info.SetErrorStatus(err)
+		result.Status = info.StatusCode
+		result.Error = NewProblem(err, result.Status, req.URL.Path)
+		return err
+	}
+
+	info.HTTPWriter.Done()
+	result.Status = w.status
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+
+	body := bytes.TrimSpace(w.body.Bytes())
+	if strings.HasPrefix(w.header.Get("Content-Type"), "application/json") &&
+		json.Valid(body) {
+		result.Body = body
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseBatchRequest(t *testing.T) {
+	tooMany := `{"operations":[` + strings.Repeat(`{"op":"delete","path":"/d"},`,
+		BatchMaxOperations) + `{"op":"delete","path":"/d"}]}`
+
+	for _, test := range []struct {
+		body string
+		err  string
+	}{
+		{`{"operations":[{"op":"upsert","path":"/dirs/d1","body":{}}]}`, ""},
+		{`{"mode":"best-effort","operations":[{"op":"delete","path":"/d"}]}`,
+			""},
+		{`{"mode":"foo","operations":[{"op":"delete","path":"/d"}]}`,
+			`Invalid batch "mode" "foo", must be one of: atomic, best-effort`},
+		{`{"operations":[]}`,
+			`A batch request must have at least one operation`},
+		{tooMany, fmt.Sprintf("Too many operations in batch request "+
+			"(%d), the max is %d", BatchMaxOperations+1, BatchMaxOperations)},
+		{`{"operations":[{"op":"get","path":"/d"}]}`,
+			`Operation 0: invalid "op" "get", must be one of: delete, ` +
+				`patch, upsert`},
+		{`{"operations":[{"op":"patch","path":"/d"},{"op":"patch"}]}`,
+			`Operation 1: "path" must start with "/"`},
+		{`{"operations":[{"op":"patch","path":"/reg-foo/d"}]}`,
+			`Operation 0: "path" (/reg-foo/d) isn't allowed in a batch request`},
+		{`{"operations":[{"op":"patch","path":"/batch?x"}]}`,
+			`Operation 0: "path" (/batch?x) isn't allowed in a batch request`},
+	} {
+		br, err := ParseBatchRequest([]byte(test.body))
+		if test.err == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", test.body, err)
+			}
+			if br.Mode == "" {
+				t.Fatalf("%s: mode should default", test.body)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("%.60s:\nExp: %s\nGot: %v", test.body, test.err, err)
+		}
+	}
+}
@@ -47,7 +47,7 @@ type Offered struct {
 var AllowableFlags = ArrayToLower([]string{
 	"doc", "epoch", "filter", "inline",
 	"nodefaultversionid", "nodefaultversionsticky",
-	"noepoch", "noreadonly", "offered",
+	"noepoch", "noreadonly", "offered", "referencedby",
 	"schema", "setdefaultversionid", "specversion"})
 
 var AllowableMutable = ArrayToLower([]string{
@@ -17,6 +17,25 @@ const SETVERSIONID = true
 const SETDEFAULTSTICKY = true
 const HASDOCUMENT = true
 const READONLY = false
+const XREFDELETE = XREFDELETE_BLOCK
+
+// Model "xrefdelete" values - what to do with Resources that have an "xref"
+// pointing to a Resource that's being deleted
+const XREFDELETE_BLOCK = "block"           // fail the delete
+const XREFDELETE_CASCADE = "cascade"       // delete the xref'ing Resources too
+const XREFDELETE_STANDALONE = "standalone" // copy target's Versions into them
+
+// Model attribute "ondelete" values - what to do with entities that have an
+// "xid" attribute pointing to an entity that's being deleted. If not set then
+// the xid isn't checked at all
+const ONDELETE_RESTRICT = "restrict" // fail the delete
+const ONDELETE_SETNULL = "setnull"   // remove the attribute from the entity
+const ONDELETE_CASCADE = "cascade"   // delete the referencing entities too
+
+// Model "versionlock" values - when a Version's document, and "immutable"
+// attributes, can no longer be changed. If not set then they can always change
+const VERSIONLOCK_MANUAL = "manual"     // once its "locked" attribute is true
+const VERSIONLOCK_ONCREATE = "oncreate" // as soon as it's created
 
 // Attribute types
 const ANY = "any"
@@ -0,0 +1,461 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// Where Version documents (blobs) are kept when they're not stored in the
+// ResourceContents table itself. Blobs are immutable and are identified by
+// an ID chosen by the store - for FileContentStore it's the SHA-256 of the
+// data, so the same document used by many Versions is only stored once.
+type ContentStore interface {
+	// Saves everything read from "r", returns the blob's ID and size
+	Put(r io.Reader) (string, int64, error)
+
+	// Returns a reader for the blob, it's up to the caller to close it
+	Open(id string) (io.ReadCloser, error)
+
+	// Deleting a blob that doesn't exist is not an error
+	Delete(id string) error
+
+	// Returns the IDs of the blobs that haven't been written in at least
+	// "age" time. Used to find unreferenced blobs that are safe to delete.
+	List(age time.Duration) ([]string, error)
+
+	// Same as Delete but only if the blob still hasn't been written in at
+	// least "age" time, since a Put of the same data might have happened
+	// after it was returned by List. Returns true if it was deleted.
+	DeleteIfOlder(id string, age time.Duration) (bool, error)
+}
+
+// The ContentStore to use for new documents. If nil then documents are
+// stored in the DB.
+var Contents ContentStore
+
+// Documents that have been saved in the ContentStore, but not yet in the DB,
+// use this as their value in an entity's NewObject
+type ContentRef struct {
+	BlobID string
+	Size   int64
+}
+
+// Saves the data from "r" in the ContentStore. If there's no data then
+// nil is returned.
+func StoreContent(r io.Reader) (*ContentRef, error) {
+	PanicIf(Contents == nil, "No ContentStore defined")
+
+	id, size, err := Contents.Put(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error saving document: %w", err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	return &ContentRef{BlobID: id, Size: size}, nil
+}
+
+// Saves "val" ([]byte, string or *ContentRef) as the document for the
+// Version "vSID". If there's a ContentStore then it's used, otherwise the
+// data is saved in the DB.
+func SaveContent(tx *Tx, vSID string, val any) error {
+	ref, ok := val.(*ContentRef)
+
+	if !ok && Contents != nil {
+		data, err := ContentBytes(val)
+		if err != nil {
+			return err
+		}
+		if ref, err = StoreContent(bytes.NewReader(data)); err != nil {
+			return err
+		}
+		if ref == nil {
+			// Empty docs are kept in the DB so we don't need a blob
+			val = []byte{}
+		}
+	}
+
+	if ref != nil {
+		return DoOneTwo(tx, `
+            REPLACE INTO ResourceContents(VersionSID, Content, BlobID)
+            VALUES(?,NULL,?)`, vSID, ref.BlobID)
+	}
+
+	return DoOneTwo(tx, `
+        REPLACE INTO ResourceContents(VersionSID, Content, BlobID)
+        VALUES(?,?,NULL)`, vSID, val)
+}
+
+// Returns a reader for the document saved under "contentID" (a Version's
+// "#contentid"), or nil if there isn't one
+func OpenContent(tx *Tx, contentID any) (io.ReadCloser, error) {
+	if IsNil(contentID) {
+		return nil, nil
+	}
+
+	results, err := Query(tx, `
+        SELECT Content, BlobID FROM ResourceContents WHERE VersionSID=?`,
+		contentID)
+	defer results.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Error finding contents %q: %s", contentID, err)
+	}
+
+	row := results.NextRow()
+	if row == nil {
+		return nil, nil
+	}
+
+	if blobID := NotNilString(row[1]); blobID != "" {
+		if Contents == nil {
+			return nil, fmt.Errorf("Document %q is in a content store, "+
+				"but none is configured", contentID)
+		}
+		return Contents.Open(blobID)
+	}
+
+	data := []byte(nil)
+	if *row[0] != nil {
+		data = (*row[0]).([]byte)
+	}
+	return bytesReadCloser{bytes.NewReader(data)}, nil
+}
+
+// Like io.NopCloser but it can still Seek
+type bytesReadCloser struct {
+	*bytes.Reader
+}
+
+func (brc bytesReadCloser) Close() error { return nil }
+
+// Same as OpenContent but returns all of the data
+func ReadContent(tx *Tx, contentID any) ([]byte, error) {
+	rc, err := OpenContent(tx, contentID)
+	if err != nil || rc == nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// Converts the possible types of a document's value into bytes
+func ContentBytes(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case *ContentRef:
+		PanicIf(Contents == nil, "No ContentStore defined")
+		rc, err := Contents.Open(v.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return []byte(fmt.Sprintf("%v", val)), nil
+}
+
+// Moves all of the documents that are in the DB into the ContentStore.
+// Each document is moved in its own Tx so this can be stopped, and
+// restarted, at any time. Returns the number of documents moved.
+func MigrateContentToStore() (int, error) {
+	log.VPrintf(3, ">Enter: MigrateContentToStore")
+	defer log.VPrintf(3, "<Exit: MigrateContentToStore")
+
+	if Contents == nil {
+		return 0, fmt.Errorf("No content store is configured")
+	}
+
+	tx, err := NewTx()
+	if err != nil {
+		return 0, err
+	}
+
+	results, err := Query(tx, `
+        SELECT VersionSID FROM ResourceContents
+        WHERE BlobID IS NULL AND LENGTH(Content)>0`)
+	defer results.Close()
+
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	vSIDs := []string{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		vSIDs = append(vSIDs, NotNilString(row[0]))
+	}
+	results.Close()
+	tx.Rollback()
+
+	count := 0
+	for _, vSID := range vSIDs {
+		if tx, err = NewTx(); err != nil {
+			return count, err
+		}
+
+		err = migrateContent(tx, vSID)
+
+		if txErr := tx.Conditional(err); txErr != nil {
+			return count, txErr
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func migrateContent(tx *Tx, vSID string) error {
+	data, err := ReadContent(tx, vSID)
+	if err != nil {
+		return err
+	}
+
+	ref, err := StoreContent(bytes.NewReader(data))
+	if err != nil || ref == nil {
+		return err
+	}
+
+	return DoOne(tx, `
+        UPDATE ResourceContents SET Content=NULL, BlobID=?
+        WHERE VersionSID=? AND BlobID IS NULL`, ref.BlobID, vSID)
+}
+
+// Deletes any blob in the ContentStore that isn't used by a Version and
+// that's older than "age". Blobs that are newer might belong to a Tx that
+// hasn't been committed yet. Returns the number of blobs deleted.
+func PruneContentStore(age time.Duration) (int, error) {
+	log.VPrintf(3, ">Enter: PruneContentStore")
+	defer log.VPrintf(3, "<Exit: PruneContentStore")
+
+	if Contents == nil {
+		return 0, nil
+	}
+
+	ids, err := Contents.List(age)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	tx, err := NewTx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	results, err := Query(tx, `
+        SELECT DISTINCT BlobID FROM ResourceContents WHERE BlobID IS NOT NULL`)
+	defer results.Close()
+
+	if err != nil {
+		return 0, err
+	}
+
+	used := map[string]bool{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		used[NotNilString(row[0])] = true
+	}
+
+	count := 0
+	for _, id := range ids {
+		if used[id] {
+			continue
+		}
+		deleted, err := Contents.DeleteIfOlder(id, age)
+		if err != nil {
+			return count, err
+		}
+		if deleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Starts a go-routine that will delete unused blobs that are older than
+// "age" every "interval"
+func StartContentStorePruner(interval time.Duration, age time.Duration) {
+	if interval <= 0 || Contents == nil {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			count, err := PruneContentStore(age)
+			if err != nil {
+				log.Printf("Error pruning content store: %s", err)
+			} else if count > 0 {
+				log.VPrintf(2, "Content store: deleted %d blobs", count)
+			}
+		}
+	}()
+}
+
+// A ContentStore that saves each blob as a file under "Dir". The file's
+// name is the SHA-256 of its data, so identical documents are only saved
+// once.
+type FileContentStore struct {
+	Dir string
+
+	// Makes checking a blob's age and then touching or deleting it atomic
+	mutex sync.Mutex
+}
+
+var _ ContentStore = &FileContentStore{}
+
+func NewFileContentStore(dir string) (*FileContentStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating content store dir %q: %s",
+			dir, err)
+	}
+	return &FileContentStore{Dir: dir}, nil
+}
+
+func IsValidBlobID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// ab12... is saved as DIR/ab/ab12... to keep the size of each dir down
+func (fcs *FileContentStore) blobPath(id string) string {
+	return filepath.Join(fcs.Dir, id[:2], id)
+}
+
+func (fcs *FileContentStore) Put(r io.Reader) (string, int64, error) {
+	// Write to a temp file as we calculate the hash so we never need to
+	// hold the entire blob in memory
+	tmp, err := os.CreateTemp(fcs.Dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name()) // Just in case, no-op after the Rename
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	id := hex.EncodeToString(hash.Sum(nil))
+	path := fcs.blobPath(id)
+
+	fcs.mutex.Lock()
+	defer fcs.mutex.Unlock()
+
+	if _, err = os.Stat(path); err == nil {
+		// Already have it. Touch it so it isn't pruned before the caller's
+		// Tx has a chance to reference it
+		now := time.Now()
+		return id, size, os.Chtimes(path, now, now)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+
+	return id, size, nil
+}
+
+func (fcs *FileContentStore) Open(id string) (io.ReadCloser, error) {
+	if !IsValidBlobID(id) {
+		return nil, fmt.Errorf("Invalid blob ID %q", id)
+	}
+	return os.Open(fcs.blobPath(id))
+}
+
+func (fcs *FileContentStore) Delete(id string) error {
+	if !IsValidBlobID(id) {
+		return fmt.Errorf("Invalid blob ID %q", id)
+	}
+	err := os.Remove(fcs.blobPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fcs *FileContentStore) DeleteIfOlder(id string,
+	age time.Duration) (bool, error) {
+
+	if !IsValidBlobID(id) {
+		return false, fmt.Errorf("Invalid blob ID %q", id)
+	}
+
+	fcs.mutex.Lock()
+	defer fcs.mutex.Unlock()
+
+	info, err := os.Stat(fcs.blobPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return false, err
+	}
+	if !info.ModTime().Before(time.Now().Add(-age)) {
+		return false, nil
+	}
+
+	err = os.Remove(fcs.blobPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+func (fcs *FileContentStore) List(age time.Duration) ([]string, error) {
+	ids := []string{}
+	cutoff := time.Now().Add(-age)
+
+	err := filepath.WalkDir(fcs.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") ||
+			!IsValidBlobID(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			ids = append(ids, d.Name())
+		}
+		return nil
+	})
+
+	return ids, err
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileContentStore(t *testing.T) {
+	fcs, err := NewFileContentStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileContentStore: %s", err)
+	}
+
+	id1, size, err := fcs.Put(strings.NewReader("hello"))
+	if err != nil || size != 5 {
+		t.Fatalf("Put: %d %s", size, err)
+	}
+	// sha256("hello")
+	if id1 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("Bad ID: %s", id1)
+	}
+
+	// Same data is only stored once
+	id2, _, err := fcs.Put(strings.NewReader("hello"))
+	if err != nil || id2 != id1 {
+		t.Fatalf("Dedup: %s %s", id2, err)
+	}
+	id3, _, err := fcs.Put(strings.NewReader("world"))
+	if err != nil || id3 == id1 {
+		t.Fatalf("Put: %s %s", id3, err)
+	}
+
+	rc, err := fcs.Open(id1)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	buf, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("Read: %q %s", string(buf), err)
+	}
+
+	if _, err = fcs.Open("../../etc/passwd"); err == nil {
+		t.Fatalf("Open should have failed")
+	}
+
+	ids, err := fcs.List(0)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("List: %v %s", ids, err)
+	}
+	ids, err = fcs.List(time.Hour)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("List(hour): %v %s", ids, err)
+	}
+
+	// Make "hello" look old, writing it again should make it new again
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(fcs.blobPath(id1), old, old)
+	ids, _ = fcs.List(time.Hour)
+	if len(ids) != 1 || ids[0] != id1 {
+		t.Fatalf("List(old): %v", ids)
+	}
+	fcs.Put(strings.NewReader("hello"))
+	ids, _ = fcs.List(time.Hour)
+	if len(ids) != 0 {
+		t.Fatalf("List(touched): %v", ids)
+	}
+
+	// A blob that was written again after it was listed isn't deleted
+	os.Chtimes(fcs.blobPath(id3), old, old)
+	ids, _ = fcs.List(time.Hour)
+	if len(ids) != 1 || ids[0] != id3 {
+		t.Fatalf("List(old): %v", ids)
+	}
+	fcs.Put(strings.NewReader("world"))
+	if deleted, err := fcs.DeleteIfOlder(id3, time.Hour); err != nil || deleted {
+		t.Fatalf("DeleteIfOlder(touched): %v %s", deleted, err)
+	}
+	os.Chtimes(fcs.blobPath(id3), old, old)
+	if deleted, err := fcs.DeleteIfOlder(id3, time.Hour); err != nil || !deleted {
+		t.Fatalf("DeleteIfOlder(old): %v %s", deleted, err)
+	}
+	if deleted, err := fcs.DeleteIfOlder(id3, time.Hour); err != nil || deleted {
+		t.Fatalf("DeleteIfOlder(gone): %v %s", deleted, err)
+	}
+
+	if err = fcs.Delete(id1); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if err = fcs.Delete(id1); err != nil {
+		t.Fatalf("Delete again: %s", err)
+	}
+	if _, err = fcs.Open(id1); err == nil {
+		t.Fatalf("Open of deleted blob should have failed")
+	}
+
+	// Only blobs show up, not temp files
+	entries, _ := os.ReadDir(fcs.Dir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			t.Fatalf("Temp file left behind: %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cross-Origin Resource Sharing settings so that browser-based tools can
+// talk to the registry directly
+type CORSConfig struct {
+	AllowedOrigins   []string // "*" means any
+	AllowedMethods   []string
+	AllowedHeaders   []string // Empty means whatever the client asks for
+	ExposedHeaders   []string // In addition to all xRegistry-* headers
+	AllowCredentials bool
+	MaxAge           time.Duration // How long preflight results can be cached
+}
+
+func NewCORSConfig(origins []string) *CORSConfig {
+	return &CORSConfig{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "PUT", "POST", "PATCH", "DELETE"},
+		ExposedHeaders: []string{"Content-Disposition", "Content-Location",
+			"Location", "Content-Range", "Accept-Ranges"},
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+func (cc *CORSConfig) IsAllowedOrigin(origin string) bool {
+	for _, o := range cc.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials are only allowed for origins that are explicitly listed,
+// never for ones that only matched "*", otherwise any site could make
+// authenticated requests on the user's behalf
+func (cc *CORSConfig) AllowsCredentials(origin string) bool {
+	if !cc.AllowCredentials {
+		return false
+	}
+	for _, o := range cc.AllowedOrigins {
+		if o != "*" && strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wraps "next" so that CORS preflight requests are answered, and the
+// CORS headers are added to all other responses
+func (cc *CORSConfig) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		if !cc.IsAllowedOrigin(origin) {
+			// No CORS headers means the browser will block it
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", origin)
+		if cc.AllowsCredentials(origin) {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// Preflight
+		reqMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && reqMethod != "" {
+			if !ArrayContainsAnyCase(cc.AllowedMethods, reqMethod) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			header.Set("Access-Control-Allow-Methods",
+				strings.Join(cc.AllowedMethods, ", "))
+
+			if len(cc.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers",
+					strings.Join(cc.AllowedHeaders, ", "))
+			} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+
+			if cc.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age",
+					strconv.Itoa(int(cc.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(&corsWriter{ResponseWriter: w, config: cc}, r)
+	})
+}
+
+// Adds the "Access-Control-Expose-Headers" header just before the response
+// is sent, since that's when we know which xRegistry-* headers are there
+type corsWriter struct {
+	http.ResponseWriter
+	config      *CORSConfig
+	wroteHeader bool
+}
+
+func (cw *corsWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+
+		exposed := append([]string{}, cw.config.ExposedHeaders...)
+		for name := range cw.Header() {
+			if strings.HasPrefix(strings.ToLower(name), "xregistry-") {
+				exposed = append(exposed, name)
+			}
+		}
+		if len(exposed) > 0 {
+			sort.Strings(exposed[len(cw.config.ExposedHeaders):])
+			cw.Header().Set("Access-Control-Expose-Headers",
+				strings.Join(exposed, ", "))
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *corsWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	cc := NewCORSConfig([]string{"https://ui.example.com"})
+	handler := cc.Wrap(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["xRegistry-fileid"] = []string{"f1"}
+			w.Header()["xRegistry-epoch"] = []string{"1"}
+			w.Write([]byte("hello"))
+		}))
+
+	do := func(method string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/dirs/d1/files/f1", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// No Origin, no CORS
+	rec := do("GET")
+	if rec.Code != 200 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("No origin: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = do("GET", "Origin", "https://ui.example.com")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://ui.example.com" {
+		t.Fatalf("Allowed origin: %v", rec.Header())
+	}
+	exp := "Content-Disposition, Content-Location, Location, Content-Range, " +
+		"Accept-Ranges, xRegistry-epoch, xRegistry-fileid"
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != exp {
+		t.Fatalf("Expose:\nExp: %s\nGot: %s", exp, got)
+	}
+	if rec.Body.String() != "hello" {
+		t.Fatalf("Body: %q", rec.Body.String())
+	}
+
+	rec = do("GET", "Origin", "https://evil.example.com")
+	if rec.Code != 200 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("Bad origin: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = do("OPTIONS", "Origin", "https://ui.example.com",
+		"Access-Control-Request-Method", "PUT",
+		"Access-Control-Request-Headers", "Content-Type, xRegistry-name")
+	if rec.Code != 204 ||
+		rec.Header().Get("Access-Control-Allow-Methods") != "GET, PUT, POST, PATCH, DELETE" ||
+		rec.Header().Get("Access-Control-Allow-Headers") != "Content-Type, xRegistry-name" ||
+		rec.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("Preflight: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = do("OPTIONS", "Origin", "https://ui.example.com",
+		"Access-Control-Request-Method", "TRACE")
+	if rec.Code != 403 {
+		t.Fatalf("Bad method: %d", rec.Code)
+	}
+
+	rec = do("OPTIONS", "Origin", "https://evil.example.com",
+		"Access-Control-Request-Method", "GET")
+	if rec.Code != 403 {
+		t.Fatalf("Bad origin preflight: %d", rec.Code)
+	}
+
+	cc.AllowedOrigins = []string{"*"}
+	rec = do("GET", "Origin", "https://any.example.com")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://any.example.com" {
+		t.Fatalf("Any origin: %v", rec.Header())
+	}
+
+	// "*" never gets credentials, only explicitly listed origins do
+	cc.AllowCredentials = true
+	rec = do("GET", "Origin", "https://any.example.com")
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("Any origin with credentials: %v", rec.Header())
+	}
+
+	cc.AllowedOrigins = []string{"*", "https://ui.example.com"}
+	rec = do("GET", "Origin", "https://ui.example.com")
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("Listed origin with credentials: %v", rec.Header())
+	}
+}
@@ -130,6 +130,18 @@ type Tx struct {
 	IgnoreDefaultVersionSticky bool
 	IgnoreDefaultVersionID     bool
 
+	// The trace span of the request this Tx is for, nil if not tracing
+	Span *Span
+
+	// Per-request logging info
+	RequestID string
+	Verbose   int // From ?verbose, only used if it's > global verbosity
+	Queries   int // # of DB calls made
+
+	// Used for all DB calls so they stop when the request times out or
+	// the client goes away. nil means context.Background()
+	Ctx context.Context
+
 	// Cache of entities this Tx is dealing with. Things can get funky if
 	// we have more than one instance of the same entity in memory.
 	// TODO DUG expand this to save all types, not just Versions.
@@ -138,6 +150,10 @@ type Tx struct {
 	// explicitly
 	Cache map[string]*Entity // e.Path
 
+	// Paths of the entities currently being deleted in this Tx. Used to
+	// stop "ondelete=cascade" from looping forever on circular references
+	deleting map[string]bool // e.Path
+
 	// For debugging
 	uuid  string   // just a unique ID for the TXs map key
 	stack []string // Stack at time NewTX
@@ -157,10 +173,16 @@ func (tx *Tx) String() string {
 }
 
 func NewTx() (*Tx, error) {
+	return NewTxWithContext(context.Background())
+}
+
+// Like NewTx but the DB transaction, and all of the Tx's DB calls, will use
+// "ctx" so they stop when it's done (e.g. the request's query timeout)
+func NewTxWithContext(ctx context.Context) (*Tx, error) {
 	log.VPrintf(4, ">Enter: NewTx")
 	defer log.VPrintf(4, "<exit: NewTx")
 
-	tx := &Tx{}
+	tx := &Tx{Ctx: ctx}
 	err := tx.NewTx()
 	if err != nil {
 		log.Printf("NewTx error: %s", err)
@@ -172,8 +194,8 @@ func NewTx() (*Tx, error) {
 // It's ok for this to be called multiple times for the same Tx just to
 // make sure we have an active transaction - it's a no-op at that point
 func (tx *Tx) NewTx() error {
-	log.VPrintf(4, ">Enter: tx.NewTx")
-	defer log.VPrintf(4, "<Exit: tx.NewTx")
+	tx.VPrintf(4, ">Enter: tx.NewTx")
+	defer tx.VPrintf(4, "<Exit: tx.NewTx")
 
 	if DB == nil {
 		if DB_Name == "" {
@@ -189,7 +211,7 @@ func (tx *Tx) NewTx() error {
 		return nil
 	}
 
-	t, err := DB.BeginTx(context.Background(),
+	t, err := DB.BeginTx(tx.Context(),
 		&sql.TxOptions{sql.LevelReadCommitted, false})
 	if err != nil {
 		DB = nil
@@ -329,6 +351,12 @@ func (tx *Tx) Rollback() error {
 		return nil
 	}
 	err := tx.tx.Rollback()
+	if err != nil && tx.ContextError() != nil {
+		// The DB conn was closed when the Context was canceled, so the
+		// DB has already undone the changes
+		tx.VPrintf(2, "Rollback after cancel: %s", err)
+		err = nil
+	}
 	Must(err)
 	if err != nil {
 		return err
@@ -352,6 +380,14 @@ func (tx *Tx) Conditional(err error) error {
 	return tx.Rollback()
 }
 
+// Returns nil if the Tx isn't part of a traced request
+func (tx *Tx) StartDBSpan(name string, cmd string) *Span {
+	span := tx.Span.StartChild(name, SPAN_CLIENT)
+	span.SetAttr("db.system", "mysql")
+	span.SetAttr("db.query.text", cmd)
+	return span
+}
+
 func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
 	// If the current Tx is closed, create a new one
 	if tx.tx == nil {
@@ -360,7 +396,7 @@ func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
 			return nil, err
 		}
 	}
-	ps, err := tx.tx.Prepare(query)
+	ps, err := tx.tx.PrepareContext(tx.Context(), query)
 
 	return ps, err
 }
@@ -476,7 +512,7 @@ func (r *Result) PullNextRow() {
 	r.Data = r.AllRows[0]
 	r.AllRows = r.AllRows[1:]
 
-	if log.GetVerbose() > 3 {
+	if r.tx.GetVerbose() > 3 {
 		dd := []string{}
 		for _, d := range r.Data {
 			dVal := reflect.ValueOf(*d)
@@ -487,7 +523,7 @@ func (r *Result) PullNextRow() {
 				dd = append(dd, fmt.Sprintf("%v", *d))
 			}
 		}
-		log.VPrintf(4, "row: %v", dd)
+		r.tx.VPrintf(4, "row: %v", dd)
 	}
 }
 
@@ -532,7 +568,7 @@ func (r *Result) RetrieveNextRowFromDB() bool {
 
 	// Move data from TempData to Data
 
-	if log.GetVerbose() >= 4 {
+	if r.tx.GetVerbose() >= 4 {
 		dd := []string{}
 		for _, d := range r.Data {
 			dVal := reflect.ValueOf(*d)
@@ -549,11 +585,22 @@ func (r *Result) RetrieveNextRowFromDB() bool {
 }
 
 func Query(tx *Tx, cmd string, args ...interface{}) (*Result, error) {
+	tx.Queries++
+	span := tx.StartDBSpan("DB Query", cmd)
+	defer span.Finish()
+
+	result, err := query(tx, cmd, args...)
+	span.SetError(err)
+	if result != nil {
+		span.SetAttr("db.response.returned_rows", len(result.AllRows))
+	}
+	return result, err
+}
+
+func query(tx *Tx, cmd string, args ...interface{}) (*Result, error) {
 	doTime := os.Getenv("RX_TIMING") != ""
 	startTime := time.Now()
-	if log.GetVerbose() >= 4 {
-		log.Printf("Query: %s", SubQuery(cmd, args))
-	}
+	tx.VPrintf(4, "Query: %s", SubQuery(cmd, args))
 
 	ps, err := tx.Prepare(cmd)
 	if doTime {
@@ -561,16 +608,22 @@ func Query(tx *Tx, cmd string, args ...interface{}) (*Result, error) {
 		log.Printf("Prep  time: %s", time.Now().Sub(startTime).Round(time.Millisecond).String())
 	}
 	if err != nil {
+		if ctxErr := tx.ContextError(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		log.Printf("Error Prepping query (%s)->%s\n", cmd, err)
 		return nil, fmt.Errorf("Error Prepping query (%s)->%s\n", cmd, err)
 	}
 	defer ps.Close()
 
-	rows, err := ps.Query(args...)
+	rows, err := ps.QueryContext(tx.Context(), args...)
 	if doTime {
 		log.Printf("Query time: %s", time.Now().Sub(startTime).Round(time.Millisecond).String())
 	}
 	if err != nil {
+		if ctxErr := tx.ContextError(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		log.Printf("Error querying DB(%s)(%v)->%s\n", cmd, args, err)
 		return nil, fmt.Errorf("Error querying DB(%s)->%s\n", cmd, err)
 	}
@@ -596,6 +649,12 @@ func Query(tx *Tx, cmd string, args ...interface{}) (*Result, error) {
 	// Download all data. We used to pull from DB on each PullNextRow
 	// but mysql doesn't support multiple queries being active in the same Tx
 	result.RetrieveAllRowsFromDB()
+	if err = rows.Err(); err != nil {
+		if ctxErr := tx.ContextError(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("Error querying DB(%s)->%s\n", cmd, err)
+	}
 	if doTime {
 		log.Printf("Get   time: %s", time.Now().Sub(startTime).Round(time.Millisecond).String())
 	}
@@ -604,21 +663,38 @@ func Query(tx *Tx, cmd string, args ...interface{}) (*Result, error) {
 }
 
 func doCount(tx *Tx, cmd string, args ...interface{}) (int, error) {
-	log.VPrintf(4, "doCount: %q args: %v", cmd, args)
+	tx.Queries++
+	span := tx.StartDBSpan("DB Exec", cmd)
+	defer span.Finish()
+
+	count, err := exec(tx, cmd, args...)
+	span.SetError(err)
+	span.SetAttr("db.response.affected_rows", count)
+	return count, err
+}
+
+func exec(tx *Tx, cmd string, args ...interface{}) (int, error) {
+	tx.VPrintf(4, "doCount: %q args: %v", cmd, args)
 	ps, err := tx.Prepare(cmd)
 	if err != nil {
+		if ctxErr := tx.ContextError(); ctxErr != nil {
+			return 0, ctxErr
+		}
 		ShowStack()
-		log.VPrintf(0, "CMD: %q args: %v", cmd, args)
+		tx.VPrintf(0, "CMD: %q args: %v", cmd, args)
 		return 0, err
 	}
 	defer ps.Close()
 
-	result, err := ps.Exec(args...)
+	result, err := ps.ExecContext(tx.Context(), args...)
 	if err != nil {
+		if ctxErr := tx.ContextError(); ctxErr != nil {
+			return 0, ctxErr
+		}
 		query := SubQuery(cmd, args)
 		log.Printf("doCount:Error DB(%s)->%s\n", query, err)
 		ShowStack()
-		log.VPrintf(0, "CMD: %q args: %v", cmd, args)
+		tx.VPrintf(0, "CMD: %q args: %v", cmd, args)
 		return 0, err
 	}
 
@@ -704,7 +780,7 @@ func DoZeroTwo(tx *Tx, cmd string, args ...interface{}) error {
 }
 
 func DoCount(tx *Tx, num int, cmd string, args ...interface{}) error {
-	log.VPrintf(4, "DoCount: %s", cmd)
+	tx.VPrintf(4, "DoCount: %s", cmd)
 	count, err := doCount(tx, cmd, args...)
 	if err != nil {
 		return err
@@ -126,7 +126,7 @@ func (e *Entity) ShowStack() {
 }
 
 func (e *Entity) Touch() {
-	log.VPrintf(3, "Touch: %s/%s", e.Singular, e.UID)
+	e.tx.VPrintf(3, "Touch: %s/%s", e.Singular, e.UID)
 
 	// See if it's already been modified (and saved) this Tx, if so exit
 	if e.ModSet && e.EpochSet {
@@ -180,27 +180,16 @@ func (e *Entity) GetPP(pp *PropPath) any {
 	if (e.Type == ENTITY_RESOURCE || e.Type == ENTITY_VERSION) && pp.Len() == 1 {
 		rm := e.GetResourceModel()
 		if rm.GetHasDocument() && pp.Top() == rm.Singular {
-			contentID := e.Get("#contentid")
-			results, err := Query(e.tx, `
-            SELECT Content FROM ResourceContents WHERE VersionSID=? `,
-				contentID)
-			defer results.Close()
-
+			data, err := ReadContent(e.tx, e.Get("#contentid"))
 			if err != nil {
 				return fmt.Errorf("Error finding contents %q: %s", e.DbSID, err)
 			}
 
-			row := results.NextRow()
-			if row == nil {
+			if data == nil {
 				// No data so just return
 				return nil
 			}
-
-			if results.NextRow() != nil {
-				panic("too many results")
-			}
-
-			return (*(row[0])).([]byte)
+			return data
 		}
 	}
 
@@ -226,7 +215,7 @@ func (e *Entity) GetPP(pp *PropPath) any {
 		val, _, _ = ObjectGetProp(e.Object, pp)
 	}
 
-	log.VPrintf(4, "%s(%s).Get(%s) -> %v", e.Plural, e.UID, pp.DB(), val)
+	e.tx.VPrintf(4, "%s(%s).Get(%s) -> %v", e.Plural, e.UID, pp.DB(), val)
 	return val
 }
 
@@ -294,8 +283,8 @@ func NestedGetProp(obj any, pp *PropPath, prev *PropPath) (any, bool, error) {
 }
 
 func RawEntityFromPath(tx *Tx, regID string, path string, anyCase bool) (*Entity, error) {
-	log.VPrintf(3, ">Enter: RawEntityFromPath(%s)", path)
-	defer log.VPrintf(3, "<Exit: RawEntityFromPath")
+	tx.VPrintf(3, ">Enter: RawEntityFromPath(%s)", path)
+	defer tx.VPrintf(3, "<Exit: RawEntityFromPath")
 
 	// RegSID,Type,Plural,Singular,eSID,UID,PropName,PropValue,PropType,Path,Abstract
 	//   0     1     2      3       4     5    6       7         8       9    10
@@ -378,8 +367,8 @@ func (e *Entity) Query(query string, args ...any) ([][]any, error) {
 }
 
 func RawEntitiesFromQuery(tx *Tx, regID string, query string, args ...any) ([]*Entity, error) {
-	log.VPrintf(3, ">Enter: RawEntititiesFromQuery(%s)", query)
-	defer log.VPrintf(3, "<Exit: RawEntitiesFromQuery")
+	tx.VPrintf(3, ">Enter: RawEntititiesFromQuery(%s)", query)
+	defer tx.VPrintf(3, "<Exit: RawEntitiesFromQuery")
 
 	// RegSID,Type,Plural,Singular,eSID,UID,PropName,PropValue,PropType,Path,Abstract
 	//   0     1     2     3        4    5     6         7        8     9     10
@@ -428,8 +417,8 @@ func RawEntitiesFromQuery(tx *Tx, regID string, query string, args ...any) ([]*E
 // Update the entity's Object - not the other props in Entity. Similar to
 // RawEntityFromPath
 func (e *Entity) Refresh() error {
-	log.VPrintf(3, ">Enter: Refresh(%s)", e.DbSID)
-	defer log.VPrintf(3, "<Exit: Refresh")
+	e.tx.VPrintf(3, ">Enter: Refresh(%s)", e.DbSID)
+	defer e.tx.VPrintf(3, "<Exit: Refresh")
 
 	results, err := Query(e.tx, `
         SELECT PropName, PropValue, PropType
@@ -469,8 +458,8 @@ func (e *Entity) Refresh() error {
 // by the caller once all of the changes are done. This is a holdover from
 // before we had transaction support - once we're sure, delete it
 func (e *Entity) eSetCommit(path string, val any) error {
-	log.VPrintf(3, ">Enter: SetCommit(%s=%v)", path, val)
-	defer log.VPrintf(3, "<Exit Set")
+	e.tx.VPrintf(3, ">Enter: SetCommit(%s=%v)", path, val)
+	defer e.tx.VPrintf(3, "<Exit Set")
 
 	err := e.eSetSave(path, val)
 	Must(e.tx.Conditional(err))
@@ -480,8 +469,8 @@ func (e *Entity) eSetCommit(path string, val any) error {
 
 // Set, Validate and Save to DB but not Commit
 func (e *Entity) eSetSave(path string, val any) error {
-	log.VPrintf(3, ">Enter: SetSave(%s=%v)", path, val)
-	defer log.VPrintf(3, "<Exit Set")
+	e.tx.VPrintf(3, ">Enter: SetSave(%s=%v)", path, val)
+	defer e.tx.VPrintf(3, "<Exit Set")
 
 	pp, err := PropPathFromUI(path)
 	if err == nil {
@@ -494,8 +483,8 @@ func (e *Entity) eSetSave(path string, val any) error {
 
 // Set the prop in the Entity but don't Validate or Save to the DB
 func (e *Entity) eJustSet(pp *PropPath, val any) error {
-	log.VPrintf(3, ">Enter: JustSet([%d] %s.%s=%v)", e.Type, e.UID, pp.UI(), val)
-	defer log.VPrintf(3, "<Exit: JustSet")
+	e.tx.VPrintf(3, ">Enter: JustSet([%d] %s.%s=%v)", e.Type, e.UID, pp.UI(), val)
+	defer e.tx.VPrintf(3, "<Exit: JustSet")
 
 	// Assume no other edits are pending
 	// e.Refresh() // trying not to have this here
@@ -541,18 +530,18 @@ func (e *Entity) eJustSet(pp *PropPath, val any) error {
 		}
 	*/
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, "Abstract/ID: %s/%s", e.Abstract, e.UID)
-		log.VPrintf(0, "e.Object:\n%s", ToJSON(e.Object))
-		log.VPrintf(0, "e.NewObject:\n%s", ToJSON(e.NewObject))
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, "Abstract/ID: %s/%s", e.Abstract, e.UID)
+		e.tx.VPrintf(0, "e.Object:\n%s", ToJSON(e.Object))
+		e.tx.VPrintf(0, "e.NewObject:\n%s", ToJSON(e.NewObject))
 	}
 
 	return ObjectSetProp(e.NewObject, pp, val)
 }
 
 func (e *Entity) ValidateAndSave() error {
-	log.VPrintf(3, ">Enter: ValidateAndSave %s/%s", e.Abstract, e.UID)
-	defer log.VPrintf(3, "<Exit: ValidateAndSave")
+	e.tx.VPrintf(3, ">Enter: ValidateAndSave %s/%s", e.Abstract, e.UID)
+	defer e.tx.VPrintf(3, "<Exit: ValidateAndSave")
 
 	// If nothing changed, then exit
 	if e.NewObject == nil {
@@ -562,8 +551,8 @@ func (e *Entity) ValidateAndSave() error {
 	// Make sure we have a tx since Validate assumes it
 	e.tx.NewTx()
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, "Validating %s/%s\ne.Object:\n%s\n\ne.NewObject:\n%s",
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, "Validating %s/%s\ne.Object:\n%s\n\ne.NewObject:\n%s",
 			e.Abstract, e.UID, ToJSON(e.Object), ToJSON(e.NewObject))
 	}
 
@@ -577,11 +566,11 @@ func (e *Entity) ValidateAndSave() error {
 // This is really just an internal Setter used for testing.
 // It'll set a property and then validate and save the entity in the DB
 func (e *Entity) SetPP(pp *PropPath, val any) error {
-	log.VPrintf(3, ">Enter: SetPP(%s: %s=%v)", e.DbSID, pp.UI(), val)
-	defer log.VPrintf(3, "<Exit SetPP")
+	e.tx.VPrintf(3, ">Enter: SetPP(%s: %s=%v)", e.DbSID, pp.UI(), val)
+	defer e.tx.VPrintf(3, "<Exit SetPP")
 	defer func() {
-		if log.GetVerbose() > 2 {
-			log.VPrintf(0, "SetPP exit: e.Object:\n%s", ToJSON(e.Object))
+		if e.tx.GetVerbose() > 2 {
+			e.tx.VPrintf(0, "SetPP exit: e.Object:\n%s", ToJSON(e.Object))
 		}
 	}()
 
@@ -607,8 +596,8 @@ func (e *Entity) SetPP(pp *PropPath, val any) error {
 // This will save a single property/value in the DB. This assumes
 // the caller is traversing the Object and splitting it into individual props
 func (e *Entity) SetDBProperty(pp *PropPath, val any) error {
-	log.VPrintf(3, ">Enter: SetDBProperty(%s=%v)", pp, val)
-	defer log.VPrintf(3, "<Exit SetDBProperty")
+	e.tx.VPrintf(3, ">Enter: SetDBProperty(%s=%v)", pp, val)
+	defer e.tx.VPrintf(3, "<Exit SetDBProperty")
 
 	PanicIf(pp.UI() == "", "pp is empty")
 
@@ -641,10 +630,7 @@ func (e *Entity) SetDBProperty(pp *PropPath, val any) error {
 				return err
 			} else {
 				// Update the content
-				err = DoOneTwo(e.tx, `
-                REPLACE INTO ResourceContents(VersionSID, Content)
-            	VALUES(?,?)`, e.DbSID, val)
-				if err != nil {
+				if err = SaveContent(e.tx, e.DbSID, val); err != nil {
 					return err
 				}
 
@@ -775,7 +761,7 @@ func readNextEntity(tx *Tx, results *Result) (*Entity, error) {
 	//   0     1     2     3        4     5   6         7        8       9    10
 	for row := results.NextRow(); row != nil; row = results.NextRow() {
 		// log.Printf("Row(%d): %#v", len(row), row)
-		if log.GetVerbose() >= 4 {
+		if tx.GetVerbose() >= 4 {
 			str := "("
 			for _, c := range row {
 				if IsNil(c) || IsNil(*c) {
@@ -1149,8 +1135,9 @@ var OrderedSpecProps = []*Attribute{
 				}
 
 				if !e.tx.IgnoreEpoch && oldEpoch != 0 && newEpoch != oldEpoch {
-					return fmt.Errorf("Attribute %q(%d) doesn't match "+
-						"existing value (%d)", "epoch", newEpoch, oldEpoch)
+					return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+						"Attribute %q(%d) doesn't match existing value (%d)",
+						"epoch", newEpoch, oldEpoch).With("attribute", "epoch")
 				}
 				return nil
 			},
@@ -1391,6 +1378,19 @@ var OrderedSpecProps = []*Attribute{
 			updateFn:   nil,
 		},
 	},
+	{
+		// Only added to the model when the Resource's "versionlock" is set
+		Name: "locked",
+		Type: BOOLEAN,
+
+		internals: AttrInternals{
+			types:     StrTypes(ENTITY_VERSION),
+			dontStore: false,
+			getFn:     nil,
+			checkFn:   nil,
+			updateFn:  nil,
+		},
+	},
 	{
 		Name: "$extensions",
 		internals: AttrInternals{
@@ -1752,17 +1752,17 @@ func init() {
 //     as defined by OrderedSpecProps
 func (e *Entity) SerializeProps(info *RequestInfo,
 	fn func(*Entity, *RequestInfo, string, any, *Attribute) error) error {
-	log.VPrintf(3, ">Enter: SerializeProps(%s/%s)", e.Abstract, e.UID)
-	defer log.VPrintf(3, "<Exit: SerializeProps")
+	e.tx.VPrintf(3, ">Enter: SerializeProps(%s/%s)", e.Abstract, e.UID)
+	defer e.tx.VPrintf(3, "<Exit: SerializeProps")
 
 	daObj := e.AddCalcProps(info)
 	attrs := e.GetAttributes(e.Object)
 
-	if log.GetVerbose() > 3 {
-		log.VPrintf(0, "SerProps.Entity: %s", ToJSON(e))
-		log.VPrintf(0, "SerProps.Obj: %s", ToJSON(e.Object))
-		log.VPrintf(0, "SerProps daObj: %s", ToJSON(daObj))
-		log.VPrintf(0, "SerProps attrs:\n%s", ToJSON(attrs))
+	if e.tx.GetVerbose() > 3 {
+		e.tx.VPrintf(0, "SerProps.Entity: %s", ToJSON(e))
+		e.tx.VPrintf(0, "SerProps.Obj: %s", ToJSON(e.Object))
+		e.tx.VPrintf(0, "SerProps daObj: %s", ToJSON(daObj))
+		e.tx.VPrintf(0, "SerProps attrs:\n%s", ToJSON(attrs))
 	}
 
 	resourceSingular := ""
@@ -1792,11 +1792,11 @@ func (e *Entity) SerializeProps(info *RequestInfo,
 			name = resourceSingular + name[9:]
 		}
 
-		log.VPrintf(4, "Ser prop: %q", name)
+		e.tx.VPrintf(4, "Ser prop: %q", name)
 
 		attr, ok := attrs[name]
 		if !ok {
-			log.VPrintf(4, "  skipping %q, no attr", name)
+			e.tx.VPrintf(4, "  skipping %q, no attr", name)
 			delete(daObj, name)
 			continue // not allowed at this eType so skip it
 		}
@@ -1830,7 +1830,7 @@ func (e *Entity) SerializeProps(info *RequestInfo,
 		}
 
 		if name[0] == '$' || prop.internals.alwaysSerialize {
-			log.VPrintf(4, "  forced serialization of %q", name)
+			e.tx.VPrintf(4, "  forced serialization of %q", name)
 			if err := fn(e, info, name, nil, attr); err != nil {
 				return err
 			}
@@ -1839,7 +1839,7 @@ func (e *Entity) SerializeProps(info *RequestInfo,
 
 		// Should be a no-op for Resources.
 		if val, ok := daObj[name]; ok {
-			log.VPrintf(4, "  val: %v", val)
+			e.tx.VPrintf(4, "  val: %v", val)
 			if !IsNil(val) {
 				cleanup := false
 				var m *Model
@@ -1864,7 +1864,7 @@ func (e *Entity) SerializeProps(info *RequestInfo,
 			}
 			delete(daObj, name)
 		} else {
-			log.VPrintf(4, "  no value for %q", name)
+			e.tx.VPrintf(4, "  no value for %q", name)
 		}
 	}
 
@@ -1891,8 +1891,13 @@ func (e *Entity) SerializeProps(info *RequestInfo,
 }
 
 func (e *Entity) Save() error {
-	log.VPrintf(3, ">Enter: Save(%s/%s)", e.Abstract, e.UID)
-	defer log.VPrintf(3, "<Exit: Save")
+	e.tx.VPrintf(3, ">Enter: Save(%s/%s)", e.Abstract, e.UID)
+	defer e.tx.VPrintf(3, "<Exit: Save")
+
+	span := e.tx.Span.StartChild("Save", SPAN_INTERNAL)
+	span.SetAttr("xregistry.entity", e.Abstract)
+	span.SetAttr("xregistry.path", e.Path)
+	defer span.Finish()
 
 	// TODO remove at some point when we're sure it's safe
 	if SpecProps["epoch"].InType(e.Type) && IsNil(e.NewObject["epoch"]) {
@@ -1902,8 +1907,8 @@ func (e *Entity) Save() error {
 		}
 	}
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, "Saving - %s (id:%s):\n%s\n", e.Abstract, e.UID,
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, "Saving - %s (id:%s):\n%s\n", e.Abstract, e.UID,
 			ToJSON(e.NewObject))
 	}
 
@@ -2231,14 +2236,20 @@ func (e *Entity) Validate() error {
 		return nil
 	}
 
+	if e.Type == ENTITY_VERSION {
+		if err := e.CheckVersionLock(); err != nil {
+			return err
+		}
+	}
+
 	// Don't touch what was passed in
 	attrs := e.GetAttributes(e.NewObject)
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, "========")
-		log.VPrintf(0, "Validating(%d/%s):\n%s",
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, "========")
+		e.tx.VPrintf(0, "Validating(%d/%s):\n%s",
 			e.Type, e.UID, ToJSON(e.NewObject))
-		log.VPrintf(0, "Attrs: %v", SortedKeys(attrs))
+		e.tx.VPrintf(0, "Attrs: %v", SortedKeys(attrs))
 	}
 	return e.ValidateObject(e.NewObject, "strict", attrs, NewPP())
 }
@@ -2247,20 +2258,20 @@ func (e *Entity) Validate() error {
 // been removed - such as collections
 func (e *Entity) ValidateObject(val any, namecharset string, origAttrs Attributes, path *PropPath) error {
 
-	log.VPrintf(3, ">Enter: ValidateObject(path: %s)", path)
-	defer log.VPrintf(3, "<Exit: ValidateObject")
+	e.tx.VPrintf(3, ">Enter: ValidateObject(path: %s)", path)
+	defer e.tx.VPrintf(3, "<Exit: ValidateObject")
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, "Check Obj:\n%s", ToJSON(val))
-		log.VPrintf(0, "OrigAttrs:\n%s", ToJSON(SortedKeys(origAttrs)))
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, "Check Obj:\n%s", ToJSON(val))
+		e.tx.VPrintf(0, "OrigAttrs:\n%s", ToJSON(SortedKeys(origAttrs)))
 	}
 
 	valValue := reflect.ValueOf(val)
 	if valValue.Kind() != reflect.Map ||
 		valValue.Type().Key().Kind() != reflect.String {
 
-		return fmt.Errorf("Attribute %q must be a map[string] or object",
-			path.UI())
+		return NewAttributeError(path,
+			"Attribute %q must be a map[string] or object", path.UI())
 	}
 	newObj := val.(map[string]any)
 
@@ -2493,12 +2504,12 @@ func (e *Entity) ValidateObject(val any, namecharset string, origAttrs Attribute
 }
 
 func (e *Entity) ValidateAttribute(val any, attr *Attribute, path *PropPath) error {
-	log.VPrintf(3, ">Enter: ValidateAttribute(%s)", path)
-	defer log.VPrintf(3, "<Exit: ValidateAttribute")
+	e.tx.VPrintf(3, ">Enter: ValidateAttribute(%s)", path)
+	defer e.tx.VPrintf(3, "<Exit: ValidateAttribute")
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, " val: %v", ToJSON(val))
-		log.VPrintf(0, " attr: %v", ToJSON(attr))
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, " val: %v", ToJSON(val))
+		e.tx.VPrintf(0, " attr: %v", ToJSON(attr))
 	}
 
 	if attr.Type == ANY {
@@ -2528,12 +2539,12 @@ func (e *Entity) ValidateAttribute(val any, attr *Attribute, path *PropPath) err
 }
 
 func (e *Entity) ValidateMap(val any, item *Item, path *PropPath) error {
-	log.VPrintf(3, ">Enter: ValidateMap(%s)", path)
-	defer log.VPrintf(3, "<Exit: ValidateMap")
+	e.tx.VPrintf(3, ">Enter: ValidateMap(%s)", path)
+	defer e.tx.VPrintf(3, "<Exit: ValidateMap")
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, " item: %v", ToJSON(item))
-		log.VPrintf(0, " val: %v", ToJSON(val))
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, " item: %v", ToJSON(item))
+		e.tx.VPrintf(0, " val: %v", ToJSON(val))
 	}
 
 	if IsNil(val) {
@@ -2542,7 +2553,7 @@ func (e *Entity) ValidateMap(val any, item *Item, path *PropPath) error {
 
 	valValue := reflect.ValueOf(val)
 	if valValue.Kind() != reflect.Map {
-		return fmt.Errorf("Attribute %q must be a map", path.UI())
+		return NewAttributeError(path, "Attribute %q must be a map", path.UI())
 	}
 
 	// All values in the map must be of the same type
@@ -2574,12 +2585,12 @@ func (e *Entity) ValidateMap(val any, item *Item, path *PropPath) error {
 }
 
 func (e *Entity) ValidateArray(val any, item *Item, path *PropPath) error {
-	log.VPrintf(3, ">Enter: ValidateArray(%s)", path)
-	defer log.VPrintf(3, "<Exit: ValidateArray")
+	e.tx.VPrintf(3, ">Enter: ValidateArray(%s)", path)
+	defer e.tx.VPrintf(3, "<Exit: ValidateArray")
 
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, "item: %s", ToJSON(item))
-		log.VPrintf(0, "val: %s", ToJSON(val))
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, "item: %s", ToJSON(item))
+		e.tx.VPrintf(0, "val: %s", ToJSON(val))
 	}
 
 	if IsNil(val) {
@@ -2588,7 +2599,8 @@ func (e *Entity) ValidateArray(val any, item *Item, path *PropPath) error {
 
 	valValue := reflect.ValueOf(val)
 	if valValue.Kind() != reflect.Slice {
-		return fmt.Errorf("Attribute %q must be an array", path.UI())
+		return NewAttributeError(path, "Attribute %q must be an array",
+			path.UI())
 	}
 
 	// All values in the array must be of the same type
@@ -2609,9 +2621,9 @@ func (e *Entity) ValidateArray(val any, item *Item, path *PropPath) error {
 }
 
 func (e *Entity) ValidateScalar(val any, attr *Attribute, path *PropPath) error {
-	if log.GetVerbose() > 2 {
-		log.VPrintf(0, ">Enter: ValidateScalar(%s:%s)", path, ToJSON(val))
-		defer log.VPrintf(3, "<Exit: ValidateScalar")
+	if e.tx.GetVerbose() > 2 {
+		e.tx.VPrintf(0, ">Enter: ValidateScalar(%s:%s)", path, ToJSON(val))
+		defer e.tx.VPrintf(3, "<Exit: ValidateScalar")
 	}
 
 	valKind := reflect.ValueOf(val).Kind()
@@ -2619,20 +2631,24 @@ func (e *Entity) ValidateScalar(val any, attr *Attribute, path *PropPath) error
 	switch attr.Type {
 	case BOOLEAN:
 		if valKind != reflect.Bool {
-			return fmt.Errorf("Attribute %q must be a boolean", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a boolean",
+				path.UI())
 		}
 	case DECIMAL:
 		if valKind != reflect.Int && valKind != reflect.Float64 {
-			return fmt.Errorf("Attribute %q must be a decimal", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a decimal",
+				path.UI())
 		}
 	case INTEGER:
 		if valKind == reflect.Float64 {
 			f := val.(float64)
 			if f != float64(int(f)) {
-				return fmt.Errorf("Attribute %q must be an integer", path.UI())
+				return NewAttributeError(path, "Attribute %q must be an integer",
+					path.UI())
 			}
 		} else if valKind != reflect.Int {
-			return fmt.Errorf("Attribute %q must be an integer", path.UI())
+			return NewAttributeError(path, "Attribute %q must be an integer",
+				path.UI())
 		}
 	case UINTEGER:
 		i := 0
@@ -2640,60 +2656,85 @@ func (e *Entity) ValidateScalar(val any, attr *Attribute, path *PropPath) error
 			f := val.(float64)
 			i = int(f)
 			if f != float64(i) {
-				return fmt.Errorf("Attribute %q must be a uinteger", path.UI())
+				return NewAttributeError(path, "Attribute %q must be a uinteger",
+					path.UI())
 			}
 		} else if valKind != reflect.Int {
-			return fmt.Errorf("Attribute %q must be a uinteger", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a uinteger",
+				path.UI())
 		} else {
 			i = val.(int)
 			if valKind != reflect.Int {
-				return fmt.Errorf("Attribute %q must be a uinteger", path.UI())
+				return NewAttributeError(path, "Attribute %q must be a uinteger",
+					path.UI())
 			}
 		}
 		if i < 0 {
-			return fmt.Errorf("Attribute %q must be a uinteger", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a uinteger",
+				path.UI())
 		}
 	case XID:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be an xid", path.UI())
+			return NewAttributeError(path, "Attribute %q must be an xid",
+				path.UI())
 		}
 		str := val.(string)
 
 		if attr.Target != "" {
 			err := e.MatchXID(str, attr.Target)
 			if err != nil {
-				return fmt.Errorf("Attribute %q %s", path.UI(), err.Error())
+				return NewAttributeError(path, "Attribute %q %s",
+					path.UI(), err.Error())
+			}
+		}
+
+		// Only check for the target's existence if they opted-in
+		if attr.OnDelete != "" {
+			exists, err := e.Registry.XIDExists(str)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return NewAttributeError(path, "Attribute %q (%s) must "+
+					"point to an existing entity", path.UI(), str)
 			}
 		}
 	case STRING:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be a string", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a string",
+				path.UI())
 		}
 	case URI:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be a uri", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a uri",
+				path.UI())
 		}
 	case URI_REFERENCE:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be a uri-reference", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a uri-reference",
+				path.UI())
 		}
 	case URI_TEMPLATE:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be a uri-template", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a uri-template",
+				path.UI())
 		}
 	case URL:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be a url", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a url",
+				path.UI())
 		}
 	case TIMESTAMP:
 		if valKind != reflect.String {
-			return fmt.Errorf("Attribute %q must be a timestamp", path.UI())
+			return NewAttributeError(path, "Attribute %q must be a timestamp",
+				path.UI())
 		}
 		str := val.(string)
 
 		_, err := ConvertStrToTime(str)
 		if err != nil {
-			return fmt.Errorf("Attribute %q is a malformed timestamp",
+			return NewAttributeError(path,
+				"Attribute %q is a malformed timestamp",
 				path.UI())
 		}
 	default:
@@ -2719,8 +2760,8 @@ func (e *Entity) ValidateScalar(val any, attr *Attribute, path *PropPath) error
 				}
 				valids += fmt.Sprintf("%v", v)
 			}
-			return fmt.Errorf("Attribute %q(%v) must be one of the enum "+
-				"values: %s", path.UI(), val, valids)
+			return NewAttributeError(path, "Attribute %q(%v) must be one "+
+				"of the enum values: %s", path.UI(), val, valids)
 		}
 	}
 
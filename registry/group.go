@@ -3,8 +3,6 @@ package registry
 import (
 	"fmt"
 	"strings"
-
-	log "github.com/duglin/dlog"
 )
 
 type Group struct {
@@ -31,8 +29,8 @@ func (g *Group) SetSave(name string, val any) error {
 }
 
 func (g *Group) Delete() error {
-	log.VPrintf(3, ">Enter: Group.Delete(%s)", g.UID)
-	defer log.VPrintf(3, "<Exit: Group.Delete")
+	g.tx.VPrintf(3, ">Enter: Group.Delete(%s)", g.UID)
+	defer g.tx.VPrintf(3, "<Exit: Group.Delete")
 
 	// Make sure we don't have any readonly Resources
 	results, err := Query(g.tx, `
@@ -48,9 +46,41 @@ func (g *Group) Delete() error {
 	}
 	row := results.NextRow()
 	if NotNilInt(row[0]) != 0 {
-		return fmt.Errorf("Delete operations on read-only " +
+		return NewProblemError(PROBLEM_READONLY, "Delete operations on read-only "+
 			"resources are not allowed")
 	}
+	results.Close()
+
+	// Look for Resources outside of this Group that xref our Resources
+	results, err = Query(g.tx, `
+        SELECT DISTINCT TargetPath FROM xRefSrc2TgtResources
+        WHERE RegistrySID=? AND TargetPath LIKE ? AND SourcePath NOT LIKE ?
+        ORDER BY TargetPath`,
+		g.Registry.DbSID, g.Path+"/%", g.Path+"/%")
+	defer results.Close()
+	if err != nil {
+		return err
+	}
+	targets := []string{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		targets = append(targets, NotNilString(row[0]))
+	}
+	results.Close()
+
+	for _, path := range targets {
+		parts := strings.Split(path, "/")
+		r, err := g.FindResource(parts[2], parts[3], false)
+		if err != nil {
+			return err
+		}
+		if err = r.ProcessXrefSources("/" + g.Path + "/"); err != nil {
+			return err
+		}
+	}
+
+	if err = g.ProcessXIDReferences(); err != nil {
+		return err
+	}
 
 	g.Registry.Touch()
 
@@ -63,8 +93,8 @@ func (g *Group) Delete() error {
 }
 
 func (g *Group) FindResource(rType string, id string, anyCase bool) (*Resource, error) {
-	log.VPrintf(3, ">Enter: FindResource(%s,%s,%v)", rType, id, anyCase)
-	defer log.VPrintf(3, "<Exit: FindResource")
+	g.tx.VPrintf(3, ">Enter: FindResource(%s,%s,%v)", rType, id, anyCase)
+	defer g.tx.VPrintf(3, "<Exit: FindResource")
 
 	ent, err := RawEntityFromPath(g.tx, g.Registry.DbSID,
 		g.Plural+"/"+g.UID+"/"+rType+"/"+id, anyCase)
@@ -73,7 +103,7 @@ func (g *Group) FindResource(rType string, id string, anyCase bool) (*Resource,
 			id, rType, err)
 	}
 	if ent == nil {
-		log.VPrintf(3, "None found")
+		g.tx.VPrintf(3, "None found")
 		return nil, nil
 	}
 
@@ -100,8 +130,8 @@ func (g *Group) UpsertResource(rType string, id string, vID string) (*Resource,
 
 // Return: *Resource, isNew, error
 func (g *Group) UpsertResourceWithObject(rType string, id string, vID string, obj Object, addType AddType, objIsVer bool) (*Resource, bool, error) {
-	log.VPrintf(3, ">Enter: UpsertResourceWithObject(%s,%s)", rType, id)
-	defer log.VPrintf(3, "<Exit: UpsertResourceWithObject")
+	g.tx.VPrintf(3, ">Enter: UpsertResourceWithObject(%s,%s)", rType, id)
+	defer g.tx.VPrintf(3, "<Exit: UpsertResourceWithObject")
 
 	// vID is the version ID we want to use for the update/create.
 	// A value of "" means just use the default Version
@@ -365,7 +395,7 @@ func (g *Group) UpsertResourceWithObject(rType string, id string, vID string, ob
 
 	// Kind of late in the process but oh well
 	if meta.Get("readonly") == true {
-		return nil, false, fmt.Errorf("Write operations on read-only " +
+		return nil, false, NewProblemError(PROBLEM_READONLY, "Write operations on read-only "+
 			"resources are not allowed")
 	}
 
@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// The "Content-Encoding"s we support for responses, in order of preference
+// when the client doesn't have one. To add another one just add it to this
+// list. Set it to nil to turn off compression.
+var ContentEncoders = []*ContentEncoder{
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+	// HTTP's "deflate" is zlib wrapped data, not raw DEFLATE (RFC 9110)
+	{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+	{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+}
+
+// Responses smaller than this aren't worth compressing
+var CompressMinSize = 1024
+
+type ContentEncoder struct {
+	Name      string
+	NewWriter func(io.Writer) io.WriteCloser
+}
+
+// Returns the ContentEncoder to use based on the client's "Accept-Encoding"
+// header, or nil if the response shouldn't be compressed
+func NegotiateEncoding(accept string) *ContentEncoder {
+	if accept == "" {
+		return nil
+	}
+
+	qs := map[string]float64{}
+	for _, enc := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(enc, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if k, v, _ := strings.Cut(strings.TrimSpace(params), "="); k == "q" {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		qs[name] = q
+	}
+
+	var best *ContentEncoder
+	bestQ := 0.0
+	for _, ce := range ContentEncoders {
+		q, ok := qs[ce.Name]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = ce, q
+		}
+	}
+
+	// If the client said "identity" is better then don't compress
+	if q, ok := qs["identity"]; ok && q >= bestQ {
+		return nil
+	}
+	return best
+}
+
+// Decides whether the response that's about to be sent should be
+// compressed, and if so sets the headers and returns the ContentEncoder.
+// Partial responses, and ones that are already encoded, are left alone.
+func StartEncoding(info *RequestInfo, status int) *ContentEncoder {
+	header := info.OriginalResponse.Header()
+
+	if status < 200 || status == http.StatusNoContent ||
+		status == http.StatusNotModified ||
+		status == http.StatusPartialContent ||
+		header.Get("Content-Encoding") != "" ||
+		header.Get("Content-Range") != "" {
+		return nil
+	}
+
+	ce := NegotiateEncoding(info.OriginalRequest.Header.Get("Accept-Encoding"))
+	if ce == nil {
+		return nil
+	}
+
+	header.Set("Content-Encoding", ce.Name)
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length") // We don't know the compressed size
+	return ce
+}
+
+// A single "bytes=START-END" range from a "Range" header
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (br *ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.Start, br.Start+br.Length-1, size)
+}
+
+// Parses the "Range" header for a document of "size" bytes. A nil range,
+// and no error, means the entire document should be returned - which is
+// what we do when there's more than one range since that's allowed.
+// An error means the range can't be satisfied (416).
+func ParseRange(header string, size int64) (*ByteRange, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	br := &ByteRange{}
+	if startStr == "" {
+		// bytes=-N, the last N bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, fmt.Errorf("Range not satisfiable")
+		}
+		if n > size {
+			n = size
+		}
+		br.Start, br.Length = size-n, n
+		return br, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	if start >= size {
+		return nil, fmt.Errorf("Range not satisfiable")
+	}
+
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	br.Start, br.Length = start, end-start+1
+	return br, nil
+}
+
+// Returns true if the "If-Range" header (if any) says that the client's copy
+// of the document is still current, meaning a partial response is ok. We
+// don't have ETags for documents so only dates can match.
+func IfRangeMatches(ifRange string, lastMod time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if lastMod.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && t.Equal(lastMod)
+}
+
+// Sends the document in "r" - either all of it or just the part asked for
+// via the "Range" header, along with its Content-Length and Last-Modified
+func HTTPWriteDocument(info *RequestInfo, version *Entity, r io.Reader) error {
+	rs, ok := r.(io.ReadSeeker)
+
+	// Other writers (e.g. ?ui, yaml) change the body, and w/o being able to
+	// seek we don't know the size, so neither a Content-Length nor a partial
+	// response would be right. A server is allowed to ignore "Range", so
+	// send all of it as a 200 and tell the client not to ask for ranges.
+	if _, isDefault := info.HTTPWriter.(*DefaultWriter); !ok || !isDefault {
+		info.AddHeader("Accept-Ranges", "none")
+		_, err := io.Copy(info, r)
+		return err
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = rs.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+
+	lastMod := time.Time{}
+	if t, err := ConvertStrToTime(version.GetAsString("modifiedat")); err == nil {
+		lastMod = t.UTC().Truncate(time.Second)
+		info.AddHeader("Last-Modified", lastMod.Format(http.TimeFormat))
+	}
+	info.AddHeader("Accept-Ranges", "bytes")
+
+	req := info.OriginalRequest
+	br := (*ByteRange)(nil)
+	if strings.EqualFold(req.Method, "GET") &&
+		IfRangeMatches(req.Header.Get("If-Range"), lastMod) {
+		if br, err = ParseRange(req.Header.Get("Range"), size); err != nil {
+			info.StatusCode = http.StatusRequestedRangeNotSatisfiable
+			info.AddHeader("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return err
+		}
+	}
+
+	if br == nil {
+		info.AddHeader("Content-Length", strconv.FormatInt(size, 10))
+		_, err = io.Copy(info, rs)
+		return err
+	}
+
+	if _, err = rs.Seek(br.Start, io.SeekStart); err != nil {
+		return err
+	}
+
+	info.StatusCode = http.StatusPartialContent
+	info.AddHeader("Content-Range", br.ContentRange(size))
+	info.AddHeader("Content-Length", strconv.FormatInt(br.Length, 10))
+	_, err = io.CopyN(info, rs, br.Length)
+	return err
+}
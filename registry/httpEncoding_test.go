@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		exp    string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "gzip"},
+		{"gzip;q=0.5, br", "br"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0", ""},
+		{"*", "gzip"},
+		{"*, gzip;q=0", "deflate"},
+		{"gzip, identity", ""},
+		{"gzip, identity;q=0.5", "gzip"},
+	} {
+		got := ""
+		if ce := NegotiateEncoding(test.accept); ce != nil {
+			got = ce.Name
+		}
+		if got != test.exp {
+			t.Fatalf("%q: Exp: %q Got: %q", test.accept, test.exp, got)
+		}
+	}
+}
+
+func TestDeflateIsZlib(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	res := httptest.NewRecorder()
+
+	data := strings.Repeat("hello world ", CompressMinSize)
+	dw := &DefaultWriter{
+		Info: &RequestInfo{OriginalRequest: req, OriginalResponse: res},
+	}
+	dw.Write([]byte(data))
+	dw.Done()
+
+	if ce := res.Header().Get("Content-Encoding"); ce != "deflate" {
+		t.Fatalf("Content-Encoding: Exp: deflate Got: %q", ce)
+	}
+
+	zr, err := zlib.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("zlib.NewReader: %s", err)
+	}
+	buf, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Error decoding: %s", err)
+	}
+	if string(buf) != data {
+		t.Fatalf("Body mismatch: %q", buf)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		size   int64
+		exp    string // Content-Range, "" for all, "error" for a 416
+	}{
+		{"", 10, ""},
+		{"bytes=0-4", 10, "bytes 0-4/10"},
+		{"bytes=5-", 10, "bytes 5-9/10"},
+		{"bytes=5-100", 10, "bytes 5-9/10"},
+		{"bytes=-3", 10, "bytes 7-9/10"},
+		{"bytes=-30", 10, "bytes 0-9/10"},
+		{"bytes=9-9", 10, "bytes 9-9/10"},
+		{"bytes=10-", 10, "error"},
+		{"bytes=-0", 10, "error"},
+		{"bytes=0-", 0, "error"},
+		{"bytes=5-4", 10, ""},
+		{"bytes=0-1,3-4", 10, ""},
+		{"items=0-4", 10, ""},
+		{"bytes=x-4", 10, ""},
+	} {
+		br, err := ParseRange(test.header, test.size)
+		got := ""
+		if err != nil {
+			got = "error"
+		} else if br != nil {
+			got = br.ContentRange(test.size)
+		}
+		if got != test.exp {
+			t.Fatalf("%q: Exp: %q Got: %q", test.header, test.exp, got)
+		}
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	lastMod := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	date := lastMod.Format(http.TimeFormat)
+
+	if !IfRangeMatches("", lastMod) || !IfRangeMatches(date, lastMod) {
+		t.Fatalf("Should match")
+	}
+	if IfRangeMatches(date, lastMod.Add(time.Second)) ||
+		IfRangeMatches(`"abc"`, lastMod) ||
+		IfRangeMatches(date, time.Time{}) {
+		t.Fatalf("Shouldn't match")
+	}
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"bytes"
+	"context"
 	// "encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -20,6 +21,10 @@ import (
 type Server struct {
 	Port       int
 	HTTPServer *http.Server
+	TLS        *TLSConfig  // nil means plain HTTP
+	CORS       *CORSConfig // nil means no CORS support
+
+	RateLimiter *RateLimiter // nil means no rate limiting
 }
 
 func NewServer(port int) *Server {
@@ -51,8 +56,22 @@ func (s *Server) Start() *Server {
 }
 
 func (s *Server) Serve() {
-	log.VPrintf(1, "Listening on %d", s.Port)
-	err := s.HTTPServer.ListenAndServe()
+	if s.CORS != nil {
+		s.HTTPServer.Handler = s.CORS.Wrap(s)
+	}
+
+	var err error
+	if s.TLS != nil {
+		if s.HTTPServer.TLSConfig, err = s.TLS.Build(); err != nil {
+			log.Printf("Serve: %s", err)
+			return
+		}
+		log.VPrintf(1, "Listening on %d (TLS)", s.Port)
+		err = s.HTTPServer.ListenAndServeTLS("", "")
+	} else {
+		log.VPrintf(1, "Listening on %d", s.Port)
+		err = s.HTTPServer.ListenAndServe()
+	}
 	if err != http.ErrServerClosed {
 		log.Printf("Serve: %s", err)
 	}
@@ -69,12 +88,61 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := NewTx()
+	// Anyone can set this header, so when users are identified by their
+	// client certs don't let them claim to be someone else
+	if s.TLS.UsesClientCerts() {
+		r.Header.Del("xRegistry~User")
+	}
+
+	start := time.Now()
+	reqID := GetRequestID(r)
+	w.Header().Set(REQUEST_ID_HEADER, reqID)
+	aw := &accessWriter{ResponseWriter: w}
+	w = aw
+
+	if !s.CheckLimits(w, r) {
+		WriteAccessLog(newAccessLogEntry(r, reqID, aw, start))
+		return
+	}
+
+	// The DB transaction needs to use the timeout too, not just the queries
+	ctx := r.Context()
+	if QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+	}
+
+	tx, err := NewTxWithContext(ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Error talking to DB, try again later\n"))
+		log.Printf("[%s] Error talking to DB: %s", reqID, err)
+		WriteProblem(w, r, fmt.Errorf("Error talking to DB, try again later"),
+			http.StatusInternalServerError)
+		entry := newAccessLogEntry(r, reqID, aw, start)
+		entry.Error = err.Error()
+		WriteAccessLog(entry)
 		return
 	}
+	tx.RequestID = reqID
+
+	// Registered first so it's run last, after the response is done
+	defer func() {
+		entry := newAccessLogEntry(r, reqID, aw, start)
+		entry.User = tx.User
+		entry.Queries = tx.Queries
+		if info != nil && info.Registry != nil {
+			entry.Registry = info.Registry.UID
+		}
+		if err != nil {
+			entry.Error = strings.TrimSpace(err.Error())
+			if entry.Status >= 500 {
+				tx.Printf("Error (%d): %s", entry.Status, entry.Error)
+			} else {
+				tx.VPrintf(2, "Error (%d): %s", entry.Status, entry.Error)
+			}
+		}
+		WriteAccessLog(entry)
+	}()
 
 	defer func() {
 		// As of now we should never have more than one active Tx during
@@ -97,24 +165,40 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		tx.Rollback()
 	}()
 
-	saveVerbose := log.GetVerbose()
 	if tmp := r.URL.Query().Get("verbose"); tmp != "" {
 		if v, err := strconv.Atoi(tmp); err == nil {
-			log.SetVerbose(v)
+			tx.Verbose = v
 		}
-		defer log.SetVerbose(saveVerbose)
 	}
 
-	log.VPrintf(2, "%s %s", r.Method, r.URL)
+	tx.VPrintf(2, "%s %s", r.Method, r.URL)
+
+	span := StartRequestSpan(r)
+	tx.Span = span
+	defer func() {
+		if span != nil {
+			span.SetAttr("http.response.status_code", aw.Status())
+			if aw.Status() >= 500 {
+				span.SetError(fmt.Errorf("%s", http.StatusText(aw.Status())))
+			}
+		}
+		span.Finish()
+	}()
 
 	info, err = ParseRequest(tx, w, r)
+	if span != nil {
+		if info.Registry != nil {
+			span.SetAttr("xregistry.registry", info.Registry.UID)
+		}
+		span.SetAttr("xregistry.what", info.What)
+		span.Name = strings.TrimSpace(r.Method + " " + info.What)
+		span.SetError(err)
+	}
 
 	if err != nil {
-		if info.StatusCode == 0 {
-			info.StatusCode = http.StatusBadRequest
-		}
-		w.WriteHeader(info.StatusCode)
-		w.Write([]byte(fmt.Sprintf("%s\n", err.Error())))
+		info.SetErrorStatus(err)
+		info.WriteError(err)
+		info.HTTPWriter.Done()
 		return
 	}
 
@@ -124,6 +208,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		info.HTTPWriter.Done()
 	}()
 
+	if AcceptsYAML(r.Header.Get("Accept")) && !r.URL.Query().Has("ui") &&
+		!r.URL.Query().Has("html") && !r.URL.Query().Has("noprops") {
+		info.HTTPWriter = NewYAMLWriter(info)
+	}
+
 	if r.URL.Query().Has("ui") { // Wrap in html page
 		info.HTTPWriter = NewPageWriter(info)
 	}
@@ -139,11 +228,16 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"the model \"hasdocument\" value set to \"false\" is invalid")
 	}
 
+	if err == nil && IsYAMLMediaType(r.Header.Get("Content-Type")) &&
+		!info.IsDocument() {
+		err = ConvertYAMLBody(info)
+	}
+
 	if err == nil {
 		if sv := info.GetFlag("specversion"); sv != "" {
 			if !info.Registry.Capabilities.SpecVersionEnabled(sv) {
-				err = fmt.Errorf("Unsupported xRegistry spec version: %s",
-					sv)
+				err = NewProblemError(PROBLEM_UNSUPPORTED_SPEC,
+					"Unsupported xRegistry spec version: %s", sv)
 			}
 		}
 	}
@@ -169,13 +263,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	Must(tx.Conditional(err))
+	span.SetError(err)
 
 	if err != nil {
-		if info.StatusCode == 0 {
-			// Only default to BadRequest if not set by someone else
-			info.StatusCode = http.StatusBadRequest
-		}
-		info.Write([]byte(err.Error() + "\n"))
+		info.SetErrorStatus(err)
+		info.WriteError(err)
 	}
 }
 
@@ -189,6 +281,7 @@ var _ HTTPWriter = &DefaultWriter{}
 var _ HTTPWriter = &BufferedWriter{}
 var _ HTTPWriter = &DiscardWriter{}
 var _ HTTPWriter = &PageWriter{}
+var _ HTTPWriter = &YAMLWriter{}
 
 func DefaultHTTPWriter(info *RequestInfo) HTTPWriter {
 	return &DefaultWriter{
@@ -197,7 +290,11 @@ func DefaultHTTPWriter(info *RequestInfo) HTTPWriter {
 }
 
 type DefaultWriter struct {
-	Info *RequestInfo
+	Info    *RequestInfo
+	Encoder io.WriteCloser // non-nil if we're compressing the response
+
+	pending []byte // Start of the response, not sent yet
+	sent    bool   // Have we really sent the status and headers yet?
 }
 
 func (dw *DefaultWriter) Write(b []byte) (int, error) {
@@ -206,7 +303,39 @@ func (dw *DefaultWriter) Write(b []byte) (int, error) {
 		if dw.Info.StatusCode == 0 {
 			dw.Info.StatusCode = http.StatusOK
 		}
+	}
+
+	if !dw.sent {
+		// Hold onto the start of the response until we know if it's big
+		// enough to be worth compressing. A nil "b" means we're done.
+		if b != nil && len(dw.pending)+len(b) < CompressMinSize {
+			dw.pending = append(dw.pending, b...)
+			return len(b), nil
+		}
+
+		dw.sent = true
+		if len(dw.pending)+len(b) >= CompressMinSize {
+			ce := StartEncoding(dw.Info, dw.Info.StatusCode)
+			if ce != nil {
+				dw.Encoder = ce.NewWriter(dw.Info.OriginalResponse)
+			}
+		}
 		dw.Info.OriginalResponse.WriteHeader(dw.Info.StatusCode)
+
+		if len(dw.pending) > 0 {
+			pending := dw.pending
+			dw.pending = nil
+			if _, err := dw.write(pending); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return dw.write(b)
+}
+
+func (dw *DefaultWriter) write(b []byte) (int, error) {
+	if dw.Encoder != nil {
+		return dw.Encoder.Write(b)
 	}
 	return dw.Info.OriginalResponse.Write(b)
 }
@@ -217,6 +346,10 @@ func (dw *DefaultWriter) AddHeader(name, value string) {
 
 func (dw *DefaultWriter) Done() {
 	dw.Write(nil)
+	if dw.Encoder != nil {
+		dw.Encoder.Close()
+		dw.Encoder = nil
+	}
 }
 
 type BufferedWriter struct {
@@ -268,6 +401,53 @@ func (bw *BufferedWriter) Done() {
 		buf = HTMLify(req, buf)
 	}
 	bw.OldWriter.Write(buf)
+	bw.OldWriter.Done()
+}
+
+// Buffers the response so that any JSON in it can be converted into YAML
+type YAMLWriter struct {
+	Info      *RequestInfo
+	OldWriter HTTPWriter
+	Headers   map[string]string
+	Buffer    *bytes.Buffer
+}
+
+func NewYAMLWriter(info *RequestInfo) *YAMLWriter {
+	return &YAMLWriter{
+		Info:      info,
+		OldWriter: info.HTTPWriter,
+		Headers:   map[string]string{},
+		Buffer:    &bytes.Buffer{},
+	}
+}
+
+func (yw *YAMLWriter) Write(b []byte) (int, error) {
+	return yw.Buffer.Write(b)
+}
+
+func (yw *YAMLWriter) AddHeader(name, value string) {
+	yw.Headers[name] = value
+}
+
+func (yw *YAMLWriter) Done() {
+	buf := yw.Buffer.Bytes()
+
+	// Only xRegistry metadata is converted, never a Resource's document
+	if len(buf) > 0 && yw.Headers["Content-Type"] == "application/json" &&
+		!yw.Info.IsDocument() {
+		if yBuf, err := JSONToYAML(buf); err != nil {
+			yw.Info.tx.Printf("Error converting response to YAML: %s", err)
+		} else {
+			buf = yBuf
+			yw.Headers["Content-Type"] = "application/yaml"
+		}
+	}
+
+	for k, v := range yw.Headers {
+		yw.OldWriter.AddHeader(k, v)
+	}
+	yw.OldWriter.Write(buf)
+	yw.OldWriter.Done()
 }
 
 type DiscardWriter struct{}
@@ -305,13 +485,7 @@ func (pw *PageWriter) AddHeader(name, value string) {
 func (pw *PageWriter) Done() {
 	pw.AddHeader("Content-Type", "text/html")
 
-	if !pw.Info.SentStatus {
-		pw.Info.SentStatus = true
-		if pw.Info.StatusCode == 0 {
-			pw.Info.StatusCode = http.StatusOK
-		}
-		pw.Info.OriginalResponse.WriteHeader(pw.Info.StatusCode)
-	}
+	// The status code is sent by OldWriter along with the headers
 
 	for k, v := range *pw.Headers {
 		pw.OldWriter.AddHeader(k, v)
@@ -1048,7 +1222,7 @@ func GetVersionModelInlines(rm *ResourceModel) []string {
 func HTTPGETCapabilities(info *RequestInfo) error {
 	if len(info.Parts) > 1 {
 		info.StatusCode = http.StatusNotFound
-		return fmt.Errorf("Not found")
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 	}
 
 	buf := []byte(nil)
@@ -1082,7 +1256,7 @@ func HTTPGETCapabilities(info *RequestInfo) error {
 func HTTPGETModel(info *RequestInfo) error {
 	if len(info.Parts) > 1 {
 		info.StatusCode = http.StatusNotFound
-		return fmt.Errorf("Not found")
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 	}
 
 	format := info.GetFlag("schema")
@@ -1112,8 +1286,8 @@ func HTTPGETModel(info *RequestInfo) error {
 }
 
 func HTTPGETContent(info *RequestInfo) error {
-	log.VPrintf(3, ">Enter: HTTPGetContent")
-	defer log.VPrintf(3, "<Exit: HTTPGetContent")
+	info.tx.VPrintf(3, ">Enter: HTTPGetContent")
+	defer info.tx.VPrintf(3, "<Exit: HTTPGetContent")
 
 	query := `
 SELECT
@@ -1134,25 +1308,32 @@ FROM FullTree WHERE RegSID=? AND `
 	}
 	query += " ORDER BY Path"
 
-	log.VPrintf(3, "Query:\n%s", SubQuery(query, args))
+	info.tx.VPrintf(3, "Query:\n%s", SubQuery(query, args))
 
 	results, err := Query(info.tx, query, args...)
 	defer results.Close()
 
 	if err != nil {
-		info.StatusCode = http.StatusInternalServerError
+		if ErrorStatusCode(err) == 0 {
+			info.StatusCode = http.StatusInternalServerError
+		}
+		return err
+	}
+
+	if err = CheckResultsSize(results); err != nil {
+		info.StatusCode = ErrorStatusCode(err)
 		return err
 	}
 
 	entity, err := readNextEntity(info.tx, results)
-	log.VPrintf(3, "Entity: %#v", entity)
+	info.tx.VPrintf(3, "Entity: %#v", entity)
 	if entity == nil {
 		info.StatusCode = http.StatusNotFound
 		if err != nil {
-			log.Printf("Error loading entity: %s", err)
+			info.tx.Printf("Error loading entity: %s", err)
 			return fmt.Errorf("Error finding entity: %s", err)
 		} else {
-			return fmt.Errorf("Not found")
+			return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 		}
 	}
 
@@ -1214,7 +1395,7 @@ FROM FullTree WHERE RegSID=? AND `
 		version = entity
 	}
 
-	log.VPrintf(3, "Version: %#v", version)
+	info.tx.VPrintf(3, "Version: %#v", version)
 
 	headerIt := func(e *Entity, info *RequestInfo, key string, val any, attr *Attribute) error {
 		if key[0] == '#' {
@@ -1279,35 +1460,34 @@ FROM FullTree WHERE RegSID=? AND `
 
 	url = entity.GetAsString(singular + "proxyurl")
 
-	log.VPrintf(3, singular+"proxyurl: %s", url)
+	info.tx.VPrintf(3, singular+"proxyurl: %s", url)
 	if url != "" {
 		// Just act as a proxy and copy the remote resource as our response
-		resp, err := http.Get(url)
+		resp, err := FetchProxyURL(info.tx.Span, url)
 		if err != nil {
 			info.StatusCode = http.StatusInternalServerError
+			if pErr, ok := err.(*ProxyError); ok {
+				info.StatusCode = pErr.StatusCode
+			}
 			return err
 		}
-		if resp.StatusCode/100 != 2 {
-			info.StatusCode = resp.StatusCode
-			return fmt.Errorf("Remote error")
-		}
 
-		// Copy all HTTP headers
-		for header, value := range resp.Header {
+		// Copy just the allowed HTTP headers
+		for header, value := range resp.Headers {
 			info.AddHeader(header, strings.Join(value, ","))
 		}
 
-		// Now copy the body
-		_, err = io.Copy(info, resp.Body)
-		if err != nil {
-			info.StatusCode = http.StatusInternalServerError
-			return err
-		}
+		info.Write(resp.Body)
 		return nil
 	}
 
-	buf := version.Get(singular)
-	if buf == nil {
+	// Stream it so we don't need the entire doc in memory
+	rc, err := OpenContent(version.tx, version.Get("#contentid"))
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+	if rc == nil {
 		// No data so just return
 		/*
 			if info.StatusCode == 0 {
@@ -1316,14 +1496,21 @@ FROM FullTree WHERE RegSID=? AND `
 		*/
 		return nil
 	}
-	info.Write(buf.([]byte))
+	defer rc.Close()
+
+	if err = HTTPWriteDocument(info, version, rc); err != nil {
+		if info.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			info.StatusCode = http.StatusInternalServerError
+		}
+		return err
+	}
 
 	return nil
 }
 
 func HTTPGet(info *RequestInfo) error {
-	log.VPrintf(3, ">Enter: HTTPGet(%s)", info.What)
-	defer log.VPrintf(3, "<Exit: HTTPGet(%s)", info.What)
+	info.tx.VPrintf(3, ">Enter: HTTPGet(%s)", info.What)
+	defer info.tx.VPrintf(3, "<Exit: HTTPGet(%s)", info.What)
 
 	info.Root = strings.Trim(info.Root, "/")
 
@@ -1339,6 +1526,22 @@ func HTTPGet(info *RequestInfo) error {
 		return SerializeQuery(info, nil, "Registry", info.Filters)
 	}
 
+	if info.RootPath == "retention" {
+		return HTTPGETRetention(info)
+	}
+
+	if info.RootPath == "metrics" {
+		return HTTPGETMetrics(info)
+	}
+
+	if info.RootPath == "batch" {
+		return HTTPBatch(info)
+	}
+
+	if info.HasFlag("referencedby") {
+		return HTTPGETReferences(info)
+	}
+
 	// 'metaInBody' tells us whether xReg metadata should be in the http
 	// response body or not (meaning, the hasDoc doc)
 	metaInBody := (info.ResourceModel == nil) ||
@@ -1366,9 +1569,9 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 	PanicIf(info.tx.IsCacheDirty(), "Unwritten stuff in cache")
 
 	defer func() {
-		if log.GetVerbose() > 3 {
+		if info.tx.GetVerbose() > 3 {
 			diff := time.Now().Sub(start).Truncate(time.Millisecond)
-			log.Printf("  Total Time: %s", diff)
+			info.tx.Printf("  Total Time: %s", diff)
 		}
 	}()
 
@@ -1378,8 +1581,13 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 		info.AddInline("model")
 	}
 
+	span := info.tx.Span.StartChild("GenerateQuery", SPAN_INTERNAL)
 	query, args, err := GenerateQuery(info.Registry, what, paths, filters,
 		info.DoDocView())
+	span.SetAttr("xregistry.what", what)
+	span.SetError(err)
+	span.Finish()
+
 	results, err := Query(info.tx, query, args...)
 	defer results.Close()
 
@@ -1388,10 +1596,15 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 		return err
 	}
 
-	if log.GetVerbose() > 3 {
-		log.Printf("SerializeQuery: %s", SubQuery(query, args))
+	if err = CheckResultsSize(results); err != nil {
+		info.StatusCode = ErrorStatusCode(err)
+		return err
+	}
+
+	if info.tx.GetVerbose() > 3 {
+		info.tx.Printf("SerializeQuery: %s", SubQuery(query, args))
 		diff := time.Now().Sub(start).Truncate(time.Millisecond)
-		log.Printf("  Query: # results: %d (time: %s)",
+		info.tx.Printf("  Query: # results: %d (time: %s)",
 			len(results.AllRows), diff)
 	}
 
@@ -1423,7 +1636,7 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 			}
 
 			info.StatusCode = http.StatusNotFound
-			return fmt.Errorf("Not found")
+			return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 		}
 	}
 
@@ -1440,7 +1653,7 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 		}
 		if IsNil(entity) {
 			info.StatusCode = http.StatusNotFound
-			return fmt.Errorf("Not found")
+			return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 		}
 	}
 
@@ -1495,7 +1708,7 @@ func HTTPPutPost(info *RequestInfo) error {
 		(info.ResourceModel.GetHasDocument() == false || info.ShowDetails ||
 			(len(info.Parts) == 5 && info.Parts[4] == "meta"))
 
-	log.VPrintf(3, "HTTPPutPost: %s %s", method, info.OriginalPath)
+	info.tx.VPrintf(3, "HTTPPutPost: %s %s", method, info.OriginalPath)
 
 	info.Root = strings.Trim(info.Root, "/")
 
@@ -1509,15 +1722,41 @@ func HTTPPutPost(info *RequestInfo) error {
 		return HTTPPUTModel(info)
 	}
 
+	if info.RootPath == "batch" {
+		return HTTPBatch(info)
+	}
+
+	if info.RootPath == "retention" || info.RootPath == "metrics" {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("%s not allowed on /%s", method, info.RootPath)
+	}
+
 	// Load-up the body
 	// //////////////////////////////////////////////////////
-	body, err := io.ReadAll(info.OriginalRequest.Body)
-	if err != nil {
-		info.StatusCode = http.StatusBadRequest
-		return fmt.Errorf("Error reading body: %s", err)
-	}
-	if len(body) == 0 {
-		body = nil
+	var body []byte
+	var docRef *ContentRef
+	var err error
+
+	// If the body is just a document, and we have a ContentStore, then
+	// stream it right into the store rather than reading it all into memory
+	docInBody := !metaInBody && (len(info.Parts) == 4 || len(info.Parts) == 6)
+	if docInBody && Contents != nil {
+		docRef, err = StoreContent(info.OriginalRequest.Body)
+		if err != nil {
+			if tlErr := info.TooLargeError(err); tlErr != nil {
+				return tlErr
+			}
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+	} else {
+		body, err = info.ReadBody()
+		if err != nil {
+			return err
+		}
+		if len(body) == 0 {
+			body = nil
+		}
 	}
 
 	// Check for some obvious high-level bad states up-front
@@ -1565,6 +1804,9 @@ func HTTPPutPost(info *RequestInfo) error {
 	if err != nil {
 		return err
 	}
+	if docRef != nil {
+		IncomingObj[info.ResourceModel.Singular] = docRef
+	}
 
 	// Walk the PATH and process things
 	///////////////////////////////////
@@ -1691,7 +1933,8 @@ func HTTPPutPost(info *RequestInfo) error {
 			addType = ADD_PATCH
 		}
 
-		for id, obj := range objMap {
+		for _, id := range SortedKeysXrefLast(objMap) {
+			obj := objMap[id]
 			r, _, err := group.UpsertResourceWithObject(info.ResourceType,
 				id, "", obj, addType, false)
 			if err != nil {
@@ -1944,7 +2187,7 @@ func HTTPPutPost(info *RequestInfo) error {
 			PanicIf(err != nil, "No meta %q: %s", resource.UID, err)
 
 			if meta.Get("readonly") == true {
-				return fmt.Errorf("Write operations on read-only " +
+				return NewProblemError(PROBLEM_READONLY, "Write operations on read-only "+
 					"resources are not allowed")
 			}
 		}
@@ -2083,12 +2326,11 @@ func HTTPPutPost(info *RequestInfo) error {
 func HTTPPUTCapabilities(info *RequestInfo) error {
 	if len(info.Parts) > 1 {
 		info.StatusCode = http.StatusNotFound
-		return fmt.Errorf("Not found")
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 	}
 
-	reqBody, err := io.ReadAll(info.OriginalRequest.Body)
+	reqBody, err := info.ReadBody()
 	if err != nil {
-		info.StatusCode = http.StatusInternalServerError
 		return err
 	}
 
@@ -2112,12 +2354,11 @@ func HTTPPUTCapabilities(info *RequestInfo) error {
 func HTTPPUTModel(info *RequestInfo) error {
 	if len(info.Parts) > 1 {
 		info.StatusCode = http.StatusNotFound
-		return fmt.Errorf("Not found")
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
 	}
 
-	reqBody, err := io.ReadAll(info.OriginalRequest.Body)
+	reqBody, err := info.ReadBody()
 	if err != nil {
-		info.StatusCode = http.StatusInternalServerError
 		return err
 	}
 
@@ -2242,6 +2483,12 @@ func HTTPDelete(info *RequestInfo) error {
 		return fmt.Errorf("Can't delete an entire registry")
 	}
 
+	if info.RootPath == "retention" || info.RootPath == "metrics" ||
+		info.RootPath == "batch" {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("DELETE not allowed on /%s", info.RootPath)
+	}
+
 	var err error
 	epochStr := info.GetFlag("epoch")
 	epochInt := -1
@@ -2280,7 +2527,8 @@ func HTTPDelete(info *RequestInfo) error {
 		// DELETE /GROUPs/gID
 		if epochInt >= 0 {
 			if e := group.Get("epoch"); e != epochInt {
-				return fmt.Errorf(`Epoch value for %q must be %d not %d`,
+				return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+					`Epoch value for %q must be %d not %d`,
 					group.UID, e, epochInt)
 			}
 		}
@@ -2326,7 +2574,8 @@ func HTTPDelete(info *RequestInfo) error {
 		// DELETE /GROUPs/gID/RESOURCEs/rID
 		if epochInt >= 0 {
 			if e := meta.Get("epoch"); e != epochInt {
-				return fmt.Errorf(`Epoch value for %q must be %d not %d`,
+				return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+					`Epoch value for %q must be %d not %d`,
 					resource.UID, e, epochInt)
 			}
 		}
@@ -2370,7 +2619,8 @@ func HTTPDelete(info *RequestInfo) error {
 		// DELETE /GROUPs/gID/RESOURCEs/rID/versions/vID
 		if epochInt >= 0 {
 			if e := version.Get("epoch"); e != epochInt {
-				return fmt.Errorf(`Epoch value for %q must be %d not %d`,
+				return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+					`Epoch value for %q must be %d not %d`,
 					info.VersionUID, e, epochInt)
 			}
 		}
@@ -2393,9 +2643,9 @@ type EpochEntryMap map[string]EpochEntry
 func LoadEpochMap(info *RequestInfo) (EpochEntryMap, error) {
 	res := EpochEntryMap{}
 
-	body, err := io.ReadAll(info.OriginalRequest.Body)
+	body, err := info.ReadBody()
 	if err != nil {
-		return nil, fmt.Errorf("Error reading body: %s", err)
+		return nil, err
 	}
 
 	bodyStr := strings.TrimSpace(string(body))
@@ -2458,7 +2708,8 @@ func HTTPDeleteGroups(info *RequestInfo) error {
 					id)
 			}
 			if tmpInt != group.Get("epoch") {
-				return fmt.Errorf(`Epoch value for %q must be %d not %d`,
+				return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+					`Epoch value for %q must be %d not %d`,
 					id, group.Get("epoch"), tmpInt)
 			}
 		}
@@ -2553,7 +2804,8 @@ func HTTPDeleteResources(info *RequestInfo) error {
 						id)
 				}
 				if tmpInt != meta.Get("epoch") {
-					return fmt.Errorf(`Epoch value for %q must be %d not %d`,
+					return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+						`Epoch value for %q must be %d not %d`,
 						id, meta.Get("epoch"), tmpInt)
 				}
 			}
@@ -2639,7 +2891,8 @@ func HTTPDeleteVersions(info *RequestInfo) error {
 					id)
 			}
 			if tmpInt != version.Get("epoch") {
-				return fmt.Errorf(`Epoch value for %q must be %d not %d`,
+				return NewProblemError(PROBLEM_MISMATCHED_EPOCH,
+					`Epoch value for %q must be %d not %d`,
 					id, version.Get("epoch"), tmpInt)
 			}
 		}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-
-	log "github.com/duglin/dlog"
 )
 
 type RequestInfo struct {
@@ -42,7 +40,8 @@ type RequestInfo struct {
 
 var explicitInlines = []string{"capabilities", "model"}
 var nonModelInlines = append([]string{"*"}, explicitInlines...)
-var rootPaths = []string{"capabilities", "model", "export"}
+var rootPaths = []string{"capabilities", "model", "export", "retention",
+	"metrics", "batch"}
 
 type Inline struct {
 	Path    string    // value from ?inline query param
@@ -157,7 +156,7 @@ func (info *RequestInfo) ShouldInline(entityPath string) bool {
 
 	for _, inline := range info.Inlines {
 		iPP := inline.PP
-		log.VPrintf(4, "Inline cmp: %q in %q",
+		info.tx.VPrintf(4, "Inline cmp: %q in %q",
 			ePP.DB(), inline.PP.DB())
 
 		// * doesn't include "model"... because they're special, they need to
@@ -175,7 +174,7 @@ func (info *RequestInfo) ShouldInline(entityPath string) bool {
 			(inline.NonWild != nil && ePP.HasPrefix(inline.NonWild)) {
 			// (iPP.Len() > 1 && iPP.Bottom() == "*" && ePP.HasPrefix(iPP.RemoveLast())) {
 
-			log.VPrintf(4, "   match: %q in %q",
+			info.tx.VPrintf(4, "   match: %q in %q",
 				ePP.DB(), inline.PP.DB())
 			return true
 		}
@@ -204,18 +203,26 @@ type FilterExpr struct {
 
 func ParseRequest(tx *Tx, w http.ResponseWriter, r *http.Request) (*RequestInfo, error) {
 	path := strings.Trim(r.URL.Path, " /")
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
 	info := &RequestInfo{
 		tx: tx,
 
 		OriginalPath:     path,
 		OriginalRequest:  r,
 		OriginalResponse: w,
-		Registry:         GetDefaultReg(tx),
-		BaseURL:          "http://" + r.Host,
+		Registry:         tx.Registry,
+		BaseURL:          scheme + "://" + r.Host,
 
 		extras: map[string]any{},
 	}
 
+	// Batch operations will already have the registry set in the Tx
+	if info.Registry == nil {
+		info.Registry = GetDefaultReg(tx)
+	}
 	PanicIf(info.Registry == nil, "No default registry")
 
 	if info.Registry != nil && tx.Registry == nil {
@@ -224,11 +231,14 @@ func ParseRequest(tx *Tx, w http.ResponseWriter, r *http.Request) (*RequestInfo,
 
 	info.HTTPWriter = DefaultHTTPWriter(info)
 
-	if log.GetVerbose() > 2 {
-		defer func() { log.VPrintf(3, "Info:\n%s\n", ToJSON(info)) }()
+	if tx.GetVerbose() > 2 {
+		defer func() { tx.VPrintf(3, "Info:\n%s\n", ToJSON(info)) }()
 	}
 
-	if tmp := r.Header.Get("xRegistry~User"); tmp != "" {
+	// A verified client cert always wins over the header
+	if tmp := ClientCertUser(r); tmp != "" {
+		tx.User = tmp
+	} else if tmp := r.Header.Get("xRegistry~User"); tmp != "" {
 		tx.User = tmp
 	}
 
@@ -438,7 +448,9 @@ func (info *RequestInfo) ParseRequestURL() error {
 	}
 	if gModel == nil && (info.Parts[0] != "model" || len(info.Parts) > 1) {
 		info.StatusCode = http.StatusNotFound
-		return fmt.Errorf("Unknown Group type: %s", info.Parts[0])
+		return NewProblemError(PROBLEM_UNKNOWN_GROUP_TYPE,
+			"Unknown Group type: %s", info.Parts[0]).
+			With("grouptype", info.Parts[0])
 	}
 	info.GroupModel = gModel
 	info.GroupType = info.Parts[0]
@@ -476,7 +488,9 @@ func (info *RequestInfo) ParseRequestURL() error {
 	}
 	if rModel == nil {
 		info.StatusCode = http.StatusNotFound
-		return fmt.Errorf("Unknown Resource type: %s", info.Parts[2])
+		return NewProblemError(PROBLEM_UNKNOWN_RESOURCE_TYPE,
+			"Unknown Resource type: %s", info.Parts[2]).
+			With("resourcetype", info.Parts[2])
 	}
 	info.ResourceModel = rModel
 	info.ResourceType = info.Parts[2]
@@ -587,6 +601,14 @@ func (info *RequestInfo) HasFlag(name string) bool {
 	return ok
 }
 
+// Returns true if the body of the request, or response, is a Resource's
+// document rather than its xRegistry metadata
+func (info *RequestInfo) IsDocument() bool {
+	return info.RootPath == "" && info.ResourceModel != nil &&
+		info.ResourceModel.GetHasDocument() && !info.ShowDetails &&
+		(len(info.Parts) == 4 || len(info.Parts) == 6)
+}
+
 func (info *RequestInfo) DoDocView() bool {
 	return info.HasFlag("doc") || info.RootPath == "export"
 }
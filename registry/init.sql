@@ -80,6 +80,10 @@ CREATE TABLE ModelEntities (        # Group or Resource (no parent=Group)
     TypeMap           JSON,
     Labels            JSON,
     MetaAttributes    JSON,
+    XRefDelete        VARCHAR(64),
+    Retention         JSON,
+    VersionLock       VARCHAR(64),
+    ProxySnapshot     BOOL,
 
     PRIMARY KEY(SID),
     UNIQUE INDEX (RegistrySID, ParentSID, Plural),
@@ -417,6 +421,7 @@ UNION SELECT * FROM xRefProps ;
 CREATE TABLE ResourceContents (
     VersionSID      VARCHAR(255),
     Content         MEDIUMBLOB,
+    BlobID          VARCHAR(64),    # If set, Content is in the ContentStore
 
     PRIMARY KEY (VersionSID)
 );
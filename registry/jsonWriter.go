@@ -5,9 +5,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	log "github.com/duglin/dlog"
-	"io"
-	"net/http"
 	"path"
 	"strings"
 )
@@ -196,8 +193,8 @@ func (jw *JsonWriter) WriteCollection() (int, error) {
 }
 
 func (jw *JsonWriter) WriteEntity() error {
-	log.VPrintf(3, ">Enter: WriteEntity (%v)", jw.Entity)
-	defer log.VPrintf(3, "<Exit: WriteEntity")
+	jw.info.tx.VPrintf(3, ">Enter: WriteEntity (%v)", jw.Entity)
+	defer jw.info.tx.VPrintf(3, "<Exit: WriteEntity")
 
 	if jw.Entity == nil {
 		jw.Printf("{}")
@@ -212,18 +209,18 @@ func (jw *JsonWriter) WriteEntity() error {
 	myAbstract := jw.Entity.Abstract
 	addSpace := false // Add space before next attribute?
 
-	if log.GetVerbose() > 3 {
-		log.VPrintf(0, "eType: %d", myType)
-		log.VPrintf(0, "JW:\n%s\n", ToJSON(jw))
-		log.VPrintf(0, "JW.Obj:\n%s\n", ToJSON(jw.Entity.Object))
-		log.VPrintf(0, "JW.NObj:\n%s\n", ToJSON(jw.Entity.NewObject))
+	if jw.info.tx.GetVerbose() > 3 {
+		jw.info.tx.VPrintf(0, "eType: %d", myType)
+		jw.info.tx.VPrintf(0, "JW:\n%s\n", ToJSON(jw))
+		jw.info.tx.VPrintf(0, "JW.Obj:\n%s\n", ToJSON(jw.Entity.Object))
+		jw.info.tx.VPrintf(0, "JW.NObj:\n%s\n", ToJSON(jw.Entity.NewObject))
 	}
 
 	jw.Printf("{")
 	jw.Indent()
 
 	jsonIt := func(e *Entity, info *RequestInfo, key string, val any, attr *Attribute) error {
-		log.VPrintf(4, "jsonIt: %q", key)
+		jw.info.tx.VPrintf(4, "jsonIt: %q", key)
 		if key == "$space" {
 			addSpace = true
 			return nil
@@ -386,16 +383,13 @@ func SerializeResourceContents(jw *JsonWriter, e *Entity, info *RequestInfo, ext
 		}
 
 		if url := jw.Entity.GetAsString(singular + "proxyurl"); url != "" {
-			resp, err := http.Get(url)
-			if err != nil {
+			resp, err := FetchProxyURL(jw.Entity.tx.Span, url)
+			if pErr, ok := err.(*ProxyError); ok && pErr.Status != "" {
+				data = []byte("GET error:" + pErr.Status)
+			} else if err != nil {
 				data = []byte("GET error:" + err.Error())
-			} else if resp.StatusCode/100 != 2 {
-				data = []byte("GET error:" + resp.Status)
 			} else {
-				data, err = io.ReadAll(resp.Body)
-				if err != nil {
-					data = []byte("GET error:" + err.Error())
-				}
+				data = resp.Body
 			}
 		}
 
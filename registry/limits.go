@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits to stop one client from hogging the server. Zero means no limit.
+
+var MaxRequestSize int64 = 100 * 1024 * 1024 // Bytes in a request's body
+var MaxResponseEntities = 0                  // # of entities in a response
+var MaxResponseSize int64 = 0                // Bytes of entity data
+var QueryTimeout time.Duration = 0           // All DB calls of one request
+
+// Per-client token bucket rate limiting. Each client's bucket holds up to
+// "Burst" tokens and is refilled at "Rate" tokens per second. Each request
+// uses one token.
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Returns zero if the client "key" is allowed to make another request,
+// otherwise it returns how long they need to wait before trying again
+func (rl *RateLimiter) Allow(key string, now time.Time) time.Duration {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.prune(now)
+
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(rl.Burst), last: now}
+		rl.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(rl.Burst), b.tokens+elapsed*rl.Rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	wait := (1 - b.tokens) / rl.Rate
+	return time.Duration(wait * float64(time.Second))
+}
+
+// Every so often get rid of the buckets that are full again since they're
+// the same as not having one at all. Must hold the mutex.
+func (rl *RateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < time.Minute {
+		return
+	}
+	rl.lastPrune = now
+
+	full := time.Duration(float64(rl.Burst) / rl.Rate * float64(time.Second))
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= full {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Who to charge the request to: the authenticated user if there is one,
+// otherwise the client's IP address. The "xRegistry~User" header isn't used
+// since anyone can set it to anything.
+func RateLimitKey(r *http.Request) string {
+	if user := ClientCertUser(r); user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Checks the limits that can be done before we start working on the
+// request. Returns false if an error was sent back to the client.
+func (s *Server) CheckLimits(w http.ResponseWriter, r *http.Request) bool {
+	if s.RateLimiter != nil {
+		wait := s.RateLimiter.Allow(RateLimitKey(r), time.Now())
+		if wait > 0 {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			WriteProblem(w, r, NewProblemError(PROBLEM_TOO_MANY_REQUESTS,
+				"Too many requests, try again in %d second(s)", secs), 0)
+			return false
+		}
+	}
+
+	if MaxRequestSize > 0 && r.Body != nil {
+		if r.ContentLength > MaxRequestSize {
+			WriteProblem(w, r, NewProblemError(PROBLEM_TOO_LARGE,
+				"Request body is too large, the max is %d bytes",
+				MaxRequestSize), 0)
+			return false
+		}
+		// In case there's no Content-Length header, or it lies
+		r.Body = http.MaxBytesReader(w, r.Body, MaxRequestSize)
+	}
+
+	return true
+}
+
+// Returns the error to send back to the client if "err" was caused by the
+// request's body being bigger than MaxRequestSize, otherwise nil
+func (info *RequestInfo) TooLargeError(err error) error {
+	mbe := (*http.MaxBytesError)(nil)
+	if !errors.As(err, &mbe) {
+		return nil
+	}
+	info.StatusCode = http.StatusRequestEntityTooLarge
+	return NewProblemError(PROBLEM_TOO_LARGE,
+		"Request body is too large, the max is %d bytes", mbe.Limit)
+}
+
+// Reads the entire body of the incoming request
+func (info *RequestInfo) ReadBody() ([]byte, error) {
+	body, err := io.ReadAll(info.OriginalRequest.Body)
+	if err != nil {
+		if tlErr := info.TooLargeError(err); tlErr != nil {
+			return nil, tlErr
+		}
+		info.StatusCode = http.StatusBadRequest
+		return nil, fmt.Errorf("Error reading body: %s", err)
+	}
+	return body, nil
+}
+
+// Makes sure the results of a query aren't too big to send back.
+// Mainly for things like "?inline=*" on the root of a large registry.
+func CheckResultsSize(results *Result) error {
+	if MaxResponseEntities <= 0 && MaxResponseSize <= 0 {
+		return nil
+	}
+
+	// RegSID,Type,Plural,Singular,eSID,UID,PropName,PropValue,...
+	//   0     1     2     3        4     5   6         7
+	entities := map[string]bool{}
+	size := int64(0)
+	for _, row := range results.AllRows {
+		entities[NotNilString(row[4])] = true
+		if !IsNil(row[7]) && !IsNil(*row[7]) {
+			switch val := (*row[7]).(type) {
+			case []byte:
+				size += int64(len(val))
+			case string:
+				size += int64(len(val))
+			}
+		}
+	}
+
+	if MaxResponseEntities > 0 && len(entities) > MaxResponseEntities {
+		return NewProblemError(PROBLEM_TOO_LARGE, "Response would have too "+
+			"many entities (%d), the max is %d. Try using fewer inlines "+
+			"or a filter", len(entities), MaxResponseEntities)
+	}
+	if MaxResponseSize > 0 && size > MaxResponseSize {
+		return NewProblemError(PROBLEM_TOO_LARGE, "Response would be too "+
+			"large (%d bytes), the max is %d. Try using fewer inlines "+
+			"or a filter", size, MaxResponseSize)
+	}
+	return nil
+}
+
+// The Context to use for the Tx's DB calls
+func (tx *Tx) Context() context.Context {
+	if tx.Ctx == nil {
+		return context.Background()
+	}
+	return tx.Ctx
+}
+
+// Returns the error to use if the Tx's DB calls can't be done any more
+// because we've hit the QueryTimeout (or the client went away)
+func (tx *Tx) ContextError() error {
+	err := tx.Context().Err()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewProblemError(PROBLEM_SERVICE_UNAVAILABLE,
+			"Request took too long, the DB query timeout is %s", QueryTimeout)
+	}
+	return NewProblemError(PROBLEM_SERVICE_UNAVAILABLE,
+		"Request was canceled: %s", err)
+}
@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if wait := rl.Allow("a", now); wait != 0 {
+			t.Fatalf("Request %d should be allowed, got wait %s", i, wait)
+		}
+	}
+	if wait := rl.Allow("a", now); wait != 500*time.Millisecond {
+		t.Fatalf("Should have to wait 500ms, got %s", wait)
+	}
+
+	// Other clients have their own bucket
+	if wait := rl.Allow("b", now); wait != 0 {
+		t.Fatalf("Other client should be allowed, got %s", wait)
+	}
+
+	// Half a second later there's one token again
+	now = now.Add(500 * time.Millisecond)
+	if wait := rl.Allow("a", now); wait != 0 {
+		t.Fatalf("Should be allowed after refill, got %s", wait)
+	}
+	if wait := rl.Allow("a", now); wait == 0 {
+		t.Fatalf("Should not be allowed")
+	}
+
+	// Full buckets are removed
+	rl.Allow("a", now.Add(time.Hour))
+	if len(rl.buckets) != 1 {
+		t.Fatalf("Buckets weren't pruned: %d", len(rl.buckets))
+	}
+
+	if rl = NewRateLimiter(0.5, 0); rl.Burst != 1 {
+		t.Fatalf("Default burst should be 1, got %d", rl.Burst)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("xRegistry~User", "someone")
+	if key := RateLimitKey(req); key != "ip:10.1.2.3" {
+		t.Fatalf("Bad key: %s", key)
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	saveSize := MaxRequestSize
+	defer func() { MaxRequestSize = saveSize }()
+	MaxRequestSize = 10
+
+	s := &Server{RateLimiter: NewRateLimiter(1, 1)}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/", strings.NewReader("{}"))
+	if !s.CheckLimits(rec, req) {
+		t.Fatalf("First request should be allowed: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	if s.CheckLimits(rec, req) || rec.Code != 429 ||
+		rec.Header().Get("Retry-After") != "1" ||
+		rec.Header().Get("Content-Type") != PROBLEM_CONTENT_TYPE {
+		t.Fatalf("Should be rate limited: %d %v", rec.Code, rec.Header())
+	}
+
+	// Too big, based on Content-Length
+	s.RateLimiter = nil
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/", strings.NewReader("12345678901"))
+	if s.CheckLimits(rec, req) || rec.Code != 413 {
+		t.Fatalf("Should be too large: %d", rec.Code)
+	}
+
+	// Too big, w/o a Content-Length
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/", io.MultiReader(
+		strings.NewReader("123456"), strings.NewReader("78901")))
+	if !s.CheckLimits(rec, req) {
+		t.Fatalf("Should be allowed w/o a Content-Length")
+	}
+	info := &RequestInfo{OriginalRequest: req}
+	if _, err := info.ReadBody(); err == nil || info.StatusCode != 413 ||
+		err.Error() != "Request body is too large, the max is 10 bytes" {
+		t.Fatalf("Bad error: %d %v", info.StatusCode, err)
+	}
+}
+
+func TestCheckResultsSize(t *testing.T) {
+	saveCount, saveSize := MaxResponseEntities, MaxResponseSize
+	defer func() {
+		MaxResponseEntities, MaxResponseSize = saveCount, saveSize
+	}()
+
+	row := func(eSID string, val string) []*any {
+		res := make([]*any, 11)
+		for i := range res {
+			res[i] = new(any)
+		}
+		*res[4] = []byte(eSID)
+		*res[7] = []byte(val)
+		return res
+	}
+	results := &Result{AllRows: [][]*any{
+		row("e1", "12345"), row("e1", "12345"), row("e2", "12345"),
+	}}
+
+	if err := CheckResultsSize(results); err != nil {
+		t.Fatalf("No limits: %s", err)
+	}
+
+	MaxResponseEntities = 2
+	if err := CheckResultsSize(results); err != nil {
+		t.Fatalf("Under the limit: %s", err)
+	}
+	MaxResponseEntities = 1
+	if err := CheckResultsSize(results); err == nil ||
+		ErrorStatusCode(err) != 413 {
+		t.Fatalf("Should be too many entities: %v", err)
+	}
+
+	MaxResponseEntities = 0
+	MaxResponseSize = 14
+	if err := CheckResultsSize(results); err == nil ||
+		!strings.Contains(err.Error(), "(15 bytes), the max is 14") {
+		t.Fatalf("Should be too large: %v", err)
+	}
+}
@@ -96,6 +96,7 @@ type Attribute struct {
 	Immutable   bool   `json:"immutable,omitempty"`
 	Required    bool   `json:"required,omitempty"`
 	Default     any    `json:"default,omitempty"`
+	OnDelete    string `json:"ondelete,omitempty"` // for xids
 
 	Attributes Attributes `json:"attributes,omitempty"` // for Objs
 	Item       *Item      `json:"item,omitempty"`       // for maps & arrays
@@ -144,6 +145,10 @@ type ResourceModel struct {
 	SetVersionId     *bool             `json:"setversionid"`            // do not include omitempty
 	SetDefaultSticky *bool             `json:"setdefaultversionsticky"` // do not include omitempty
 	HasDocument      *bool             `json:"hasdocument"`             // do not include omitempty
+	XRefDelete       string            `json:"xrefdelete,omitempty"`
+	Retention        *RetentionPolicy  `json:"retention,omitempty"`
+	VersionLock      string            `json:"versionlock,omitempty"`
+	ProxySnapshot    bool              `json:"proxysnapshot,omitempty"`
 	TypeMap          map[string]string `json:"typemap,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty"`
 	Attributes       Attributes        `json:"attributes,omitempty"`
@@ -681,8 +686,8 @@ func (i *Item) DelAttribute(name string) error {
 }
 
 func LoadModel(reg *Registry) *Model {
-	log.VPrintf(3, ">Enter: LoadModel")
-	defer log.VPrintf(3, "<Exit: LoadModel")
+	reg.tx.VPrintf(3, ">Enter: LoadModel")
+	defer reg.tx.VPrintf(3, "<Exit: LoadModel")
 
 	PanicIf(reg == nil, "nil")
 	groups := map[string]*GroupModel{} // Model SID -> *GroupModel
@@ -723,7 +728,8 @@ func LoadModel(reg *Registry) *Model {
         SELECT
             SID, RegistrySID, ParentSID, Plural, Singular, Attributes,
 			MaxVersions, SetVersionId, SetDefaultSticky, HasDocument,
-			TypeMap, Labels, MetaAttributes
+			TypeMap, Labels, MetaAttributes, XRefDelete, Retention,
+			VersionLock, ProxySnapshot
         FROM ModelEntities
         WHERE RegistrySID=?
         ORDER BY ParentSID ASC`, reg.DbSID)
@@ -751,6 +757,10 @@ func LoadModel(reg *Registry) *Model {
 		if row[12] != nil {
 			Unmarshal([]byte(NotNilString(row[12])), &metaAttrs)
 		}
+		retention := (*RetentionPolicy)(nil)
+		if row[14] != nil {
+			Unmarshal([]byte(NotNilString(row[14])), &retention)
+		}
 
 		if *row[2] == nil { // ParentSID nil -> new Group
 			g := &GroupModel{ // Plural
@@ -784,6 +794,10 @@ func LoadModel(reg *Registry) *Model {
 					SetVersionId:     PtrBool(NotNilBoolDef(row[7], SETVERSIONID)),
 					SetDefaultSticky: PtrBool(NotNilBoolDef(row[8], SETDEFAULTSTICKY)),
 					HasDocument:      PtrBool(NotNilBoolDef(row[9], HASDOCUMENT)),
+					XRefDelete:       NotNilString(row[13]),
+					Retention:        retention,
+					VersionLock:      NotNilString(row[15]),
+					ProxySnapshot:    NotNilBoolDef(row[16], false),
 					TypeMap:          typemap,
 					Labels:           labels,
 					MetaAttributes:   metaAttrs,
@@ -856,7 +870,7 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 	// Apply new stuff
 	newM.Registry = m.Registry
 	for _, newGM := range newM.Groups {
-		log.VPrintf(4, "Applying Group: %s", newGM.Plural)
+		m.Registry.tx.VPrintf(4, "Applying Group: %s", newGM.Plural)
 		newGM.Model = m
 		oldGM := m.Groups[newGM.Plural]
 		if oldGM == nil {
@@ -871,7 +885,7 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 		oldGM.Attributes = newGM.Attributes
 
 		for _, newRM := range newGM.Resources {
-			log.VPrintf(4, "Applying Resource: %s", newRM.Plural)
+			m.Registry.tx.VPrintf(4, "Applying Resource: %s", newRM.Plural)
 			oldRM := oldGM.Resources[newRM.Plural]
 			if oldRM == nil {
 				oldRM, err = oldGM.AddResourceModelFull(&ResourceModel{
@@ -883,7 +897,7 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 					HasDocument:      newRM.HasDocument,
 				})
 				if err != nil {
-					log.VPrintf(4, "Err: %s", err)
+					m.Registry.tx.VPrintf(4, "Err: %s", err)
 					return err
 				}
 
@@ -894,6 +908,10 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 				oldRM.SetDefaultSticky = newRM.SetDefaultSticky
 				oldRM.HasDocument = newRM.HasDocument
 			}
+			oldRM.XRefDelete = newRM.XRefDelete
+			oldRM.Retention = newRM.Retention
+			oldRM.VersionLock = newRM.VersionLock
+			oldRM.ProxySnapshot = newRM.ProxySnapshot
 			oldRM.Attributes = newRM.Attributes
 			oldRM.TypeMap = newRM.TypeMap
 			oldRM.Labels = newRM.Labels
@@ -911,8 +929,8 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 }
 
 func (gm *GroupModel) Delete() error {
-	log.VPrintf(3, ">Enter: Delete.GroupModel: %s", gm.Plural)
-	defer log.VPrintf(3, "<Exit: Delete.GroupModel")
+	gm.Model.Registry.tx.VPrintf(3, ">Enter: Delete.GroupModel: %s", gm.Plural)
+	defer gm.Model.Registry.tx.VPrintf(3, "<Exit: Delete.GroupModel")
 	err := DoOne(gm.Model.Registry.tx, `
         DELETE FROM ModelEntities
 		WHERE RegistrySID=? AND SID=?`, // SID should be enough, but ok
@@ -1101,13 +1119,18 @@ func (gm *GroupModel) AddResourceModelFull(rm *ResourceModel) (*ResourceModel, e
 	buf, _ = json.Marshal(rm.Labels)
 	labels := string(buf)
 
+	buf, _ = json.Marshal(rm.Retention)
+	retention := string(buf)
+
 	err := DoOne(gm.Model.Registry.tx, `
 		INSERT INTO ModelEntities(
 			SID, RegistrySID, ParentSID, Plural, Singular, MaxVersions,
-			SetVersionId, SetDefaultSticky, HasDocument, TypeMap, Labels)
-		VALUES(?,?,?,?,?,?,?,?,?,?,?)`,
+			SetVersionId, SetDefaultSticky, HasDocument, TypeMap, Labels,
+			XRefDelete, Retention, VersionLock, ProxySnapshot)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 		rm.SID, gm.Model.Registry.DbSID, gm.SID, rm.Plural, rm.Singular, rm.MaxVersions,
-		rm.GetSetVersionId(), rm.GetSetDefaultSticky(), rm.GetHasDocument(), typemap, labels)
+		rm.GetSetVersionId(), rm.GetSetDefaultSticky(), rm.GetHasDocument(), typemap, labels,
+		rm.XRefDelete, retention, rm.VersionLock, rm.ProxySnapshot)
 	if err != nil {
 		log.Printf("Error inserting resourceModel(%s): %s", rm.Plural, err)
 		return nil, err
@@ -1173,10 +1196,18 @@ func (rm *ResourceModel) GetHasDocument() bool {
 	return rm.HasDocument == nil || *rm.HasDocument == true
 }
 
+func (rm *ResourceModel) GetXRefDelete() string {
+	if rm.XRefDelete == "" {
+		return XREFDELETE
+	}
+	return rm.XRefDelete
+}
+
 func (rm *ResourceModel) Delete() error {
-	log.VPrintf(3, ">Enter: Delete.ResourceModel: %s", rm.Plural)
-	defer log.VPrintf(3, "<Exit: Delete.ResourceModel")
-	err := DoOne(rm.GroupModel.Model.Registry.tx, `
+	tx := rm.GroupModel.Model.Registry.tx
+	tx.VPrintf(3, ">Enter: Delete.ResourceModel: %s", rm.Plural)
+	defer tx.VPrintf(3, "<Exit: Delete.ResourceModel")
+	err := DoOne(tx, `
         DELETE FROM ModelEntities
 		WHERE RegistrySID=? AND SID=?`, // SID should be enough, but ok
 		rm.GroupModel.Model.Registry.DbSID, rm.SID)
@@ -1202,6 +1233,8 @@ func (rm *ResourceModel) Save() error {
 	attrs := string(buf)
 	buf, _ = json.Marshal(rm.MetaAttributes)
 	metaAttrs := string(buf)
+	buf, _ = json.Marshal(rm.Retention)
+	retention := string(buf)
 
 	err := DoZeroTwo(rm.GroupModel.Model.Registry.tx, `
         INSERT INTO ModelEntities(
@@ -1209,23 +1242,25 @@ func (rm *ResourceModel) Save() error {
 			ParentSID, Plural, Singular, MaxVersions,
 			Attributes,
 			SetVersionId, SetDefaultSticky, HasDocument, TypeMap,
-			Labels, MetaAttributes)
-        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)
+			Labels, MetaAttributes, XRefDelete, Retention, VersionLock,
+			ProxySnapshot)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
         ON DUPLICATE KEY UPDATE
             ParentSID=?, Plural=?, Singular=?,
 			Attributes=?,
             MaxVersions=?, SetVersionId=?, SetDefaultSticky=?, HasDocument=?, TypeMap=?, Labels=?,
-			MetaAttributes=?`,
+			MetaAttributes=?, XRefDelete=?, Retention=?, VersionLock=?,
+			ProxySnapshot=?`,
 		rm.SID, rm.GroupModel.Model.Registry.DbSID,
 		rm.GroupModel.SID, rm.Plural, rm.Singular, rm.MaxVersions,
 		attrs,
 		rm.GetSetVersionId(), rm.GetSetDefaultSticky(), rm.GetHasDocument(), typemap, labels,
-		metaAttrs,
+		metaAttrs, rm.XRefDelete, retention, rm.VersionLock, rm.ProxySnapshot,
 
 		rm.GroupModel.SID, rm.Plural, rm.Singular,
 		attrs,
 		rm.MaxVersions, rm.GetSetVersionId(), rm.GetSetDefaultSticky(), rm.GetHasDocument(), typemap, labels,
-		metaAttrs)
+		metaAttrs, rm.XRefDelete, retention, rm.VersionLock, rm.ProxySnapshot)
 	if err != nil {
 		log.Printf("Error updating resourceModel(%s): %s", rm.Plural, err)
 		return err
@@ -1768,6 +1803,25 @@ func (rm *ResourceModel) Verify(rmName string) error {
 			rmName)
 	}
 
+	if rm.XRefDelete != "" && rm.XRefDelete != XREFDELETE_BLOCK &&
+		rm.XRefDelete != XREFDELETE_CASCADE &&
+		rm.XRefDelete != XREFDELETE_STANDALONE {
+		return fmt.Errorf("Resource %q has an invalid 'xrefdelete' value "+
+			"(%s), must be one of: %s, %s, %s", rmName, rm.XRefDelete,
+			XREFDELETE_BLOCK, XREFDELETE_CASCADE, XREFDELETE_STANDALONE)
+	}
+
+	if err := rm.Retention.Verify(rmName); err != nil {
+		return err
+	}
+
+	if rm.VersionLock != "" && rm.VersionLock != VERSIONLOCK_MANUAL &&
+		rm.VersionLock != VERSIONLOCK_ONCREATE {
+		return fmt.Errorf("Resource %q has an invalid 'versionlock' value "+
+			"(%s), must be one of: %s, %s", rmName, rm.VersionLock,
+			VERSIONLOCK_MANUAL, VERSIONLOCK_ONCREATE)
+	}
+
 	// Make sure we have the xRegistry core/spec defined attributes
 	// in the list and they're not changed in an inappropriate way.
 	// This just checks the Group level Attributes
@@ -1788,6 +1842,11 @@ func (rm *ResourceModel) Verify(rmName string) error {
 			specProp = specProp.Clone(rm.Singular + "id")
 		}
 
+		// "locked" is only part of the model when locking is turned on
+		if specProp.Name == "locked" && rm.VersionLock == "" {
+			continue
+		}
+
 		if specProp.InType(ENTITY_VERSION) {
 			modelAttr, ok := rm.Attributes[specProp.Name]
 			if !ok {
@@ -1918,6 +1977,26 @@ func (rm *ResourceModel) SetSetDefaultSticky(val bool) error {
 	return rm.VerifyAndSave()
 }
 
+func (rm *ResourceModel) SetXRefDelete(val string) error {
+	rm.XRefDelete = val
+	return rm.VerifyAndSave()
+}
+
+func (rm *ResourceModel) SetRetention(val *RetentionPolicy) error {
+	rm.Retention = val
+	return rm.VerifyAndSave()
+}
+
+func (rm *ResourceModel) SetVersionLock(val string) error {
+	rm.VersionLock = val
+	return rm.VerifyAndSave()
+}
+
+func (rm *ResourceModel) SetProxySnapshot(val bool) error {
+	rm.ProxySnapshot = val
+	return rm.VerifyAndSave()
+}
+
 func (rm *ResourceModel) VerifyAndSave() error {
 	if err := rm.Verify(rm.Plural); err != nil {
 		return err
@@ -2296,6 +2375,21 @@ func (attrs Attributes) Verify(namecharset string, ld *LevelData) error {
 				"since \"type\" is not \"xid\"", path.UI())
 		}
 
+		if attr.OnDelete != "" {
+			if attr.Type != XID {
+				return fmt.Errorf("%q must not have an \"ondelete\" value "+
+					"since \"type\" is not \"xid\"", path.UI())
+			}
+			if attr.OnDelete != ONDELETE_RESTRICT &&
+				attr.OnDelete != ONDELETE_SETNULL &&
+				attr.OnDelete != ONDELETE_CASCADE {
+				return fmt.Errorf("%q has an invalid \"ondelete\" value "+
+					"(%s), must be one of: %s, %s, %s", path.UI(),
+					attr.OnDelete, ONDELETE_CASCADE, ONDELETE_RESTRICT,
+					ONDELETE_SETNULL)
+			}
+		}
+
 		// Is it ok for strict=true and enum=[] ? Require no value???
 		// if attr.Strict == true && len(attr.Enum) == 0 {
 		// }
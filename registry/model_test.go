@@ -602,6 +602,47 @@ func TestTargetRegExp(t *testing.T) {
 	}
 }
 
+func TestAttributesFindPP(t *testing.T) {
+	ptr := &Attribute{Name: "ptr", Type: XID, OnDelete: ONDELETE_SETNULL}
+	sub := &Attribute{Name: "sub", Type: XID}
+	attrs := Attributes{
+		"ptr": ptr,
+		"obj": &Attribute{
+			Name:       "obj",
+			Type:       OBJECT,
+			Attributes: Attributes{"sub": sub},
+		},
+		"list": &Attribute{
+			Name: "list",
+			Type: ARRAY,
+			Item: &Item{Type: XID},
+		},
+		"*": &Attribute{Name: "*", Type: STRING},
+	}
+
+	for _, test := range []struct {
+		ui      string
+		expType string
+		expAttr *Attribute
+	}{
+		{"ptr", XID, ptr},
+		{"obj.sub", XID, sub},
+		{"obj.foo", "", nil},
+		{"list[2]", XID, nil},
+		{"ptr.foo", "", nil},
+		{"other", STRING, attrs["*"]},
+	} {
+		daType, attr := attrs.FindPP(MustPropPathFromUI(test.ui))
+		if daType != test.expType || attr != test.expAttr {
+			t.Fatalf("%s: Exp: %q/%v Got: %q/%v", test.ui, test.expType,
+				test.expAttr, daType, attr)
+		}
+		if attrs.GetTypeFromPP(MustPropPathFromUI(test.ui)) != daType {
+			t.Fatalf("%s: GetTypeFromPP doesn't match FindPP", test.ui)
+		}
+	}
+}
+
 func TestValidChars(t *testing.T) {
 	a10 := "a234567890"
 	a50 := a10 + a10 + a10 + a10 + a10
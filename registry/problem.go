@@ -0,0 +1,315 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors are sent to clients as RFC 9457 "problem details" so they don't
+// need to parse the error text. Each class of error has its own "type" URI.
+
+var ProblemTypeBase = "https://xregistry.io/errors/"
+
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+
+// Error classes - the last part of the "type" URI
+const (
+	PROBLEM_BAD_REQUEST            = "bad_request"
+	PROBLEM_NOT_FOUND              = "not_found"
+	PROBLEM_UNKNOWN_GROUP_TYPE     = "unknown_group_type"
+	PROBLEM_UNKNOWN_RESOURCE_TYPE  = "unknown_resource_type"
+	PROBLEM_INVALID_ATTRIBUTE      = "invalid_attribute"
+	PROBLEM_MISMATCHED_EPOCH       = "mismatched_epoch"
+	PROBLEM_READONLY               = "readonly"
+	PROBLEM_CONFLICT               = "conflict"
+	PROBLEM_METHOD_NOT_ALLOWED     = "method_not_allowed"
+	PROBLEM_UNSUPPORTED_SPEC       = "unsupported_specversion"
+	PROBLEM_TOO_LARGE              = "too_large"
+	PROBLEM_RANGE_NOT_SATISFIABLE  = "range_not_satisfiable"
+	PROBLEM_TOO_MANY_REQUESTS      = "too_many_requests"
+	PROBLEM_UPSTREAM_ERROR         = "upstream_error"
+	PROBLEM_SERVER_ERROR           = "server_error"
+	PROBLEM_SERVICE_UNAVAILABLE    = "service_unavailable"
+	PROBLEM_UNSUPPORTED_MEDIA_TYPE = "unsupported_media_type"
+)
+
+type problemClass struct {
+	Title  string
+	Status int
+}
+
+var problemClasses = map[string]problemClass{
+	PROBLEM_BAD_REQUEST:            {"Bad request", 400},
+	PROBLEM_NOT_FOUND:              {"Not found", 404},
+	PROBLEM_UNKNOWN_GROUP_TYPE:     {"Unknown Group type", 404},
+	PROBLEM_UNKNOWN_RESOURCE_TYPE:  {"Unknown Resource type", 404},
+	PROBLEM_INVALID_ATTRIBUTE:      {"Invalid attribute", 400},
+	PROBLEM_MISMATCHED_EPOCH:       {"Mismatched epoch", 400},
+	PROBLEM_READONLY:               {"Read-only", 400},
+	PROBLEM_CONFLICT:               {"Conflict", 409},
+	PROBLEM_METHOD_NOT_ALLOWED:     {"Method not allowed", 405},
+	PROBLEM_UNSUPPORTED_SPEC:       {"Unsupported spec version", 400},
+	PROBLEM_TOO_LARGE:              {"Too large", 413},
+	PROBLEM_RANGE_NOT_SATISFIABLE:  {"Range not satisfiable", 416},
+	PROBLEM_TOO_MANY_REQUESTS:      {"Too many requests", 429},
+	PROBLEM_UPSTREAM_ERROR:         {"Upstream error", 502},
+	PROBLEM_SERVER_ERROR:           {"Server error", 500},
+	PROBLEM_SERVICE_UNAVAILABLE:    {"Service unavailable", 503},
+	PROBLEM_UNSUPPORTED_MEDIA_TYPE: {"Unsupported media type", 415},
+}
+
+// An error that knows which class of problem it is, and any extra info
+// that should be included in the problem details sent to the client
+type ProblemError struct {
+	Class  string
+	Msg    string
+	Extras map[string]any
+}
+
+func (pe *ProblemError) Error() string {
+	return pe.Msg
+}
+
+func NewProblemError(class string, format string, args ...any) *ProblemError {
+	return &ProblemError{
+		Class: class,
+		Msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+// Adds an extra member to the problem details
+func (pe *ProblemError) With(name string, value any) *ProblemError {
+	if pe.Extras == nil {
+		pe.Extras = map[string]any{}
+	}
+	pe.Extras[name] = value
+	return pe
+}
+
+// For errors about the value of a specific attribute
+func NewAttributeError(path *PropPath, format string, args ...any) error {
+	return NewProblemError(PROBLEM_INVALID_ATTRIBUTE, format, args...).
+		With("attribute", path.UI())
+}
+
+// RFC 9457 problem details
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	Extras   map[string]any
+}
+
+// The standard members are first, then any extras in alphabetical order
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	add := func(name string, value any) error {
+		if buf.Len() == 0 {
+			buf.WriteString("{")
+		} else {
+			buf.WriteString(",")
+		}
+		val, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(val)
+		return nil
+	}
+
+	add("type", p.Type)
+	add("title", p.Title)
+	add("status", p.Status)
+	if p.Detail != "" {
+		add("detail", p.Detail)
+	}
+	if p.Instance != "" {
+		add("instance", p.Instance)
+	}
+
+	keys := SortedKeys(p.Extras)
+	for _, key := range keys {
+		if err := add(key, p.Extras[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+func (p *Problem) UnmarshalJSON(buf []byte) error {
+	tmp := map[string]any{}
+	if err := json.Unmarshal(buf, &tmp); err != nil {
+		return err
+	}
+
+	*p = Problem{}
+	p.Type, _ = tmp["type"].(string)
+	p.Title, _ = tmp["title"].(string)
+	if status, ok := tmp["status"].(float64); ok {
+		p.Status = int(status)
+	}
+	p.Detail, _ = tmp["detail"].(string)
+	p.Instance, _ = tmp["instance"].(string)
+
+	for _, key := range []string{"type", "title", "status", "detail",
+		"instance"} {
+		delete(tmp, key)
+	}
+	if len(tmp) > 0 {
+		p.Extras = tmp
+	}
+	return nil
+}
+
+// Returns the default HTTP status code for the error, or 0 if it doesn't
+// have one
+func ErrorStatusCode(err error) int {
+	if IsConflictError(err) {
+		return http.StatusConflict
+	}
+	pe := (*ProblemError)(nil)
+	if errors.As(err, &pe) {
+		return problemClasses[pe.Class].Status
+	}
+	return 0
+}
+
+// Converts "err" into the problem details for a response with the
+// HTTP status code of "status"
+func NewProblem(err error, status int, instance string) *Problem {
+	class := ""
+	extras := map[string]any(nil)
+
+	pe := (*ProblemError)(nil)
+	if errors.As(err, &pe) {
+		class = pe.Class
+		extras = pe.Extras
+	} else if IsConflictError(err) {
+		class = PROBLEM_CONFLICT
+	}
+
+	// Not a classified error so use the status code to pick one
+	if _, ok := problemClasses[class]; !ok {
+		class = ProblemClassFromStatus(status)
+	}
+
+	pc := problemClasses[class]
+	if status == 0 {
+		status = pc.Status
+	}
+
+	return &Problem{
+		Type:     ProblemTypeBase + class,
+		Title:    pc.Title,
+		Status:   status,
+		Detail:   err.Error(),
+		Instance: instance,
+		Extras:   extras,
+	}
+}
+
+func ProblemClassFromStatus(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return PROBLEM_NOT_FOUND
+	case http.StatusMethodNotAllowed:
+		return PROBLEM_METHOD_NOT_ALLOWED
+	case http.StatusConflict:
+		return PROBLEM_CONFLICT
+	case http.StatusRequestEntityTooLarge:
+		return PROBLEM_TOO_LARGE
+	case http.StatusUnsupportedMediaType:
+		return PROBLEM_UNSUPPORTED_MEDIA_TYPE
+	case http.StatusRequestedRangeNotSatisfiable:
+		return PROBLEM_RANGE_NOT_SATISFIABLE
+	case http.StatusTooManyRequests:
+		return PROBLEM_TOO_MANY_REQUESTS
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return PROBLEM_UPSTREAM_ERROR
+	case http.StatusServiceUnavailable:
+		return PROBLEM_SERVICE_UNAVAILABLE
+	}
+	if status >= 500 {
+		return PROBLEM_SERVER_ERROR
+	}
+	return PROBLEM_BAD_REQUEST
+}
+
+// Sets info.StatusCode for "err" unless someone else already set it
+func (info *RequestInfo) SetErrorStatus(err error) {
+	if IsConflictError(err) {
+		info.StatusCode = http.StatusConflict
+	} else if info.StatusCode == 0 {
+		// Only default to the error's status (or BadRequest) if not
+		// set by someone else
+		info.StatusCode = ErrorStatusCode(err)
+	}
+	if info.StatusCode == 0 {
+		info.StatusCode = http.StatusBadRequest
+	}
+}
+
+// Sends "err" to the client as problem details. If "?ui" was used then it's
+// sent as plain text instead, as it used to be, so it shows up nicely in
+// the browser. If we already started sending the response then all we can
+// do is append the error text.
+func (info *RequestInfo) WriteError(err error) {
+	ui := info.OriginalRequest != nil &&
+		info.OriginalRequest.URL.Query().Has("ui")
+
+	if info.SentStatus || ui {
+		info.Write([]byte(err.Error() + "\n"))
+		return
+	}
+
+	instance := ""
+	if info.OriginalRequest != nil {
+		instance = info.OriginalRequest.URL.Path
+	}
+	problem := NewProblem(err, info.StatusCode, instance)
+	info.StatusCode = problem.Status
+
+	buf, _ := json.MarshalIndent(problem, "", "  ")
+	info.AddHeader("Content-Type", PROBLEM_CONTENT_TYPE)
+	info.Write(append(buf, '\n'))
+}
+
+// For when there's no RequestInfo
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error, status int) {
+	problem := NewProblem(err, status, r.URL.Path)
+	buf, _ := json.MarshalIndent(problem, "", "  ")
+
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(problem.Status)
+	w.Write(append(buf, '\n'))
+}
+
+// Returns the "detail" from a problem details response, or the body as is
+// if it isn't one
+func ProblemDetail(contentType string, body []byte) string {
+	if !strings.HasPrefix(contentType, PROBLEM_CONTENT_TYPE) {
+		return string(body)
+	}
+	tmp := struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	}{}
+	if json.Unmarshal(body, &tmp) != nil {
+		return string(body)
+	}
+	if tmp.Detail != "" {
+		return tmp.Detail
+	}
+	return tmp.Title
+}
@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblem(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+		exp    string
+	}{
+		{fmt.Errorf("oops"), 0,
+			`{"type":"https://xregistry.io/errors/bad_request","title":"Bad request","status":400,"detail":"oops","instance":"/x"}`},
+		{fmt.Errorf("oops"), 404,
+			`{"type":"https://xregistry.io/errors/not_found","title":"Not found","status":404,"detail":"oops","instance":"/x"}`},
+		{fmt.Errorf("oops"), 504,
+			`{"type":"https://xregistry.io/errors/upstream_error","title":"Upstream error","status":504,"detail":"oops","instance":"/x"}`},
+		{NewConflictError("locked"), 0,
+			`{"type":"https://xregistry.io/errors/conflict","title":"Conflict","status":409,"detail":"locked","instance":"/x"}`},
+		{NewProblemError(PROBLEM_UNKNOWN_GROUP_TYPE, "Unknown Group type: %s", "foo").With("grouptype", "foo"), 0,
+			`{"type":"https://xregistry.io/errors/unknown_group_type","title":"Unknown Group type","status":404,"detail":"Unknown Group type: foo","instance":"/x","grouptype":"foo"}`},
+		{NewAttributeError(NewPPP("labels").P("a"), "bad"), 400,
+			`{"type":"https://xregistry.io/errors/invalid_attribute","title":"Invalid attribute","status":400,"detail":"bad","instance":"/x","attribute":"labels.a"}`},
+		// Wrapped errors keep their class
+		{fmt.Errorf("wrapped: %w", NewProblemError(PROBLEM_READONLY, "ro")), 0,
+			`{"type":"https://xregistry.io/errors/readonly","title":"Read-only","status":400,"detail":"wrapped: ro","instance":"/x"}`},
+	} {
+		status := test.status
+		if status == 0 {
+			status = ErrorStatusCode(test.err)
+		}
+		buf, err := json.Marshal(NewProblem(test.err, status, "/x"))
+		if err != nil || string(buf) != test.exp {
+			t.Fatalf("%q:\nExp: %s\nGot: %s", test.err, test.exp, string(buf))
+		}
+
+		// And back again
+		p := &Problem{}
+		if err = json.Unmarshal(buf, p); err != nil {
+			t.Fatalf("%q: %s", test.err, err)
+		}
+		buf2, _ := json.Marshal(p)
+		if string(buf2) != test.exp {
+			t.Fatalf("%q:\nExp: %s\nGot: %s", test.err, test.exp, string(buf2))
+		}
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/dirs/d1", nil)
+	WriteProblem(rec, req, NewProblemError(PROBLEM_NOT_FOUND, "Not found"), 0)
+
+	if rec.Code != 404 ||
+		rec.Header().Get("Content-Type") != PROBLEM_CONTENT_TYPE {
+		t.Fatalf("Bad response: %d %v", rec.Code, rec.Header())
+	}
+
+	body := rec.Body.Bytes()
+	if got := ProblemDetail(PROBLEM_CONTENT_TYPE, body); got != "Not found" {
+		t.Fatalf("Bad detail: %q\n%s", got, string(body))
+	}
+	if got := ProblemDetail("text/plain", []byte("hi")); got != "hi" {
+		t.Fatalf("Bad detail: %q", got)
+	}
+	if got := ProblemDetail(PROBLEM_CONTENT_TYPE, []byte("{bad")); got != "{bad" {
+		t.Fatalf("Bad detail: %q", got)
+	}
+}
@@ -0,0 +1,399 @@
+package registry
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// Settings for fetching RESOURCEproxyurl documents
+var ProxyTimeout = 30 * time.Second
+var ProxyMaxSize int64 = 16 * 1024 * 1024   // Largest doc we'll fetch
+var ProxyCacheSize int64 = 64 * 1024 * 1024 // Total size of cached docs
+
+// The upstream HTTP headers that are passed along to our clients
+var ProxyHeaders = []string{
+	"Content-Type",
+	"Content-Language",
+	"Last-Modified",
+}
+
+// Counters for the proxy fetches, see GET /metrics
+type ProxyMetrics struct {
+	Requests      int64 `json:"requests"`      // All requests for a doc
+	CacheHits     int64 `json:"cachehits"`     // Served from the cache
+	DiskLoads     int64 `json:"diskloads"`     // Cache entries from ProxyDisk
+	Revalidations int64 `json:"revalidations"` // Upstream said "304"
+	Fetches       int64 `json:"fetches"`       // Full GETs sent upstream
+	Failures      int64 `json:"failures"`      // Any failure, includes:
+	Timeouts      int64 `json:"timeouts"`      // - took too long
+	BadStatus     int64 `json:"badstatus"`     // - non-2xx response
+	TooLarge      int64 `json:"toolarge"`      // - more than ProxyMaxSize
+}
+
+var proxyMetrics = &ProxyMetrics{}
+
+func GetProxyMetrics() ProxyMetrics {
+	return ProxyMetrics{
+		Requests:      atomic.LoadInt64(&proxyMetrics.Requests),
+		CacheHits:     atomic.LoadInt64(&proxyMetrics.CacheHits),
+		DiskLoads:     atomic.LoadInt64(&proxyMetrics.DiskLoads),
+		Revalidations: atomic.LoadInt64(&proxyMetrics.Revalidations),
+		Fetches:       atomic.LoadInt64(&proxyMetrics.Fetches),
+		Failures:      atomic.LoadInt64(&proxyMetrics.Failures),
+		Timeouts:      atomic.LoadInt64(&proxyMetrics.Timeouts),
+		BadStatus:     atomic.LoadInt64(&proxyMetrics.BadStatus),
+		TooLarge:      atomic.LoadInt64(&proxyMetrics.TooLarge),
+	}
+}
+
+// The result of fetching a RESOURCEproxyurl
+type ProxyResponse struct {
+	URL     string
+	Body    []byte
+	Headers http.Header // Only the ones in ProxyHeaders
+
+	etag         string
+	lastModified string
+	expires      time.Time // Must revalidate after this
+	size         int64     // For the cache accounting
+	elem         *list.Element
+}
+
+// An error fetching a proxied doc. "StatusCode" is the HTTP status code to
+// return to our client
+type ProxyError struct {
+	StatusCode int
+	Status     string // Upstream's status (e.g. "404 Not Found"), if any
+	Msg        string
+}
+
+func (pe *ProxyError) Error() string {
+	return pe.Msg
+}
+
+// An LRU cache of upstream documents, bounded by ProxyCacheSize
+type proxyCache struct {
+	mutex   sync.Mutex
+	entries map[string]*ProxyResponse
+	lru     *list.List // Front is most recently used
+	size    int64
+}
+
+var ProxyCache = &proxyCache{
+	entries: map[string]*ProxyResponse{},
+	lru:     list.New(),
+}
+
+func (pc *proxyCache) Get(url string) *ProxyResponse {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pr := pc.entries[url]
+	if pr != nil {
+		pc.lru.MoveToFront(pr.elem)
+	}
+	return pr
+}
+
+func (pc *proxyCache) Add(pr *ProxyResponse) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pc.remove(pc.entries[pr.URL])
+
+	pr.size = int64(len(pr.Body))
+	if ProxyCacheSize <= 0 || pr.size > ProxyCacheSize {
+		return
+	}
+
+	pr.elem = pc.lru.PushFront(pr)
+	pc.entries[pr.URL] = pr
+	pc.size += pr.size
+
+	for pc.size > ProxyCacheSize {
+		pc.remove(pc.lru.Back().Value.(*ProxyResponse))
+	}
+}
+
+func (pc *proxyCache) Remove(url string) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	pc.remove(pc.entries[url])
+}
+
+// Assumes the lock is held
+func (pc *proxyCache) remove(pr *ProxyResponse) {
+	if pr == nil || pc.entries[pr.URL] != pr {
+		return
+	}
+	pc.lru.Remove(pr.elem)
+	delete(pc.entries, pr.URL)
+	pc.size -= pr.size
+}
+
+func (pc *proxyCache) Clear() {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pc.entries = map[string]*ProxyResponse{}
+	pc.lru.Init()
+	pc.size = 0
+}
+
+// Returns the document at "url", using the cache when the upstream server's
+// Cache-Control/Expires headers allow for it, and revalidating stale entries
+// via their ETag or Last-Modified values. "parent" is the trace span of the
+// request, if any.
+func FetchProxyURL(parent *Span, url string) (*ProxyResponse, error) {
+	log.VPrintf(3, ">Enter: FetchProxyURL(%s)", url)
+	defer log.VPrintf(3, "<Exit: FetchProxyURL")
+
+	span := parent.StartChild("Proxy GET", SPAN_CLIENT)
+	span.SetAttr("url.full", url)
+	defer span.Finish()
+
+	atomic.AddInt64(&proxyMetrics.Requests, 1)
+
+	cached := ProxyCache.Get(url)
+	if cached == nil && ProxyDisk != nil {
+		if cached = ProxyDisk.Get(url); cached != nil {
+			atomic.AddInt64(&proxyMetrics.DiskLoads, 1)
+			ProxyCache.Add(cached)
+		}
+	}
+	if cached != nil && time.Now().Before(cached.expires) {
+		atomic.AddInt64(&proxyMetrics.CacheHits, 1)
+		span.SetAttr("xregistry.proxy.cache", "hit")
+		return cached, nil
+	}
+
+	span.SetAttr("xregistry.proxy.cache", "miss")
+	pr, err := fetchProxyURL(span, url, cached)
+	if err != nil {
+		span.SetError(err)
+		atomic.AddInt64(&proxyMetrics.Failures, 1)
+		log.VPrintf(2, "Error fetching %q: %s", url, err)
+		return nil, err
+	}
+	return pr, nil
+}
+
+func fetchProxyURL(span *Span, url string, cached *ProxyResponse) (*ProxyResponse, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if span != nil {
+		req.Header.Add("traceparent", span.TraceParent())
+	}
+
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Add("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Add("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	client := &http.Client{Timeout: ProxyTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		if netErr := net.Error(nil); errors.As(err, &netErr) && netErr.Timeout() {
+			atomic.AddInt64(&proxyMetrics.Timeouts, 1)
+			return nil, &ProxyError{
+				StatusCode: http.StatusGatewayTimeout,
+				Msg:        fmt.Sprintf("Timeout fetching %q", url),
+			}
+		}
+		return nil, &ProxyError{
+			StatusCode: http.StatusBadGateway,
+			Msg:        fmt.Sprintf("Error fetching %q: %s", url, err),
+		}
+	}
+	defer resp.Body.Close()
+
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		atomic.AddInt64(&proxyMetrics.Revalidations, 1)
+		// Copy it since others might be using the old one
+		fresh := *cached
+		fresh.expires = calcExpires(resp.Header)
+		fresh.elem = nil
+		cacheProxyResponse(&fresh)
+		return &fresh, nil
+	}
+
+	atomic.AddInt64(&proxyMetrics.Fetches, 1)
+
+	if resp.StatusCode/100 != 2 {
+		atomic.AddInt64(&proxyMetrics.BadStatus, 1)
+		uncacheProxyURL(url)
+		return nil, &ProxyError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Msg:        "Remote error",
+		}
+	}
+
+	if resp.ContentLength > ProxyMaxSize {
+		atomic.AddInt64(&proxyMetrics.TooLarge, 1)
+		return nil, tooLargeError(url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ProxyMaxSize+1))
+	if err != nil {
+		return nil, &ProxyError{
+			StatusCode: http.StatusBadGateway,
+			Msg:        fmt.Sprintf("Error reading %q: %s", url, err),
+		}
+	}
+	if int64(len(body)) > ProxyMaxSize {
+		atomic.AddInt64(&proxyMetrics.TooLarge, 1)
+		return nil, tooLargeError(url)
+	}
+
+	pr := &ProxyResponse{
+		URL:     url,
+		Body:    body,
+		Headers: http.Header{},
+
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		expires:      calcExpires(resp.Header),
+	}
+
+	for _, name := range ProxyHeaders {
+		if vals := resp.Header.Values(name); len(vals) > 0 {
+			pr.Headers[http.CanonicalHeaderKey(name)] = vals
+		}
+	}
+
+	if isCacheable(resp.Header) {
+		cacheProxyResponse(pr)
+	} else {
+		uncacheProxyURL(url)
+	}
+
+	return pr, nil
+}
+
+func tooLargeError(url string) error {
+	return &ProxyError{
+		StatusCode: http.StatusBadGateway,
+		Msg: fmt.Sprintf("Document at %q is larger than the maximum "+
+			"allowed (%d bytes)", url, ProxyMaxSize),
+	}
+}
+
+// Returns true if the response can be saved in our cache. Even if it's
+// stale right away, we can keep it if we're able to revalidate it later.
+func isCacheable(header http.Header) bool {
+	cc := parseCacheControl(header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if header.Get("ETag") != "" || header.Get("Last-Modified") != "" {
+		return true
+	}
+	return time.Now().Before(calcExpires(header))
+}
+
+// Returns the time at which the response is no longer fresh
+func calcExpires(header http.Header) time.Time {
+	now := time.Now()
+	cc := parseCacheControl(header)
+
+	if _, ok := cc["no-cache"]; ok {
+		return now
+	}
+	if val, ok := cc["max-age"]; ok {
+		if secs, err := strconv.Atoi(val); err == nil && secs > 0 {
+			return now.Add(time.Duration(secs) * time.Second)
+		}
+		return now
+	}
+	if val := header.Get("Expires"); val != "" {
+		if t, err := http.ParseTime(val); err == nil {
+			return t
+		}
+	}
+	return now
+}
+
+// "no-cache, max-age=60" -> {"no-cache":"", "max-age":"60"}
+func parseCacheControl(header http.Header) map[string]string {
+	res := map[string]string{}
+	for _, val := range header.Values("Cache-Control") {
+		for _, dir := range strings.Split(val, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(dir), "=")
+			if name != "" {
+				res[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return res
+}
+
+// If "obj" has a RESOURCEproxyurl then replace it with the doc it points to
+// so that the Version no longer depends on the upstream server
+func SnapshotProxyURL(parent *Span, obj Object, singular string) error {
+	url, ok := obj[singular+"proxyurl"].(string)
+	if !ok || url == "" {
+		return nil
+	}
+
+	resp, err := FetchProxyURL(parent, url)
+	if err != nil {
+		if pErr, ok := err.(*ProxyError); ok && pErr.Status != "" {
+			err = fmt.Errorf("%s", pErr.Status)
+		}
+		return fmt.Errorf("Error fetching %q: %s", url, err)
+	}
+
+	obj[singular] = resp.Body
+	obj[singular+"proxyurl"] = nil
+	if IsNil(obj["contenttype"]) {
+		if ct := resp.Headers.Get("Content-Type"); ct != "" {
+			obj["contenttype"] = ct
+		}
+	}
+	return nil
+}
+
+// GET /metrics
+func HTTPGETMetrics(info *RequestInfo) error {
+	if len(info.Parts) > 1 {
+		info.StatusCode = http.StatusNotFound
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
+	}
+
+	buf, err := json.MarshalIndent(map[string]any{
+		"proxy": GetProxyMetrics(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	info.AddHeader("Content-Type", "application/json")
+	info.Write(buf)
+	info.Write([]byte("\n"))
+	return nil
+}
@@ -0,0 +1,220 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyFetch(t *testing.T) {
+	ProxyCache.Clear()
+	defer ProxyCache.Clear()
+
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			hits[r.URL.Path]++
+			switch r.URL.Path {
+			case "/maxage":
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("X-Secret", "shh")
+				fmt.Fprintf(w, "maxage")
+			case "/etag":
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Cache-Control", "no-cache")
+				fmt.Fprintf(w, "etag")
+			case "/nostore":
+				w.Header().Set("Cache-Control", "no-store")
+				fmt.Fprintf(w, "nostore")
+			case "/big":
+				fmt.Fprintf(w, "%s", strings.Repeat("x", 100))
+			case "/slow":
+				time.Sleep(500 * time.Millisecond)
+				fmt.Fprintf(w, "slow")
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer srv.Close()
+
+	before := GetProxyMetrics()
+
+	// Cached based on max-age, only allowed headers are kept
+	for i := 0; i < 2; i++ {
+		pr, err := FetchProxyURL(nil, srv.URL+"/maxage")
+		if err != nil || string(pr.Body) != "maxage" {
+			t.Fatalf("maxage: %v %v", pr, err)
+		}
+		if pr.Headers.Get("Content-Type") != "text/plain" ||
+			pr.Headers.Get("X-Secret") != "" {
+			t.Fatalf("maxage headers: %v", pr.Headers)
+		}
+	}
+	if hits["/maxage"] != 1 {
+		t.Fatalf("maxage hits: %d", hits["/maxage"])
+	}
+
+	// Always revalidated, but only sent once
+	for i := 0; i < 3; i++ {
+		pr, err := FetchProxyURL(nil, srv.URL+"/etag")
+		if err != nil || string(pr.Body) != "etag" {
+			t.Fatalf("etag: %v %v", pr, err)
+		}
+	}
+	if hits["/etag"] != 3 {
+		t.Fatalf("etag hits: %d", hits["/etag"])
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := FetchProxyURL(nil, srv.URL+"/nostore"); err != nil {
+			t.Fatalf("nostore: %s", err)
+		}
+	}
+	if hits["/nostore"] != 2 {
+		t.Fatalf("nostore hits: %d", hits["/nostore"])
+	}
+
+	_, err := FetchProxyURL(nil, srv.URL+"/missing")
+	if pErr, ok := err.(*ProxyError); !ok || pErr.StatusCode != 404 {
+		t.Fatalf("missing: %v", err)
+	}
+
+	oldSize := ProxyMaxSize
+	ProxyMaxSize = 10
+	_, err = FetchProxyURL(nil, srv.URL+"/big")
+	ProxyMaxSize = oldSize
+	if pErr, ok := err.(*ProxyError); !ok || pErr.StatusCode != 502 {
+		t.Fatalf("big: %v", err)
+	}
+
+	oldTimeout := ProxyTimeout
+	ProxyTimeout = 100 * time.Millisecond
+	_, err = FetchProxyURL(nil, srv.URL+"/slow")
+	ProxyTimeout = oldTimeout
+	if pErr, ok := err.(*ProxyError); !ok || pErr.StatusCode != 504 {
+		t.Fatalf("slow: %v", err)
+	}
+
+	after := GetProxyMetrics()
+	for _, test := range []struct {
+		name string
+		exp  int64
+		got  int64
+	}{
+		{"requests", 10, after.Requests - before.Requests},
+		{"cachehits", 1, after.CacheHits - before.CacheHits},
+		{"revalidations", 2, after.Revalidations - before.Revalidations},
+		{"fetches", 6, after.Fetches - before.Fetches},
+		{"failures", 3, after.Failures - before.Failures},
+		{"timeouts", 1, after.Timeouts - before.Timeouts},
+		{"badstatus", 1, after.BadStatus - before.BadStatus},
+		{"toolarge", 1, after.TooLarge - before.TooLarge},
+	} {
+		if test.exp != test.got {
+			t.Fatalf("%s: Exp: %d Got: %d", test.name, test.exp, test.got)
+		}
+	}
+}
+
+func TestProxyCacheLRU(t *testing.T) {
+	ProxyCache.Clear()
+	defer ProxyCache.Clear()
+
+	oldSize := ProxyCacheSize
+	ProxyCacheSize = 10
+	defer func() { ProxyCacheSize = oldSize }()
+
+	ProxyCache.Add(&ProxyResponse{URL: "a", Body: []byte("aaaa")})
+	ProxyCache.Add(&ProxyResponse{URL: "b", Body: []byte("bbbb")})
+	ProxyCache.Get("a") // "b" is now the oldest
+	ProxyCache.Add(&ProxyResponse{URL: "c", Body: []byte("cccc")})
+
+	if ProxyCache.Get("a") == nil || ProxyCache.Get("b") != nil ||
+		ProxyCache.Get("c") == nil {
+		t.Fatalf("Wrong entries evicted")
+	}
+
+	// Too big to ever be cached
+	ProxyCache.Add(&ProxyResponse{URL: "d", Body: []byte("ddddddddddd")})
+	if ProxyCache.Get("d") != nil || ProxyCache.Get("a") == nil {
+		t.Fatalf("Too big entry was cached")
+	}
+}
+
+func TestProxyDiskCache(t *testing.T) {
+	ProxyCache.Clear()
+	defer ProxyCache.Clear()
+
+	disk, err := NewProxyDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewProxyDiskCache: %s", err)
+	}
+	ProxyDisk = disk
+	defer func() { ProxyDisk = nil }()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			if r.URL.Path == "/gone" && hits > 1 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "doc")
+		}))
+	defer srv.Close()
+
+	before := GetProxyMetrics()
+
+	// Still cached after the in-memory cache is lost (e.g. a restart)
+	for i := 0; i < 2; i++ {
+		ProxyCache.Clear()
+		pr, err := FetchProxyURL(nil, srv.URL+"/doc")
+		if err != nil || string(pr.Body) != "doc" ||
+			pr.Headers.Get("Content-Type") != "text/plain" {
+			t.Fatalf("doc: %v %v", pr, err)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("doc hits: %d", hits)
+	}
+	if got := GetProxyMetrics().DiskLoads - before.DiskLoads; got != 1 {
+		t.Fatalf("diskloads: Exp: 1 Got: %d", got)
+	}
+
+	// Errors remove it from disk too
+	pr := disk.Get(srv.URL + "/doc")
+	pr.URL = srv.URL + "/gone"
+	pr.expires = time.Now()
+	if err = disk.Add(pr); err != nil {
+		t.Fatalf("Add: %s", err)
+	}
+	if _, err = FetchProxyURL(nil, srv.URL+"/gone"); err == nil {
+		t.Fatalf("gone should have failed")
+	}
+	if disk.Get(srv.URL+"/gone") != nil {
+		t.Fatalf("gone should be removed")
+	}
+
+	// The doc is still used by "/doc"
+	if count, err := disk.PruneBlobs(0); err != nil || count != 0 {
+		t.Fatalf("PruneBlobs: %d %v", count, err)
+	}
+	disk.Remove(srv.URL + "/doc")
+	if count, err := disk.PruneBlobs(0); err != nil || count != 1 {
+		t.Fatalf("PruneBlobs: %d %v", count, err)
+	}
+	if disk.Get(srv.URL+"/doc") != nil {
+		t.Fatalf("doc should be removed")
+	}
+}
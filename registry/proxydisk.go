@@ -0,0 +1,220 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// An optional second level for ProxyCache. Cacheable documents are also
+// saved on disk so they survive restarts and aren't limited by
+// ProxyCacheSize. The documents themselves are kept in a FileContentStore
+// under DIR/blobs, and each URL's headers and validators are in
+// DIR/urls/SHA256(url).json. It's not the -contentdir store since that one
+// deletes any blob that isn't referenced by a Version.
+type ProxyDiskCache struct {
+	Dir   string
+	blobs *FileContentStore
+}
+
+// nil means proxied documents are only cached in memory
+var ProxyDisk *ProxyDiskCache
+
+type proxyDiskEntry struct {
+	URL          string      `json:"url"`
+	BlobID       string      `json:"blobid"`
+	Headers      http.Header `json:"headers,omitempty"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastmodified,omitempty"`
+	Expires      time.Time   `json:"expires"`
+}
+
+func NewProxyDiskCache(dir string) (*ProxyDiskCache, error) {
+	blobs, err := NewFileContentStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Join(dir, "urls"), 0755); err != nil {
+		return nil, fmt.Errorf("Error creating proxy cache dir %q: %s",
+			dir, err)
+	}
+	return &ProxyDiskCache{Dir: dir, blobs: blobs}, nil
+}
+
+func (pdc *ProxyDiskCache) entryPath(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(pdc.Dir, "urls", hex.EncodeToString(hash[:])+".json")
+}
+
+// Returns the cached response for "url", or nil if there isn't one (or it
+// can't be read)
+func (pdc *ProxyDiskCache) Get(url string) *ProxyResponse {
+	buf, err := os.ReadFile(pdc.entryPath(url))
+	if err != nil {
+		return nil
+	}
+
+	entry := proxyDiskEntry{}
+	if err = json.Unmarshal(buf, &entry); err != nil || entry.URL != url {
+		return nil
+	}
+
+	rc, err := pdc.blobs.Open(entry.BlobID)
+	if err != nil {
+		// Lost the doc, so the entry is useless
+		pdc.Remove(url)
+		return nil
+	}
+	defer rc.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rc, ProxyMaxSize+1))
+	if err != nil || int64(len(body)) > ProxyMaxSize {
+		return nil
+	}
+
+	return &ProxyResponse{
+		URL:     url,
+		Body:    body,
+		Headers: entry.Headers,
+
+		etag:         entry.ETag,
+		lastModified: entry.LastModified,
+		expires:      entry.Expires,
+	}
+}
+
+func (pdc *ProxyDiskCache) Add(pr *ProxyResponse) error {
+	id, _, err := pdc.blobs.Put(bytes.NewReader(pr.Body))
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(proxyDiskEntry{
+		URL:          pr.URL,
+		BlobID:       id,
+		Headers:      pr.Headers,
+		ETag:         pr.etag,
+		LastModified: pr.lastModified,
+		Expires:      pr.expires,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write it to a temp file first so readers never see half of it
+	path := pdc.entryPath(pr.URL)
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the Rename
+
+	_, err = tmp.Write(buf)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Removes the entry for "url". Its doc is left behind since other URLs
+// might have the same one, PruneBlobs will clean it up.
+func (pdc *ProxyDiskCache) Remove(url string) error {
+	err := os.Remove(pdc.entryPath(url))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Deletes the docs that aren't used by any entry and haven't been written
+// in at least "age" time (so we don't race with an Add). Returns the number
+// of docs deleted.
+func (pdc *ProxyDiskCache) PruneBlobs(age time.Duration) (int, error) {
+	ids, err := pdc.blobs.List(age)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(pdc.Dir, "urls", "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	used := map[string]bool{}
+	for _, file := range files {
+		entry := proxyDiskEntry{}
+		if buf, err := os.ReadFile(file); err == nil &&
+			json.Unmarshal(buf, &entry) == nil {
+			used[entry.BlobID] = true
+		}
+	}
+
+	count := 0
+	for _, id := range ids {
+		if used[id] {
+			continue
+		}
+		deleted, err := pdc.blobs.DeleteIfOlder(id, age)
+		if err != nil {
+			return count, err
+		}
+		if deleted {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Starts a go-routine that will delete the unused docs in ProxyDisk that
+// are older than "age" every "interval"
+func StartProxyDiskPruner(interval time.Duration, age time.Duration) {
+	if interval <= 0 || ProxyDisk == nil {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			count, err := ProxyDisk.PruneBlobs(age)
+			if err != nil {
+				log.Printf("Error pruning proxy cache dir: %s", err)
+			} else if count > 0 {
+				log.VPrintf(2, "Proxy cache dir: deleted %d docs", count)
+			}
+		}
+	}()
+}
+
+// Saves "pr" in the caches
+func cacheProxyResponse(pr *ProxyResponse) {
+	ProxyCache.Add(pr)
+	if ProxyDisk != nil {
+		if err := ProxyDisk.Add(pr); err != nil {
+			log.Printf("Error saving %q in the proxy cache dir: %s",
+				pr.URL, err)
+		}
+	}
+}
+
+// Removes "url" from the caches
+func uncacheProxyURL(url string) {
+	ProxyCache.Remove(url)
+	if ProxyDisk != nil {
+		if err := ProxyDisk.Remove(url); err != nil {
+			log.Printf("Error removing %q from the proxy cache dir: %s",
+				url, err)
+		}
+	}
+}
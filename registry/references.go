@@ -0,0 +1,357 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Returns all of the entities that reference "e" (or anything under it),
+// either via a Resource's 'xref' or via an attribute of type "xid".
+// The result is a map of the referencing entity's XID to the list of
+// attribute names (in UI form) that hold the reference.
+func (e *Entity) GetReferences() (map[string][]string, error) {
+	e.tx.VPrintf(3, ">Enter: GetReferences(%s)", e.Path)
+	defer e.tx.VPrintf(3, "<Exit: GetReferences")
+
+	refs := map[string][]string{}
+
+	// xrefs can only point to Resources
+	if r, ok := e.Self.(*Resource); ok && e.Type == ENTITY_RESOURCE {
+		sources, err := r.GetXrefSources()
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			refs[source+"/meta"] = append(refs[source+"/meta"], "xref")
+		}
+	}
+
+	xidRefs, err := e.GetXIDReferences()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range xidRefs {
+		src := "/" + ref.Path
+		refs[src] = append(refs[src], ref.PP.UI())
+	}
+
+	for _, names := range refs {
+		sort.Strings(names)
+	}
+
+	return refs, nil
+}
+
+// An "xid" attribute value that points to an entity (or to something under it)
+type XIDReference struct {
+	Path      string     // Path of the entity holding the attribute
+	PP        *PropPath  // Location of the attribute within that entity
+	Attribute *Attribute // nil if the attribute is an array/map item
+}
+
+// Returns all of the "xid" attributes (per the model) whose values point to
+// "e" or to something under it, sorted by entity path and prop name
+func (e *Entity) GetXIDReferences() ([]*XIDReference, error) {
+	e.tx.VPrintf(3, ">Enter: GetXIDReferences(%s)", e.Path)
+	defer e.tx.VPrintf(3, "<Exit: GetXIDReferences")
+
+	xid := "/" + e.Path
+
+	// Find all string props that look like they point to us. Note that
+	// "LIKE" treats "_" as a wildcard so we double check the value below
+	results, err := Query(e.tx, `
+        SELECT DISTINCT e.Path, p.PropName, p.PropValue
+        FROM Props AS p
+        JOIN Entities AS e ON (e.eSID=p.EntitySID)
+        WHERE p.RegistrySID=? AND p.PropType=? AND
+          (p.PropValue=? OR p.PropValue LIKE ?)
+        ORDER BY e.Path, p.PropName`,
+		e.Registry.DbSID, STRING, xid, xid+"/%")
+	defer results.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*XIDReference{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		val := NotNilString(row[2])
+		if val != xid && !strings.HasPrefix(val, xid+"/") {
+			continue
+		}
+		pp, err := PropPathFromDB(NotNilString(row[1]))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, &XIDReference{
+			Path: NotNilString(row[0]),
+			PP:   pp,
+		})
+	}
+	results.Close()
+
+	// Now only keep the ones that are defined as "xid" in the model
+	refs := []*XIDReference{}
+	entities := map[string]*Entity{}
+	for _, ref := range candidates {
+		ent, ok := entities[ref.Path]
+		if !ok {
+			ent, err = RawEntityFromPath(e.tx, e.Registry.DbSID, ref.Path,
+				false)
+			if err != nil {
+				return nil, err
+			}
+			entities[ref.Path] = ent
+		}
+		if ent == nil {
+			continue
+		}
+
+		daType, attr := ent.GetAttributes(ent.Object).FindPP(ref.PP)
+		if daType == XID {
+			ref.Attribute = attr
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// Returns the "type" of the attribute that defines "pp", or "" if it's
+// not defined
+func (attrs Attributes) GetTypeFromPP(pp *PropPath) string {
+	daType, _ := attrs.FindPP(pp)
+	return daType
+}
+
+// Returns the "type" of the attribute that defines "pp", and the Attribute
+// itself. If "pp" is defined by a map/array's "item" then the Attribute
+// will be nil. If not found then "" and nil are returned.
+func (attrs Attributes) FindPP(pp *PropPath) (string, *Attribute) {
+	attr := attrs[pp.Top()]
+	if attr == nil {
+		attr = attrs["*"]
+	}
+	if attr == nil {
+		return "", nil
+	}
+
+	daType, subAttrs, item := attr.Type, attr.Attributes, attr.Item
+	for pp = pp.Next(); pp.Len() > 0; pp = pp.Next() {
+		switch daType {
+		case OBJECT:
+			attr = subAttrs[pp.Top()]
+			if attr == nil {
+				attr = subAttrs["*"]
+			}
+			if attr == nil {
+				return "", nil
+			}
+			daType, subAttrs, item = attr.Type, attr.Attributes, attr.Item
+		case MAP, ARRAY:
+			if item == nil {
+				return "", nil
+			}
+			attr = nil
+			daType, subAttrs, item = item.Type, item.Attributes, item.Item
+		default:
+			return "", nil
+		}
+	}
+
+	return daType, attr
+}
+
+// Before "e" is deleted, apply the "ondelete" policy of any "xid" attribute
+// that points to it (or to something under it)
+func (e *Entity) ProcessXIDReferences() error {
+	e.tx.VPrintf(3, ">Enter: ProcessXIDReferences(%s)", e.Path)
+	defer e.tx.VPrintf(3, "<Exit: ProcessXIDReferences")
+
+	if e.tx.deleting == nil {
+		e.tx.deleting = map[string]bool{}
+	}
+	e.tx.deleting[e.Path] = true
+	defer delete(e.tx.deleting, e.Path)
+
+	refs, err := e.GetXIDReferences()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.Attribute == nil || ref.Attribute.OnDelete == "" {
+			continue
+		}
+
+		// Skip references from within the entity being deleted, or from
+		// entities that are already on their way out
+		if e.tx.IsDeleting(ref.Path) {
+			continue
+		}
+
+		src := "/" + ref.Path
+
+		if ref.Attribute.OnDelete == ONDELETE_RESTRICT {
+			return fmt.Errorf("Can't delete %q since it is referenced by "+
+				"the %q attribute of %q", "/"+e.Path, ref.PP.UI(), src)
+		}
+
+		// Might be gone already due to an earlier cascade
+		ent, err := e.Registry.FindEntityFromPath(ref.Path)
+		if err != nil {
+			return err
+		}
+		if ent == nil {
+			continue
+		}
+
+		if ref.Attribute.OnDelete == ONDELETE_SETNULL {
+			if err = ent.SetPP(ref.PP, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// ONDELETE_CASCADE
+		// We can't (yet) delete an entity's parent while in the middle of
+		// deleting the entity itself, so block that case
+		victim := ent
+		if ent.Type == ENTITY_META {
+			victim = &ent.Self.(*Meta).Resource.Entity
+		}
+		if ent.Type != ENTITY_REGISTRY &&
+			strings.HasPrefix(e.Path, victim.Path+"/") {
+			return fmt.Errorf("Can't delete %q since it would cascade the "+
+				"delete to %q", "/"+e.Path, "/"+victim.Path)
+		}
+
+		switch ent.Type {
+		case ENTITY_GROUP:
+			err = ent.Self.(*Group).Delete()
+		case ENTITY_RESOURCE, ENTITY_META:
+			err = victim.Self.(*Resource).Delete()
+		case ENTITY_VERSION:
+			err = ent.Self.(*Version).DeleteSetNextVersion("")
+		default:
+			err = fmt.Errorf("Can't delete %q since it is referenced by "+
+				"the %q attribute of %q, which can't be deleted",
+				"/"+e.Path, ref.PP.UI(), src)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns true if "path", or any of its parents, is being deleted
+func (tx *Tx) IsDeleting(path string) bool {
+	for p := path; ; {
+		if tx.deleting[p] {
+			return true
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return false
+		}
+		p = p[:i]
+	}
+}
+
+// Returns true if "xid" points to an existing entity in the Registry
+func (reg *Registry) XIDExists(xid string) (bool, error) {
+	results, err := Query(reg.tx, `
+        SELECT EXISTS(SELECT 1 FROM Entities WHERE RegSID=? AND Path=?)`,
+		reg.DbSID, strings.Trim(xid, "/"))
+	defer results.Close()
+
+	if err != nil {
+		return false, err
+	}
+
+	row := results.NextRow()
+	return NotNilInt(row[0]) != 0, nil
+}
+
+// Returns the entity at "path" (e.g. GROUPS/gID/RESOURCES/rID/meta) using
+// the Tx's cache when possible so we don't lose any pending changes
+func (reg *Registry) FindEntityFromPath(path string) (*Entity, error) {
+	if path == "" {
+		return &reg.Entity, nil
+	}
+
+	var err error
+	parts := strings.Split(path, "/")
+
+	g := reg.tx.GetGroup(reg, parts[0], parts[1])
+	if g == nil {
+		g, err = reg.FindGroup(parts[0], parts[1], false)
+		if err != nil || g == nil {
+			return nil, err
+		}
+	}
+	if len(parts) == 2 {
+		return &g.Entity, nil
+	}
+
+	r := reg.tx.GetResource(g, parts[2], parts[3])
+	if r == nil {
+		r, err = g.FindResource(parts[2], parts[3], false)
+		if err != nil || r == nil {
+			return nil, err
+		}
+	}
+	if len(parts) == 4 {
+		return &r.Entity, nil
+	}
+
+	if parts[4] == "meta" {
+		m, err := r.FindMeta(false)
+		if err != nil || m == nil {
+			return nil, err
+		}
+		return &m.Entity, nil
+	}
+
+	v, err := r.FindVersion(parts[5], false)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return &v.Entity, nil
+}
+
+func HTTPGETReferences(info *RequestInfo) error {
+	if info.What != "Entity" || info.ResourceUID == "" ||
+		(len(info.Parts) == 5 && info.Parts[4] == "meta") {
+
+		return fmt.Errorf("'referencedby' is only allowed on Resources " +
+			"and Versions")
+	}
+
+	entity, err := info.Registry.XID2Entity("/" + info.Root)
+	if err != nil || entity == nil {
+		info.StatusCode = http.StatusNotFound
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
+	}
+
+	refs, err := entity.GetReferences()
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+
+	buf, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	info.AddHeader("Content-Type", "application/json")
+	info.Write(buf)
+	info.Write([]byte("\n"))
+	return nil
+}
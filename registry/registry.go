@@ -76,8 +76,8 @@ func (r *Registry) Commit() error {
 type RegOpt string
 
 func NewRegistry(tx *Tx, id string, regOpts ...RegOpt) (*Registry, error) {
-	log.VPrintf(3, ">Enter: NewRegistry %q", id)
-	defer log.VPrintf(3, "<Exit: NewRegistry")
+	tx.VPrintf(3, ">Enter: NewRegistry %q", id)
+	defer tx.VPrintf(3, "<Exit: NewRegistry")
 
 	var err error // must be used for all error checking due to defer
 	newTx := false
@@ -222,8 +222,8 @@ func (reg *Registry) SetSave(name string, val any) error {
 }
 
 func (reg *Registry) Delete() error {
-	log.VPrintf(3, ">Enter: Reg.Delete(%s)", reg.UID)
-	defer log.VPrintf(3, "<Exit: Reg.Delete")
+	reg.tx.VPrintf(3, ">Enter: Reg.Delete(%s)", reg.UID)
+	defer reg.tx.VPrintf(3, "<Exit: Reg.Delete")
 
 	err := DoOne(reg.tx, `DELETE FROM Registries WHERE SID=?`, reg.DbSID)
 	if err != nil {
@@ -234,8 +234,8 @@ func (reg *Registry) Delete() error {
 }
 
 func FindRegistryBySID(tx *Tx, sid string) (*Registry, error) {
-	log.VPrintf(3, ">Enter: FindRegistrySID(%s)", sid)
-	defer log.VPrintf(3, "<Exit: FindRegistrySID")
+	tx.VPrintf(3, ">Enter: FindRegistrySID(%s)", sid)
+	defer tx.VPrintf(3, "<Exit: FindRegistrySID")
 
 	if tx.Registry != nil && tx.Registry.DbSID == sid {
 		return tx.Registry, nil
@@ -267,8 +267,8 @@ func FindRegistryBySID(tx *Tx, sid string) (*Registry, error) {
 
 // BY UID
 func FindRegistry(tx *Tx, id string) (*Registry, error) {
-	log.VPrintf(3, ">Enter: FindRegistry(%s)", id)
-	defer log.VPrintf(3, "<Exit: FindRegistry")
+	tx.VPrintf(3, ">Enter: FindRegistry(%s)", id)
+	defer tx.VPrintf(3, "<Exit: FindRegistry")
 
 	if tx != nil && tx.Registry != nil && tx.Registry.UID == id {
 		return tx.Registry, nil
@@ -311,7 +311,7 @@ func FindRegistry(tx *Tx, id string) (*Registry, error) {
 	row := results.NextRow()
 
 	if row == nil {
-		log.VPrintf(3, "None found")
+		tx.VPrintf(3, "None found")
 		return nil, nil
 	}
 
@@ -368,8 +368,8 @@ func (reg *Registry) LoadModel() *Model {
 }
 
 func (reg *Registry) LoadModelFromFile(file string) error {
-	log.VPrintf(3, ">Enter: LoadModelFromFile: %s", file)
-	defer log.VPrintf(3, "<Exit:LoadModelFromFile")
+	reg.tx.VPrintf(3, ">Enter: LoadModelFromFile: %s", file)
+	defer reg.tx.VPrintf(3, "<Exit:LoadModelFromFile")
 
 	var err error
 	buf := []byte{}
@@ -473,15 +473,15 @@ func (reg *Registry) Update(obj Object, addType AddType) error {
 }
 
 func (reg *Registry) FindGroup(gType string, id string, anyCase bool) (*Group, error) {
-	log.VPrintf(3, ">Enter: FindGroup(%s,%s,%v)", gType, id, anyCase)
-	defer log.VPrintf(3, "<Exit: FindGroup")
+	reg.tx.VPrintf(3, ">Enter: FindGroup(%s,%s,%v)", gType, id, anyCase)
+	defer reg.tx.VPrintf(3, "<Exit: FindGroup")
 
 	ent, err := RawEntityFromPath(reg.tx, reg.DbSID, gType+"/"+id, anyCase)
 	if err != nil {
 		return nil, fmt.Errorf("Error finding Group %q(%s): %s", id, gType, err)
 	}
 	if ent == nil {
-		log.VPrintf(3, "None found")
+		reg.tx.VPrintf(3, "None found")
 		return nil, nil
 	}
 
@@ -507,8 +507,8 @@ func (reg *Registry) UpsertGroup(gType string, id string) (*Group, bool, error)
 }
 
 func (reg *Registry) UpsertGroupWithObject(gType string, id string, obj Object, addType AddType) (*Group, bool, error) {
-	log.VPrintf(3, ">Enter UpsertGroupWithObject(%s,%s)", gType, id)
-	defer log.VPrintf(3, "<Exit UpsertGroupWithObject")
+	reg.tx.VPrintf(3, ">Enter UpsertGroupWithObject(%s,%s)", gType, id)
+	defer reg.tx.VPrintf(3, "<Exit UpsertGroupWithObject")
 
 	if err := CheckAttrs(obj); err != nil {
 		return nil, false, err
@@ -627,7 +627,8 @@ func (reg *Registry) UpsertGroupWithObject(gType string, id string, obj Object,
 				fmt.Errorf("Attribute %q doesn't appear to be of a "+
 					"map of %q", plural, plural)
 		}
-		for key, val := range collMap {
+		for _, key := range SortedKeysXrefLast(collMap) {
+			val := collMap[key]
 			valObj, ok := val.(map[string]any)
 			if !ok {
 				return nil, false,
@@ -65,7 +65,7 @@ var _ EntitySetter = &Resource{}
 var _ EntitySetter = &Meta{}
 
 func (r *Resource) Get(name string) any {
-	log.VPrintf(4, "Get: r(%s).Get(%s)", r.UID, name)
+	r.tx.VPrintf(4, "Get: r(%s).Get(%s)", r.UID, name)
 
 	meta, err := r.FindMeta(false)
 	PanicIf(err != nil, "No meta %q: %s", r.UID, err)
@@ -147,14 +147,190 @@ func (r *Resource) IsXref() bool {
 	return !IsNil(meta.Get("xref"))
 }
 
+// Make sure that 'xref' (which must already be syntactically correct) points
+// to an existing Resource of the same type as "r". Chains (and therefore
+// cycles) of xrefs aren't allowed, so the target can't be an xref and "r"
+// can't be the target of someone else's xref.
+func (r *Resource) CheckXref(xref string) error {
+	parts := strings.Split(xref, "/")
+
+	if parts[1] != r.Group.Plural || parts[3] != r.Plural {
+		return fmt.Errorf("'xref' (%s) must point to a Resource of type "+
+			"\"/%s/%s\"", xref, r.Group.Plural, r.Plural)
+	}
+
+	if xref[1:] == r.Path {
+		return fmt.Errorf("'xref' (%s) can't point to itself", xref)
+	}
+
+	target := (*Resource)(nil)
+	group, err := r.Registry.FindGroup(parts[1], parts[2], false)
+	if err == nil && group != nil {
+		target, err = group.FindResource(parts[3], parts[4], false)
+	}
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return fmt.Errorf("'xref' (%s) must point to an existing Resource",
+			xref)
+	}
+
+	if target.IsXref() {
+		return fmt.Errorf("'xref' (%s) can't point to a Resource that is "+
+			"also an xref", xref)
+	}
+
+	sources, err := r.GetXrefSources()
+	if err != nil {
+		return err
+	}
+	if len(sources) > 0 {
+		return fmt.Errorf("'xref' can't be set on %q since it is the "+
+			"target of an xref from: %s", "/"+r.Path,
+			strings.Join(sources, ","))
+	}
+
+	return nil
+}
+
+// Returns the XIDs of all Resources that have an 'xref' pointing to "r"
+func (r *Resource) GetXrefSources() ([]string, error) {
+	results, err := Query(r.tx, `
+        SELECT SourcePath FROM xRefSrc2TgtResources
+        WHERE RegistrySID=? AND TargetSID=?
+        ORDER BY SourcePath`, r.Registry.DbSID, r.DbSID)
+	defer results.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	xids := []string{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		xids = append(xids, "/"+NotNilString(row[0]))
+	}
+	return xids, nil
+}
+
+// Called just before "r" is deleted. Apply the model's "xrefdelete" policy to
+// all Resources whose 'xref' points to "r", skipping the ones whose XID
+// starts with "skip" since those are going away too.
+func (r *Resource) ProcessXrefSources(skip string) error {
+	r.tx.VPrintf(3, ">Enter: ProcessXrefSources(%s,%s)", r.UID, skip)
+	defer r.tx.VPrintf(3, "<Exit: ProcessXrefSources")
+
+	xids, err := r.GetXrefSources()
+	if err != nil {
+		return err
+	}
+
+	sources := []string{}
+	for _, xid := range xids {
+		if skip == "" || !strings.HasPrefix(xid, skip) {
+			sources = append(sources, xid)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	policy := r.GetResourceModel().GetXRefDelete()
+	if policy == XREFDELETE_BLOCK {
+		return fmt.Errorf("Can't delete %q since it is the target of an "+
+			"xref from: %s", "/"+r.Path, strings.Join(sources, ","))
+	}
+
+	for _, xid := range sources {
+		// Use the cached Group, if there, so we don't lose any pending
+		// changes to it
+		parts := strings.Split(xid, "/")
+		group := r.tx.GetGroup(r.Registry, parts[1], parts[2])
+		if group == nil {
+			group, err = r.Registry.FindGroup(parts[1], parts[2], false)
+			if err != nil || group == nil {
+				return err
+			}
+		}
+		source, err := group.FindResource(parts[3], parts[4], false)
+		if err != nil || source == nil {
+			return err
+		}
+
+		if policy == XREFDELETE_CASCADE {
+			err = source.Delete()
+		} else {
+			err = source.CopyXrefTarget(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Convert "r" from an xref'd Resource into a standalone one by removing its
+// 'xref' and copying all of the Versions (and default version info) from
+// "target" into it
+func (r *Resource) CopyXrefTarget(target *Resource) error {
+	r.tx.VPrintf(3, ">Enter: CopyXrefTarget(%s,%s)", r.UID, target.UID)
+	defer r.tx.VPrintf(3, "<Exit: CopyXrefTarget")
+
+	targetMeta, err := target.FindMeta(false)
+	if err != nil {
+		return err
+	}
+	defVerID := targetMeta.Get("defaultversionid")
+	sticky := targetMeta.Get("defaultversionsticky")
+
+	vers, err := target.GetVersions()
+	if err != nil {
+		return err
+	}
+
+	meta, _, err := r.UpsertMetaWithObject(Object{"xref": nil}, ADD_PATCH,
+		false, false)
+	if err != nil {
+		return err
+	}
+
+	for _, ver := range vers {
+		obj := Object{}
+		for k, v := range ver.Object {
+			// Skip internal attributes and let the new Version calc its epoch
+			if k[0] == '#' || k == "epoch" {
+				continue
+			}
+			obj[k] = v
+		}
+		delete(obj, target.Singular+"id")
+		if r.GetHasDocument() && !IsNil(ver.Object["#contentid"]) {
+			obj[r.Singular] = ver.Get(r.Singular)
+		}
+
+		if _, _, err = r.UpsertVersionWithObject(ver.UID, obj, ADD_ADD); err != nil {
+			return err
+		}
+	}
+
+	meta.JustSet("defaultversionid", defVerID)
+	meta.JustSet("defaultversionsticky", sticky)
+
+	if err = r.ProcessVersionInfo(); err != nil {
+		return err
+	}
+	return meta.ValidateAndSave()
+}
+
 func (m *Meta) SetCommit(name string, val any) error {
-	log.VPrintf(4, "SetCommitMeta: m(%s).Set(%s,%v)", m.UID, name, val)
+	m.tx.VPrintf(4, "SetCommitMeta: m(%s).Set(%s,%v)", m.UID, name, val)
 
 	return m.Entity.eSetCommit(name, val)
 }
 
 func (r *Resource) SetCommitMeta(name string, val any) error {
-	log.VPrintf(4, "SetCommitMeta: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "SetCommitMeta: r(%s).Set(%s,%v)", r.UID, name, val)
 
 	meta, err := r.FindMeta(false)
 	PanicIf(err != nil, "No meta %q: %s", r.UID, err)
@@ -166,7 +342,7 @@ func (r *Resource) SetCommit(name string, val any) error {
 }
 
 func (r *Resource) SetCommitDefault(name string, val any) error {
-	log.VPrintf(4, "SetCommitDefault: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "SetCommitDefault: r(%s).Set(%s,%v)", r.UID, name, val)
 
 	v, err := r.GetDefault()
 	PanicIf(err != nil, "%s", err)
@@ -175,12 +351,12 @@ func (r *Resource) SetCommitDefault(name string, val any) error {
 }
 
 func (m *Meta) JustSet(name string, val any) error {
-	log.VPrintf(4, "JustSet: m(%s).JustSet(%s,%v)", m.Resource.UID, name, val)
+	m.tx.VPrintf(4, "JustSet: m(%s).JustSet(%s,%v)", m.Resource.UID, name, val)
 	return m.Entity.eJustSet(NewPPP(name), val)
 }
 
 func (r *Resource) JustSetMeta(name string, val any) error {
-	log.VPrintf(4, "JustSetMeta: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "JustSetMeta: r(%s).Set(%s,%v)", r.UID, name, val)
 	meta, err := r.FindMeta(false)
 	PanicIf(err != nil, "No meta %q: %s", r.UID, err)
 	return meta.Entity.eJustSet(NewPPP(name), val)
@@ -191,19 +367,19 @@ func (r *Resource) JustSet(name string, val any) error {
 }
 
 func (r *Resource) JustSetDefault(name string, val any) error {
-	log.VPrintf(4, "JustSetDefault: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "JustSetDefault: r(%s).Set(%s,%v)", r.UID, name, val)
 	v, err := r.GetDefault()
 	PanicIf(err != nil, "%s", err)
 	return v.JustSet(name, val)
 }
 
 func (m *Meta) SetSave(name string, val any) error {
-	log.VPrintf(4, "SetSave: m(%s).SetSave(%s,%v)", m.Resource.UID, name, val)
+	m.tx.VPrintf(4, "SetSave: m(%s).SetSave(%s,%v)", m.Resource.UID, name, val)
 	return m.Entity.eSetSave(name, val)
 }
 
 func (r *Resource) SetSaveMeta(name string, val any) error {
-	log.VPrintf(4, "SetSaveMeta: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "SetSaveMeta: r(%s).Set(%s,%v)", r.UID, name, val)
 
 	meta, err := r.FindMeta(false)
 	PanicIf(err != nil, "%s", err)
@@ -212,7 +388,7 @@ func (r *Resource) SetSaveMeta(name string, val any) error {
 
 // Should only ever be used for "id"
 func (r *Resource) SetSaveResource(name string, val any) error {
-	log.VPrintf(4, "SetSaveResource: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "SetSaveResource: r(%s).Set(%s,%v)", r.UID, name, val)
 
 	PanicIf(name != r.Singular+"id", "You shouldn't be using this")
 
@@ -224,7 +400,7 @@ func (r *Resource) SetSave(name string, val any) error {
 }
 
 func (r *Resource) SetSaveDefault(name string, val any) error {
-	log.VPrintf(4, "SetSaveDefault: r(%s).Set(%s,%v)", r.UID, name, val)
+	r.tx.VPrintf(4, "SetSaveDefault: r(%s).Set(%s,%v)", r.UID, name, val)
 
 	v, err := r.GetDefault()
 	PanicIf(err != nil, "%s", err)
@@ -241,8 +417,8 @@ func (r *Resource) Touch() {
 }
 
 func (r *Resource) FindMeta(anyCase bool) (*Meta, error) {
-	log.VPrintf(3, ">Enter: FindMeta(%v)", anyCase)
-	defer log.VPrintf(3, "<Exit: FindMeta")
+	r.tx.VPrintf(3, ">Enter: FindMeta(%v)", anyCase)
+	defer r.tx.VPrintf(3, "<Exit: FindMeta")
 
 	if m := r.tx.GetMeta(r); m != nil {
 		return m, nil
@@ -255,7 +431,7 @@ func (r *Resource) FindMeta(anyCase bool) (*Meta, error) {
 		return nil, fmt.Errorf("Error finding Meta for %q: %q", r.UID, err)
 	}
 	if ent == nil {
-		log.VPrintf(3, "None found")
+		r.tx.VPrintf(3, "None found")
 		return nil, nil
 	}
 
@@ -267,8 +443,8 @@ func (r *Resource) FindMeta(anyCase bool) (*Meta, error) {
 
 // Maybe replace error with a panic? same for other finds??
 func (r *Resource) FindVersion(id string, anyCase bool) (*Version, error) {
-	log.VPrintf(3, ">Enter: FindVersion(%s,%v)", id, anyCase)
-	defer log.VPrintf(3, "<Exit: FindVersion")
+	r.tx.VPrintf(3, ">Enter: FindVersion(%s,%v)", id, anyCase)
+	defer r.tx.VPrintf(3, "<Exit: FindVersion")
 
 	if v := r.tx.GetVersion(r, id); v != nil {
 		return v, nil
@@ -281,7 +457,7 @@ func (r *Resource) FindVersion(id string, anyCase bool) (*Version, error) {
 		return nil, fmt.Errorf("Error finding Version %q: %s", id, err)
 	}
 	if ent == nil {
-		log.VPrintf(3, "None found")
+		r.tx.VPrintf(3, "None found")
 		return nil, nil
 	}
 
@@ -395,8 +571,8 @@ func (r *Resource) SetDefault(newDefault *Version) error {
 // we're removing the 'xref' attr. Other cases, the http layer would have
 // already create the Resource and default version for us.
 func (r *Resource) UpsertMetaWithObject(obj Object, addType AddType, createVersion bool, processVersionInfo bool) (*Meta, bool, error) {
-	log.VPrintf(3, ">Enter: UpsertMeta(%s,%v,%v,%v)", r.UID, addType, createVersion, processVersionInfo)
-	defer log.VPrintf(3, "<Exit: UpsertMeta")
+	r.tx.VPrintf(3, ">Enter: UpsertMeta(%s,%v,%v,%v)", r.UID, addType, createVersion, processVersionInfo)
+	defer r.tx.VPrintf(3, "<Exit: UpsertMeta")
 
 	if err := CheckAttrs(obj); err != nil {
 		return nil, false, err
@@ -406,7 +582,7 @@ func (r *Resource) UpsertMetaWithObject(obj Object, addType AddType, createVersi
 	PanicIf(err != nil, "No meta %q: %s", r.UID, err)
 
 	if meta.Get("readonly") == true {
-		return nil, false, fmt.Errorf("Write operations on read-only " +
+		return nil, false, NewProblemError(PROBLEM_READONLY, "Write operations on read-only "+
 			"resources are not allowed")
 	}
 
@@ -515,6 +691,9 @@ func (r *Resource) UpsertMetaWithObject(obj Object, addType AddType, createVersi
 					return nil, false, fmt.Errorf("'xref' (%s) must be of the "+
 						"form: /GROUPS/gID/RESOURCES/rID", xref)
 				}
+				if err = r.CheckXref(xref); err != nil {
+					return nil, false, err
+				}
 			}
 		}
 	}
@@ -769,8 +948,8 @@ func (r *Resource) UpsertVersion(id string) (*Version, bool, error) {
 
 // *Version, isNew, error
 func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddType) (*Version, bool, error) {
-	log.VPrintf(3, ">Enter: UpsertVersion(%s,%v)", id, addType)
-	defer log.VPrintf(3, "<Exit: UpsertVersion")
+	r.tx.VPrintf(3, ">Enter: UpsertVersion(%s,%v)", id, addType)
+	defer r.tx.VPrintf(3, "<Exit: UpsertVersion")
 
 	if err := CheckAttrs(obj); err != nil {
 		return nil, false, err
@@ -780,7 +959,7 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 	PanicIf(err != nil, "No meta %q: %s", r.UID, err)
 
 	if meta.Get("readonly") == true {
-		return nil, false, fmt.Errorf("Write operations on read-only " +
+		return nil, false, NewProblemError(PROBLEM_READONLY, "Write operations on read-only "+
 			"resources are not allowed")
 	}
 
@@ -885,6 +1064,13 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 				return nil, false, err
 			}
 
+			// Pin the proxied doc into the registry if asked to
+			if isNew && rm.ProxySnapshot {
+				if err = SnapshotProxyURL(r.tx.Span, obj, r.Singular); err != nil {
+					return nil, false, err
+				}
+			}
+
 			data, ok := obj[r.Singular]
 			// If there's data and it's not already just an array of bytes
 			// then convert it. This is for cases where the data is raw JSON
@@ -904,7 +1090,10 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 			// removed that logic (and the #-contenttype_ attr). Look for
 			// the ConvertResourceContents func and the hoops I had to just
 			// thru to make sure all cases were handled.
-			if ok && !IsNil(data) && reflect.ValueOf(data).Type().String() != "[]uint8" {
+			// A *ContentRef means the doc was already saved in the
+			// ContentStore (e.g. streamed from an HTTP request), so skip it
+			_, isRef := data.(*ContentRef)
+			if ok && !IsNil(data) && !isRef && reflect.ValueOf(data).Type().String() != "[]uint8" {
 				// Get the raw bytes of the "rm.Singular" json attribute
 				buf := []byte(nil)
 				switch reflect.ValueOf(data).Kind() {
@@ -1009,6 +1198,11 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 		return nil, false, err
 	}
 
+	// Now apply any other retention rules, but never delete the new one
+	if _, err = r.ApplyRetention(v.UID); err != nil {
+		return nil, false, err
+	}
+
 	// Only validate meta if there's a defaultversionid. Assume that
 	// if it's missing then we're in the middle of recreating things
 	if meta.GetAsString("defaultversionid") != "" {
@@ -1095,17 +1289,25 @@ func (r *Resource) EnsureMaxVersions() error {
 }
 
 func (r *Resource) Delete() error {
-	log.VPrintf(3, ">Enter: Resource.Delete(%s)", r.UID)
-	defer log.VPrintf(3, "<Exit: Resource.Delete")
+	r.tx.VPrintf(3, ">Enter: Resource.Delete(%s)", r.UID)
+	defer r.tx.VPrintf(3, "<Exit: Resource.Delete")
 
 	meta, err := r.FindMeta(false)
 	PanicIf(err != nil, "No meta %q: %s", r.UID, err)
 
 	if meta.Get("readonly") == true {
-		return fmt.Errorf("Delete operations on read-only " +
+		return NewProblemError(PROBLEM_READONLY, "Delete operations on read-only "+
 			"resources are not allowed")
 	}
 
+	if err = r.ProcessXrefSources(""); err != nil {
+		return err
+	}
+
+	if err = r.ProcessXIDReferences(); err != nil {
+		return err
+	}
+
 	if err = meta.Delete(); err != nil {
 		return err
 	}
@@ -1121,8 +1323,8 @@ func (r *Resource) Delete() error {
 }
 
 func (m *Meta) Delete() error {
-	log.VPrintf(3, ">Enter: Meta.Delete(%s)", m.UID)
-	defer log.VPrintf(3, "<Exit: Meta.Delete")
+	m.tx.VPrintf(3, ">Enter: Meta.Delete(%s)", m.UID)
+	defer m.tx.VPrintf(3, "<Exit: Meta.Delete")
 
 	err := DoOne(m.tx, `DELETE FROM Metas WHERE SID=?`, m.DbSID)
 	if err != nil {
@@ -0,0 +1,371 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// Model "retention" policy for a Resource type. Each non-zero rule marks
+// some of the Versions as "to be kept", any Version that isn't kept by at
+// least one rule is deleted. The default Version, and any Version that is
+// referenced by an "xid" attribute, are always kept.
+// This is applied in addition to "maxversions", each time a Version is
+// created and by the background sweeper (see StartRetentionSweeper).
+type RetentionPolicy struct {
+	MaxVersions  int  `json:"maxversions,omitempty"`  // keep newest N
+	MaxAgeDays   int  `json:"maxagedays,omitempty"`   // keep newer than N days
+	KeepPerMajor bool `json:"keeppermajor,omitempty"` // keep newest per semver major
+}
+
+func (rp *RetentionPolicy) Verify(rmName string) error {
+	if rp == nil {
+		return nil
+	}
+	if rp.MaxVersions < 0 {
+		return fmt.Errorf("Resource %q must have a 'retention.maxversions' "+
+			"value >= 0", rmName)
+	}
+	if rp.MaxAgeDays < 0 {
+		return fmt.Errorf("Resource %q must have a 'retention.maxagedays' "+
+			"value >= 0", rmName)
+	}
+	return nil
+}
+
+// Returns true if the policy could ever cause a Version to be deleted
+func (rp *RetentionPolicy) IsActive() bool {
+	return rp != nil && (rp.MaxVersions > 0 || rp.MaxAgeDays > 0)
+}
+
+// The meta attribute that a Resource can use to override its model's
+// retention policy. It's not a spec defined attribute so the model needs to
+// define it first, see AddRetentionOverride.
+const RETENTION_META = "retention"
+
+// Adds the RETENTION_META attribute to the meta of this Resource type so
+// that each Resource can override the model's retention policy
+func (rm *ResourceModel) AddRetentionOverride() (*Attribute, error) {
+	return rm.AddMetaAttribute(&Attribute{
+		Name:        RETENTION_META,
+		Type:        OBJECT,
+		Description: "Overrides the model's Version retention policy",
+		Attributes: Attributes{
+			"maxversions":  {Name: "maxversions", Type: UINTEGER},
+			"maxagedays":   {Name: "maxagedays", Type: UINTEGER},
+			"keeppermajor": {Name: "keeppermajor", Type: BOOLEAN},
+		},
+	})
+}
+
+// Returns the retention policy of "r" - the one in its meta's
+// RETENTION_META attribute if it has one, otherwise its model's. An override
+// replaces the model's policy, it isn't merged with it, so "maxversions":0
+// (for example) turns retention off for just this Resource.
+func (r *Resource) GetRetentionPolicy(meta *Meta) (*RetentionPolicy, error) {
+	val := meta.Get(RETENTION_META)
+	if IsNil(val) {
+		return r.GetResourceModel().Retention, nil
+	}
+
+	rp := &RetentionPolicy{}
+	if err := Unmarshal([]byte(ToJSON(val)), rp); err != nil {
+		return nil, fmt.Errorf("Resource %q has an invalid %q meta "+
+			"attribute: %s", r.UID, RETENTION_META, err)
+	}
+	if err := rp.Verify(r.UID); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Returns the "major" part of a semver-like Version ID (e.g. "v1.2" -> "1")
+// or "" if it doesn't look like one
+func SemverMajor(vID string) string {
+	str := strings.TrimPrefix(strings.TrimPrefix(vID, "v"), "V")
+	major, _, _ := strings.Cut(str, ".")
+	if major == "" || strings.Trim(major, "0123456789") != "" {
+		return ""
+	}
+	if i, err := strconv.Atoi(major); err == nil {
+		return strconv.Itoa(i) // Remove any leading zeros
+	}
+	return ""
+}
+
+// Returns the IDs of the Versions of "r" that its retention policy (see
+// GetRetentionPolicy) says should be deleted, oldest first. "skip" is the ID
+// of a Version that must not be included (e.g. the one being created)
+func (r *Resource) GetExpiredVersionIDs(skip string) ([]string, error) {
+	r.tx.VPrintf(3, ">Enter: GetExpiredVersionIDs(%s)", r.UID)
+	defer r.tx.VPrintf(3, "<Exit: GetExpiredVersionIDs")
+
+	rm := r.GetResourceModel()
+	if !rm.Retention.IsActive() && rm.MetaAttributes[RETENTION_META] == nil {
+		return nil, nil
+	}
+	if r.IsXref() {
+		return nil, nil
+	}
+
+	// Other Resources share our Versions via their meta.xref, so keep all
+	// of them since we can't tell which ones are still needed
+	if sources, err := r.GetXrefSources(); err != nil || len(sources) > 0 {
+		return nil, err
+	}
+
+	meta, err := r.FindMeta(false)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	if meta.Get("readonly") == true {
+		return nil, nil
+	}
+
+	rp, err := r.GetRetentionPolicy(meta)
+	if err != nil || !rp.IsActive() {
+		return nil, err
+	}
+	defaultID := meta.GetAsString("defaultversionid")
+
+	// Newest first
+	results, err := Query(r.tx, `
+			SELECT v.UID,p.PropValue FROM Versions AS v
+			JOIN EffectiveProps as p
+			  ON (p.EntitySID=v.SID AND
+			      p.PropName='createdat`+string(DB_IN)+`')
+			WHERE v.RegistrySID=? AND v.ResourceSID=?
+			  ORDER BY p.PropValue DESC, v.UID DESC`,
+		r.Registry.DbSID, r.DbSID)
+	defer results.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Error getting Versions: %s", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -rp.MaxAgeDays)
+	majors := map[string]bool{}
+	candidates := []string{}
+
+	count := 0
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		vID := NotNilString(row[0])
+		count++
+
+		keep := (vID == skip || vID == defaultID)
+
+		if rp.MaxVersions > 0 && count <= rp.MaxVersions {
+			keep = true
+		}
+
+		if rp.MaxAgeDays > 0 {
+			createdAt, err := ConvertStrToTime(NotNilString(row[1]))
+			if err != nil || createdAt.After(cutoff) {
+				keep = true
+			}
+		}
+
+		if rp.KeepPerMajor {
+			if major := SemverMajor(vID); major != "" && !majors[major] {
+				majors[major] = true
+				keep = true
+			}
+		}
+
+		if !keep {
+			candidates = append([]string{vID}, candidates...)
+		}
+	}
+	results.Close()
+
+	// Last check, don't delete any that are referenced by an xid attribute
+	expired := []string{}
+	for _, vID := range candidates {
+		v, err := r.FindVersion(vID, false)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		refs, err := v.GetXIDReferences()
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) == 0 {
+			expired = append(expired, vID)
+		}
+	}
+
+	return expired, nil
+}
+
+// Deletes all of the Versions that the retention policy says have expired,
+// except for "skip". Returns the list of deleted Version IDs.
+func (r *Resource) ApplyRetention(skip string) ([]string, error) {
+	vIDs, err := r.GetExpiredVersionIDs(skip)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vID := range vIDs {
+		v, err := r.FindVersion(vID, false)
+		if err != nil {
+			return nil, err
+		}
+		if err = v.JustDelete(); err != nil {
+			return nil, err
+		}
+	}
+
+	return vIDs, nil
+}
+
+// Applies the retention policies to all Resources in the Registry. If
+// "dryRun" is true then nothing is deleted. Returns a map of Resource XID
+// to the list of Version IDs that were (or would be) deleted.
+func (reg *Registry) SweepRetention(dryRun bool) (map[string][]string, error) {
+	reg.tx.VPrintf(3, ">Enter: SweepRetention(%s,%v)", reg.UID, dryRun)
+	defer reg.tx.VPrintf(3, "<Exit: SweepRetention")
+
+	res := map[string][]string{}
+
+	for _, gm := range reg.Model.Groups {
+		for _, rm := range gm.Resources {
+			// Resources can only have their own policy if the model
+			// allows it
+			if !rm.Retention.IsActive() &&
+				rm.MetaAttributes[RETENTION_META] == nil {
+				continue
+			}
+
+			paths, err := rm.GetResourcePaths()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, path := range paths {
+				ent, err := reg.FindEntityFromPath(path)
+				if err != nil {
+					return nil, err
+				}
+				if ent == nil {
+					continue
+				}
+				r := ent.Self.(*Resource)
+
+				vIDs := []string(nil)
+				if dryRun {
+					vIDs, err = r.GetExpiredVersionIDs("")
+				} else {
+					vIDs, err = r.ApplyRetention("")
+				}
+				if err != nil {
+					return nil, err
+				}
+				if len(vIDs) > 0 {
+					res["/"+path] = vIDs
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Returns the Paths of all Resources of this type, sorted
+func (rm *ResourceModel) GetResourcePaths() ([]string, error) {
+	reg := rm.GroupModel.Model.Registry
+
+	results, err := Query(reg.tx, `
+        SELECT Path FROM Resources
+        WHERE RegistrySID=? AND ModelSID=?
+        ORDER BY Path`,
+		reg.DbSID, rm.SID)
+	defer results.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		paths = append(paths, NotNilString(row[0]))
+	}
+	return paths, nil
+}
+
+// Starts a go-routine that will apply the retention policies of all
+// Registries every "interval". Each Registry is done in its own Tx.
+func StartRetentionSweeper(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	log.VPrintf(1, "Retention sweeper interval: %s", interval)
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			for _, name := range GetRegistryNames() {
+				if err := SweepRegistryRetention(name); err != nil {
+					log.Printf("Error sweeping retention for %q: %s",
+						name, err)
+				}
+			}
+		}
+	}()
+}
+
+func SweepRegistryRetention(name string) error {
+	tx, err := NewTx()
+	if err != nil {
+		return err
+	}
+
+	reg, err := FindRegistry(tx, name)
+	if err == nil && reg != nil {
+		var res map[string][]string
+		if res, err = reg.SweepRetention(false); err == nil {
+			for xid, vIDs := range res {
+				log.VPrintf(2, "Retention: deleted %s versions: %s", xid,
+					strings.Join(vIDs, ","))
+			}
+		}
+	}
+
+	if txErr := tx.Conditional(err); txErr != nil {
+		return txErr
+	}
+	return err
+}
+
+// GET /retention - returns what the sweeper would delete (dry-run)
+func HTTPGETRetention(info *RequestInfo) error {
+	if len(info.Parts) > 1 {
+		info.StatusCode = http.StatusNotFound
+		return NewProblemError(PROBLEM_NOT_FOUND, "Not found")
+	}
+
+	res, err := info.Registry.SweepRetention(true)
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+
+	buf, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	info.AddHeader("Content-Type", "application/json")
+	info.Write(buf)
+	info.Write([]byte("\n"))
+	return nil
+}
@@ -0,0 +1,30 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestSemverMajor(t *testing.T) {
+	for _, test := range []struct {
+		vID   string
+		major string
+	}{
+		{"", ""},
+		{"1", "1"},
+		{"1.2.3", "1"},
+		{"v2", "2"},
+		{"V2.0", "2"},
+		{"v02.1", "2"},
+		{"10.0.0-rc1", "10"},
+		{"v", ""},
+		{"vv1", ""},
+		{"a.1", ""},
+		{"1a.2", ""},
+		{"-1.0", ""},
+		{".1", ""},
+	} {
+		if got := SemverMajor(test.vID); got != test.major {
+			t.Fatalf("%q: Exp: %q Got: %q", test.vID, test.major, got)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// If set then client certificates are verified against these CAs and
+	// the certificate's subject is used as the user (Tx.User)
+	ClientCAFile      string
+	RequireClientCert bool // Reject requests w/o a valid client cert
+}
+
+// Returns true if users are identified by their client certificates, in
+// which case the "xRegistry~User" header must not be trusted
+func (tc *TLSConfig) UsesClientCerts() bool {
+	return tc != nil && tc.ClientCAFile != ""
+}
+
+// Returns the tls.Config to use for the HTTP server
+func (tc *TLSConfig) Build() (*tls.Config, error) {
+	reloader, err := NewCertReloader(tc.CertFile, tc.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if tc.ClientCAFile != "" {
+		buf, err := os.ReadFile(tc.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading client CA file %q: %s",
+				tc.ClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("No certificates found in client CA "+
+				"file %q", tc.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if tc.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if tc.RequireClientCert {
+		return nil, fmt.Errorf("Requiring client certificates needs a " +
+			"client CA file")
+	}
+
+	return config, nil
+}
+
+// Holds the server's certificate and reloads it when the files change, so
+// certs can be rotated w/o restarting the server
+type CertReloader struct {
+	CertFile      string
+	KeyFile       string
+	CheckInterval time.Duration // How often to look for changes
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // Latest mod time of the 2 files when loaded
+	lastCheck time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CheckInterval: 10 * time.Second,
+	}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *CertReloader) filesModTime() (time.Time, error) {
+	res := time.Time{}
+	for _, file := range []string{cr.CertFile, cr.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return res, err
+		}
+		if info.ModTime().After(res) {
+			res = info.ModTime()
+		}
+	}
+	return res, nil
+}
+
+// Assumes the lock is held, or that no one else has access to "cr" yet
+func (cr *CertReloader) load() error {
+	modTime, err := cr.filesModTime()
+	if err != nil {
+		return fmt.Errorf("Error loading TLS certificate: %s", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.CertFile, cr.KeyFile)
+	if err != nil {
+		return fmt.Errorf("Error loading TLS certificate: %s", err)
+	}
+
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.lastCheck = time.Now()
+	return nil
+}
+
+// For tls.Config.GetCertificate. If the files have changed then the new
+// cert is loaded. If that fails then we keep using the old one.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if time.Since(cr.lastCheck) >= cr.CheckInterval {
+		cr.lastCheck = time.Now()
+
+		modTime, err := cr.filesModTime()
+		if err == nil && !modTime.Equal(cr.modTime) {
+			if err = cr.load(); err != nil {
+				log.Printf("%s", err)
+			} else {
+				log.VPrintf(1, "Reloaded TLS certificate %q", cr.CertFile)
+			}
+		}
+	}
+
+	return cr.cert, nil
+}
+
+// Returns the user name from the request's verified client certificate, or
+// "" if there isn't one. We use the subject's CN, or the entire subject if
+// there's no CN.
+func ClientCertUser(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 ||
+		len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName != "" {
+		return subject.CommonName
+	}
+	return subject.String()
+}
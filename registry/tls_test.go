@@ -0,0 +1,212 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// Creates a cert signed by "parent", or a self-signed CA if parent is nil
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey,
+		signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, file string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	ca := newTestCert(t, "ca", 1, nil)
+	c1 := newTestCert(t, "server", 2, ca)
+	writeFile(t, certFile, c1.certPEM)
+	writeFile(t, keyFile, c1.keyPEM)
+
+	cr, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %s", err)
+	}
+	cr.CheckInterval = 0
+
+	serial := func() int64 {
+		cert, _ := cr.GetCertificate(nil)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.SerialNumber.Int64()
+	}
+	if serial() != 2 {
+		t.Fatalf("Wrong cert")
+	}
+
+	// Bad files are ignored, we keep using the old cert
+	writeFile(t, certFile, []byte("junk"))
+	os.Chtimes(certFile, time.Now(), time.Now().Add(time.Minute))
+	if serial() != 2 {
+		t.Fatalf("Wrong cert after bad update")
+	}
+
+	c2 := newTestCert(t, "server", 3, ca)
+	writeFile(t, certFile, c2.certPEM)
+	writeFile(t, keyFile, c2.keyPEM)
+	os.Chtimes(certFile, time.Now(), time.Now().Add(2*time.Minute))
+	if serial() != 3 {
+		t.Fatalf("Cert wasn't reloaded")
+	}
+
+	if _, err := NewCertReloader(certFile, filepath.Join(dir, "xx")); err == nil {
+		t.Fatalf("Missing key file should fail")
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", 1, nil)
+	server := newTestCert(t, "server", 2, ca)
+	client := newTestCert(t, "alice", 3, ca)
+
+	tc := &TLSConfig{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	writeFile(t, tc.CertFile, server.certPEM)
+	writeFile(t, tc.KeyFile, server.keyPEM)
+	writeFile(t, tc.ClientCAFile, ca.certPEM)
+
+	config, err := tc.Build()
+	if err != nil {
+		t.Fatalf("Build: %s", err)
+	}
+
+	// Not httptest.Server since it'll add its own cert to the config
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user:" + ClientCertUser(r)))
+	})
+	serve := func(config *tls.Config) (net.Listener, string) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen: %s", err)
+		}
+		go http.Serve(tls.NewListener(ln, config), handler)
+		return ln, "https://" + ln.Addr().String()
+	}
+	ln, url := serve(config)
+	defer func() { ln.Close() }()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clientCert, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+
+	get := func(certs ...tls.Certificate) (string, error) {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+		res, err := c.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		buf, _ := io.ReadAll(res.Body)
+		return string(buf), nil
+	}
+
+	if got, err := get(clientCert); err != nil || got != "user:alice" {
+		t.Fatalf("With cert: %q %v", got, err)
+	}
+	if got, err := get(); err != nil || got != "user:" {
+		t.Fatalf("Without cert: %q %v", got, err)
+	}
+
+	// Now make it required
+	ln.Close()
+	tc.RequireClientCert = true
+	if config, err = tc.Build(); err != nil {
+		t.Fatalf("Build: %s", err)
+	}
+	ln, url = serve(config)
+
+	if _, err := get(); err == nil {
+		t.Fatalf("Should have failed w/o a client cert")
+	}
+	if got, err := get(clientCert); err != nil || got != "user:alice" {
+		t.Fatalf("With cert: %q %v", got, err)
+	}
+
+	if _, err := (&TLSConfig{CertFile: tc.CertFile, KeyFile: tc.KeyFile,
+		RequireClientCert: true}).Build(); err == nil {
+		t.Fatalf("Should need a client CA")
+	}
+}
+
+func TestUsesClientCerts(t *testing.T) {
+	if (*TLSConfig)(nil).UsesClientCerts() ||
+		(&TLSConfig{CertFile: "c", KeyFile: "k"}).UsesClientCerts() {
+		t.Fatalf("Shouldn't use client certs")
+	}
+	if !(&TLSConfig{ClientCAFile: "ca"}).UsesClientCerts() {
+		t.Fatalf("Should use client certs")
+	}
+}
@@ -0,0 +1,440 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// A minimal OpenTelemetry-style tracer. Spans are created for each HTTP
+// request (and the DB, save and proxy work done for it), the W3C
+// "traceparent" header is used to join the caller's trace and to propagate
+// it to upstream servers, and finished spans are exported in OTLP/JSON form
+// to a file or to an OTLP/HTTP collector.
+//
+// When tracing isn't enabled (see StartTracing) all of the Span methods are
+// no-ops on the nil *Span that's returned.
+
+type SpanKind int
+
+// Same values as OTLP
+const (
+	SPAN_INTERNAL = SpanKind(1)
+	SPAN_SERVER   = SpanKind(2)
+	SPAN_CLIENT   = SpanKind(3)
+)
+
+type SpanAttr struct {
+	Key   string
+	Value any // string, int, int64, bool
+}
+
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte // All zeros for a root span
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+	End      time.Time
+	Attrs    []SpanAttr
+	Error    string // Non-empty means the span's status is "error"
+
+	mutex sync.Mutex
+	ended bool
+}
+
+type SpanExporter interface {
+	ExportSpans(spans []*Span) error
+}
+
+var TraceServiceName = "xregistry"
+var TraceBatchSize = 512
+var TraceFlushInterval = 5 * time.Second
+
+// The current spanBatcher, nil when tracing is off. It's swapped atomically
+// since requests read it while tracing is being turned on or off.
+var tracer atomic.Pointer[spanBatcher]
+
+type spanBatcher struct {
+	exporter SpanExporter
+	spans    chan *Span
+	stop     chan struct{} // Closed to tell run() to flush and exit
+	done     chan struct{} // Closed by run() when it's finished
+}
+
+// Turns on tracing. All finished spans will be sent to "exporter" in
+// batches. Calling it again replaces the previous exporter.
+func StartTracing(exporter SpanExporter) {
+	sb := &spanBatcher{
+		exporter: exporter,
+		spans:    make(chan *Span, TraceBatchSize*4),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go sb.run()
+	tracer.Swap(sb).shutdown()
+}
+
+// Turns off tracing, exporting any spans that are still queued
+func StopTracing() {
+	tracer.Swap(nil).shutdown()
+}
+
+func TracingEnabled() bool {
+	return tracer.Load() != nil
+}
+
+// Tells run() to export what's queued and waits for it. "spans" is never
+// closed since spans that were finished just before this might still be
+// sent to it, those are dropped.
+func (sb *spanBatcher) shutdown() {
+	if sb == nil {
+		return
+	}
+	close(sb.stop)
+	<-sb.done
+}
+
+func (sb *spanBatcher) run() {
+	defer close(sb.done)
+
+	batch := []*Span{}
+	ticker := time.NewTicker(TraceFlushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := sb.exporter.ExportSpans(batch); err != nil {
+			log.VPrintf(1, "Error exporting %d spans: %s", len(batch), err)
+		}
+		batch = []*Span{}
+	}
+
+	add := func(span *Span) {
+		batch = append(batch, span)
+		if len(batch) >= TraceBatchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case span := <-sb.spans:
+			add(span)
+		case <-ticker.C:
+			flush()
+		case <-sb.stop:
+			// Grab whatever is already queued
+			for {
+				select {
+				case span := <-sb.spans:
+					add(span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (sb *spanBatcher) add(span *Span) {
+	select {
+	case <-sb.stop:
+		// Tracing was turned off, or the exporter replaced
+	case sb.spans <- span:
+	default:
+		// Don't slow down requests just because the exporter is behind
+		log.VPrintf(3, "Trace queue is full, dropping span %q", span.Name)
+	}
+}
+
+func newSpan(name string, kind SpanKind) *Span {
+	span := &Span{
+		Name:  name,
+		Kind:  kind,
+		Start: time.Now(),
+	}
+	rand.Read(span.SpanID[:])
+	return span
+}
+
+// Starts the span for an incoming HTTP request. If the request has a valid
+// "traceparent" header then the span joins that trace, otherwise a new
+// trace is started. Returns nil if tracing isn't enabled.
+func StartRequestSpan(r *http.Request) *Span {
+	if !TracingEnabled() {
+		return nil
+	}
+
+	span := newSpan(r.Method, SPAN_SERVER)
+	if traceID, parentID, ok := ParseTraceParent(r.Header.Get("traceparent")); ok {
+		span.TraceID = traceID
+		span.ParentID = parentID
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+
+	span.SetAttr("http.request.method", r.Method)
+	span.SetAttr("url.path", r.URL.Path)
+	return span
+}
+
+// Starts a new span that's a child of "s". Returns nil if "s" is nil so
+// callers don't need to check whether tracing is enabled.
+func (s *Span) StartChild(name string, kind SpanKind) *Span {
+	if s == nil || !TracingEnabled() {
+		return nil
+	}
+
+	span := newSpan(name, kind)
+	span.TraceID = s.TraceID
+	span.ParentID = s.SpanID
+	return span
+}
+
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, attr := range s.Attrs {
+		if attr.Key == key {
+			s.Attrs[i].Value = value
+			return
+		}
+	}
+	s.Attrs = append(s.Attrs, SpanAttr{Key: key, Value: value})
+}
+
+func (s *Span) GetAttr(key string) any {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, attr := range s.Attrs {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+// Marks the span as failed. A nil "err" is ignored so it can be called
+// with whatever the traced func returned.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Error = strings.TrimSpace(err.Error())
+}
+
+// Finishes the span and queues it for exporting. Only the first call
+// has any effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mutex.Unlock()
+
+	if sb := tracer.Load(); sb != nil {
+		sb.add(s)
+	}
+}
+
+// Returns the W3C "traceparent" header value to send to other servers so
+// that their spans become children of this one
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.TraceID[:]),
+		hex.EncodeToString(s.SpanID[:]))
+}
+
+// Parses a W3C "traceparent" header: version-traceid-parentid-flags
+func ParseTraceParent(header string) ([16]byte, [8]byte, bool) {
+	traceID := [16]byte{}
+	parentID := [8]byte{}
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 ||
+		len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false
+	}
+
+	// "ff" is an invalid version, and version "00" must have exactly 4 parts
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceID, parentID, false
+	}
+	if strings.ToLower(header) != header {
+		return traceID, parentID, false
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.DecodeString(parts[0] + parts[3]); err != nil {
+		return traceID, parentID, false
+	}
+
+	// All zeros isn't allowed for either one
+	if traceID == [16]byte{} || parentID == [8]byte{} {
+		return traceID, parentID, false
+	}
+
+	return traceID, parentID, true
+}
+
+// Converts the spans into an OTLP/JSON ExportTraceServiceRequest
+func SpansToOTLP(spans []*Span) []byte {
+	type kv = map[string]any
+
+	attrs := func(list []SpanAttr) []kv {
+		res := []kv{}
+		for _, attr := range list {
+			val := kv{}
+			switch v := attr.Value.(type) {
+			case bool:
+				val["boolValue"] = v
+			case int:
+				val["intValue"] = strconv.Itoa(v)
+			case int64:
+				val["intValue"] = strconv.FormatInt(v, 10)
+			default:
+				val["stringValue"] = fmt.Sprintf("%v", v)
+			}
+			res = append(res, kv{"key": attr.Key, "value": val})
+		}
+		return res
+	}
+
+	otlpSpans := []kv{}
+	for _, s := range spans {
+		s.mutex.Lock()
+		span := kv{
+			"traceId":           hex.EncodeToString(s.TraceID[:]),
+			"spanId":            hex.EncodeToString(s.SpanID[:]),
+			"name":              s.Name,
+			"kind":              int(s.Kind),
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        attrs(s.Attrs),
+		}
+		if s.ParentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.ParentID[:])
+		}
+		if s.Error != "" {
+			span["status"] = kv{"code": 2, "message": s.Error}
+		}
+		s.mutex.Unlock()
+		otlpSpans = append(otlpSpans, span)
+	}
+
+	req := kv{
+		"resourceSpans": []kv{{
+			"resource": kv{
+				"attributes": attrs([]SpanAttr{
+					{"service.name", TraceServiceName},
+					{"service.version", GitCommit},
+				}),
+			},
+			"scopeSpans": []kv{{
+				"scope": kv{"name": "github.com/xregistry/server/registry"},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+
+	buf, _ := json.Marshal(req)
+	return buf
+}
+
+// Appends each batch of spans to a file as one line of OTLP/JSON, the same
+// format that the OpenTelemetry Collector's "file" exporter uses
+type OTLPFileExporter struct {
+	File string
+
+	mutex sync.Mutex
+}
+
+func (fe *OTLPFileExporter) ExportSpans(spans []*Span) error {
+	fe.mutex.Lock()
+	defer fe.mutex.Unlock()
+
+	file, err := os.OpenFile(fe.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY,
+		0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(SpansToOTLP(spans), '\n'))
+	return err
+}
+
+// Sends each batch of spans to an OTLP/HTTP collector using JSON encoding
+type OTLPHTTPExporter struct {
+	URL     string // e.g. http://localhost:4318/v1/traces
+	Timeout time.Duration
+}
+
+// "endpoint" is the collector's base URL. If it doesn't include a path then
+// the standard "/v1/traces" is used.
+func NewOTLPHTTPExporter(endpoint string) *OTLPHTTPExporter {
+	url := strings.TrimRight(endpoint, "/")
+	if i := strings.Index(url, "://"); i < 0 || !strings.Contains(url[i+3:], "/") {
+		url += "/v1/traces"
+	}
+	return &OTLPHTTPExporter{
+		URL:     url,
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (he *OTLPHTTPExporter) ExportSpans(spans []*Span) error {
+	client := &http.Client{Timeout: he.Timeout}
+	res, err := client.Post(he.URL, "application/json",
+		bytes.NewReader(SpansToOTLP(spans)))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("Error sending spans to %q: %s", he.URL, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+func (me *memExporter) ExportSpans(spans []*Span) error {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+	me.spans = append(me.spans, spans...)
+	return nil
+}
+
+func TestParseTraceParent(t *testing.T) {
+	good := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID, parentID, ok := ParseTraceParent(good)
+	if !ok || hex.EncodeToString(traceID[:]) != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		hex.EncodeToString(parentID[:]) != "00f067aa0ba902b7" {
+		t.Fatalf("Bad parse of %q", good)
+	}
+
+	if _, _, ok := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Fatalf("Future versions can have more fields")
+	}
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+	} {
+		if _, _, ok := ParseTraceParent(header); ok {
+			t.Fatalf("Should have failed: %q", header)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	var nilSpan *Span
+	nilSpan.SetAttr("a", "b")
+	nilSpan.Finish()
+	if nilSpan.StartChild("x", SPAN_INTERNAL) != nil {
+		t.Fatalf("Child of nil should be nil")
+	}
+
+	req := httptest.NewRequest("GET", "/dirs", nil)
+	if StartRequestSpan(req) != nil {
+		t.Fatalf("Tracing isn't enabled, should be nil")
+	}
+
+	exp := &memExporter{}
+	StartTracing(exp)
+	defer StopTracing()
+
+	req.Header.Set("traceparent",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	root := StartRequestSpan(req)
+	child := root.StartChild("child", SPAN_CLIENT)
+	child.SetAttr("count", 5)
+	child.SetAttr("count", 6)
+	child.SetError(os.ErrNotExist)
+	child.Finish()
+	child.Finish()
+	root.Finish()
+	StopTracing()
+
+	if len(exp.spans) != 2 {
+		t.Fatalf("Wrong # of spans: %d", len(exp.spans))
+	}
+	if exp.spans[0] != child || exp.spans[1] != root {
+		t.Fatalf("Wrong spans")
+	}
+	if root.TraceID != child.TraceID || child.ParentID != root.SpanID ||
+		hex.EncodeToString(root.ParentID[:]) != "00f067aa0ba902b7" {
+		t.Fatalf("Bad IDs: %s %s", root.TraceParent(), child.TraceParent())
+	}
+	if len(child.Attrs) != 1 || child.GetAttr("count") != 6 {
+		t.Fatalf("Bad attrs: %v", child.Attrs)
+	}
+	if root.GetAttr("url.path") != "/dirs" {
+		t.Fatalf("Bad attrs: %v", root.Attrs)
+	}
+
+	otlp := map[string]any{}
+	if err := json.Unmarshal(SpansToOTLP(exp.spans), &otlp); err != nil {
+		t.Fatalf("Bad OTLP: %s", err)
+	}
+	buf, _ := json.Marshal(otlp["resourceSpans"].([]any)[0].(map[string]any)["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0])
+	str := string(buf)
+	for _, exp := range []string{
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"parentSpanId":"` + hex.EncodeToString(root.SpanID[:]) + `"`,
+		`"kind":3`,
+		`{"key":"count","value":{"intValue":"6"}}`,
+		`"status":{"code":2,"message":"file does not exist"}`,
+	} {
+		if !strings.Contains(str, exp) {
+			t.Fatalf("Missing %s in:\n%s", exp, str)
+		}
+	}
+}
+
+// Spans finishing while tracing is turned on and off shouldn't panic, or
+// race, run with -race
+func TestTracingStartStop(t *testing.T) {
+	defer StopTracing()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				span := StartRequestSpan(req)
+				span.StartChild("child", SPAN_INTERNAL).Finish()
+				span.Finish()
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		StartTracing(&memExporter{})
+		StopTracing()
+	}
+	wg.Wait()
+
+	if TracingEnabled() {
+		t.Fatalf("Tracing should be off")
+	}
+}
+
+func TestTraceExporters(t *testing.T) {
+	span := &Span{Name: "test", Kind: SPAN_SERVER}
+
+	file := filepath.Join(t.TempDir(), "spans.json")
+	fe := &OTLPFileExporter{File: file}
+	fe.ExportSpans([]*Span{span})
+	fe.ExportSpans([]*Span{span})
+	buf, _ := os.ReadFile(file)
+	if lines := strings.Split(strings.TrimSpace(string(buf)), "\n"); len(lines) != 2 {
+		t.Fatalf("Wrong # of lines:\n%s", string(buf))
+	}
+
+	got := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" ||
+			r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		buf := make([]byte, 1024)
+		n, _ := r.Body.Read(buf)
+		got = string(buf[:n])
+	}))
+	defer srv.Close()
+
+	he := NewOTLPHTTPExporter(srv.URL)
+	if err := he.ExportSpans([]*Span{span}); err != nil {
+		t.Fatalf("Export: %s", err)
+	}
+	if !strings.Contains(got, `"name":"test"`) {
+		t.Fatalf("Bad body: %s", got)
+	}
+
+	he = NewOTLPHTTPExporter(srv.URL + "/other")
+	if he.ExportSpans([]*Span{span}) == nil {
+		t.Fatalf("Should have failed")
+	}
+}
+
+func TestProxyTraceParent(t *testing.T) {
+	header := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("traceparent")
+		w.Write([]byte("doc"))
+	}))
+	defer srv.Close()
+	defer ProxyCache.Clear()
+
+	exp := &memExporter{}
+	StartTracing(exp)
+	defer StopTracing()
+
+	root := StartRequestSpan(httptest.NewRequest("GET", "/", nil))
+	if _, err := FetchProxyURL(root, srv.URL+"/trace"); err != nil {
+		t.Fatalf("Fetch: %s", err)
+	}
+	StopTracing()
+
+	if len(exp.spans) != 1 || exp.spans[0].TraceParent() != header {
+		t.Fatalf("Bad traceparent: %q", header)
+	}
+	if exp.spans[0].GetAttr("http.response.status_code") != 200 {
+		t.Fatalf("Bad attrs: %v", exp.spans[0].Attrs)
+	}
+}
@@ -30,6 +30,25 @@ func NewUUID() string {
 	return fmt.Sprintf("%s%d", uuid.NewString()[:8], count)
 }
 
+// An error that should result in a 409 (Conflict) being returned to an HTTP
+// client, regardless of the status code the HTTP layer would normally use
+type ConflictError struct {
+	msg string
+}
+
+func (ce *ConflictError) Error() string {
+	return ce.msg
+}
+
+func NewConflictError(format string, args ...any) error {
+	return &ConflictError{msg: fmt.Sprintf(format, args...)}
+}
+
+func IsConflictError(err error) bool {
+	ce := (*ConflictError)(nil)
+	return errors.As(err, &ce)
+}
+
 func IsURL(str string) bool {
 	return strings.HasPrefix(str, "http:") || strings.HasPrefix(str, "https:")
 }
@@ -181,6 +200,31 @@ func SortedKeys(m interface{}) []string {
 	return keys
 }
 
+// Same as SortedKeys but for a map of Resources (id->obj), and any Resource
+// that has a "meta.xref" will appear at the end. This allows for the target
+// of an xref to be created in the same request as the xref itself.
+func SortedKeysXrefLast(m interface{}) []string {
+	mV := reflect.ValueOf(m)
+	keys, xrefs := []string{}, []string{}
+
+	for _, k := range SortedKeys(m) {
+		obj := map[string]any(nil)
+		switch val := mV.MapIndex(reflect.ValueOf(k)).Interface().(type) {
+		case Object:
+			obj = val
+		case map[string]any:
+			obj = val
+		}
+
+		if meta, ok := obj["meta"].(map[string]any); ok && !IsNil(meta["xref"]) {
+			xrefs = append(xrefs, k)
+		} else {
+			keys = append(keys, k)
+		}
+	}
+	return append(keys, xrefs...)
+}
+
 func GetStack() []string {
 	stack := []string{}
 
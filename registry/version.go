@@ -1,9 +1,9 @@
 package registry
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-
-	log "github.com/duglin/dlog"
 )
 
 type Version struct {
@@ -41,10 +41,14 @@ func (v *Version) JustDelete() error {
 
 	meta, _ := v.Resource.FindMeta(false)
 	if meta.Get("readonly") == true {
-		return fmt.Errorf("Delete operations on read-only " +
+		return NewProblemError(PROBLEM_READONLY, "Delete operations on read-only "+
 			"resources are not allowed")
 	}
 
+	if err := v.ProcessXIDReferences(); err != nil {
+		return err
+	}
+
 	// Zero is ok if it's already been deleted
 	err := DoZeroOne(v.tx, `DELETE FROM Versions WHERE SID=?`, v.DbSID)
 	if err != nil {
@@ -55,8 +59,8 @@ func (v *Version) JustDelete() error {
 }
 
 func (v *Version) DeleteSetNextVersion(nextVersionID string) error {
-	log.VPrintf(3, ">Enter: Version.Delete(%s, %s)", v.UID, nextVersionID)
-	defer log.VPrintf(3, "<Exit: Version.Delete")
+	v.tx.VPrintf(3, ">Enter: Version.Delete(%s, %s)", v.UID, nextVersionID)
+	defer v.tx.VPrintf(3, "<Exit: Version.Delete")
 
 	if v.Resource.IsXref() {
 		return fmt.Errorf(`Can't delete "versions" if "xref" is set`)
@@ -114,3 +118,147 @@ func (v *Version) DeleteSetNextVersion(nextVersionID string) error {
 func (v *Version) SetDefault() error {
 	return v.Resource.SetDefault(v)
 }
+
+// Returns true if the Version's document, and its "immutable" attributes,
+// can no longer be changed. This is based on its last saved state, so a
+// Version that's being created is never locked.
+func (e *Entity) IsLockedVersion() bool {
+	if e.Type != ENTITY_VERSION || len(e.Object) == 0 {
+		return false
+	}
+
+	switch e.GetResourceModel().VersionLock {
+	case VERSIONLOCK_ONCREATE:
+		return true
+	case VERSIONLOCK_MANUAL:
+		return e.Object["locked"] == true
+	}
+	return false
+}
+
+// Called before a Version is validated to make sure that, if it's locked,
+// none of the locked parts are being changed. Locked attributes that are
+// missing from the incoming data (e.g. a PUT that only has "labels") are
+// copied forward rather than being treated as being removed.
+func (e *Entity) CheckVersionLock() error {
+	e.tx.VPrintf(3, ">Enter: CheckVersionLock(%s)", e.Path)
+	defer e.tx.VPrintf(3, "<Exit: CheckVersionLock")
+
+	rm := e.GetResourceModel()
+
+	if rm.VersionLock == "" {
+		// Locking was turned off, so drop any leftover "locked" value
+		// unless the model still has it as an extension
+		if rm.Attributes["locked"] == nil {
+			delete(e.NewObject, "locked")
+		}
+		return nil
+	}
+
+	names := []string{}
+
+	if rm.VersionLock == VERSIONLOCK_ONCREATE {
+		// "locked" is always true, but allow it to be left out
+		val, ok := e.NewObject["locked"]
+		if ok && val != true && e.IsLockedVersion() {
+			return NewConflictError("Attribute %q of locked Version %q "+
+				"can't be changed", "locked", "/"+e.Path)
+		}
+		e.NewObject["locked"] = true
+	} else {
+		names = append(names, "locked")
+	}
+
+	if !e.IsLockedVersion() {
+		return nil
+	}
+
+	if rm.GetHasDocument() {
+		names = append(names, rm.Singular+"url", rm.Singular+"proxyurl",
+			"contenttype")
+	}
+	attrs := e.GetAttributes(e.Object)
+	for _, name := range SortedKeys(attrs) {
+		if attrs[name].Immutable && SpecProps[name] == nil && name != "*" {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		newVal, ok := e.NewObject[name]
+		oldVal := e.Object[name]
+		if !ok {
+			if !IsNil(oldVal) {
+				e.NewObject[name] = oldVal
+			}
+			continue
+		}
+		same, err := SameJSONValue(oldVal, newVal)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return NewConflictError("Attribute %q of locked Version %q "+
+				"can't be changed", name, "/"+e.Path)
+		}
+	}
+
+	// Now the document itself, which is only in NewObject if it's being set
+	if rm.GetHasDocument() {
+		newVal, ok := e.NewObject[rm.Singular]
+		if !ok {
+			return nil
+		}
+
+		oldDoc, err := e.GetStoredDocument()
+		if err != nil {
+			return err
+		}
+
+		newDoc, err := ContentBytes(newVal)
+		if err != nil {
+			return err
+		}
+
+		if IsNil(newVal) != (oldDoc == nil) || !bytes.Equal(oldDoc, newDoc) {
+			return NewConflictError("The document of locked Version %q "+
+				"can't be changed", "/"+e.Path)
+		}
+	}
+
+	return nil
+}
+
+// Returns true if "a" and "b" are the same once serialized. Each one is
+// marshaled, parsed and marshaled again so that things like the types of
+// numbers (1 vs 1.0 vs json.Number), the order of map keys or whether it's
+// a struct or a map don't matter.
+func SameJSONValue(a, b any) (bool, error) {
+	canonical := func(val any) ([]byte, error) {
+		buf, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		var tmp any
+		if err = json.Unmarshal(buf, &tmp); err != nil {
+			return nil, err
+		}
+		return json.Marshal(tmp)
+	}
+
+	aBuf, err := canonical(a)
+	if err != nil {
+		return false, err
+	}
+	bBuf, err := canonical(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aBuf, bBuf), nil
+}
+
+// Returns the Version's document as it is in the DB, or nil if there isn't
+// one. Unlike Get() this ignores any pending (unsaved) changes.
+func (e *Entity) GetStoredDocument() ([]byte, error) {
+	return ReadContent(e.tx, e.Object["#contentid"])
+}
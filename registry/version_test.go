@@ -0,0 +1,38 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSameJSONValue(t *testing.T) {
+	for _, test := range []struct {
+		a, b any
+		exp  bool
+	}{
+		{nil, nil, true},
+		{"x", "x", true},
+		{"x", "y", false},
+		{1, 1.0, true},
+		{1, json.Number("1"), true},
+		{int64(1000), json.Number("1e3"), true},
+		{1, "1", false},
+		{map[string]any{"a": 1, "b": 2}, map[string]int{"b": 2, "a": 1}, true},
+		{map[string]any{"a": 1}, map[string]any{"a": 1, "b": nil}, false},
+		{[]any{1, 2}, []int{1, 2}, true},
+		{[]any{1, 2}, []int{2, 1}, false},
+		{struct {
+			A int `json:"a"`
+		}{1}, map[string]any{"a": 1}, true},
+	} {
+		got, err := SameJSONValue(test.a, test.b)
+		if err != nil || got != test.exp {
+			t.Fatalf("%v vs %v: Exp: %v Got: %v %v", test.a, test.b,
+				test.exp, got, err)
+		}
+	}
+
+	if _, err := SameJSONValue(func() {}, 1); err == nil {
+		t.Fatalf("Should have failed")
+	}
+}
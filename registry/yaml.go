@@ -0,0 +1,351 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML <-> JSON conversions, using yaml.v3's node tree so that the order of
+// the keys is preserved in both directions. Conversions go thru JSON so
+// that the rest of the code only ever needs to deal with JSON. Since the
+// result is JSON, only one document is allowed and map keys must be
+// scalars.
+
+var yamlMediaTypes = []string{
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"text/x-yaml",
+}
+
+// Returns true if "ct" (a Content-Type or Accept value) is a YAML media type
+func IsYAMLMediaType(ct string) bool {
+	ct, _, _ = strings.Cut(ct, ";")
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	return ArrayContains(yamlMediaTypes, ct) || strings.HasSuffix(ct, "+yaml")
+}
+
+// Returns true if the HTTP "Accept" header prefers YAML over JSON. On a tie
+// the first one listed wins.
+func AcceptsYAML(accept string) bool {
+	bestQ := 0.0
+	yaml := false
+
+	for _, mt := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(mt, ";")
+		mt = strings.ToLower(strings.TrimSpace(mt))
+
+		isYAML := IsYAMLMediaType(mt)
+		if !isYAML && mt != "application/json" && !strings.HasSuffix(mt, "+json") {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, val, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		if q > bestQ {
+			bestQ = q
+			yaml = isYAML
+		}
+	}
+	return yaml
+}
+
+// Replaces the YAML body of the incoming request with its JSON equivalent
+func ConvertYAMLBody(info *RequestInfo) error {
+	req := info.OriginalRequest
+
+	body, err := info.ReadBody()
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(string(body)) != "" {
+		if body, err = YAMLToJSON(body); err != nil {
+			info.StatusCode = http.StatusBadRequest
+			return err
+		}
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
+// JSON -> YAML
+// ////////////////////////////////////////////////////////////
+
+func JSONToYAML(buf []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	node, err := jsonToNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Error converting to YAML: extra data after " +
+			"the JSON value")
+	}
+
+	res := &bytes.Buffer{}
+	enc := yaml.NewEncoder(res)
+	enc.SetIndent(2)
+	if err = enc.Encode(node); err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error converting to YAML: %s", err)
+	}
+	return res.Bytes(), nil
+}
+
+func jsonToNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("Error converting to YAML: %s", err)
+	}
+
+	node := &yaml.Node{}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		if v == '[' {
+			node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, fmt.Errorf("Error converting to YAML: %s",
+						err)
+				}
+				node.Content = append(node.Content, &yaml.Node{
+					Kind:  yaml.ScalarNode,
+					Tag:   "!!str",
+					Value: key.(string),
+				})
+			}
+			val, err := jsonToNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, val)
+		}
+		dec.Token() // } or ]
+		// Empty ones are written as {} and []
+		if len(node.Content) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		return node, nil
+	case string:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!str", v
+	case json.Number:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!float", v.String()
+		if _, err := v.Int64(); err == nil {
+			node.Tag = "!!int"
+		}
+	case bool:
+		node.Kind, node.Tag = yaml.ScalarNode, "!!bool"
+		node.Value = strconv.FormatBool(v)
+	default: // nil
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!null", "null"
+	}
+	return node, nil
+}
+
+// YAML -> JSON
+// ////////////////////////////////////////////////////////////
+
+func YAMLToJSON(buf []byte) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+
+	doc := &yaml.Node{}
+	if err := dec.Decode(doc); err != nil && err != io.EOF {
+		return nil, yamlError(err)
+	}
+	if err := dec.Decode(&yaml.Node{}); err != io.EOF {
+		if err != nil {
+			return nil, yamlError(err)
+		}
+		return nil, fmt.Errorf("Error parsing YAML: multiple documents " +
+			"are not supported")
+	}
+
+	res := &bytes.Buffer{}
+	if len(doc.Content) == 0 {
+		// Empty document
+		res.WriteString("null")
+		return res.Bytes(), nil
+	}
+	if err := writeJSON(res, doc.Content[0], 0); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// Use the same "Error parsing YAML: line N: ..." format for all errors
+func yamlError(err error) error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	return fmt.Errorf("Error parsing YAML: %s", msg)
+}
+
+// Aliases can point to their own ancestors, so stop at some point
+const yamlMaxDepth = 1000
+
+func writeJSON(w *bytes.Buffer, node *yaml.Node, depth int) error {
+	if depth > yamlMaxDepth {
+		return fmt.Errorf("Error parsing YAML: line %d: too deeply nested",
+			node.Line)
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return writeJSON(w, node.Alias, depth+1)
+
+	case yaml.MappingNode:
+		pairs, err := yamlMapPairs(node, depth)
+		if err != nil {
+			return err
+		}
+		w.WriteString("{")
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			if err := writeJSONValue(w, pairs[i].Value); err != nil {
+				return err
+			}
+			w.WriteString(":")
+			if err := writeJSON(w, pairs[i+1], depth+1); err != nil {
+				return err
+			}
+		}
+		w.WriteString("}")
+
+	case yaml.SequenceNode:
+		w.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			if err := writeJSON(w, item, depth+1); err != nil {
+				return err
+			}
+		}
+		w.WriteString("]")
+
+	default:
+		// Keep these as the strings they are, rather than a time.Time or
+		// the decoded bytes
+		if tag := node.ShortTag(); tag == "!!timestamp" || tag == "!!binary" {
+			return writeJSONValue(w, node.Value)
+		}
+
+		var val any
+		if err := node.Decode(&val); err != nil {
+			return yamlError(err)
+		}
+		if f, ok := val.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			return fmt.Errorf("Error parsing YAML: line %d: %q can't be "+
+				"converted to JSON", node.Line, node.Value)
+		}
+		return writeJSONValue(w, val)
+	}
+	return nil
+}
+
+// Returns the key/value nodes of a mapping, in order, with any "<<" merge
+// keys expanded. Keys must be scalars since JSON only has string keys.
+func yamlMapPairs(node *yaml.Node, depth int) ([]*yaml.Node, error) {
+	res := []*yaml.Node{}
+	seen := map[string]int{} // key -> index in res
+
+	add := func(key, val *yaml.Node, override bool) {
+		if i, ok := seen[key.Value]; ok {
+			if override {
+				res[i+1] = val
+			}
+			return
+		}
+		seen[key.Value] = len(res)
+		res = append(res, key, val)
+	}
+
+	merges := []*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		for key.Kind == yaml.AliasNode {
+			key = key.Alias
+		}
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("Error parsing YAML: line %d: map keys "+
+				"must be scalars", key.Line)
+		}
+		if key.Tag == "!!merge" {
+			merges = append(merges, val)
+			continue
+		}
+		if _, ok := seen[key.Value]; ok {
+			return nil, fmt.Errorf("Error parsing YAML: line %d: duplicate "+
+				"key %q", key.Line, key.Value)
+		}
+		add(key, val, true)
+	}
+
+	// Merged keys never override the mapping's own keys
+	for _, merge := range merges {
+		for merge.Kind == yaml.AliasNode {
+			merge = merge.Alias
+		}
+		list := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			list = merge.Content
+		}
+		for _, m := range list {
+			for m.Kind == yaml.AliasNode {
+				m = m.Alias
+			}
+			if m.Kind != yaml.MappingNode || depth > yamlMaxDepth {
+				return nil, fmt.Errorf("Error parsing YAML: line %d: "+
+					"\"<<\" must be a map or a list of maps", m.Line)
+			}
+			pairs, err := yamlMapPairs(m, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(pairs); i += 2 {
+				add(pairs[i], pairs[i+1], false)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func writeJSONValue(w *bytes.Buffer, val any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(val); err != nil {
+		return err
+	}
+	// Encode adds a \n, remove it
+	w.Truncate(w.Len() - 1)
+	return nil
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	for _, test := range []struct {
+		yaml string
+		json string
+	}{
+		{"", `null`},
+		{"hello", `"hello"`},
+		{"a: 1\nb: two\n", `{"a":1,"b":"two"}`},
+		{"# comment\n---\na: 1 # more\n...\n", `{"a":1}`},
+		{"b: 1\na: 2", `{"b":1,"a":2}`},
+		{"a: 007\nb: 1.50\nc: .5\nd: 1e3\ne: 0x1F\nf: -3",
+			`{"a":7,"b":1.5,"c":0.5,"d":1000,"e":31,"f":-3}`},
+		{"a: true\nb: False\nc: null\nd: ~\ne:", `{"a":true,"b":false,"c":null,"d":null,"e":null}`},
+		{`a: "x: y"` + "\nb: 'it''s'\nc: \"tab\\tnl\\n\"\nd: it's # c",
+			`{"a":"x: y","b":"it's","c":"tab\tnl\n","d":"it's"}`},
+		{"a: http://example.com/x#frag", `{"a":"http://example.com/x#frag"}`},
+		{"\"1\": x\n2: y", `{"1":"x","2":"y"}`},
+		{"a:\n  b:\n    c: 1\n  d: 2\ne: 3", `{"a":{"b":{"c":1},"d":2},"e":3}`},
+		{"- 1\n- two\n-\n  - 3\n- - 4\n  - 5", `[1,"two",[3],[4,5]]`},
+		{"a:\n- 1\n- 2\nb: x", `{"a":[1,2],"b":"x"}`},
+		{"a:\n  - b: 1\n    c: 2\n  - d: 3", `{"a":[{"b":1,"c":2},{"d":3}]}`},
+		{"a: [1, 'x', {b: 2, c: [d]}]\ne: {}\nf: []",
+			`{"a":[1,"x",{"b":2,"c":["d"]}],"e":{},"f":[]}`},
+		{"a: [1,\n  2]\nb: 3", `{"a":[1,2],"b":3}`},
+		{"a: |\n  line1\n  # not a comment\n\n  line3\nb: 1",
+			`{"a":"line1\n# not a comment\n\nline3\n","b":1}`},
+		{"a: |-\n  x\n  y\n", `{"a":"x\ny"}`},
+		{"a: >\n  x\n  y\n\n  z\n", `{"a":"x y\nz\n"}`},
+		{"- |\n  x\n- y", `["x\n","y"]`},
+		{"a: &x 1\nb: *x", `{"a":1,"b":1}`},
+		{"a: &b {x: 1, y: 2}\nc:\n  <<: *b\n  y: 3",
+			`{"a":{"x":1,"y":2},"c":{"y":3,"x":1}}`},
+	} {
+		got, err := YAMLToJSON([]byte(test.yaml))
+		if err != nil {
+			t.Fatalf("%q: %s", test.yaml, err)
+		}
+		if string(got) != test.json {
+			t.Fatalf("%q:\nExp: %s\nGot: %s", test.yaml, test.json, got)
+		}
+	}
+
+	for _, test := range []struct {
+		yaml string
+		err  string
+	}{
+		{"a: 1\na: 2", `Error parsing YAML: line 2: duplicate key "a"`},
+		{"a: 1\n  b: 2", `Error parsing YAML: line 2: mapping values are not allowed in this context`},
+		{"a: [1, 2", `Error parsing YAML: line 1: did not find expected ',' or ']'`},
+		{"? [1]\n: x", `Error parsing YAML: line 1: map keys must be scalars`},
+		{"a: .inf", `Error parsing YAML: line 1: ".inf" can't be converted to JSON`},
+		{"a: 1\n---\nb: 2", `Error parsing YAML: multiple documents are not supported`},
+		{"a:\n\tb: 1", `Error parsing YAML: line 2: found character that cannot start any token`},
+	} {
+		_, err := YAMLToJSON([]byte(test.yaml))
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("%q:\nExp: %s\nGot: %v", test.yaml, test.err, err)
+		}
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	for _, test := range []struct {
+		json string
+		yaml string
+	}{
+		{`"hi"`, "hi\n"},
+		{`{}`, "{}\n"},
+		{`{"b":1,"a":"x","c":null,"d":true,"e":[],"f":{}}`,
+			"b: 1\na: x\nc: null\nd: true\ne: []\nf: {}\n"},
+		{`{"a":{"b":[1,{"c":2,"d":[3]},[4]]}}`,
+			"a:\n  b:\n    - 1\n    - c: 2\n      d:\n        - 3\n    - - 4\n"},
+		{`{"a":"","b":"true","c":"1.5","d":"x: y","e":"- x","f":"a\nb","g":" x"}`,
+			"a: \"\"\nb: \"true\"\nc: \"1.5\"\nd: 'x: y'\ne: '- x'\n" +
+				"f: |-\n  a\n  b\ng: ' x'\n"},
+		{`{"url":"http://example.com/x?a=1&b=<2>"}`,
+			"url: http://example.com/x?a=1&b=<2>\n"},
+	} {
+		got, err := JSONToYAML([]byte(test.json))
+		if err != nil {
+			t.Fatalf("%s: %s", test.json, err)
+		}
+		if string(got) != test.yaml {
+			t.Fatalf("%s:\nExp: %s\nGot: %s", test.json, test.yaml, got)
+		}
+
+		// And back again
+		back, err := YAMLToJSON(got)
+		if err != nil {
+			t.Fatalf("%s: %s", got, err)
+		}
+		if string(back) != test.json {
+			t.Fatalf("Round trip:\nExp: %s\nGot: %s", test.json, back)
+		}
+	}
+}
+
+func TestAcceptsYAML(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		exp    bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/yaml", true},
+		{"text/yaml; charset=utf-8", true},
+		{"application/json, application/yaml", false},
+		{"application/yaml, application/json", true},
+		{"application/json;q=0.5, application/yaml", true},
+		{"application/yaml;q=0.1, application/json", false},
+	} {
+		if got := AcceptsYAML(test.accept); got != test.exp {
+			t.Fatalf("%q: Exp: %v Got: %v", test.accept, test.exp, got)
+		}
+	}
+}
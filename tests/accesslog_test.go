@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	log "github.com/duglin/dlog"
+	"github.com/xregistry/server/registry"
+)
+
+func TestAccessLog(t *testing.T) {
+	reg := NewRegistry("TestAccessLog")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	buf := &bytes.Buffer{}
+	registry.AccessLog = buf
+	defer func() { registry.AccessLog = nil }()
+
+	do := func(method, url, reqID string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, "http://localhost:8181"+url,
+			strings.NewReader("{}"))
+		xNoErr(t, err)
+		if reqID != "" {
+			req.Header.Set("X-Request-Id", reqID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		xNoErr(t, err)
+		res.Body.Close()
+		return res
+	}
+	lastEntry := func() *registry.AccessLogEntry {
+		t.Helper()
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		entry := &registry.AccessLogEntry{}
+		xNoErr(t, json.Unmarshal([]byte(lines[len(lines)-1]), entry))
+		return entry
+	}
+
+	res := do("PUT", "/dirs/d1", "my-req.1")
+	xCheckEqual(t, "", res.Header.Get("X-Request-Id"), "my-req.1")
+
+	entry := lastEntry()
+	xCheckEqual(t, "", entry.RequestID, "my-req.1")
+	xCheckEqual(t, "", entry.Registry, reg.UID)
+	xCheckEqual(t, "", entry.Method, "PUT")
+	xCheckEqual(t, "", entry.Path, "/dirs/d1")
+	xCheckEqual(t, "", entry.Status, 201)
+	xCheckEqual(t, "", entry.Bytes > 0, true)
+	xCheckEqual(t, "", entry.Queries > 0, true)
+	xCheckEqual(t, "", entry.Error, "")
+
+	// Bad IDs are replaced
+	res = do("GET", "/dirs/d1?verbose=4", "bad id!")
+	reqID := res.Header.Get("X-Request-Id")
+	xCheckEqual(t, "", reqID != "" && reqID != "bad id!", true)
+	xCheckEqual(t, "", lastEntry().RequestID, reqID)
+	xCheckEqual(t, "", lastEntry().Path, "/dirs/d1?verbose=4")
+
+	// Per-request verbosity doesn't change the global one
+	xCheckEqual(t, "", log.GetVerbose() < 4, true)
+
+	res = do("GET", "/dirs/d2", "")
+	xCheckEqual(t, "", res.StatusCode, 404)
+	entry = lastEntry()
+	xCheckEqual(t, "", entry.RequestID, res.Header.Get("X-Request-Id"))
+	xCheckEqual(t, "", entry.Status, 404)
+	xCheckEqual(t, "", entry.Error != "", true)
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xregistry/server/registry"
+)
+
+func TestHTTPBatch(t *testing.T) {
+	reg := NewRegistry("TestHTTPBatch")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddAttr("myint", registry.INTEGER)
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	batch := func(body string, code int) *registry.BatchResponse {
+		t.Helper()
+		res, err := http.Post("http://localhost:8181/batch",
+			"application/json", strings.NewReader(body))
+		xNoErr(t, err)
+		buf, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		xCheckEqual(t, string(buf), res.StatusCode, code)
+		xCheckEqual(t, "", res.Header.Get("Content-Type"), "application/json")
+
+		br := &registry.BatchResponse{}
+		xNoErr(t, json.Unmarshal(buf, br))
+		return br
+	}
+
+	// Atomic, all good
+	br := batch(`{"operations":[
+	  {"op":"upsert","path":"/dirs/d1","body":{"myint":1}},
+	  {"op":"upsert","path":"/dirs/d1/files/f1$details","body":{}},
+	  {"op":"patch","path":"/dirs/d1","body":{"myint":2}}
+	]}`, 200)
+	xCheckEqual(t, "", br.Mode, "atomic")
+	xCheckEqual(t, "", br.Committed, true)
+	xCheckEqual(t, "", len(br.Results), 3)
+	xCheckEqual(t, "", br.Results[0].Status, 201)
+	xCheckEqual(t, "", br.Results[1].Status, 201)
+	xCheckEqual(t, "", br.Results[2].Status, 200)
+	xCheckEqual(t, "", strings.Contains(string(br.Results[2].Body),
+		`"myint": 2`), true)
+
+	code, _ := xGET(t, "dirs/d1/files/f1$details")
+	xCheckEqual(t, "", code, 200)
+
+	// Atomic, 2nd one fails so nothing is saved
+	br = batch(`{"mode":"atomic","operations":[
+	  {"op":"upsert","path":"/dirs/d2","body":{}},
+	  {"op":"upsert","path":"/dirs/d3","body":{"myint":"abc"}},
+	  {"op":"delete","path":"/dirs/d1"}
+	]}`, 400)
+	xCheckEqual(t, "", br.Committed, false)
+	xCheckEqual(t, "", br.Results[0].Status, 201)
+	xCheckEqual(t, "", br.Results[1].Status, 400)
+	xCheckEqual(t, "", br.Results[1].Error.Type,
+		"https://xregistry.io/errors/invalid_attribute")
+	xCheckEqual(t, "", br.Results[1].Error.Extras["attribute"], "myint")
+	xCheckEqual(t, "", br.Results[2].Status, 424)
+
+	code, _ = xGET(t, "dirs/d2")
+	xCheckEqual(t, "", code, 404)
+	code, _ = xGET(t, "dirs/d1")
+	xCheckEqual(t, "", code, 200)
+
+	// Best-effort, only the bad one fails
+	br = batch(`{"mode":"best-effort","operations":[
+	  {"op":"upsert","path":"/dirs/d2","body":{}},
+	  {"op":"delete","path":"/dirs/dx"},
+	  {"op":"delete","path":"/dirs/d1"}
+	]}`, 200)
+	xCheckEqual(t, "", br.Committed, true)
+	xCheckEqual(t, "", br.Results[0].Status, 201)
+	xCheckEqual(t, "", br.Results[1].Status, 404)
+	xCheckEqual(t, "", br.Results[1].Error.Detail, "Not found")
+	xCheckEqual(t, "", br.Results[2].Status, 204)
+
+	code, _ = xGET(t, "dirs/d2")
+	xCheckEqual(t, "", code, 200)
+	code, _ = xGET(t, "dirs/d1")
+	xCheckEqual(t, "", code, 404)
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "GET batch",
+		URL:        "/batch",
+		Method:     "GET",
+		Code:       405,
+		ResHeaders: []string{"*"},
+		ResBody:    "GET not allowed on /batch\n",
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Bad batch op",
+		URL:        "/batch",
+		Method:     "POST",
+		ReqBody:    `{"operations":[{"op":"get","path":"/dirs"}]}`,
+		Code:       400,
+		ResHeaders: []string{"*"},
+		ResBody: `Operation 0: invalid "op" "get", must be one of: ` +
+			"delete, patch, upsert\n",
+	})
+}
@@ -25,6 +25,7 @@ func TestCapabilitySimple(t *testing.T) {
     "noepoch",
     "noreadonly",
     "offered",
+    "referencedby",
     "schema",
     "setdefaultversionid",
     "specversion"
@@ -67,6 +68,7 @@ func TestCapabilitySimple(t *testing.T) {
       "noepoch",
       "noreadonly",
       "offered",
+      "referencedby",
       "schema",
       "setdefaultversionid",
       "specversion"
@@ -272,6 +274,7 @@ func TestCapabilityPath(t *testing.T) {
     "noepoch",
     "noreadonly",
     "offered",
+    "referencedby",
     "schema",
     "setdefaultversionid",
     "specversion"
@@ -398,8 +401,8 @@ func TestCapabilityPath(t *testing.T) {
   "enforcecompatibility": false,
   "flags": [
     "doc", "epoch", "filter", "inline", "nodefaultversionid",
-    "nodefaultversionsticky", "noepoch", "noreadonly", "offered", "schema",
-	"setdefaultversionid", "specversion"
+    "nodefaultversionsticky", "noepoch", "noreadonly", "offered",
+    "referencedby", "schema", "setdefaultversionid", "specversion"
   ],
   "mutable": [ "capabilities", "entities", "model" ],
   "pagination": false,
@@ -420,6 +423,7 @@ func TestCapabilityPath(t *testing.T) {
     "noepoch",
     "noreadonly",
     "offered",
+    "referencedby",
     "schema",
     "setdefaultversionid",
     "specversion"
@@ -453,6 +457,7 @@ func TestCapabilityPath(t *testing.T) {
     "noepoch",
     "noreadonly",
     "offered",
+    "referencedby",
     "schema",
     "setdefaultversionid",
     "specversion"
@@ -664,8 +669,8 @@ func TestCapabilityAttr(t *testing.T) {
   "enforcecompatibility": false,
   "flags": [
     "doc", "epoch", "filter", "inline", "nodefaultversionid",
-    "nodefaultversionsticky", "noepoch", "noreadonly", "offered", "schema",
-	"setdefaultversionid", "specversion"
+    "nodefaultversionsticky", "noepoch", "noreadonly", "offered",
+    "referencedby", "schema", "setdefaultversionid", "specversion"
   ],
   "mutable": [ "capabilities", "entities", "model" ],
   "pagination": false,
@@ -697,6 +702,7 @@ func TestCapabilityAttr(t *testing.T) {
     "noepoch",
     "noreadonly",
     "offered",
+    "referencedby",
     "schema",
     "setdefaultversionid",
     "specversion"
@@ -796,8 +802,8 @@ func TestCapabilityAttr(t *testing.T) {
 
 // "doc", "epoch", "filter", "inline",
 // "nodefaultversionid", "nodefaultversionsticky",
-// "noepoch", "noreadonly", "offered", "schema", "setdefaultversionid",
-// "specversion"})
+// "noepoch", "noreadonly", "offered", "referencedby", "schema",
+// "setdefaultversionid", "specversion"})
 
 func TestCapabilityFlagsOff(t *testing.T) {
 	reg := NewRegistry("TestCapabilityFlags")
@@ -937,6 +943,7 @@ func TestCapabilityOffered(t *testing.T) {
       "noepoch",
       "noreadonly",
       "offered",
+      "referencedby",
       "schema",
       "setdefaultversionid",
       "specversion"
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/andybalholm/brotli"
 	"github.com/xregistry/server/registry"
 )
 
@@ -334,3 +337,231 @@ func CompareContentMeta(t *testing.T, reg *registry.Registry, test *Test) {
 		t.Fatalf("Extra prop %q in $details, not in header: %s", propName, u)
 	}
 }
+
+func TestContentStore(t *testing.T) {
+	reg := NewRegistry("TestContentStore")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	// Start with the doc in the DB
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `hello`, 201, `*`)
+
+	store, err := registry.NewFileContentStore(t.TempDir())
+	xNoErr(t, err)
+	registry.Contents = store
+	defer func() { registry.Contents = nil }()
+
+	// Same doc in 2 Versions is only stored once
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", `hello`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2", `hello`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f3", `world`, 201, `*`)
+	ids, err := store.List(0)
+	xNoErr(t, err)
+	xCheckEqual(t, "", len(ids), 2)
+
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1", ``, 200, `hello`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v2", ``, 200, `hello`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f3", ``, 200, `world`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f3$details?inline=file", ``, 200,
+		`*`)
+
+	f3, err := reg.FindXIDResource("/dirs/d1/files/f3")
+	xNoErr(t, err)
+	xCheckEqual(t, "", string(f3.Get("file").([]byte)), "world")
+
+	// Move "v1" out of the DB
+	count, err := registry.MigrateContentToStore()
+	xNoErr(t, err)
+	xCheckEqual(t, "", count >= 1, true)
+	ids, err = store.List(0)
+	xNoErr(t, err)
+	xCheckEqual(t, "", len(ids), 2)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1", ``, 200, `hello`)
+
+	// Blobs are only pruned once nothing uses them
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f3", ``, 204, ``)
+	count, err = registry.PruneContentStore(0)
+	xNoErr(t, err)
+	xCheckEqual(t, "", count, 1)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v2", ``, 200, `hello`)
+
+	// A doc that's too large for the DB is fine
+	big := strings.Repeat("0123456789", 2*1024*1024)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f4", big, 201, `*`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f4", ``, 200, big)
+}
+
+func TestProxySnapshot(t *testing.T) {
+	reg := NewRegistry("TestProxySnapshot")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	rm, _ := gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, rm.SetProxySnapshot(true))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	registry.ProxyCache.Clear()
+	before := registry.GetProxyMetrics()
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1$details",
+		`{"fileproxyurl":"http://localhost:8181/EMPTY-Snap"}`, 201, `*`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1", ``, 200,
+		`hello-Snap`)
+
+	f1, err := reg.FindXIDResource("/dirs/d1/files/f1")
+	xNoErr(t, err)
+	v1, err := f1.FindVersion("v1", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", v1.Get("fileproxyurl"), nil)
+	xCheckEqual(t, "", string(v1.Get("file").([]byte)), "hello-Snap")
+
+	// Upstream errors fail the create
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2$details",
+		`{"fileproxyurl":"http://localhost:1/foo"}`, 400, `*`)
+
+	// Turned off, the URL is kept as-is
+	xNoErr(t, rm.SetProxySnapshot(false))
+	xNoErr(t, reg.SaveAllAndCommit())
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v3$details",
+		`{"fileproxyurl":"http://localhost:8181/EMPTY-Snap3"}`, 201, `*`)
+	v3, err := f1.FindVersion("v3", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", v3.Get("fileproxyurl"),
+		"http://localhost:8181/EMPTY-Snap3")
+
+	after := registry.GetProxyMetrics()
+	xCheckEqual(t, "", after.Failures-before.Failures, int64(1))
+
+	res, err := http.Get("http://localhost:8181/metrics")
+	xNoErr(t, err)
+	defer res.Body.Close()
+	xCheckEqual(t, "", res.StatusCode, 200)
+
+	metrics := map[string]registry.ProxyMetrics{}
+	xNoErr(t, json.NewDecoder(res.Body).Decode(&metrics))
+	xCheckEqual(t, "", metrics["proxy"].Failures >= 1, true)
+
+	xHTTP(t, reg, "PUT", "/metrics", `{}`, 405, "PUT not allowed on /metrics\n")
+}
+
+func TestDocumentRangeAndCompression(t *testing.T) {
+	reg := NewRegistry("TestDocumentRangeAndCompression")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", `0123456789`, 201, `*`)
+
+	client := &http.Client{
+		Transport: &http.Transport{DisableCompression: true},
+	}
+	get := func(url string, headers ...string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", "http://localhost:8181"+url, nil)
+		xNoErr(t, err)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		res, err := client.Do(req)
+		xNoErr(t, err)
+		return res
+	}
+	body := func(res *http.Response) string {
+		t.Helper()
+		defer res.Body.Close()
+		buf, err := io.ReadAll(res.Body)
+		xNoErr(t, err)
+		return string(buf)
+	}
+
+	res := get("/dirs/d1/files/f1")
+	xCheckEqual(t, "", res.StatusCode, 200)
+	xCheckEqual(t, "", res.Header.Get("Content-Length"), "10")
+	xCheckEqual(t, "", res.Header.Get("Accept-Ranges"), "bytes")
+	lastMod := res.Header.Get("Last-Modified")
+	xCheckEqual(t, "", lastMod != "", true)
+	xCheckEqual(t, "", body(res), "0123456789")
+
+	res = get("/dirs/d1/files/f1", "Range", "bytes=2-4")
+	xCheckEqual(t, "", res.StatusCode, 206)
+	xCheckEqual(t, "", res.Header.Get("Content-Range"), "bytes 2-4/10")
+	xCheckEqual(t, "", res.Header.Get("Content-Length"), "3")
+	xCheckEqual(t, "", body(res), "234")
+
+	res = get("/dirs/d1/files/f1", "Range", "bytes=-3", "If-Range", lastMod)
+	xCheckEqual(t, "", res.StatusCode, 206)
+	xCheckEqual(t, "", body(res), "789")
+
+	// Stale copy, so send it all
+	res = get("/dirs/d1/files/f1", "Range", "bytes=-3",
+		"If-Range", "Mon, 01 Jan 2001 00:00:00 GMT")
+	xCheckEqual(t, "", res.StatusCode, 200)
+	xCheckEqual(t, "", body(res), "0123456789")
+
+	res = get("/dirs/d1/files/f1", "Range", "bytes=20-")
+	xCheckEqual(t, "", res.StatusCode, 416)
+	xCheckEqual(t, "", res.Header.Get("Content-Range"), "bytes */10")
+	res.Body.Close()
+
+	// Too small to bother compressing
+	res = get("/dirs/d1/files/f1", "Accept-Encoding", "gzip")
+	xCheckEqual(t, "", res.Header.Get("Content-Encoding"), "")
+	xCheckEqual(t, "", body(res), "0123456789")
+
+	// Compressed, but never for partial responses
+	saveMin := registry.CompressMinSize
+	registry.CompressMinSize = 0
+	defer func() { registry.CompressMinSize = saveMin }()
+
+	res = get("/dirs/d1/files/f1", "Accept-Encoding", "gzip")
+	xCheckEqual(t, "", res.StatusCode, 200)
+	xCheckEqual(t, "", res.Header.Get("Content-Encoding"), "gzip")
+	xCheckEqual(t, "", res.Header.Get("Content-Length"), "")
+	zr, err := gzip.NewReader(res.Body)
+	xNoErr(t, err)
+	buf, err := io.ReadAll(zr)
+	xNoErr(t, err)
+	xCheckEqual(t, "", string(buf), "0123456789")
+	res.Body.Close()
+
+	res = get("/dirs/d1/files/f1", "Accept-Encoding", "gzip",
+		"Range", "bytes=0-1")
+	xCheckEqual(t, "", res.StatusCode, 206)
+	xCheckEqual(t, "", res.Header.Get("Content-Encoding"), "")
+	xCheckEqual(t, "", body(res), "01")
+
+	res = get("/export", "Accept-Encoding", "br, deflate")
+	xCheckEqual(t, "", res.StatusCode, 200)
+	xCheckEqual(t, "", res.Header.Get("Content-Encoding"), "deflate")
+	xCheckEqual(t, "", res.Header.Get("Vary"), "Accept-Encoding")
+	dr, err := zlib.NewReader(res.Body)
+	xNoErr(t, err)
+	buf, err = io.ReadAll(dr)
+	xNoErr(t, err)
+	res.Body.Close()
+	xCheckEqual(t, "", strings.Contains(string(buf), `"dirs"`), true)
+
+	res = get("/export", "Accept-Encoding", "br")
+	xCheckEqual(t, "", res.StatusCode, 200)
+	xCheckEqual(t, "", res.Header.Get("Content-Encoding"), "br")
+	buf, err = io.ReadAll(brotli.NewReader(res.Body))
+	xNoErr(t, err)
+	res.Body.Close()
+	xCheckEqual(t, "", strings.Contains(string(buf), `"dirs"`), true)
+
+	res = get("/dirs/d1/files/f1$details", "Accept-Encoding", "identity")
+	xCheckEqual(t, "", res.Header.Get("Content-Encoding"), "")
+	xCheckEqual(t, "", strings.Contains(body(res), `"fileid": "f1"`), true)
+
+	// Writers that change the body ignore the Range and send all of it
+	res = get("/dirs/d1/files/f1?ui", "Range", "bytes=0-1")
+	xCheckEqual(t, "", res.StatusCode, 200)
+	xCheckEqual(t, "", res.Header.Get("Accept-Ranges"), "none")
+	xCheckEqual(t, "", res.Header.Get("Content-Range"), "")
+	xCheckEqual(t, "", strings.Contains(body(res), "0123456789"), true)
+}
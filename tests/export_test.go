@@ -47,6 +47,7 @@ func TestExportBasic(t *testing.T) {
       "noepoch",
       "noreadonly",
       "offered",
+      "referencedby",
       "schema",
       "setdefaultversionid",
       "specversion"
@@ -566,6 +567,7 @@ func TestExportBasic(t *testing.T) {
       "noepoch",
       "noreadonly",
       "offered",
+      "referencedby",
       "schema",
       "setdefaultversionid",
       "specversion"
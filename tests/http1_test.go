@@ -1323,7 +1323,7 @@ func TestHTTPRegistry(t *testing.T) {
 		ReqHeaders: []string{},
 		ReqBody:    "",
 		Code:       405,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody:    "POST not allowed on the root of the registry\n",
 	})
 
@@ -1409,7 +1409,7 @@ func TestHTTPRegistry(t *testing.T) {
   "epoch":33
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody:    "Attribute \"epoch\"(33) doesn't match existing value (4)\n",
 	})
 
@@ -1526,7 +1526,7 @@ func TestHTTPRegistry(t *testing.T) {
   }
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody: `Attribute "mymapobj.mapobj_int" must be a map[string] or object
 `,
 	})
@@ -1674,7 +1674,7 @@ func TestHTTPRegistry(t *testing.T) {
 			ReqHeaders: []string{},
 			ReqBody:    test.request,
 			Code:       400,
-			ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+			ResHeaders: []string{"Content-Type:application/problem+json"},
 			ResBody:    test.response + "\n",
 		})
 	}
@@ -1688,7 +1688,7 @@ func TestHTTPRegistry(t *testing.T) {
   "self": 123
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody: `Attribute "self" must be a url
 `,
 	})
@@ -1702,7 +1702,7 @@ func TestHTTPRegistry(t *testing.T) {
   "xid": 123
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody: `Attribute "xid" must be an xid
 `,
 	})
@@ -1716,7 +1716,7 @@ func TestHTTPRegistry(t *testing.T) {
   "registryid": 123
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody:    "Attribute \"registryid\" must be a string\n",
 	})
 
@@ -1729,7 +1729,7 @@ func TestHTTPRegistry(t *testing.T) {
   "registryid": "foo"
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody: `The "registryid" attribute must be set to "TestHTTPRegistry", not "foo"
 `,
 	})
@@ -1864,7 +1864,7 @@ func TestHTTPGroups(t *testing.T) {
 		ReqHeaders: []string{},
 		ReqBody:    "",
 		Code:       405,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody:    "PUT not allowed on collections\n",
 	})
 
@@ -2310,7 +2310,7 @@ func TestHTTPGroups(t *testing.T) {
   "format":"myformat/1"
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody:    "Attribute \"epoch\"(10) doesn't match existing value (4)\n",
 	})
 
@@ -2321,7 +2321,7 @@ func TestHTTPGroups(t *testing.T) {
 		ReqHeaders: []string{},
 		ReqBody:    `{ "dirid":"dir2" }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody: `The "dirid" attribute must be set to "dir1", not "dir2"
 `,
 	})
@@ -2364,7 +2364,7 @@ func TestHTTPGroups(t *testing.T) {
   "format": "myformat/1"
 }`,
 		Code:       400,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody: `The "dirid" attribute must be set to "dir2", not "dir3"
 `,
 	})
@@ -2386,7 +2386,7 @@ func TestHTTPResourcesHeaders(t *testing.T) {
 		ReqHeaders: []string{},
 		ReqBody:    "",
 		Code:       405,
-		ResHeaders: []string{"Content-Type:text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type:application/problem+json"},
 		ResBody:    "PUT not allowed on collections\n",
 	})
 
@@ -2514,7 +2514,7 @@ func TestHTTPResourcesHeaders(t *testing.T) {
 		ReqBody:    "My cool doc",
 		Code:       400,
 		ResHeaders: []string{
-			"Content-Type: text/plain; charset=utf-8",
+			"Content-Type: application/problem+json",
 		},
 		ResBody: `The "fileid" attribute must be set to "f1", not "f2"
 `,
@@ -6214,7 +6214,7 @@ func TestHTTPDefault(t *testing.T) {
 		Method:     "POST",
 		ReqHeaders: []string{`xRegistry-versionid: bogus`},
 		Code:       404,
-		ResHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type: application/problem+json"},
 		ResBody:    "Unknown Group type: badgroup\n",
 	})
 
@@ -6224,7 +6224,7 @@ func TestHTTPDefault(t *testing.T) {
 		Method:     "POST",
 		ReqHeaders: []string{`xRegistry-versionid: bogus`},
 		Code:       400,
-		ResHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type: application/problem+json"},
 		ResBody:    `Including "xRegistry" headers when "$details" is used is invalid` + "\n",
 	})
 
@@ -6234,7 +6234,7 @@ func TestHTTPDefault(t *testing.T) {
 		Method:     "POST",
 		ReqHeaders: []string{`xRegistry-versionid: bogus`},
 		Code:       400,
-		ResHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type: application/problem+json"},
 		ResBody:    `Version "6" not found` + "\n",
 	})
 
@@ -6244,7 +6244,7 @@ func TestHTTPDefault(t *testing.T) {
 		Method:     "POST",
 		ReqHeaders: []string{`xRegistry-versionid: bogus`},
 		Code:       404,
-		ResHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type: application/problem+json"},
 		ResBody:    `Unknown Resource type: badfiles` + "\n",
 	})
 
@@ -6254,7 +6254,7 @@ func TestHTTPDefault(t *testing.T) {
 		Method:     "POST",
 		ReqHeaders: []string{`xRegistry-versionid: bogus`},
 		Code:       400,
-		ResHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type: application/problem+json"},
 		ResBody:    `Including "xRegistry" headers when "$details" is used is invalid` + "\n",
 	})
 
@@ -6263,7 +6263,7 @@ func TestHTTPDefault(t *testing.T) {
 		URL:        "/dirs/d1/files/f1$details?setdefaultversionid=6",
 		Method:     "POST",
 		Code:       400,
-		ResHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		ResHeaders: []string{"Content-Type: application/problem+json"},
 		ResBody:    `Version "6" not found` + "\n",
 	})
 
@@ -2668,7 +2668,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
         }`,
 		Code: 400,
 		ResHeaders: []string{
-			"Content-Type:text/plain; charset=utf-8",
+			"Content-Type:application/problem+json",
 		},
 		ResBody: `Invalid extension(s): f2,f3
 `})
@@ -2684,7 +2684,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
         }`,
 		Code: 400,
 		ResHeaders: []string{
-			"Content-Type:text/plain; charset=utf-8",
+			"Content-Type:application/problem+json",
 		},
 		ResBody: `The "fileid" attribute must be set to "f4", not "f5"
 `})
@@ -2975,7 +2975,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
 		ReqBody:    ``,
 		Code:       400,
 		ResHeaders: []string{
-			"Content-Type:text/plain; charset=utf-8",
+			"Content-Type:application/problem+json",
 		},
 		ResBody: `Set of Versions to add can't be empty
 `,
@@ -3019,7 +3019,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
         }`,
 		Code: 400,
 		ResHeaders: []string{
-			"Content-Type:text/plain; charset=utf-8",
+			"Content-Type:application/problem+json",
 		},
 		ResBody: `?setdefaultversionid can not be 'null'
 `,
@@ -3036,7 +3036,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
         }`,
 		Code: 400,
 		ResHeaders: []string{
-			"Content-Type:text/plain; charset=utf-8",
+			"Content-Type:application/problem+json",
 		},
 		ResBody: `?setdefaultversionid can not be 'request'
 `,
@@ -3123,7 +3123,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
         }`,
 		Code: 400,
 		ResHeaders: []string{
-			"Content-Type:text/plain; charset=utf-8",
+			"Content-Type:application/problem+json",
 		},
 		ResBody: `Version "v3" not found
 `,
@@ -681,6 +681,10 @@ func TestInlineResource(t *testing.T) {
 		xCheck(t, err == nil, fmt.Sprintf("%s", err))
 
 		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode/100 != 2 {
+			body = []byte(registry.ProblemDetail(
+				res.Header.Get("Content-Type"), body) + "\n")
+		}
 
 		for _, str := range remove {
 			str = fmt.Sprintf(`(?m)^ *%s.*$\n`, str)
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xregistry/server/registry"
+)
+
+func TestHTTPLimits(t *testing.T) {
+	reg := NewRegistry("TestHTTPLimits")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	saveReq := registry.MaxRequestSize
+	saveCount := registry.MaxResponseEntities
+	defer func() {
+		registry.MaxRequestSize = saveReq
+		registry.MaxResponseEntities = saveCount
+	}()
+
+	registry.MaxRequestSize = 20
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Body too large",
+		URL:        "/dirs/d1/files/f1",
+		Method:     "PUT",
+		ReqBody:    strings.Repeat("x", 21),
+		Code:       413,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		ResBody:    "Request body is too large, the max is 20 bytes\n",
+	})
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", strings.Repeat("x", 20),
+		201, "*")
+	registry.MaxRequestSize = saveReq
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2", "{}", 201, "*")
+
+	registry.MaxResponseEntities = 3
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Too many entities",
+		URL:        "/?inline=*",
+		Method:     "GET",
+		Code:       413,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		BodyMasks:  []string{`entities \(\d+\)||entities (N)`},
+		ResBody: "Response would have too many entities (N), the max " +
+			"is 3. Try using fewer inlines or a filter\n",
+	})
+
+	// Without the inline it's fine
+	xHTTP(t, reg, "GET", "/", "", 200, "*")
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/xregistry/server/registry"
+)
+
+func TestHTTPProblemDetails(t *testing.T) {
+	reg := NewRegistry("TestHTTPProblemDetails")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddAttr("myint", registry.INTEGER)
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Unknown group type",
+		URL:        "/foos/f1",
+		Method:     "GET",
+		Code:       404,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		ResBody: `{
+  "type": "https://xregistry.io/errors/unknown_group_type",
+  "title": "Unknown Group type",
+  "status": 404,
+  "detail": "Unknown Group type: foos",
+  "instance": "/foos/f1",
+  "grouptype": "foos"
+}
+`,
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Not found",
+		URL:        "/dirs/d1",
+		Method:     "GET",
+		Code:       404,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		ResBody: `{
+  "type": "https://xregistry.io/errors/not_found",
+  "title": "Not found",
+  "status": 404,
+  "detail": "Not found",
+  "instance": "/dirs/d1"
+}
+`,
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Bad attribute",
+		URL:        "/dirs/d1",
+		Method:     "PUT",
+		ReqBody:    `{"myint": "abc"}`,
+		Code:       400,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		ResBody: `{
+  "type": "https://xregistry.io/errors/invalid_attribute",
+  "title": "Invalid attribute",
+  "status": 400,
+  "detail": "Attribute \"myint\" must be an integer",
+  "instance": "/dirs/d1",
+  "attribute": "myint"
+}
+`,
+	})
+
+	xHTTP(t, reg, "PUT", "/dirs/d1", `{}`, 201, "*")
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Bad epoch",
+		URL:        "/dirs/d1",
+		Method:     "PUT",
+		ReqBody:    `{"epoch": 5}`,
+		Code:       400,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		ResBody: `{
+  "type": "https://xregistry.io/errors/mismatched_epoch",
+  "title": "Mismatched epoch",
+  "status": 400,
+  "detail": "Attribute \"epoch\"(5) doesn't match existing value (1)",
+  "instance": "/dirs/d1",
+  "attribute": "epoch"
+}
+`,
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Bad epoch on delete",
+		URL:        "/dirs/d1?epoch=5",
+		Method:     "DELETE",
+		Code:       400,
+		ResHeaders: []string{"Content-Type: application/problem+json"},
+		ResBody: `{
+  "type": "https://xregistry.io/errors/mismatched_epoch",
+  "title": "Mismatched epoch",
+  "status": 400,
+  "detail": "Epoch value for \"d1\" must be 1 not 5",
+  "instance": "/dirs/d1"
+}
+`,
+	})
+
+	// Old style for the UI
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "Unknown group type - ui",
+		URL:        "/foos/f1?ui",
+		Method:     "GET",
+		Code:       404,
+		ResHeaders: []string{"*"},
+		ResBody:    "Unknown Group type: foos\n",
+	})
+}
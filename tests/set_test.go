@@ -574,7 +574,9 @@ func TestSetNameUser(t *testing.T) {
 				t.Logf("Body:\n%s", string(resBody))
 				t.Fatalf("%q should have failed, but didn't", name)
 			}
-			if !strings.HasPrefix(string(resBody), msg) {
+			detail := registry.ProblemDetail(res.Header.Get("Content-Type"),
+				resBody)
+			if !strings.HasPrefix(detail, msg) {
 				t.Fatalf("%q got wrong err msg: %q", name, string(resBody))
 			}
 		}
@@ -899,3 +899,96 @@ func TestNameCharSet(t *testing.T) {
 `)
 
 }
+
+func TestXIDOnDelete(t *testing.T) {
+	reg := NewRegistry("TestXIDOnDelete")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, false)
+
+	_, err := reg.Model.AddAttribute(&registry.Attribute{
+		Name:     "badptr",
+		Type:     registry.STRING,
+		OnDelete: registry.ONDELETE_RESTRICT,
+	})
+	xCheckErr(t, err, `"model.badptr" must not have an "ondelete" value `+
+		`since "type" is not "xid"`)
+
+	_, err = reg.Model.AddAttribute(&registry.Attribute{
+		Name:     "badptr",
+		Type:     registry.XID,
+		Target:   "/dirs/files",
+		OnDelete: "foo",
+	})
+	xCheckErr(t, err, `"model.badptr" has an invalid "ondelete" value `+
+		`(foo), must be one of: cascade, restrict, setnull`)
+
+	_, err = reg.Model.AddAttribute(&registry.Attribute{
+		Name:     "restrictptr",
+		Type:     registry.XID,
+		Target:   "/dirs/files",
+		OnDelete: registry.ONDELETE_RESTRICT,
+	})
+	xNoErr(t, err)
+
+	_, err = reg.Model.AddAttribute(&registry.Attribute{
+		Name:     "nullptr",
+		Type:     registry.XID,
+		Target:   "/dirs/files[/versions]",
+		OnDelete: registry.ONDELETE_SETNULL,
+	})
+	xNoErr(t, err)
+
+	_, err = gm.AddAttribute(&registry.Attribute{
+		Name:     "cascadeptr",
+		Type:     registry.XID,
+		Target:   "/dirs/files",
+		OnDelete: registry.ONDELETE_CASCADE,
+	})
+	xNoErr(t, err)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2/versions/v1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2/versions/v2", `{}`, 201, `*`)
+
+	// Target must exist
+	xHTTP(t, reg, "PATCH", "/", `{"restrictptr":"/dirs/d1/files/f9"}`, 400,
+		`Attribute "restrictptr" (/dirs/d1/files/f9) must point to an `+
+			"existing entity\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d2", `{"cascadeptr":"/dirs/d1/files/f9"}`,
+		400, `Attribute "cascadeptr" (/dirs/d1/files/f9) must point to an `+
+			"existing entity\n")
+
+	// Restrict
+	xHTTP(t, reg, "PATCH", "/", `{"restrictptr":"/dirs/d1/files/f1"}`, 200,
+		`*`)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", ``, 400,
+		`Can't delete "/dirs/d1/files/f1" since it is referenced by the `+
+			`"restrictptr" attribute of "/"`+"\n")
+	xHTTP(t, reg, "DELETE", "/dirs/d1", ``, 400,
+		`Can't delete "/dirs/d1" since it is referenced by the `+
+			`"restrictptr" attribute of "/"`+"\n")
+	xHTTP(t, reg, "PATCH", "/", `{"restrictptr":null}`, 200, `*`)
+
+	// Set-null
+	xHTTP(t, reg, "PATCH", "/", `{"nullptr":"/dirs/d1/files/f2/versions/v1"}`,
+		200, `*`)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f2/versions/v1", ``, 204, ``)
+	reg.Refresh()
+	xCheckEqual(t, "", reg.Get("nullptr"), nil)
+
+	// Cascade
+	xHTTP(t, reg, "PUT", "/dirs/d2", `{"cascadeptr":"/dirs/d1/files/f2"}`,
+		201, `*`)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f2", ``, 204, ``)
+	xHTTP(t, reg, "GET", "/dirs/d2", ``, 404, "Not found\n")
+
+	// References from within the entity being deleted are ignored
+	xHTTP(t, reg, "PUT", "/dirs/d3/files/f3", `{}`, 201, `*`)
+	xHTTP(t, reg, "PATCH", "/dirs/d3", `{"cascadeptr":"/dirs/d3/files/f3"}`,
+		200, `*`)
+	xHTTP(t, reg, "DELETE", "/dirs/d3", ``, 204, ``)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1", ``, 200, `*`)
+}
@@ -388,6 +388,23 @@ func xCheckHTTP(t *testing.T, reg *registry.Registry, test *HTTPTest) {
 		fmt.Sprintf("Expected status %d, got %d\n%s",
 			test.Code, res.StatusCode, string(resBody)))
 
+	// Errors are sent as problem details. Unless the test is looking for
+	// the JSON itself, check it's valid and then just compare the "detail"
+	// to the expected error message.
+	if strings.HasPrefix(res.Header.Get("Content-Type"),
+		registry.PROBLEM_CONTENT_TYPE) &&
+		!strings.HasPrefix(strings.TrimSpace(test.ResBody), "{") {
+
+		problem := map[string]any{}
+		xNoErr(t, json.Unmarshal(resBody, &problem))
+		xCheck(t, strings.HasPrefix(fmt.Sprintf("%v", problem["type"]),
+			registry.ProblemTypeBase), "Bad problem type: "+string(resBody))
+		xCheckEqual(t, "Problem status", problem["status"],
+			float64(res.StatusCode))
+		xCheckEqual(t, "Problem instance", problem["instance"], req.URL.Path)
+		resBody = []byte(fmt.Sprintf("%v\n", problem["detail"]))
+	}
+
 	// t.Logf("%v\n%s", res.Header, string(resBody))
 	testHeaders := map[string]string{}
 
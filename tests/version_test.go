@@ -872,3 +872,215 @@ func TestVersionOrdering2(t *testing.T) {
 }
 `})
 }
+
+func TestVersionRetention(t *testing.T) {
+	reg := NewRegistry("TestVersionRetention")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	rm, _ := gm.AddResourceModel("files", "file", 0, true, true, false)
+	_, err := reg.Model.AddAttrXID("ptr", "/dirs/files/versions")
+	xNoErr(t, err)
+
+	xCheckErr(t, rm.SetRetention(&registry.RetentionPolicy{MaxVersions: -1}),
+		`Resource "files" must have a 'retention.maxversions' value >= 0`)
+	xCheckErr(t, rm.SetRetention(&registry.RetentionPolicy{MaxAgeDays: -1}),
+		`Resource "files" must have a 'retention.maxagedays' value >= 0`)
+	xNoErr(t, rm.SetRetention(&registry.RetentionPolicy{
+		MaxVersions:  2,
+		KeepPerMajor: true,
+	}))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	// Applied on each write. Newest 2 are kept, plus the newest of each
+	// major version
+	for i, vID := range []string{"v1.0", "v1.1", "v2.0", "v2.1", "v3.0"} {
+		xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/"+vID,
+			fmt.Sprintf(`{"createdat":"2024-01-01T12:00:0%dZ"}`, i), 201, `*`)
+	}
+
+	f1, err := reg.FindXIDResource("/dirs/d1/files/f1")
+	xNoErr(t, err)
+	vIDs, err := f1.GetVersionIDs()
+	xNoErr(t, err)
+	xCheckEqual(t, "", vIDs, []string{"v1.1", "v2.1", "v3.0"})
+
+	// Referenced Versions are always kept
+	xHTTP(t, reg, "PATCH", "/", `{"ptr":"/dirs/d1/files/f1/versions/v1.1"}`,
+		200, `*`)
+	xNoErr(t, rm.SetRetention(&registry.RetentionPolicy{MaxVersions: 1}))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	// Dry-run shouldn't delete anything
+	xHTTP(t, reg, "GET", "/retention", ``, 200, `{
+  "/dirs/d1/files/f1": [
+    "v2.1"
+  ]
+}
+`)
+	xHTTP(t, reg, "GET", "/retention", ``, 200, `{
+  "/dirs/d1/files/f1": [
+    "v2.1"
+  ]
+}
+`)
+
+	res, err := reg.SweepRetention(false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", res, map[string][]string{"/dirs/d1/files/f1": {"v2.1"}})
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	vIDs, err = f1.GetVersionIDs()
+	xNoErr(t, err)
+	xCheckEqual(t, "", vIDs, []string{"v1.1", "v3.0"})
+	xHTTP(t, reg, "GET", "/retention", ``, 200, "{}\n")
+
+	// Age based - the default Version is always kept
+	xHTTP(t, reg, "PATCH", "/", `{"ptr":null}`, 200, `*`)
+	xNoErr(t, rm.SetRetention(&registry.RetentionPolicy{MaxAgeDays: 30}))
+	xNoErr(t, reg.SaveAllAndCommit())
+	xHTTP(t, reg, "GET", "/retention", ``, 200, `{
+  "/dirs/d1/files/f1": [
+    "v1.1"
+  ]
+}
+`)
+
+	// A Resource can override its model's policy, and it replaces it
+	_, err = rm.AddRetentionOverride()
+	xNoErr(t, err)
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/meta",
+		`{"retention":{"maxversions":5}}`, 200, `*`)
+	xHTTP(t, reg, "GET", "/retention", ``, 200, "{}\n")
+
+	xNoErr(t, rm.SetRetention(nil))
+	xNoErr(t, reg.SaveAllAndCommit())
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/meta",
+		`{"retention":{"maxversions":1}}`, 200, `*`)
+	xHTTP(t, reg, "GET", "/retention", ``, 200, `{
+  "/dirs/d1/files/f1": [
+    "v1.1"
+  ]
+}
+`)
+
+	// Resources that use f1's Versions via meta.xref keep them all alive
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fx$details",
+		`{"meta":{"xref":"/dirs/d1/files/f1"}}`, 201, `*`)
+	xHTTP(t, reg, "GET", "/retention", ``, 200, "{}\n")
+	res, err = reg.SweepRetention(false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", len(res), 0)
+	xNoErr(t, reg.SaveAllAndCommit())
+	vIDs, err = f1.GetVersionIDs()
+	xNoErr(t, err)
+	xCheckEqual(t, "", vIDs, []string{"v1.1", "v3.0"})
+
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/fx", ``, 204, ``)
+	xHTTP(t, reg, "GET", "/retention", ``, 200, `{
+  "/dirs/d1/files/f1": [
+    "v1.1"
+  ]
+}
+`)
+
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/meta",
+		`{"retention":{"maxversions":-1}}`, 400, `*`)
+
+	xHTTP(t, reg, "PUT", "/retention", `{}`, 405,
+		"PUT not allowed on /retention\n")
+	xHTTP(t, reg, "DELETE", "/retention", ``, 405,
+		"DELETE not allowed on /retention\n")
+	xHTTP(t, reg, "GET", "/retention/foo", ``, 404, "Not found\n")
+}
+
+func TestVersionLock(t *testing.T) {
+	reg := NewRegistry("TestVersionLock")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	rm, _ := gm.AddResourceModel("files", "file", 0, true, true, true)
+	_, err := rm.AddAttribute(&registry.Attribute{
+		Name:      "owner",
+		Type:      registry.STRING,
+		Immutable: true,
+	})
+	xNoErr(t, err)
+
+	xCheckErr(t, rm.SetVersionLock("foo"),
+		`Resource "files" has an invalid 'versionlock' value (foo), must `+
+			`be one of: manual, oncreate`)
+	xNoErr(t, rm.SetVersionLock(registry.VERSIONLOCK_MANUAL))
+	xCheckEqual(t, "", rm.Attributes["locked"] != nil, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	// Not locked yet, so anything goes
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{"doc":1}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{"doc":2}`, 200, `*`)
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v1$details",
+		`{"owner":"me"}`, 200, `*`)
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v1$details",
+		`{"owner":"you","locked":true}`, 200, `*`)
+
+	// Locked
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{"doc":3}`, 409,
+		`The document of locked Version "/dirs/d1/files/f1/versions/v1" `+
+			"can't be changed\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v1$details",
+		`{"owner":"me"}`, 409,
+		`Attribute "owner" of locked Version "/dirs/d1/files/f1/versions/v1" `+
+			"can't be changed\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v1$details",
+		`{"fileurl":"http://example.com"}`, 409,
+		`Attribute "fileurl" of locked Version "/dirs/d1/files/f1/versions/v1" `+
+			"can't be changed\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v1$details",
+		`{"locked":false}`, 409,
+		`Attribute "locked" of locked Version "/dirs/d1/files/f1/versions/v1" `+
+			"can't be changed\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1$details", `{"file":{"doc":4}}`,
+		409,
+		`The document of locked Version "/dirs/d1/files/f1/versions/v1" `+
+			"can't be changed\n")
+
+	// Same document is ok, and so are labels and description, even via a
+	// PUT that leaves out the locked attributes
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{"doc":2}`, 200, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1$details",
+		`{"description":"desc","labels":{"l1":"v1"}}`, 200, `*`)
+
+	f1, err := reg.FindXIDResource("/dirs/d1/files/f1")
+	xNoErr(t, err)
+	v1, err := f1.FindVersion("v1", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", v1.Get("description"), "desc")
+	xCheckEqual(t, "", v1.Get("labels.l1"), "v1")
+	xCheckEqual(t, "", v1.Get("owner"), "you")
+	xCheckEqual(t, "", v1.Get("locked"), true)
+	xCheckEqual(t, "", v1.Get("contenttype"), "application/json")
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1", ``, 200,
+		"{\n  \"doc\": 2\n}\n")
+
+	// Every Version is locked once created
+	xNoErr(t, rm.SetVersionLock(registry.VERSIONLOCK_ONCREATE))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", `{"doc":1}`, 201, `*`)
+	v2, err := f1.FindVersion("v2", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", v2.Get("locked"), true)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", `{"doc":2}`, 409,
+		`The document of locked Version "/dirs/d1/files/f1/versions/v2" `+
+			"can't be changed\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v2$details",
+		`{"locked":false}`, 409,
+		`Attribute "locked" of locked Version "/dirs/d1/files/f1/versions/v2" `+
+			"can't be changed\n")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/versions/v2$details",
+		`{"description":"new"}`, 200, `*`)
+
+	// Turning it off unlocks everything
+	xNoErr(t, rm.SetVersionLock(""))
+	xNoErr(t, reg.SaveAllAndCommit())
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", `{"doc":3}`, 200, `*`)
+}
@@ -1,10 +1,12 @@
 package tests
 
 import (
+	"bytes"
 	"os"
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/xregistry/server/registry"
 )
@@ -50,3 +52,620 @@ func TestXRBasic(t *testing.T) {
 		xCheckEqual(t, "", string(out), "")
 	}
 }
+
+func TestXRResourceVersion(t *testing.T) {
+	reg := NewRegistry("TestXRResourceVersion")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xr := func(args ...string) (string, error) {
+		t.Helper()
+		args = append([]string{"-s", "localhost:8181"}, args...)
+		out, err := exec.Command("../xr", args...).CombinedOutput()
+		return string(out), err
+	}
+
+	dir := t.TempDir()
+	docFile := dir + "/doc.json"
+	xNoErr(t, os.WriteFile(docFile, []byte(`{"hello":"world"}`), 0644))
+
+	out, err := xr("resource", "create", "/dirs/d1/files/f1",
+		"--doc", docFile, "-d", `{"description":"my file"}`)
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("resource", "create", "/dirs/d1/files/f1")
+	xCheckEqual(t, "", err != nil, true)
+	xCheckEqual(t, "", out, "Resource \"/dirs/d1/files/f1\" already exists\n")
+
+	out, err = xr("resource", "create", "/dirs/d1/foos/f1")
+	xCheckEqual(t, "", out, "Unknown Resource type: foos\n")
+
+	out, err = xr("resource", "get", "/dirs/d1/files/f1", "-o", "json")
+	xNoErr(t, err)
+	xCheckEqual(t, "", strings.Contains(out, `"contenttype": "application/json"`),
+		true)
+	xCheckEqual(t, "", strings.Contains(out, `"description": "my file"`), true)
+
+	out, err = xr("version", "create", "/dirs/d1/files/f1/versions/v2",
+		"--doc", docFile, "-c", "text/plain")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("version", "list", "/dirs/d1/files/f1")
+	xNoErr(t, err)
+	xCheckEqual(t, "", strings.Count(out, "\n"), 3)
+	xCheckEqual(t, "", strings.Contains(out, "/dirs/d1/files/f1/versions/v2"),
+		true)
+
+	out, err = xr("version", "set-default", "/dirs/d1/files/f1/versions/1")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("resource", "meta", "/dirs/d1/files/f1", "-o", "json",
+		"-v", "--compatibility", "backward")
+	xNoErr(t, err)
+	xCheckEqual(t, "", strings.Contains(out, `"defaultversionid": "1"`), true)
+	xCheckEqual(t, "", strings.Contains(out, `"defaultversionsticky": true`),
+		true)
+	xCheckEqual(t, "", strings.Contains(out, `"compatibility": "backward"`),
+		true)
+
+	out, err = xr("version", "get", "/dirs/d1/files/f1/versions/v2",
+		"--doc", "-")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out, `{"hello":"world"}`)
+
+	out, err = xr("resource", "list", "/dirs/d1")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out, "TYPE   ID  DEFAULT  VERSIONS  XID\n"+
+		"files  f1  1        2         /dirs/d1/files/f1\n")
+
+	out, err = xr("version", "delete", "/dirs/d1/files/f1/versions/v2")
+	xCheckEqual(t, out, err, nil)
+	out, err = xr("resource", "delete", "/dirs/d1/files/f1")
+	xCheckEqual(t, out, err, nil)
+
+	code, _ := xGET(t, "dirs/d1/files/f1")
+	xCheckEqual(t, "", code, 404)
+}
+
+func TestXRApply(t *testing.T) {
+	reg := NewRegistry("TestXRApply")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/old", "{}", 201, "*")
+
+	dir := t.TempDir()
+	write := func(path string, data string) {
+		t.Helper()
+		path = dir + "/" + path
+		xNoErr(t, os.MkdirAll(path[:strings.LastIndex(path, "/")], 0755))
+		xNoErr(t, os.WriteFile(path, []byte(data), 0644))
+	}
+	apply := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-s", "localhost:8181", "apply", dir}, args...)
+		out, err := exec.Command("../xr", args...).CombinedOutput()
+		xCheckEqual(t, string(out), err, nil)
+		return string(out)
+	}
+
+	write("dirs/d1/group.json", `{"description":"my dir"}`)
+	write("dirs/d1/files/f1/versions/1/doc.json", `{"hello":"world"}`)
+	write("dirs/d1/files/f1/versions/2/version.yaml", "description: two\n")
+	write("dirs/d1/files/f1/versions/2/doc.txt", "hello")
+
+	out := apply("--dry-run")
+	xCheckEqual(t, "", strings.Contains(out, "+ create group /dirs/d1\n"),
+		true)
+	xCheckEqual(t, "", strings.Contains(out,
+		"Plan: 3 to create, 0 to update, 0 to delete"), true)
+	code, _ := xGET(t, "dirs/d1")
+	xCheckEqual(t, "", code, 404)
+
+	apply()
+	code, body := xGET(t, "dirs/d1/files/f1/versions/2")
+	xCheckEqual(t, "", code, 200)
+	xCheckEqual(t, "", body, "hello")
+	code, body = xGET(t, "dirs/d1/files/f1/versions/2$details")
+	xCheckEqual(t, "", strings.Contains(body, `"contenttype": "text/plain`),
+		true)
+
+	// Nothing changed so nothing to do
+	xCheckEqual(t, "", apply(), "No changes\n")
+
+	// Update a doc, make v1 the default and delete "old"
+	write("dirs/d1/files/f1/versions/2/doc.txt", "bye")
+	write("dirs/d1/files/f1/meta.json",
+		`{"defaultversionid":"1","defaultversionsticky":true}`)
+	out = apply("--prune")
+	xCheckEqual(t, "", strings.Contains(out,
+		"~ update version /dirs/d1/files/f1/versions/2\n"+
+			"    (document changed)\n"), true)
+	xCheckEqual(t, "", strings.Contains(out,
+		"- delete group /dirs/old\n"), true)
+
+	_, body = xGET(t, "dirs/d1/files/f1/versions/2")
+	xCheckEqual(t, "", body, "bye")
+	_, body = xGET(t, "dirs/d1/files/f1/meta")
+	xCheckEqual(t, "", strings.Contains(body, `"defaultversionid": "1"`),
+		true)
+	code, _ = xGET(t, "dirs/old")
+	xCheckEqual(t, "", code, 404)
+
+	xCheckEqual(t, "", apply("--prune"), "No changes\n")
+}
+
+func TestXRProfile(t *testing.T) {
+	reg := NewRegistry("TestXRProfile")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	config := t.TempDir() + "/config"
+
+	xr := func(args ...string) (string, error) {
+		t.Helper()
+		cmd := exec.Command("../xr", args...)
+		cmd.Env = append(os.Environ(), "XR_CONFIG="+config, "XR_SERVER=",
+			"XR_PROFILE=")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := xr("login", "local", "-s", "localhost:8181", "--token", "abc")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("login", "bad", "-s", "localhost:1")
+	xCheckEqual(t, "", err != nil, true)
+
+	out, err = xr("login", "other", "-s", "localhost:1", "-u", "me",
+		"--password", "pw", "--no-verify")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("profile", "list")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out,
+		"CURRENT  NAME   SERVER                  AUTH\n"+
+			"         local  http://localhost:8181  token\n"+
+			"*        other  http://localhost:1     basic (me)\n")
+
+	out, err = xr("profile", "show", "other", "-o", "json")
+	xNoErr(t, err)
+	xCheckEqual(t, "", strings.Contains(out, `"password": "****"`), true)
+
+	// Commands pick up the server from the profile
+	out, err = xr("profile", "use", "local")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("group", "create", "dir", "d1")
+	xCheckEqual(t, out, err, nil)
+
+	code, _ := xGET(t, "dirs/d1")
+	xCheckEqual(t, "", code, 200)
+
+	out, err = xr("-p", "other", "group", "get", "dirs")
+	xCheckEqual(t, "", err != nil, true)
+
+	out, err = xr("profile", "use", "foo")
+	xCheckEqual(t, "", out, "Unknown profile: foo\n")
+
+	out, err = xr("profile", "delete", "local")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("profile", "list")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out,
+		"CURRENT  NAME   SERVER              AUTH\n"+
+			"         other  http://localhost:1  basic (me)\n")
+}
+
+func TestXRRegistrySync(t *testing.T) {
+	reg := NewRegistry("TestXRRegistrySync")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	reg2, err := registry.NewRegistry(nil, "TestXRRegistrySyncDst")
+	xNoErr(t, err)
+	defer PassDeleteReg(t, reg2)
+	gm, _ = reg2.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg2.SaveAllAndCommit())
+
+	src := "localhost:8181"
+	dst := "localhost:8181/reg-TestXRRegistrySyncDst"
+	xr := func(args ...string) (string, error) {
+		t.Helper()
+		out, err := exec.Command("../xr", args...).CombinedOutput()
+		return string(out), err
+	}
+
+	xHTTP(t, reg, "PUT", "/dirs/d1", `{"labels":{"env":"prod"}}`, 201, "*")
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", "one", 201, "*")
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", "two", 201, "*")
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/meta",
+		`{"defaultversionid":"v1","defaultversionsticky":true}`, 200, "*")
+	xHTTP(t, reg, "PUT", "/dirs/d2", `{}`, 201, "*")
+
+	out, err := xr("registry", "diff", src, dst)
+	xCheckEqual(t, "", err != nil, true) // Exit code 1
+	xCheckEqual(t, "", strings.Contains(out,
+		"+ create version /dirs/d1/files/f1/versions/v2\n"), true)
+	xCheckEqual(t, "", strings.Contains(out,
+		"Plan: 5 to create, 0 to update, 0 to delete"), true)
+
+	// Just d1, based on its label
+	out, err = xr("registry", "sync", src, dst, "--label", "env=prod")
+	xCheckEqual(t, out, err, nil)
+
+	code, body := xGET(t, "reg-TestXRRegistrySyncDst/dirs/d1/files/f1")
+	xCheckEqual(t, "", code, 200)
+	xCheckEqual(t, "", body, "one")
+	code, body = xGET(t,
+		"reg-TestXRRegistrySyncDst/dirs/d1/files/f1/versions/v2")
+	xCheckEqual(t, "", body, "two")
+	code, _ = xGET(t, "reg-TestXRRegistrySyncDst/dirs/d2")
+	xCheckEqual(t, "", code, 404)
+
+	// An export file works as SRC too
+	file := t.TempDir() + "/export.json"
+	_, body = xGET(t, "export")
+	xNoErr(t, os.WriteFile(file, []byte(body), 0644))
+
+	out, err = xr("registry", "sync", file, dst, "--path", "/dirs/d2")
+	xCheckEqual(t, out, err, nil)
+
+	out, err = xr("registry", "diff", src, dst)
+	xCheckEqual(t, out, err, nil)
+	xCheckEqual(t, "", out, "No differences\n")
+
+	// Remove things from DST that aren't in SRC
+	xHTTP(t, reg2, "PUT", "/reg-TestXRRegistrySyncDst/dirs/d3", `{}`, 201,
+		"*")
+	out, err = xr("registry", "sync", src, dst, "--delete", "--dry-run")
+	xCheckEqual(t, "", out, "- delete group /dirs/d3\n\n"+
+		"Plan: 0 to create, 0 to update, 1 to delete\n")
+
+	out, err = xr("registry", "sync", src, dst, "--delete")
+	xCheckEqual(t, out, err, nil)
+	code, _ = xGET(t, "reg-TestXRRegistrySyncDst/dirs/d3")
+	xCheckEqual(t, "", code, 404)
+
+	out, err = xr("registry", "sync", src, file)
+	xCheckEqual(t, "", out, "DST must be a server, not a file: "+file+"\n")
+}
+
+func TestXRWatch(t *testing.T) {
+	reg := NewRegistry("TestXRWatch")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1", `{}`, 201, "*")
+
+	out := &bytes.Buffer{}
+	cmd := exec.Command("../xr", "-s", "localhost:8181", "watch", "/dirs",
+		"--interval", "100ms", "--count", "40")
+	cmd.Stdout = out
+	xNoErr(t, cmd.Start())
+
+	// Give each change time to be seen on its own
+	time.Sleep(500 * time.Millisecond)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", "hello", 201, "*")
+	time.Sleep(500 * time.Millisecond)
+	xHTTP(t, reg, "PATCH", "/dirs/d1", `{"description":"hi"}`, 200, "*")
+	time.Sleep(500 * time.Millisecond)
+	xHTTP(t, reg, "DELETE", "/dirs/d1", ``, 204, "*")
+
+	xNoErr(t, cmd.Wait())
+
+	// Remove the timestamps
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()),
+		"\n") {
+		_, line, _ = strings.Cut(line, " ")
+		lines = append(lines, line)
+	}
+	all := strings.Join(lines, "\n") + "\n"
+
+	for _, exp := range []string{
+		"created resource /dirs/d1/files/f1 (epoch: 1)\n",
+		"created version /dirs/d1/files/f1/versions/1 (epoch: 1)\n",
+		"updated group /dirs/d1 (epoch: ",
+		"deleted group /dirs/d1\n",
+		"deleted resource /dirs/d1/files/f1\n",
+		"deleted version /dirs/d1/files/f1/versions/1\n",
+	} {
+		xCheckEqual(t, all, strings.Contains(all, exp), true)
+	}
+}
+
+func TestXROutput(t *testing.T) {
+	reg := NewRegistry("TestXROutput")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xr := func(args ...string) (string, error) {
+		t.Helper()
+		args = append([]string{"-s", "localhost:8181"}, args...)
+		out, err := exec.Command("../xr", args...).CombinedOutput()
+		return string(out), err
+	}
+
+	xHTTP(t, reg, "PUT", "/dirs/d1", `{"name":"one","labels":{"env":"prod"}}`,
+		201, "*")
+	xHTTP(t, reg, "PUT", "/dirs/d2", `{"name":"two"}`, 201, "*")
+
+	out, err := xr("get", "/dirs")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out, "TYPE  ID  NAME  EPOCH  XID\n"+
+		"dir   d1  one   1      /dirs/d1\n"+
+		"dir   d2  two   1      /dirs/d2\n")
+
+	out, err = xr("get", "/dirs", "--columns", "id,labels.env")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out, "ID  LABELS.ENV\n"+
+		"d1  prod\n"+
+		"d2  \n")
+
+	out, err = xr("get", "/dirs", "-o", "wide")
+	xNoErr(t, err)
+	xCheckEqual(t, "", strings.Contains(strings.Split(out, "\n")[0],
+		"MODIFIED"), true)
+
+	out, err = xr("get", "/dirs", "-o", "jsonpath={.*.*.dirid}")
+	xNoErr(t, err)
+	xCheckEqual(t, "", out, "d1 d2\n")
+
+	out, err = xr("group", "get", "dirs",
+		"-o", `template={{range $id, $d := .dirs}}{{$id}}={{$d.name}} {{end}}`)
+	xNoErr(t, err)
+	xCheckEqual(t, "", out, "d1=one d2=two \n")
+
+	out, err = xr("group", "types", "-o", "yaml")
+	xNoErr(t, err)
+	xCheckEqual(t, "", strings.HasPrefix(out, "- Plural: dirs\n"), true)
+
+	out, err = xr("get", "/dirs", "-o", "xml")
+	xCheckEqual(t, "", err != nil, true)
+	xCheckEqual(t, "", out, "--output must be one of 'table', 'wide', "+
+		"'json', 'yaml', 'jsonpath=EXPR', 'template=TMPL'\n")
+
+	out, err = xr("model", "normalize", "-o", "table")
+	xCheckEqual(t, "", err != nil, true)
+	xCheckEqual(t, "", out, "--output must be one of 'json', 'yaml', "+
+		"'jsonpath=EXPR', 'template=TMPL'\n")
+}
+
+func TestXRCompletion(t *testing.T) {
+	reg := NewRegistry("TestXRCompletion")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", "hi", 201, "*")
+	xHTTP(t, reg, "PUT", "/dirs/d2", "{}", 201, "*")
+
+	cache, ttl := t.TempDir(), "1m"
+	xr := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-s", "localhost:8181", "__complete"},
+			args...)
+		cmd := exec.Command("../xr", args...)
+		cmd.Env = append(os.Environ(), "XR_CACHE_DIR="+cache,
+			"XR_CACHE_TTL="+ttl)
+		out, err := cmd.Output()
+		xNoErr(t, err)
+		return string(out)
+	}
+
+	xCheckEqual(t, "", xr("get", "/d"), "/dirs/\n:2\n")
+	xCheckEqual(t, "", xr("get", "/dirs/"), "/dirs/d1/\n/dirs/d2/\n:2\n")
+	xCheckEqual(t, "", xr("resource", "get", "/dirs/d1/"),
+		"/dirs/d1/files/\n:2\n")
+	xCheckEqual(t, "", xr("version", "get", "/dirs/d1/files/f1/"),
+		"/dirs/d1/files/f1/meta\n/dirs/d1/files/f1/versions/\n:2\n")
+	xCheckEqual(t, "", xr("version", "get", "/dirs/d1/files/f1/versions/"),
+		"/dirs/d1/files/f1/versions/v1\n:2\n")
+	xCheckEqual(t, "", xr("group", "get", ""), "dirs\n:4\n")
+	xCheckEqual(t, "", xr("group", "delete", "dir/"),
+		"dir/d1\ndir/d2\n:4\n")
+	xCheckEqual(t, "", xr("get", "-o", "js"), "json\njsonpath=\n:2\n")
+
+	out := xr("get", "/", "--columns", "dirid,epo")
+	xCheckEqual(t, "", strings.Contains(out, "dirid,epoch\n"), true)
+
+	// New entities show up once the cache expires, or without a cache
+	xHTTP(t, reg, "PUT", "/dirs/d3", "{}", 201, "*")
+	xCheckEqual(t, "", xr("get", "/dirs/"), "/dirs/d1/\n/dirs/d2/\n:2\n")
+	ttl = "0"
+	xCheckEqual(t, "", xr("get", "/dirs/d3"), "/dirs/d3/\n:2\n")
+}
+
+func TestXRShell(t *testing.T) {
+	reg := NewRegistry("TestXRShell")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", "hello", 201,
+		"*")
+
+	cmd := exec.Command("../xr", "-s", "localhost:8181", "shell")
+	cmd.Stdin = strings.NewReader(`pwd
+ls
+cd dirs/d1
+pwd
+ls
+cd files/f1
+ls
+ls versions
+cat versions/v1
+cd ../../../../dirs/dx
+cd ..
+pwd
+resource list ./d1
+exit
+ls
+`)
+	out, err := cmd.CombinedOutput()
+	xNoErr(t, err)
+
+	// The error from "cd" is on its own line, so just check the rest
+	lines := strings.Split(string(out), "\n")
+	xCheckEqual(t, "", strings.HasPrefix(lines[7], "hello/dirs/dx: "), true)
+	lines[7] = "hello"
+	xCheckEqual(t, "", strings.Join(lines, "\n"), `/
+dirs/
+/dirs/d1
+files/
+meta
+versions/
+v1
+hello
+/dirs
+TYPE   ID  DEFAULT  VERSIONS  XID
+files  f1  v1       1         /dirs/d1/files/f1
+`)
+}
+
+func TestXRModelTools(t *testing.T) {
+	reg := NewRegistry("TestXRModelTools")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1", `{}`, 201, "*")
+
+	xr := func(args ...string) (string, error) {
+		t.Helper()
+		args = append([]string{"-s", "localhost:8181"}, args...)
+		out, err := exec.Command("../xr", args...).CombinedOutput()
+		return string(out), err
+	}
+
+	// Build a model file with the editing helpers
+	file := t.TempDir() + "/model.json"
+	out, err := xr("model", "add-group", file, "dirs")
+	xCheckEqual(t, out, err, nil)
+	out, err = xr("model", "add-resource", file, "dirs", "files")
+	xCheckEqual(t, out, err, nil)
+	out, err = xr("model", "add-attribute", file, "color", "--on", "dirs",
+		"--enum", "red,blue", "-d", "The color")
+	xCheckEqual(t, out, err, nil)
+	out, err = xr("model", "add-attribute", file, "color", "--on", "dirs")
+	xCheckEqual(t, "", out, "Attribute \"color\" already exists\n")
+	out, err = xr("model", "add-attribute", file, "x", "--on", "dirs/bad")
+	xCheckEqual(t, "", out, "Unknown Resource type: dirs/bad\n")
+
+	out, err = xr("model", "lint", file)
+	xCheckEqual(t, out, err, nil)
+	xCheckEqual(t, "", out, "")
+
+	out, err = xr("model", "diff", "localhost:8181", file)
+	xCheckEqual(t, "", err != nil, true) // Exit code 1
+	xCheckEqual(t, "", out, `~ update group dirs
+    attributes.color: <none> -> {"description":"The color","enum":["red","blue"],"name":"color","type":"string"}
+
+Plan: 0 to create, 1 to update, 0 to delete
+`)
+
+	out, err = xr("model", "push", file)
+	xCheckEqual(t, out, err, nil)
+	out, err = xr("model", "diff", "localhost:8181", file)
+	xCheckEqual(t, out, err, nil)
+	xCheckEqual(t, "", out, "No differences\n")
+
+	// Lint warnings
+	out, err = xr("model", "add-attribute", file, "versionid", "--on", "dirs")
+	xCheckEqual(t, out, err, nil)
+	out, err = xr("model", "lint", file, "--skip", "unbounded")
+	xCheckEqual(t, "", err != nil, true)
+	xCheckEqual(t, "", out, `warning: groups.dirs.attributes.versionid: "versionid" is used by the spec, or the model, for something else (shadow)
+warning: groups.dirs.attributes.versionid: has no description (description)
+`)
+
+	// Removing "dirs" would delete d1 so it needs --force
+	xNoErr(t, os.WriteFile(file, []byte(`{"groups":{"things":{
+	  "plural":"things","singular":"thing"}}}`), 0644))
+	out, err = xr("model", "push", file)
+	xCheckEqual(t, "", out, `+ create group things
+- delete group dirs
+
+Plan: 1 to create, 0 to update, 1 to delete
+
+This will delete: 1 dirs
+Existing entities will be deleted, use --force to push the model anyway
+`)
+	code, _ := xGET(t, "dirs/d1")
+	xCheckEqual(t, "", code, 200)
+
+	out, err = xr("model", "push", file, "--force")
+	xCheckEqual(t, out, err, nil)
+	code, _ = xGET(t, "things")
+	xCheckEqual(t, "", code, 200)
+}
+
+func TestXRCodegen(t *testing.T) {
+	reg := NewRegistry("TestXRCodegen")
+	defer PassDeleteReg(t, reg)
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	gm.AddAttribute(&registry.Attribute{
+		Name: "color",
+		Type: registry.STRING,
+		Enum: []any{"red", "blue"},
+	})
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	out, err := exec.Command("../xr", "-s", "localhost:8181", "codegen",
+		"--package", "dirs").CombinedOutput()
+	xCheckEqual(t, string(out), err, nil)
+	code := string(out)
+	for _, str := range []string{
+		"// Code generated by \"xr codegen\". DO NOT EDIT.\n\npackage dirs\n",
+		"type Dir struct {\n\tColor ",
+		"\tDirID         string            `json:\"dirid,omitempty\"`\n",
+		"\tDirColorBlue DirColor = \"blue\"\n",
+		"type File struct {\n",
+		"\tEpoch         *uint64           `json:\"epoch,omitempty\"`\n",
+		"type FileMeta struct {\n",
+		"func (c *Client) Dir(id string) *DirClient {\n",
+		"func (g *DirClient) Files() *FileCollection {\n",
+		"func (r *FileClient) Versions() *FileVersionCollection {\n",
+	} {
+		xCheckEqual(t, str, strings.Contains(code, str), true)
+	}
+
+	// Same model from a file, as TypeScript
+	file := t.TempDir() + "/model.json"
+	_, body := xGET(t, "model")
+	xNoErr(t, os.WriteFile(file, []byte(body), 0644))
+	out, err = exec.Command("../xr", "codegen", file, "--lang",
+		"ts").CombinedOutput()
+	xCheckEqual(t, string(out), err, nil)
+	code = string(out)
+	for _, str := range []string{
+		"export interface Dir {\n  color?: DirColor;\n",
+		"export type DirColor = \"red\" | \"blue\";\n",
+		"  listFiles(dirID: string, ...filters: string[]): Promise<File[]> {\n",
+		"  getFileMeta(dirID: string, fileID: string): Promise<FileMeta> {\n",
+	} {
+		xCheckEqual(t, str, strings.Contains(code, str), true)
+	}
+}
@@ -571,6 +571,8 @@ func TestXrefErrors(t *testing.T) {
 	d, _ := reg.AddGroup("dirs", "d1")
 	_, err := d.AddResource("files", "f1", "v1")
 	xNoErr(t, err)
+	_, err = d.AddResource("files", "fx", "v1")
+	xNoErr(t, err)
 
 	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/meta",
 		`{"xref": "/dirs/d1/files/fx","fileid":"f2"}`, 400,
@@ -587,22 +589,22 @@ func TestXrefErrors(t *testing.T) {
 		"Extra attributes (foo) in \"meta\" not allowed when \"xref\" is set\n")
 
 	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1",
-		`{"meta": {"fileid":"f1", "xref":"/dirs/d1/files/f1"},"epoch":5, "description": "x"}`,
+		`{"meta": {"fileid":"f1", "xref":"/dirs/d1/files/fx"},"epoch":5, "description": "x"}`,
 		400,
 		"Extra attributes (description,epoch) not allowed when \"xref\" is set\n")
 	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1",
-		`{"meta": {"fileid":"f1", "xref":"/dirs/d1/files/f1"},"epoch":5, "description": "x"}`,
+		`{"meta": {"fileid":"f1", "xref":"/dirs/d1/files/fx"},"epoch":5, "description": "x"}`,
 		400,
 		"Extra attributes (description,epoch) not allowed when \"xref\" is set\n")
 
 	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1",
-		`{"fileid": "f2", "meta": {"xref":"/dirs/d1/files/f1"}}`, 400,
+		`{"fileid": "f2", "meta": {"xref":"/dirs/d1/files/fx"}}`, 400,
 		"The \"fileid\" attribute must be set to \"f1\", not \"f2\"\n")
 	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1",
-		`{"meta": {"xref":"/dirs/d1/files/f1","epoch":6}}`, 400,
+		`{"meta": {"xref":"/dirs/d1/files/fx","epoch":6}}`, 400,
 		"Attribute \"epoch\"(6) doesn't match existing value (1)\n")
 	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1",
-		`{"fileid": "f1", "meta": {"xref":"/dirs/d1/files/f1","modifiedat":"2025-01-01-T:12:00:00"}}`, 400,
+		`{"fileid": "f1", "meta": {"xref":"/dirs/d1/files/fx","modifiedat":"2025-01-01-T:12:00:00"}}`, 400,
 		"Extra attributes (modifiedat) in \"meta\" not allowed when \"xref\" is set\n")
 
 	// Works!
@@ -1413,3 +1415,200 @@ func TestXrefDocs(t *testing.T) {
 }
 `)
 }
+
+func TestXrefValidate(t *testing.T) {
+	reg := NewRegistry("TestXrefValidate")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, false)
+	gm.AddResourceModel("datas", "data", 0, true, true, false)
+	gm, _ = reg.Model.AddGroupModel("foos", "foo")
+	gm.AddResourceModel("files", "file", 0, true, true, false)
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/datas/d1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/foos/f1/files/f1", `{}`, 201, `*`)
+
+	// Wrong Resource type
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fx/meta",
+		`{"xref":"/dirs/d1/datas/d1"}`, 400,
+		"'xref' (/dirs/d1/datas/d1) must point to a Resource of type "+
+			"\"/dirs/files\"\n")
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fx/meta",
+		`{"xref":"/foos/f1/files/f1"}`, 400,
+		"'xref' (/foos/f1/files/f1) must point to a Resource of type "+
+			"\"/dirs/files\"\n")
+
+	// Missing target
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fx/meta",
+		`{"xref":"/dirs/d1/files/f9"}`, 400,
+		"'xref' (/dirs/d1/files/f9) must point to an existing Resource\n")
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fx/meta",
+		`{"xref":"/dirs/d9/files/f1"}`, 400,
+		"'xref' (/dirs/d9/files/f1) must point to an existing Resource\n")
+
+	// Pointing to itself
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/meta",
+		`{"xref":"/dirs/d1/files/f1"}`, 400,
+		"'xref' (/dirs/d1/files/f1) can't point to itself\n")
+
+	// Finally, a good one
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fx/meta",
+		`{"xref":"/dirs/d1/files/f1"}`, 201, `*`)
+
+	// No chains
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/fy/meta",
+		`{"xref":"/dirs/d1/files/fx"}`, 400,
+		"'xref' (/dirs/d1/files/fx) can't point to a Resource that is "+
+			"also an xref\n")
+
+	// No cycles
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/meta",
+		`{"xref":"/dirs/d1/files/fx"}`, 400,
+		"'xref' (/dirs/d1/files/fx) can't point to a Resource that is "+
+			"also an xref\n")
+
+	// A target can't become an xref
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/meta",
+		`{"xref":"/dirs/d1/files/f2"}`, 400,
+		"'xref' can't be set on \"/dirs/d1/files/f1\" since it is the "+
+			"target of an xref from: /dirs/d1/files/fx\n")
+
+	// But re-pointing an xref is ok
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/fx/meta",
+		`{"xref":"/dirs/d1/files/f2"}`, 200, `*`)
+
+	// Target and xref in the same request is ok
+	xHTTP(t, reg, "POST", "/dirs/d1/files",
+		`{"fa":{"meta":{"xref":"/dirs/d1/files/fz"}},"fz":{}}`, 200, `*`)
+}
+
+func TestXrefDeletePolicy(t *testing.T) {
+	reg := NewRegistry("TestXrefDeletePolicy")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	rm, _ := gm.AddResourceModel("files", "file", 0, true, true, false)
+
+	xCheckEqual(t, "", rm.GetXRefDelete(), "block")
+	xCheckErr(t, rm.SetXRefDelete("foo"),
+		"Resource \"files\" has an invalid 'xrefdelete' value (foo), "+
+			"must be one of: block, cascade, standalone")
+	xNoErr(t, rm.SetXRefDelete(""))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d2/files/fx/meta",
+		`{"xref":"/dirs/d1/files/f1"}`, 201, `*`)
+
+	// Default is to block
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", ``, 400,
+		"Can't delete \"/dirs/d1/files/f1\" since it is the target of an "+
+			"xref from: /dirs/d2/files/fx\n")
+	xHTTP(t, reg, "DELETE", "/dirs/d1", ``, 400,
+		"Can't delete \"/dirs/d1/files/f1\" since it is the target of an "+
+			"xref from: /dirs/d2/files/fx\n")
+
+	// Xrefs in the same Group as the target don't block a Group delete
+	xHTTP(t, reg, "PUT", "/dirs/d3/files/f3", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d3/files/fy/meta",
+		`{"xref":"/dirs/d3/files/f3"}`, 201, `*`)
+	xHTTP(t, reg, "DELETE", "/dirs/d3", ``, 204, ``)
+
+	// Cascade
+	xNoErr(t, rm.SetXRefDelete("cascade"))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", ``, 204, ``)
+	xHTTP(t, reg, "GET", "/dirs/d2/files/fx", ``, 404, "Not found\n")
+
+	// Standalone
+	xNoErr(t, rm.SetXRefDelete("standalone"))
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2",
+		`{"description":"two"}`, 201, `*`)
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1/meta",
+		`{"defaultversionid":"v1"}`, 200, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d2/files/fx/meta",
+		`{"xref":"/dirs/d1/files/f1"}`, 201, `*`)
+
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", ``, 204, ``)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1", ``, 404, "Not found\n")
+
+	fx, err := reg.FindXIDResource("/dirs/d2/files/fx")
+	xNoErr(t, err)
+	xCheckEqual(t, "", fx.IsXref(), false)
+
+	vIDs, err := fx.GetVersionIDs()
+	xNoErr(t, err)
+	xCheckEqual(t, "", vIDs, []string{"v1", "v2"})
+
+	meta, err := fx.FindMeta(false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", meta.Get("defaultversionid"), "v1")
+	xCheckEqual(t, "", meta.Get("defaultversionsticky"), true)
+
+	v2, err := fx.FindVersion("v2", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", v2.Get("description"), "two")
+}
+
+func TestXrefReferencedBy(t *testing.T) {
+	reg := NewRegistry("TestXrefReferencedBy")
+	defer PassDeleteReg(t, reg)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, false)
+	_, err := reg.Model.AddAttrXID("ptr", "/dirs/files")
+	xNoErr(t, err)
+	xNoErr(t, reg.SaveAllAndCommit())
+
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", `{}`, 201, `*`)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2", `{}`, 201, `*`)
+
+	// Nothing points to it yet
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1?referencedby", ``, 200, "{}\n")
+
+	xHTTP(t, reg, "PUT", "/dirs/d2/files/fx/meta",
+		`{"xref":"/dirs/d1/files/f1"}`, 201, `*`)
+	xHTTP(t, reg, "PATCH", "/", `{"ptr":"/dirs/d1/files/f1"}`, 200, `*`)
+
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1?referencedby", ``, 200, `{
+  "/": [
+    "ptr"
+  ],
+  "/dirs/d2/files/fx/meta": [
+    "xref"
+  ]
+}
+`)
+
+	// Other entities are not impacted
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1?referencedby", ``,
+		200, "{}\n")
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f2?referencedby", ``, 200, "{}\n")
+
+	// Removing the references removes them from the list
+	xHTTP(t, reg, "PATCH", "/", `{"ptr":null}`, 200, `*`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1?referencedby", ``, 200, `{
+  "/dirs/d2/files/fx/meta": [
+    "xref"
+  ]
+}
+`)
+
+	// Errors
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f9?referencedby", ``, 404,
+		"Not found\n")
+	xHTTP(t, reg, "GET", "/dirs/d1?referencedby", ``, 400,
+		"'referencedby' is only allowed on Resources and Versions\n")
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/meta?referencedby", ``, 400,
+		"'referencedby' is only allowed on Resources and Versions\n")
+	xHTTP(t, reg, "GET", "/dirs/d1/files?referencedby", ``, 400,
+		"'referencedby' is only allowed on Resources and Versions\n")
+}
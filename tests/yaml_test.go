@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"testing"
+)
+
+func TestHTTPYAML(t *testing.T) {
+	reg := NewRegistry("TestHTTPYAML")
+	defer PassDeleteReg(t, reg)
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:   "PUT model as YAML",
+		URL:    "/model",
+		Method: "PUT",
+		ReqHeaders: []string{
+			"Content-Type: application/yaml",
+		},
+		ReqBody: `# A comment
+groups:
+  dirs:
+    singular: dir
+    resources:
+      files:
+        singular: file
+        attributes:
+          tags:
+            type: array
+            item:
+              type: string
+`,
+		Code:       200,
+		ResHeaders: []string{"Content-Type: application/json"},
+		ResBody:    "*",
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:   "PUT group as YAML",
+		URL:    "/dirs/d1",
+		Method: "PUT",
+		ReqHeaders: []string{
+			"Content-Type: application/yaml",
+			"Accept: application/yaml",
+		},
+		ReqBody: "name: my dir\nlabels:\n  owner: 'me'\n",
+		Code:    201,
+		ResHeaders: []string{
+			"Content-Type: application/yaml",
+		},
+		ResBody: `dirid: d1
+self: http://localhost:8181/dirs/d1
+xid: /dirs/d1
+epoch: 1
+name: my dir
+labels:
+  owner: me
+createdat: "2024-01-01T12:00:01Z"
+modifiedat: "2024-01-01T12:00:01Z"
+filesurl: http://localhost:8181/dirs/d1/files
+filescount: 0
+`,
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:   "PUT version metadata as YAML",
+		URL:    "/dirs/d1/files/f1/versions/v1$details",
+		Method: "PUT",
+		ReqHeaders: []string{
+			"Content-Type: text/yaml",
+		},
+		ReqBody:    "tags: [a, b]\n",
+		Code:       201,
+		ResHeaders: []string{"Content-Type: application/json"},
+		ResBody:    "*",
+	})
+
+	// The document is never converted
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:   "PUT doc that is YAML",
+		URL:    "/dirs/d1/files/f2",
+		Method: "PUT",
+		ReqHeaders: []string{
+			"Content-Type: application/yaml",
+			"xRegistry-contenttype: application/yaml",
+		},
+		ReqBody:    "a: b\n",
+		Code:       201,
+		ResHeaders: []string{"*"},
+		ResBody:    "*",
+	})
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "GET doc that is YAML",
+		URL:        "/dirs/d1/files/f2",
+		Method:     "GET",
+		ReqHeaders: []string{"Accept: application/yaml"},
+		Code:       200,
+		ResHeaders: []string{"*"},
+		ResBody:    "a: b\n",
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "GET version as YAML",
+		URL:        "/dirs/d1/files/f1/versions/v1$details",
+		Method:     "GET",
+		ReqHeaders: []string{"Accept: application/yaml"},
+		Code:       200,
+		ResHeaders: []string{"Content-Type: application/yaml"},
+		ResBody: `fileid: f1
+versionid: v1
+self: http://localhost:8181/dirs/d1/files/f1/versions/v1$details
+xid: /dirs/d1/files/f1/versions/v1
+epoch: 1
+isdefault: true
+createdat: "2024-01-01T12:00:01Z"
+modifiedat: "2024-01-01T12:00:01Z"
+tags:
+  - a
+  - b
+`,
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "GET collection as YAML",
+		URL:        "/dirs?inline=files&filter=files.fileid=f9",
+		Method:     "GET",
+		ReqHeaders: []string{"Accept: application/yaml;q=0.9, application/json;q=0.5"},
+		Code:       200,
+		ResHeaders: []string{"Content-Type: application/yaml"},
+		ResBody:    "{}\n",
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "JSON is preferred",
+		URL:        "/dirs?inline=files&filter=files.fileid=f9",
+		Method:     "GET",
+		ReqHeaders: []string{"Accept: application/json, application/yaml"},
+		Code:       200,
+		ResHeaders: []string{"Content-Type: application/json"},
+		ResBody:    "{}\n",
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:       "GET capabilities as YAML",
+		URL:        "/capabilities",
+		Method:     "GET",
+		ReqHeaders: []string{"Accept: application/yaml"},
+		Code:       200,
+		ResHeaders: []string{"Content-Type: application/yaml"},
+		ResBody:    "*",
+	})
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		Name:   "Bad YAML",
+		URL:    "/dirs/d2",
+		Method: "PUT",
+		ReqHeaders: []string{
+			"Content-Type: application/yaml",
+		},
+		ReqBody: "name: x\nname: y\n",
+		Code:    400,
+		ResBody: "Error parsing YAML: line 2: duplicate key \"name\"\n",
+	})
+}